@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/logging"
+	"automation-hub/internal/models"
+	"automation-hub/internal/services/email"
+	"automation-hub/internal/services/processor"
+)
+
+const commandUsage = `usage: automation-hub [--dry-run]
+       automation-hub config check   load and validate config.yaml, print it with secrets masked
+       automation-hub test-email --service NAME [--account NAME] [--limit N]
+                                     extract the code from the latest email of a service, sending nothing`
+
+// extractor is implemented by processors that can extract a code without sending it
+type extractor interface {
+	Extract(email models.Email) (decodedText, code string)
+}
+
+// runCommand runs a subcommand instead of the service and returns the process
+// exit code: 0 on success, 1 if the command failed, 2 for unknown commands
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 2 && args[0] == "config" && args[1] == "check" {
+		return checkConfig(stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "test-email" {
+		return testEmail(args[1:], stdout, stderr)
+	}
+	fmt.Fprintln(stderr, commandUsage)
+	return 2
+}
+
+// checkConfig loads the config like the service does, including environment
+// overrides and secret files, validates it and prints the result
+func checkConfig(stdout, stderr io.Writer) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+
+	out, err := cfg.Dump()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to print config: %v\n", err)
+		return 1
+	}
+	_, _ = stdout.Write(out)
+	if cfg.MigratedFrom != 0 {
+		fmt.Fprintf(stderr, "config.yaml is version %d, printed above migrated to version %d\n", cfg.MigratedFrom, config.CurrentVersion)
+	}
+	// The service only warns, but a typo in CI should fail the check
+	if len(cfg.UnknownKeys) > 0 {
+		fmt.Fprintf(stderr, "unknown keys, check for typos:\n  %s\n", strings.Join(cfg.UnknownKeys, "\n  "))
+		return 1
+	}
+	fmt.Fprintln(stderr, "configuration OK")
+	return 0
+}
+
+// testEmail finds the latest email of a service, read or unread, and prints its
+// decoded text and the extracted code. Mail is opened read-only and nothing is
+// sent, so it can be run against the live mailbox while tuning a pattern.
+func testEmail(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test-email", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	service := flags.String("service", "", "name of the email service to test")
+	account := flags.String("account", "", "name of the email account to search, by default the first one with the service")
+	limit := flags.Int("limit", 20, "how many recent emails from the service's senders to check per folder")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *service == "" || flags.NArg() > 0 {
+		fmt.Fprintln(stderr, commandUsage)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	logger, err := logging.New(cfg.Server.LogLevel, cfg.Server.LogFormat)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid logging configuration: %v\n", err)
+		return 1
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	// The point is to see the codes
+	logging.SetSensitive(true)
+
+	// No notifiers: the processors are only used to match and extract
+	var emailConfig config.EmailConfig
+	var proc models.EmailProcessor
+	for _, candidate := range cfg.Accounts() {
+		if *account != "" && candidate.AccountName() != *account {
+			continue
+		}
+		manager, err := processor.NewProcessorManager(candidate, processor.Notifiers{}, logger)
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid email service configuration: %v\n", err)
+			return 1
+		}
+		if found, ok := manager.Find(*service); ok {
+			emailConfig, proc = candidate, found
+			break
+		}
+	}
+	if proc == nil {
+		if *account != "" {
+			fmt.Fprintf(stderr, "unknown service %q in account %q\n", *service, *account)
+		} else {
+			fmt.Fprintf(stderr, "unknown service %q\n", *service)
+		}
+		return 1
+	}
+	ext, ok := proc.(extractor)
+	if !ok {
+		fmt.Fprintf(stderr, "service %q does not support test-email\n", *service)
+		return 1
+	}
+
+	found, folder, err := email.NewIMAPClient(emailConfig, logger).FindLatest(proc, *limit)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *service, err)
+		return 1
+	}
+
+	decodedText, code := ext.Extract(found)
+	fmt.Fprintf(stdout, "Folder:  %s\nFrom:    %s\nSubject: %s\nDate:    %s\n\n", folder, found.From, found.Subject, found.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(stdout, "----- decoded text -----\n%s\n----- end -----\n\n", decodedText)
+	fmt.Fprintf(stdout, "Code: %s\n", code)
+	if code == processor.NotFoundCode {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/email"
+	"automation-hub/internal/services/processor"
+)
+
+// mailboxes are the monitored IMAP accounts in config order. They report to the
+// health and admin endpoints as one, the way an IMAPClient reports its folders.
+type mailboxes []*email.IMAPClient
+
+// LastPoll returns the oldest last successful poll across the accounts, zero
+// until every account has been polled once
+func (m mailboxes) LastPoll() time.Time {
+	var oldest time.Time
+	for _, mailbox := range m {
+		lastPoll := mailbox.LastPoll()
+		if lastPoll.IsZero() {
+			return time.Time{}
+		}
+		if oldest.IsZero() || lastPoll.Before(oldest) {
+			oldest = lastPoll
+		}
+	}
+	return oldest
+}
+
+// PollingInterval returns the longest polling interval of any account
+func (m mailboxes) PollingInterval() time.Duration {
+	var longest time.Duration
+	for _, mailbox := range m {
+		longest = max(longest, mailbox.PollingInterval())
+	}
+	return longest
+}
+
+// LastError returns the most recent failed poll of any account, prefixed with
+// the account when there are several
+func (m mailboxes) LastError() (error, time.Time) {
+	var lastErr error
+	var lastErrAt time.Time
+	for _, mailbox := range m {
+		err, at := mailbox.LastError()
+		if err != nil && at.After(lastErrAt) {
+			lastErr, lastErrAt = m.wrap(mailbox, err), at
+		}
+	}
+	return lastErr, lastErrAt
+}
+
+// CheckOnce checks every account once and adds up the emails found and
+// processed. Accounts that fail don't stop the others from being checked.
+func (m mailboxes) CheckOnce(ctx context.Context) (found, processed int, err error) {
+	if len(m) == 0 {
+		return 0, 0, errors.New("email monitoring has not started")
+	}
+	var errs []error
+	for _, mailbox := range m {
+		accountFound, accountProcessed, err := mailbox.CheckOnce(ctx)
+		found += accountFound
+		processed += accountProcessed
+		if err != nil {
+			errs = append(errs, m.wrap(mailbox, err))
+		}
+	}
+	return found, processed, errors.Join(errs...)
+}
+
+// AccountCapabilities returns the capabilities each account's server
+// advertised after login, by account name
+func (m mailboxes) AccountCapabilities() map[string][]string {
+	capabilities := make(map[string][]string, len(m))
+	for _, mailbox := range m {
+		capabilities[mailbox.Account()] = mailbox.Capabilities()
+	}
+	return capabilities
+}
+
+func (m mailboxes) find(account string) *email.IMAPClient {
+	for _, mailbox := range m {
+		if mailbox.Account() == account {
+			return mailbox
+		}
+	}
+	return nil
+}
+
+func (m mailboxes) wrap(mailbox *email.IMAPClient, err error) error {
+	if len(m) < 2 {
+		return err
+	}
+	return fmt.Errorf("%s: %w", mailbox.Account(), err)
+}
+
+// managers are the processor managers of the accounts, in config order
+type managers []*processor.Manager
+
+// newManagers builds the processor manager of every account
+func newManagers(accounts []config.EmailConfig, notifiers processor.Notifiers, logger *zap.Logger) (managers, error) {
+	result := make(managers, 0, len(accounts))
+	for _, account := range accounts {
+		manager, err := processor.NewProcessorManager(account, notifiers, logger)
+		if err != nil {
+			if len(accounts) > 1 {
+				return nil, fmt.Errorf("account %s: %w", account.AccountName(), err)
+			}
+			return nil, err
+		}
+		result = append(result, manager)
+	}
+	return result, nil
+}
+
+// Describe lists the processors of every account, account by account
+func (m managers) Describe() []processor.Info {
+	infos := []processor.Info{}
+	for _, manager := range m {
+		infos = append(infos, manager.Describe()...)
+	}
+	return infos
+}
+
+// SetRecent shares one buffer of recent events across the accounts
+func (m managers) SetRecent(recent *processor.Recent) {
+	for _, manager := range m {
+		manager.SetRecent(recent)
+	}
+}
+
+// SetAudit shares one audit log across the accounts
+func (m managers) SetAudit(audit *zap.Logger) {
+	for _, manager := range m {
+		manager.SetAudit(audit)
+	}
+}
+
+// services counts the processors loaded across the accounts
+func (m managers) services() int {
+	var n int
+	for _, manager := range m {
+		n += len(manager.GetProcessors())
+	}
+	return n
+}
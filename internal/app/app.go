@@ -0,0 +1,415 @@
+// Package app wires the services, processors and HTTP server together, so
+// automation-hub can be run from main, embedded or tested end to end.
+package app
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/handlers"
+	"automation-hub/internal/logging"
+	"automation-hub/internal/services/discord"
+	"automation-hub/internal/services/email"
+	"automation-hub/internal/services/gotify"
+	"automation-hub/internal/services/processor"
+	"automation-hub/internal/services/telegram"
+	"automation-hub/internal/services/webhook"
+)
+
+// defaultShutdownTimeout bounds how long Run waits for requests and email
+// processing in flight once ctx is canceled
+const defaultShutdownTimeout = 30 * time.Second
+
+// options are the settings Run takes besides the config file
+type options struct {
+	dryRun   bool
+	reload   <-chan struct{}
+	listener net.Listener
+	sender   telegram.Sender
+	shutdown time.Duration
+}
+
+// Option changes how Run starts the service
+type Option func(*options)
+
+// WithDryRun keeps dry run on whatever the config file says, like --dry-run
+func WithDryRun(enabled bool) Option {
+	return func(o *options) { o.dryRun = enabled }
+}
+
+// WithReload reloads the config file every time a value is received, see
+// config.Reload. main sends one on SIGHUP.
+func WithReload(reload <-chan struct{}) Option {
+	return func(o *options) { o.reload = reload }
+}
+
+// WithListener serves HTTP on listener instead of listening on server.address,
+// e.g. on a random port in tests
+func WithListener(listener net.Listener) Option {
+	return func(o *options) { o.listener = listener }
+}
+
+// WithTelegramSender sends Telegram messages through sender instead of
+// connecting to the Bot API
+func WithTelegramSender(sender telegram.Sender) Option {
+	return func(o *options) { o.sender = sender }
+}
+
+// WithShutdownTimeout changes how long Run waits for requests and email
+// processing in flight once ctx is canceled, 30 seconds by default
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.shutdown = timeout }
+}
+
+// Run validates cfg, starts email monitoring and the HTTP server and blocks
+// until ctx is canceled, then shuts both down gracefully. It returns an error
+// if the configuration is invalid, the server can't listen or stops serving, or
+// webhook requests are still in flight when the shutdown times out.
+// logger should already be configured from cfg.Server, see logging.New.
+func Run(ctx context.Context, cfg *config.Config, logger *zap.Logger, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	logging.SetSensitive(cfg.Server.LogSensitive)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration, fix config.yaml and restart: %w", err)
+	}
+	warnUnknownKeys(cfg, logger)
+
+	// Initialize services
+	telegramClient, err := newTelegramClient(cfg.Telegram, o.sender, logger)
+	if err != nil {
+		return err
+	}
+	discordClient := discord.NewClient(cfg.Discord, logger)
+	webhookClient := webhook.NewClient(cfg.NotifyWebhooks, logger)
+	gotifyClient := gotify.NewClient(cfg.Gotify, logger)
+	accounts := cfg.Accounts()
+	imapClients := make(mailboxes, 0, len(accounts))
+	for _, account := range accounts {
+		imapClients = append(imapClients, email.NewIMAPClient(account, logger))
+		if account.TLS.InsecureSkipVerify && account.TLSMode != config.TLSModeNone {
+			logger.Warn("IMAP certificate verification DISABLED (email.tls.insecure_skip_verify): anyone on the network path can intercept the password, use email.tls.ca_file instead",
+				zap.String("account", account.AccountName()),
+				zap.String("host", account.Host))
+		}
+		if account.TLSMode == config.TLSModeNone {
+			logger.Warn("IMAP TLS disabled: the password is sent in the clear (tls_mode: none)",
+				zap.String("account", account.AccountName()),
+				zap.String("host", account.Host))
+		}
+	}
+	if cfg.MigratedFrom != 0 {
+		logger.Warn("config.yaml uses an older layout and was migrated in memory, check the output of `config check` and set version in the file",
+			zap.Int("file_version", cfg.MigratedFrom),
+			zap.Int("current_version", config.CurrentVersion))
+	}
+	dryRun := cfg.DryRun || o.dryRun
+	if dryRun {
+		logger.Warn("Dry run enabled: Telegram messages are only logged and emails left untouched")
+	}
+	telegramClient.SetDryRun(dryRun)
+	discordClient.SetDryRun(dryRun)
+	webhookClient.SetDryRun(dryRun)
+	gotifyClient.SetDryRun(dryRun)
+	for _, imapClient := range imapClients {
+		imapClient.SetDryRun(dryRun)
+	}
+
+	// Fail fast on unknown chat aliases instead of at send time
+	if err := telegramClient.CheckChatIDs(configuredChatIDs(cfg)...); err != nil {
+		return fmt.Errorf("invalid Telegram chat configuration: %w", err)
+	}
+	if err := discordClient.CheckWebhooks(configuredDiscordWebhooks(cfg)...); err != nil {
+		return fmt.Errorf("invalid Discord webhook configuration: %w", err)
+	}
+	// Load the server certificate before listening or starting any goroutine,
+	// so a bad server.tls fails with nothing left running
+	var certs *certReloader
+	if cfg.Server.IsEnabled() && cfg.Server.TLS.CertFile != "" {
+		if certs, err = newCertReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile, logger); err != nil {
+			return fmt.Errorf("failed to load server certificate: %w", err)
+		}
+	}
+
+	// Initialize one processor manager per account with dynamic configuration
+	notifiers := processor.Notifiers{Telegram: telegramClient, Discord: discordClient, Webhook: webhookClient, Gotify: gotifyClient}
+	processorManagers, err := newManagers(accounts, notifiers, logger)
+	if err != nil {
+		return fmt.Errorf("invalid email service configuration: %w", err)
+	}
+	recent := processor.NewRecent(cfg.Server.RecentEvents)
+	processorManagers.SetRecent(recent)
+	audit, err := logging.NewAudit(cfg.Server.AuditLog)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", cfg.Server.AuditLog, err)
+	}
+	defer func() {
+		_ = audit.Sync()
+	}()
+	processorManagers.SetAudit(audit)
+	// Accounts sharing a dead letter file share its sink
+	deadLetters := make(map[string]*zap.Logger, len(accounts))
+	for i, account := range accounts {
+		deadLetter, ok := deadLetters[account.DeadLetter]
+		if !ok {
+			if deadLetter, err = logging.NewAudit(account.DeadLetter); err != nil {
+				return fmt.Errorf("failed to open dead letter log %s: %w", account.DeadLetter, err)
+			}
+			defer func() {
+				_ = deadLetter.Sync()
+			}()
+			deadLetters[account.DeadLetter] = deadLetter
+		}
+		imapClients[i].SetDeadLetter(deadLetter)
+	}
+
+	// Webhook-only deployments never connect to IMAP, and accounts without
+	// services are not polled
+	var monitored mailboxes
+	var monitoredManagers managers
+	for i, account := range accounts {
+		if len(processorManagers[i].GetProcessors()) == 0 {
+			if len(accounts) > 1 {
+				logger.Info("No email services for account, not monitoring it", zap.String("account", account.AccountName()))
+			}
+			continue
+		}
+		if err := checkIMAP(ctx, account, imapClients[i], logger); err != nil {
+			return err
+		}
+		monitored = append(monitored, imapClients[i])
+		monitoredManagers = append(monitoredManagers, processorManagers[i])
+	}
+	monitoring := len(monitored) > 0
+
+	// Setup HTTP server for webhooks, probes and metrics. Failed webhooks are
+	// logged and skipped. server.enabled: false doesn't bind a port.
+	serving := cfg.Server.IsEnabled()
+	var listener net.Listener
+	if serving {
+		listener = o.listener
+		if listener == nil {
+			if listener, err = net.Listen("tcp", cfg.Server.Address); err != nil {
+				return fmt.Errorf("failed to start server: %w", err)
+			}
+		}
+	} else {
+		logger.Info("HTTP server disabled by server.enabled, not serving probes or metrics")
+	}
+
+	// Start email monitoring with dynamic processors. Canceling ctx stops
+	// polling; sends in flight keep sendCtx until they are drained on shutdown.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sendCtx, cancelSends := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSends()
+
+	// One monitor per account; shutdown waits for all of them
+	monitorDone := make(chan struct{})
+	var imapStatus handlers.IMAPStatus
+	if monitoring {
+		imapStatus = monitored
+		var monitors sync.WaitGroup
+		for i, imapClient := range monitored {
+			monitors.Go(func() {
+				imapClient.StartMonitoring(ctx, sendCtx, monitoredManagers[i])
+			})
+		}
+		go func() {
+			defer close(monitorDone)
+			monitors.Wait()
+		}()
+	} else {
+		logger.Info("No email services configured, not starting IMAP monitoring")
+		close(monitorDone)
+	}
+	if !monitoring && !serving {
+		logger.Warn("No email services configured and the HTTP server is disabled, nothing to do")
+	}
+
+	healthHandler := handlers.NewHealthHandler(imapStatus, telegramClient, logger)
+	inFlight := handlers.NewInFlight()
+	router, _ := buildRouter(cfg, telegramClient, monitored, processorManagers, recent, healthHandler, inFlight, logger)
+	routes := &swappableRouter{}
+	routes.Store(router)
+
+	// Reload services and webhooks when asked to
+	go watchReload(ctx, o.reload, &reloader{
+		telegram:  telegramClient,
+		discord:   discordClient,
+		imap:      imapClients,
+		monitored: monitored,
+		health:    healthHandler,
+		inFlight:  inFlight,
+		recent:    recent,
+		audit:     audit,
+		routes:    routes,
+		serving:   serving,
+		dryRun:    o.dryRun,
+		logger:    logger,
+	})
+
+	srv := newServer(cfg.Server, routes)
+	https := certs != nil
+	if https {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	}
+
+	// Start server
+	serveErr := make(chan error, 1)
+	if serving {
+		go func() {
+			logger.Info("Starting server", zap.String("address", listener.Addr().String()), zap.Bool("tls", https))
+			serve := srv.Serve
+			if https {
+				// The certificate comes from TLSConfig, not from files given here
+				serve = func(l net.Listener) error { return srv.ServeTLS(l, "", "") }
+			}
+			if err := serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("server stopped: %w", err)
+			}
+		}()
+	}
+
+	// Wait until the caller stops the service or the server fails
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErr:
+		logger.Error("Server failed, shutting down", zap.Error(runErr))
+	}
+
+	logger.Info("Shutting down server...")
+	shutdownTimeout := cmp.Or(o.shutdown, defaultShutdownTimeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+
+	// Stop polling; checks and Telegram sends in flight are drained below
+	cancel()
+
+	// Name the requests the drain waits for, so a stuck handler shows up in the logs
+	if requests := inFlight.Requests(); len(requests) > 0 {
+		logger.Info("Waiting for webhook requests in flight", zap.Int("requests", len(requests)))
+		logInFlight(logger.Info, "Webhook request in flight", requests)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		requests := inFlight.Requests()
+		logger.Error("Server forced to shutdown", zap.Error(err), zap.Int("requests_in_flight", len(requests)))
+		logInFlight(logger.Error, "Webhook request still in flight after the shutdown timeout", requests)
+		if len(requests) > 0 {
+			runErr = errors.Join(runErr, fmt.Errorf("shutdown timed out after %s with %d webhook requests in flight: %s",
+				shutdownTimeout, len(requests), describeInFlight(requests)))
+		}
+	}
+
+	// monitorDone waits for every Manager's pending sends. Sends still running
+	// after the shutdown timeout are aborted; their emails stay unread and are
+	// picked up again on the next start.
+	select {
+	case <-monitorDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Timed out waiting for email monitoring to stop, aborting sends in flight")
+	}
+	cancelSends()
+
+	logger.Info("Server exited")
+	return runErr
+}
+
+// logInFlight logs one line per request, with how long it has been running
+func logInFlight(log func(string, ...zap.Field), msg string, requests []handlers.InFlightRequest) {
+	for _, req := range requests {
+		log(msg,
+			zap.String("request_id", req.ID),
+			zap.String("path", req.Path),
+			zap.Duration("running", time.Since(req.Started).Round(time.Millisecond)))
+	}
+}
+
+// describeInFlight lists requests as "<request ID> <path> (running 41s)"
+func describeInFlight(requests []handlers.InFlightRequest) string {
+	descriptions := make([]string, len(requests))
+	for i, req := range requests {
+		descriptions[i] = fmt.Sprintf("%s %s (running %s)", req.ID, req.Path, time.Since(req.Started).Round(time.Second))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// newTelegramClient connects to the Bot API, or sends through sender when one
+// is given. With telegram.allow_degraded a client that fails to start is
+// replaced by a disabled one.
+func newTelegramClient(cfg config.TelegramConfig, sender telegram.Sender, logger *zap.Logger) (*telegram.Client, error) {
+	if sender != nil {
+		return telegram.NewClientWithSender(cfg, sender, logger)
+	}
+
+	client, err := telegram.NewClient(cfg, logger)
+	if err == nil {
+		return client, nil
+	}
+	if !cfg.AllowDegraded {
+		return nil, fmt.Errorf("failed to start Telegram client: %w", err)
+	}
+	logger.Error("Failed to start Telegram client, running without Telegram (allow_degraded)", zap.Error(err))
+	client, err = telegram.NewDisabledClient(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Telegram client: %w", err)
+	}
+	return client, nil
+}
+
+// defaultServerTimeout applies to reads and writes without server.timeouts
+const defaultServerTimeout = 15 * time.Second
+
+// newServer applies server.timeouts and max_header_bytes. Unset idle and
+// read_header timeouts fall back to the read timeout, as in net/http.
+func newServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	seconds := func(n int) time.Duration {
+		return time.Duration(n) * time.Second
+	}
+	return &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadTimeout:       cmp.Or(seconds(cfg.Timeouts.Read), defaultServerTimeout),
+		WriteTimeout:      cmp.Or(seconds(cfg.Timeouts.Write), defaultServerTimeout),
+		IdleTimeout:       seconds(cfg.Timeouts.Idle),
+		ReadHeaderTimeout: seconds(cfg.Timeouts.ReadHeader),
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// checkIMAP logs in to an account once before monitoring starts, so bad
+// credentials or an unreachable host show up right away. A failure only stops
+// startup with email.fail_fast, otherwise the polls keep retrying.
+func checkIMAP(ctx context.Context, cfg config.EmailConfig, imapClient *email.IMAPClient, logger *zap.Logger) error {
+	capabilities, err := imapClient.Check(ctx)
+	if err == nil {
+		logger.Info("IMAP login succeeded",
+			zap.String("account", cfg.AccountName()),
+			zap.String("host", cfg.Host),
+			zap.Strings("capabilities", capabilities))
+		return nil
+	}
+	if cfg.FailFast {
+		return fmt.Errorf("IMAP self-check of account %s failed (email.fail_fast): %w", cfg.AccountName(), err)
+	}
+	logger.Error("IMAP self-check failed, monitoring starts anyway and retries on every poll",
+		zap.String("account", cfg.AccountName()),
+		zap.String("host", cfg.Host),
+		zap.Error(err))
+	return nil
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+// fakeSender records the texts of the Telegram messages sent
+type fakeSender struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg, ok := c.(tgbotapi.MessageConfig); ok {
+		s.texts = append(s.texts, msg.Text)
+	}
+	return tgbotapi.Message{MessageID: len(s.texts)}, nil
+}
+
+func (s *fakeSender) Texts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.texts...)
+}
+
+func TestRunWebhook(t *testing.T) {
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Address: "127.0.0.1:0"},
+		Telegram: config.TelegramConfig{BotToken: "test"},
+		Hook: []config.WebhookConfig{{
+			Name: "sonarr",
+			Path: "/webhook/sonarr",
+			Config: config.WebhookProcessorConfig{
+				TelegramChatID:  "123",
+				TelegramMessage: "📺 {{.series.title}} imported",
+			},
+		}},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	sender := &fakeSender{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg, zap.NewNop(), WithListener(listener), WithTelegramSender(sender))
+	}()
+
+	url := "http://" + listener.Addr().String() + "/webhook/sonarr"
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(`{"series": {"title": "Severance"}}`))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", resp.StatusCode)
+	}
+	if texts := sender.Texts(); len(texts) != 1 || texts[0] != "📺 Severance imported" {
+		t.Errorf("Sent %q, expected the rendered webhook message", texts)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() returned unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was canceled")
+	}
+}
+
+func TestRunServesProbesWithoutWebhooks(t *testing.T) {
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Address: "127.0.0.1:0"},
+		Telegram: config.TelegramConfig{BotToken: "test"},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg, zap.NewNop(), WithListener(listener), WithTelegramSender(&fakeSender{}))
+	}()
+
+	// No webhooks or admin token, the probes and metrics are still served
+	for _, path := range []string{"/healthz", "/metrics"} {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s = %d, expected 200 OK", path, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() returned unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was canceled")
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	err := Run(context.Background(), &config.Config{}, zap.NewNop(), WithTelegramSender(&fakeSender{}))
+	if err == nil {
+		t.Error("Expected error for an invalid configuration, got nil")
+	}
+}
+
+func TestRunIMAPFailFast(t *testing.T) {
+	// Nothing listens on the port, so the self-check login fails
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Address: "127.0.0.1:0"},
+		Telegram: config.TelegramConfig{BotToken: "test"},
+		Emails: []config.EmailConfig{{
+			Host:     "127.0.0.1",
+			Port:     port,
+			FailFast: true,
+			Services: []config.ServiceConfig{{
+				Name: "github",
+				Config: config.ServiceProcessorConfig{
+					EmailFrom:      []string{"noreply@github.com"},
+					EmailSubject:   []string{"code"},
+					TelegramChatID: "123",
+				},
+			}},
+		}},
+	}
+
+	err = Run(context.Background(), cfg, zap.NewNop(), WithTelegramSender(&fakeSender{}))
+	if err == nil || !strings.Contains(err.Error(), "email.fail_fast") {
+		t.Errorf("Run() = %v, expected the IMAP self-check error", err)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	srv := newServer(config.ServerConfig{Address: ":8080"}, http.NotFoundHandler())
+	if srv.ReadTimeout != 15*time.Second || srv.WriteTimeout != 15*time.Second || srv.IdleTimeout != 0 || srv.ReadHeaderTimeout != 0 || srv.MaxHeaderBytes != 0 {
+		t.Errorf("Default server = read %v, write %v, idle %v, read header %v, max header bytes %d, expected 15s reads and writes only",
+			srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, srv.ReadHeaderTimeout, srv.MaxHeaderBytes)
+	}
+
+	srv = newServer(config.ServerConfig{
+		Address:        ":8080",
+		Timeouts:       config.ServerTimeouts{Read: 30, Write: 60, Idle: 120, ReadHeader: 5},
+		MaxHeaderBytes: 16384,
+	}, http.NotFoundHandler())
+	if srv.ReadTimeout != 30*time.Second || srv.WriteTimeout != time.Minute || srv.IdleTimeout != 2*time.Minute || srv.ReadHeaderTimeout != 5*time.Second || srv.MaxHeaderBytes != 16384 {
+		t.Errorf("Configured server = read %v, write %v, idle %v, read header %v, max header bytes %d, expected the configured values",
+			srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, srv.ReadHeaderTimeout, srv.MaxHeaderBytes)
+	}
+}
+
+// blockingSender holds every Telegram send until release is closed, ignoring
+// cancellation like a send stuck on the network
+type blockingSender struct {
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.sending <- struct{}{}
+	<-s.release
+	return tgbotapi.Message{MessageID: 1}, nil
+}
+
+func TestRunShutdownReportsRequestsInFlight(t *testing.T) {
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Address: "127.0.0.1:0"},
+		Telegram: config.TelegramConfig{BotToken: "test"},
+		Hook: []config.WebhookConfig{{
+			Name:   "sonarr",
+			Path:   "/webhook/sonarr",
+			Config: config.WebhookProcessorConfig{TelegramChatID: "123", TelegramMessage: "imported"},
+		}},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	sender := &blockingSender{sending: make(chan struct{}, 1), release: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg, zap.NewNop(), WithListener(listener), WithTelegramSender(sender), WithShutdownTimeout(100*time.Millisecond))
+	}()
+
+	posted := make(chan struct{})
+	go func() {
+		defer close(posted)
+		req, _ := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/webhook/sonarr", strings.NewReader(`{}`))
+		req.Header.Set("X-Request-ID", "stuck-1")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	defer func() {
+		close(sender.release)
+		<-posted
+	}()
+
+	select {
+	case <-sender.sending:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The webhook request never reached Telegram")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "1 webhook requests in flight: stuck-1 /webhook/sonarr") {
+			t.Errorf("Run() = %v, expected the shutdown timeout to name the request in flight", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the shutdown timeout")
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/handlers"
+	"automation-hub/internal/logging"
+	"automation-hub/internal/services/discord"
+	"automation-hub/internal/services/gotify"
+	"automation-hub/internal/services/processor"
+	"automation-hub/internal/services/telegram"
+	"automation-hub/internal/services/webhook"
+)
+
+// swappableRouter serves the current router and lets a reload replace it
+// atomically; requests already in flight finish on the previous one
+type swappableRouter struct {
+	current atomic.Pointer[mux.Router]
+}
+
+func (r *swappableRouter) Store(router *mux.Router) {
+	r.current.Store(router)
+}
+
+func (r *swappableRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.current.Load().ServeHTTP(w, req)
+}
+
+// reloader rebuilds the email processors and webhook routes from the config file.
+// Telegram, Discord webhook aliases, IMAP accounts and connections and server
+// settings still require a restart.
+type reloader struct {
+	telegram  *telegram.Client
+	discord   *discord.Client
+	imap      mailboxes // every account, for dry run
+	monitored mailboxes // the accounts polled since startup
+	health    *handlers.HealthHandler
+	inFlight  *handlers.InFlight // kept across reloads, requests outlive the router they came in on
+	recent    *processor.Recent  // kept across reloads, server.recent_events needs a restart
+	audit     *zap.Logger        // kept across reloads, server.audit_log needs a restart
+	routes    *swappableRouter
+	serving   bool // the HTTP server was started
+	dryRun    bool // WithDryRun keeps dry run on whatever the file says
+	logger    *zap.Logger
+}
+
+// Reload applies the config file only if it passes validation and every chat
+// ID and webhook is valid, otherwise the running configuration is kept
+func (r *reloader) Reload() error {
+	cfg, err := config.Reload()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	warnUnknownKeys(cfg, r.logger)
+
+	if err := r.telegram.CheckChatIDs(configuredChatIDs(cfg)...); err != nil {
+		return fmt.Errorf("invalid Telegram chat configuration: %w", err)
+	}
+	if err := r.discord.CheckWebhooks(configuredDiscordWebhooks(cfg)...); err != nil {
+		return fmt.Errorf("invalid Discord webhook configuration: %w", err)
+	}
+
+	// notify_webhooks and gotify are stateless, so they are rebuilt and pick up changes
+	webhookClient := webhook.NewClient(cfg.NotifyWebhooks, r.logger)
+	webhookClient.SetDryRun(cfg.DryRun || r.dryRun)
+	gotifyClient := gotify.NewClient(cfg.Gotify, r.logger)
+	gotifyClient.SetDryRun(cfg.DryRun || r.dryRun)
+	notifiers := processor.Notifiers{Telegram: r.telegram, Discord: r.discord, Webhook: webhookClient, Gotify: gotifyClient}
+	processorManagers, err := newManagers(cfg.Accounts(), notifiers, r.logger)
+	if err != nil {
+		return fmt.Errorf("invalid email service configuration: %w", err)
+	}
+	processorManagers.SetRecent(r.recent)
+	processorManagers.SetAudit(r.audit)
+	router, err := buildRouter(cfg, r.telegram, r.monitored, processorManagers, r.recent, r.health, r.inFlight, r.logger)
+	if err != nil {
+		return err
+	}
+	var unmonitored bool
+	for _, processorManager := range processorManagers {
+		if mailbox := r.monitored.find(processorManager.Account()); mailbox != nil {
+			mailbox.SetDispatcher(processorManager)
+		} else if len(processorManager.GetProcessors()) > 0 {
+			unmonitored = true
+		}
+	}
+	r.routes.Store(router)
+	logging.SetSensitive(cfg.Server.LogSensitive)
+	r.telegram.SetDryRun(cfg.DryRun || r.dryRun)
+	r.discord.SetDryRun(cfg.DryRun || r.dryRun)
+	for _, mailbox := range r.imap {
+		mailbox.SetDryRun(cfg.DryRun || r.dryRun)
+	}
+
+	if unmonitored {
+		r.logger.Warn("Email services added but IMAP monitoring was not started, restart to poll for them")
+	}
+	if !r.serving && cfg.Server.IsEnabled() {
+		r.logger.Warn("HTTP server enabled but it was not started, restart to serve it")
+	}
+
+	r.logger.Info("Configuration reloaded",
+		zap.Int("services", processorManagers.services()),
+		zap.Int("webhooks", len(cfg.Hook)))
+	return nil
+}
+
+// watchReload reloads the configuration every time a value is received on
+// reload, until ctx is canceled. A nil channel never reloads.
+func watchReload(ctx context.Context, reload <-chan struct{}, r *reloader) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			r.logger.Info("Reloading configuration")
+			if err := r.Reload(); err != nil {
+				r.logger.Error("Configuration reload failed, keeping current configuration", zap.Error(err))
+			}
+		}
+	}
+}
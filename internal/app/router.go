@@ -0,0 +1,126 @@
+package app
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/handlers"
+	"automation-hub/internal/metrics"
+	"automation-hub/internal/services/telegram"
+)
+
+// buildRouter registers the probes, metrics, admin endpoints and configured webhook
+// routes. Webhooks that fail to build are skipped and reported in the returned error.
+func buildRouter(cfg *config.Config, telegramClient *telegram.Client, poller handlers.Poller, processors handlers.ProcessorLister, recent handlers.EventLister, healthHandler *handlers.HealthHandler, inFlight *handlers.InFlight, logger *zap.Logger) (*mux.Router, error) {
+	router := mux.NewRouter()
+	router.Use(handlers.Recover(logger))
+	router.MethodNotAllowedHandler = handlers.MethodNotAllowed(router)
+	webhookHandler := handlers.NewWebhookHandler(telegramClient, cfg, logger)
+	webhookHandler.SetInFlight(inFlight)
+
+	// Health and readiness probes
+	router.HandleFunc("/healthz", healthHandler.HandleHealthz).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.HandleReadyz).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Admin endpoints are only exposed when an admin token is configured
+	if cfg.Server.AdminToken != "" {
+		adminHandler := handlers.NewAdminHandler(poller, telegramClient, processors, recent, cfg.Server.AdminToken, logger)
+		admin := router.PathPrefix("/admin").Subrouter()
+		postMethods, getMethods := []string{http.MethodPost}, []string{http.MethodGet}
+		// Browser dashboards need CORS, preflights are answered by the middleware
+		if len(cfg.Server.CORSAllowedOrigins) > 0 {
+			admin.Use(handlers.CORS(cfg.Server.CORSAllowedOrigins))
+			postMethods = append(postMethods, http.MethodOptions)
+			getMethods = append(getMethods, http.MethodOptions)
+		}
+		admin.HandleFunc("/poll", adminHandler.RequireToken(adminHandler.HandlePoll)).Methods(postMethods...)
+		admin.HandleFunc("/telegram-test", adminHandler.RequireToken(adminHandler.HandleTelegramTest)).Methods(postMethods...)
+		admin.HandleFunc("/processors", adminHandler.RequireToken(adminHandler.HandleProcessors)).Methods(getMethods...)
+		admin.HandleFunc("/recent", adminHandler.RequireToken(adminHandler.HandleRecent)).Methods(getMethods...)
+		admin.HandleFunc("/capabilities", adminHandler.RequireToken(adminHandler.HandleCapabilities)).Methods(getMethods...)
+	}
+
+	// Register webhook routes dynamically from configuration
+	var errs []error
+	for _, hook := range cfg.Hook {
+		if !hook.IsEnabled() {
+			logger.Info("Skipping disabled webhook", zap.String("name", hook.Name))
+			continue
+		}
+		handler, err := webhookHandler.HandlerFor(hook)
+		if err != nil {
+			logger.Error("Failed to register webhook route",
+				zap.String("name", hook.Name),
+				zap.Error(err))
+			errs = append(errs, fmt.Errorf("webhook %s: %w", hook.Name, err))
+			continue
+		}
+		handler = webhookHandler.VerifySignature(hook, handler)
+		handler = webhookHandler.RequireToken(hook, handler)
+		handler = webhookHandler.WithTimeout(hook, handler)
+		handler = webhookHandler.Instrument(hook, webhookHandler.WithRequestID(handler))
+		router.HandleFunc(hook.Path, handler).Methods("POST")
+		logger.Info("Registered webhook route",
+			zap.String("name", hook.Name),
+			zap.String("path", hook.Path),
+			zap.Bool("signed", hook.Secret != ""),
+			zap.Bool("token", hook.AuthToken != ""))
+		if hook.Secret == "" && hook.AuthToken == "" {
+			logger.Warn("Webhook has no auth_token or secret, accepting unauthenticated requests",
+				zap.String("name", hook.Name))
+		}
+	}
+
+	return router, errors.Join(errs...)
+}
+
+// warnUnknownKeys logs the config keys that match no setting, usually typos
+// such as email_subjetc that would otherwise silently disable a setting
+func warnUnknownKeys(cfg *config.Config, logger *zap.Logger) {
+	for _, key := range cfg.UnknownKeys {
+		logger.Warn("Unknown key in config.yaml is ignored, check for a typo", zap.String("key", key))
+	}
+}
+
+// configuredChatIDs collects the telegram_chat_id of every enabled Telegram
+// service and webhook, and of every email.fallback
+func configuredChatIDs(cfg *config.Config) []string {
+	var chatIDs []string
+	for _, account := range cfg.Accounts() {
+		if account.Fallback.Enabled() {
+			chatIDs = append(chatIDs, account.Fallback.TelegramChatID)
+		}
+		for _, service := range account.Services {
+			if !service.IsEnabled() || cmp.Or(service.Config.Notifier, config.NotifierTelegram) != config.NotifierTelegram {
+				continue
+			}
+			chatIDs = append(chatIDs, service.Config.TelegramChatID)
+		}
+	}
+	for _, hook := range cfg.Hook {
+		if hook.IsEnabled() {
+			chatIDs = append(chatIDs, hook.Config.TelegramChatID)
+		}
+	}
+	return chatIDs
+}
+
+// configuredDiscordWebhooks collects the discord_webhook of every enabled Discord service
+func configuredDiscordWebhooks(cfg *config.Config) []string {
+	var webhooks []string
+	for _, account := range cfg.Accounts() {
+		for _, service := range account.Services {
+			if service.IsEnabled() && service.Config.Notifier == config.NotifierDiscord {
+				webhooks = append(webhooks, service.Config.DiscordWebhook)
+			}
+		}
+	}
+	return webhooks
+}
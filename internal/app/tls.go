@@ -0,0 +1,81 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// certReloader serves the server.tls certificate and loads it again when its
+// files change, so a renewed certificate (e.g. from certbot) applies to new
+// connections without a restart. A renewal that fails to load is logged and the
+// previous certificate is kept.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // latest modification of the two files when loaded
+}
+
+// newCertReloader loads the certificate and key, failing if they don't make a pair
+func newCertReloader(certFile, keyFile string, logger *zap.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is the tls.Config hook, checking the files on every handshake
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if modTime, err := r.filesModTime(); err == nil && !modTime.Equal(r.modTime) {
+		if err := r.load(modTime); err != nil {
+			r.logger.Warn("Failed to reload server certificate, keeping the previous one",
+				zap.String("cert_file", r.certFile),
+				zap.Error(err))
+			// Retry only once the files change again
+			r.modTime = modTime
+		} else {
+			r.logger.Info("Reloaded server certificate", zap.String("cert_file", r.certFile))
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+// writeCert writes a self-signed certificate for commonName and its key to dir,
+// returning their paths
+func writeCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func servedCommonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() returned unexpected error: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse served certificate: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "old.example.com")
+	r, err := newCertReloader(certFile, keyFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newCertReloader() returned unexpected error: %v", err)
+	}
+	if name := servedCommonName(t, r); name != "old.example.com" {
+		t.Fatalf("Served %s, expected old.example.com", name)
+	}
+
+	// A renewal is picked up on the next handshake
+	writeCert(t, dir, "new.example.com")
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("Failed to touch %s: %v", path, err)
+		}
+	}
+	if name := servedCommonName(t, r); name != "new.example.com" {
+		t.Errorf("Served %s after renewal, expected new.example.com", name)
+	}
+
+	// A broken renewal keeps the previous certificate
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatalf("Failed to touch key: %v", err)
+	}
+	if name := servedCommonName(t, r); name != "new.example.com" {
+		t.Errorf("Served %s after a broken renewal, expected new.example.com", name)
+	}
+
+	if _, err := newCertReloader(certFile, filepath.Join(dir, "missing.pem"), zap.NewNop()); err == nil {
+		t.Error("newCertReloader() with a missing key = nil, expected error")
+	}
+}
+
+func TestRunHTTPS(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "hub.example.com")
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Address:    "127.0.0.1:0",
+			AdminToken: "adm1n",
+			TLS:        config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile},
+		},
+		Telegram: config.TelegramConfig{BotToken: "test"},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg, zap.NewNop(), WithListener(listener), WithTelegramSender(&fakeSender{}))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz over HTTPS failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "hub.example.com" {
+		t.Errorf("Expected the configured certificate to be served, got %+v", resp.TLS)
+	}
+}
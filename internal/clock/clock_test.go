@@ -0,0 +1,43 @@
+package clock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := NewFake(start)
+
+	if got := clk.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, expected %v", got, start)
+	}
+
+	clk.Advance(time.Minute)
+	if got := clk.Now(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Now() after Advance = %v, expected %v", got, start.Add(time.Minute))
+	}
+
+	select {
+	case fired := <-clk.After(2 * time.Second):
+		if expected := start.Add(time.Minute + 2*time.Second); !fired.Equal(expected) {
+			t.Errorf("After() fired at %v, expected %v", fired, expected)
+		}
+	default:
+		t.Fatal("After() did not fire at once")
+	}
+	<-clk.After(0)
+
+	if got, expected := clk.Waits(), []time.Duration{2 * time.Second, 0}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Waits() = %v, expected %v", got, expected)
+	}
+}
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	if now := Real.Now(); now.Before(before) {
+		t.Errorf("Real.Now() = %v, before %v", now, before)
+	}
+	<-Real.After(time.Millisecond)
+}
@@ -1,56 +1,279 @@
 package config
 
 import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
+	Version  int             `mapstructure:"version"` // versión del formato, vacío = 1; se migra a CurrentVersion al cargar
 	Server   ServerConfig    `mapstructure:"server"`
-	Email    EmailConfig     `mapstructure:"email"`
+	Emails   []EmailConfig   `mapstructure:"emails"`   // cuentas IMAP, una por monitor; email: es la forma de una sola cuenta
+	Services []ServiceConfig `mapstructure:"services"` // servicios compartidos, las cuentas los usan con shared_services
 	Telegram TelegramConfig  `mapstructure:"telegram"`
+	Discord  DiscordConfig   `mapstructure:"discord"`
+	Gotify   GotifyConfig    `mapstructure:"gotify"`
 	Hook     []WebhookConfig `mapstructure:"hook"`
+	// Endpoints HTTP propios para servicios con notifier: webhook, por alias
+	NotifyWebhooks map[string]NotifyWebhookConfig `mapstructure:"notify_webhooks"`
+	DryRun         bool                           `mapstructure:"dry_run"` // registra los mensajes de Telegram en lugar de enviarlos
+	MigratedFrom   int                            `mapstructure:"-"`       // versión del fichero si se migró al cargarlo, 0 = ya era la actual
+	UnknownKeys    []string                       `mapstructure:"-"`       // claves del fichero que no corresponden a ningún campo (erratas)
 }
 
 type ServerConfig struct {
-	Address string `mapstructure:"address"`
+	Enabled               *bool           `mapstructure:"enabled"` // false no abre ningún puerto (ni /healthz ni /metrics), true por defecto
+	Address               string          `mapstructure:"address"`
+	LogLevel              string          `mapstructure:"log_level"`               // debug, info (por defecto), warn o error
+	LogFormat             string          `mapstructure:"log_format"`              // json (por defecto) o console
+	LogSensitive          bool            `mapstructure:"log_sensitive"`           // registra códigos y cuerpos sin enmascarar
+	MaxBodyBytes          int64           `mapstructure:"max_body_bytes"`          // tamaño máximo del cuerpo de un webhook, 1 MiB por defecto
+	WebhookTimeoutSeconds int             `mapstructure:"webhook_timeout_seconds"` // tiempo máximo por petición de webhook, 10 por defecto
+	AdminToken            Secret          `mapstructure:"admin_token"`             // habilita /admin/* con Authorization: Bearer
+	AdminTokenFile        string          `mapstructure:"admin_token_file"`        // alternativa a admin_token
+	CORSAllowedOrigins    []string        `mapstructure:"cors_allowed_origins"`    // orígenes que pueden llamar a /admin/* desde el navegador, "*" = todos
+	RecentEvents          int             `mapstructure:"recent_events"`           // emails recientes que muestra /admin/recent, 0 = 50
+	AuditLog              string          `mapstructure:"audit_log"`               // fichero, stdout o stderr para una línea JSON por código reenviado, vacío = desactivado
+	Timeouts              ServerTimeouts  `mapstructure:"timeouts"`
+	MaxHeaderBytes        int             `mapstructure:"max_header_bytes"` // tamaño máximo de las cabeceras, 0 = 1 MiB (por defecto de Go)
+	TLS                   ServerTLSConfig `mapstructure:"tls"`              // sirve HTTPS en lugar de HTTP
+}
+
+// IsEnabled reports whether the HTTP server is started, true unless enabled: false
+func (s ServerConfig) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// ServerTLSConfig activa HTTPS con un certificado en PEM, se recarga al cambiar los ficheros
+type ServerTLSConfig struct {
+	CertFile string `mapstructure:"cert_file"` // certificado, con los intermedios detrás
+	KeyFile  string `mapstructure:"key_file"`  // clave privada
+}
+
+// ServerTimeouts son los tiempos máximos del servidor HTTP, en segundos
+type ServerTimeouts struct {
+	Read       int `mapstructure:"read"`        // leer la petición completa, 0 = 15
+	Write      int `mapstructure:"write"`       // escribir la respuesta, 0 = 15
+	Idle       int `mapstructure:"idle"`        // conexiones keep-alive inactivas, 0 = igual que read
+	ReadHeader int `mapstructure:"read_header"` // leer las cabeceras, 0 = igual que read
 }
 
 type EmailConfig struct {
-	Host            string          `mapstructure:"host"`
-	Port            int             `mapstructure:"port"`
-	Username        string          `mapstructure:"username"`
-	Password        string          `mapstructure:"password"`
-	PollingInterval int             `mapstructure:"polling_interval"` // en segundos
-	Services        []ServiceConfig `mapstructure:"services"`
+	Name               string          `mapstructure:"name"` // nombre de la cuenta en logs y métricas, vacío = username
+	Host               string          `mapstructure:"host"`
+	Port               int             `mapstructure:"port"`
+	TLSMode            string          `mapstructure:"tls_mode"`       // tls (por defecto), starttls o none
+	AllowInsecure      bool            `mapstructure:"allow_insecure"` // obligatorio con tls_mode: none, la contraseña viaja en claro
+	TLS                IMAPTLSConfig   `mapstructure:"tls"`            // verificación del certificado del servidor IMAP
+	Username           string          `mapstructure:"username"`
+	Password           Secret          `mapstructure:"password"`
+	PasswordFile       string          `mapstructure:"password_file"`        // alternativa a password, p. ej. /run/secrets/imap
+	PollingInterval    int             `mapstructure:"polling_interval"`     // en segundos
+	PollingJitter      int             `mapstructure:"polling_jitter"`       // % aleatorio (±) aplicado a cada espera, 0 = intervalo fijo
+	DialTimeout        int             `mapstructure:"dial_timeout"`         // en segundos, conexión y saludo del servidor, 0 = 30
+	CommandTimeout     int             `mapstructure:"command_timeout"`      // en segundos, por comando IMAP, 0 = 120
+	FailFast           bool            `mapstructure:"fail_fast"`            // no arrancar si la comprobación inicial de IMAP falla
+	Compress           bool            `mapstructure:"compress"`             // COMPRESS=DEFLATE tras el login si el servidor lo anuncia
+	Folders            []FolderConfig  `mapstructure:"folders"`              // carpetas a vigilar, vacío = solo INBOX
+	SearchSinceMinutes int             `mapstructure:"search_since_minutes"` // 0 = sin límite
+	MaxPerCycle        int             `mapstructure:"max_per_cycle"`        // emails procesados por ciclo, los más antiguos primero, 0 = sin límite
+	MaxConcurrency     int             `mapstructure:"max_concurrency"`      // emails procesados a la vez, 0 = 4
+	MaxAttempts        int             `mapstructure:"max_attempts"`         // ciclos fallidos por email antes de descartarlo, 0 = reintentar siempre
+	DeadLetter         string          `mapstructure:"dead_letter"`          // fichero, stdout o stderr con una línea JSON por email descartado
+	MoveToFolder       string          `mapstructure:"move_to_folder"`       // vacío = no mover
+	ReadOnly           bool            `mapstructure:"read_only"`            // abre las carpetas con EXAMINE y nunca modifica el buzón
+	Dedup              bool            `mapstructure:"dedup"`                // evita reenviar el mismo email
+	DedupWindowMinutes int             `mapstructure:"dedup_window_minutes"` // 0 = 10 minutos
+	StateFile          string          `mapstructure:"state_file"`           // persiste los emails procesados (activa dedup)
+	AllowedSenders     []string        `mapstructure:"allowed_senders"`      // direcciones o dominios; vacío = todos
+	BlockedSenders     []string        `mapstructure:"blocked_senders"`      // direcciones o dominios ignorados siempre
+	Fallback           FallbackConfig  `mapstructure:"fallback"`             // reenvía los emails que ningún servicio procesa
+	Services           []ServiceConfig `mapstructure:"services"`
+	SharedServices     []string        `mapstructure:"shared_services"` // nombres de servicios de services usados también por esta cuenta
+	// Patrones por defecto por nombre de servicio, se combinan con los incluidos
+	DefaultPatterns map[string]string `mapstructure:"default_patterns"`
+}
+
+// AccountName names the account in logs and metrics: name, else the username
+func (e EmailConfig) AccountName() string {
+	return cmp.Or(e.Name, e.Username, "default")
+}
+
+// Accounts returns the IMAP accounts with the shared services each one lists in
+// shared_services appended to its own services. Unknown names are skipped, see
+// Validate.
+func (c *Config) Accounts() []EmailConfig {
+	accounts := slices.Clone(c.Emails)
+	for i, account := range accounts {
+		services := slices.Clone(account.Services)
+		for _, name := range account.SharedServices {
+			for _, service := range c.Services {
+				if service.Name == name {
+					services = append(services, service)
+					break
+				}
+			}
+		}
+		accounts[i].Services = services
+	}
+	return accounts
+}
+
+type FallbackConfig struct {
+	TelegramChatID  string `mapstructure:"telegram_chat_id"` // vacío = desactivado, los emails sin servicio solo se registran
+	TelegramMessage string `mapstructure:"telegram_message"` // plantilla con {{.From}} y {{.Subject}}, vacío = por defecto
+}
+
+// Enabled reports whether unmatched emails are forwarded
+func (f FallbackConfig) Enabled() bool {
+	return f.TelegramChatID != ""
+}
+
+type FolderConfig struct {
+	Name            string `mapstructure:"name"`
+	PollingInterval int    `mapstructure:"polling_interval"` // en segundos, 0 = email.polling_interval
+}
+
+type IMAPTLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`              // CA en PEM para servidores con CA privada o autofirmados
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // no verifica el certificado, solo para pruebas
 }
 
 type ServiceConfig struct {
-	Name   string                 `mapstructure:"name"`
-	Config ServiceProcessorConfig `mapstructure:"config"`
+	Name     string                 `mapstructure:"name"`
+	Type     string                 `mapstructure:"type"`     // tipo de procesador registrado, vacío = generic
+	Priority int                    `mapstructure:"priority"` // mayor primero, empates en el orden del fichero
+	Enabled  *bool                  `mapstructure:"enabled"`  // false lo desactiva sin borrar su configuración, true por defecto
+	Config   ServiceProcessorConfig `mapstructure:"config"`
+}
+
+// IsEnabled reports whether the service is loaded, true unless enabled: false
+func (s ServiceConfig) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
 }
 
 type ServiceProcessorConfig struct {
-	EmailFrom       string   `mapstructure:"email_from"`
-	EmailSubject    []string `mapstructure:"email_subject"`
-	TelegramChatID  string   `mapstructure:"telegram_chat_id"`
-	TelegramMessage string   `mapstructure:"telegram_message"`
-	CodePattern     string   `mapstructure:"code_pattern,omitempty"` // regex personalizado opcional
+	EmailFrom          []string `mapstructure:"email_from"`
+	FromMatch          string   `mapstructure:"from_match"` // contains (por defecto), exact o domain
+	EmailSubject       []string `mapstructure:"email_subject"`
+	SubjectMatch       string   `mapstructure:"subject_match"`    // contains (por defecto) o regex
+	CaseInsensitive    bool     `mapstructure:"case_insensitive"` // remitente y asunto sin distinguir mayúsculas
+	TelegramChatID     string   `mapstructure:"telegram_chat_id"` // uno o varios IDs separados por comas
+	TelegramMessage    string   `mapstructure:"telegram_message"`
+	CodePattern        string   `mapstructure:"code_pattern,omitempty"` // regex personalizado opcional
+	CodeMarker         []string `mapstructure:"code_marker"`            // buscar el código solo tras este texto
+	NotifyOnFailure    bool     `mapstructure:"notify_on_failure"`      // enviar "Not found" si no se extrae código
+	ForwardAttachments []string `mapstructure:"forward_attachments"`    // tipos MIME de adjuntos a reenviar, p. ej. application/pdf o image/*
+	DecodeQR           bool     `mapstructure:"decode_qr"`              // leer el código de imágenes QR adjuntas
+	BodyContains       []string `mapstructure:"body_contains"`          // el cuerpo debe contener alguna de estas frases
+	BodyRegex          string   `mapstructure:"body_regex"`             // el cuerpo debe coincidir con este regex
+	Notifier           string   `mapstructure:"notifier"`               // telegram (por defecto), discord, webhook o gotify
+	DiscordWebhook     string   `mapstructure:"discord_webhook"`        // alias de discord.webhooks o URL, con notifier: discord
+	NotifyWebhook      string   `mapstructure:"notify_webhook"`         // alias de notify_webhooks, con notifier: webhook
+	MaxAgeMinutes      int      `mapstructure:"max_age_minutes"`        // ignora emails con cabecera Date más antigua, 0 = sin límite
+	CooldownSeconds    int      `mapstructure:"cooldown_seconds"`       // tras un envío, ignora los emails del servicio durante N segundos, 0 = desactivado
+	GotifyPriority     *int     `mapstructure:"gotify_priority"`        // 0-10 con notifier: gotify, vacío = prioridad de la aplicación
+
+	DisableNotification bool `mapstructure:"disable_notification"` // telegram: entrega silenciosa, sin sonido
+	ReplyToMessageID    int  `mapstructure:"reply_to_message_id"`  // telegram: responder a este mensaje, 0 = ninguno
+	InlineCopyButton    bool `mapstructure:"inline_copy_button"`   // telegram: botón bajo el mensaje que copia el código
+}
+
+// Modos de conexión IMAP de tls_mode
+const (
+	TLSModeTLS      = "tls"
+	TLSModeStartTLS = "starttls"
+	TLSModeNone     = "none"
+)
+
+// Modos de comparación de email_subject
+const (
+	SubjectMatchContains = "contains"
+	SubjectMatchRegex    = "regex"
+)
+
+// Modos de comparación de email_from
+const (
+	FromMatchContains = "contains"
+	FromMatchExact    = "exact"
+	FromMatchDomain   = "domain"
+)
+
+// Canales de notificación de los servicios
+const (
+	NotifierTelegram = "telegram"
+	NotifierDiscord  = "discord"
+	NotifierWebhook  = "webhook"
+	NotifierGotify   = "gotify"
+)
+
+type DiscordConfig struct {
+	Webhooks map[string]Secret `mapstructure:"webhooks"` // alias -> URL del webhook, usable como discord_webhook
+}
+
+type GotifyConfig struct {
+	URL       string `mapstructure:"url"`        // servidor de Gotify, p. ej. https://push.example.com
+	Token     Secret `mapstructure:"token"`      // token de la aplicación de Gotify
+	TokenFile string `mapstructure:"token_file"` // alternativa a token
+}
+
+type NotifyWebhookConfig struct {
+	URL     Secret            `mapstructure:"url"`
+	Method  string            `mapstructure:"method"`  // POST (por defecto), PUT o PATCH
+	Headers map[string]Secret `mapstructure:"headers"` // cabeceras extra, p. ej. Authorization
 }
 
 type TelegramConfig struct {
-	BotToken string            `mapstructure:"bot_token"`
-	ChatIDs  map[string]string `mapstructure:"chat_ids"`
+	BotToken         Secret            `mapstructure:"bot_token"`
+	BotTokenFile     string            `mapstructure:"bot_token_file"` // alternativa a bot_token
+	ChatIDs          map[string]string `mapstructure:"chat_ids"`
+	ParseMode        string            `mapstructure:"parse_mode"`          // Markdown, MarkdownV2, HTML o vacío (texto plano)
+	MessagePrefix    string            `mapstructure:"message_prefix"`      // se antepone tal cual a todos los mensajes, p. ej. "[home] "
+	MessageSuffix    string            `mapstructure:"message_suffix"`      // se añade tal cual al final de todos los mensajes
+	MaxAttempts      int               `mapstructure:"max_attempts"`        // 0 = 3 intentos
+	RetryBaseDelayMs int               `mapstructure:"retry_base_delay_ms"` // 0 = 1000 ms, se duplica en cada reintento
+	// Límites de envío de Telegram (0 = valores por defecto)
+	RateLimitPerSecond     int `mapstructure:"rate_limit_per_second"`      // global, 0 = 30 msg/s
+	ChatRateLimitPerMinute int `mapstructure:"chat_rate_limit_per_minute"` // por chat, 0 = 20 msg/min
+	// Si el bot no arranca (token inválido, API caída), seguir sin Telegram y registrar los envíos como errores
+	AllowDegraded bool `mapstructure:"allow_degraded"`
+	// Cortocircuito: tras N fallos seguidos de red o 5xx los envíos fallan al momento durante la espera
+	BreakerThreshold       int `mapstructure:"breaker_threshold"`        // 0 = 5 fallos, -1 = desactivado
+	BreakerCooldownSeconds int `mapstructure:"breaker_cooldown_seconds"` // 0 = 60 s antes de probar de nuevo
 }
 
 type WebhookConfig struct {
-	Name   string                 `mapstructure:"name"`
-	Path   string                 `mapstructure:"path"`
-	Config WebhookProcessorConfig `mapstructure:"config"`
+	Name                string                 `mapstructure:"name"`
+	Path                string                 `mapstructure:"path"`
+	Secret              Secret                 `mapstructure:"secret"`                // opcional: clave HMAC-SHA256 para X-Signature
+	SecretFile          string                 `mapstructure:"secret_file"`           // alternativa a secret
+	AuthToken           Secret                 `mapstructure:"auth_token"`            // opcional: token exigido en Authorization: Bearer
+	AuthTokenFile       string                 `mapstructure:"auth_token_file"`       // alternativa a auth_token
+	Strict              bool                   `mapstructure:"strict"`                // rechaza campos desconocidos en el JSON recibido
+	TimeoutSeconds      int                    `mapstructure:"timeout_seconds"`       // sustituye server.webhook_timeout_seconds para este webhook
+	DedupSeconds        int                    `mapstructure:"dedup_seconds"`         // qbittorrent: ignora avisos repetidos, 0 = 60 s, negativo = desactivado
+	Enabled             *bool                  `mapstructure:"enabled"`               // false lo desactiva sin borrar su configuración, true por defecto
+	ResponseTemplate    string                 `mapstructure:"response_template"`     // cuerpo de la respuesta con el payload recibido, vacío = {"status":"success",...}
+	ResponseContentType string                 `mapstructure:"response_content_type"` // Content-Type de response_template, application/json por defecto
+	Config              WebhookProcessorConfig `mapstructure:"config"`
+}
+
+// IsEnabled reports whether the webhook route is registered, true unless enabled: false
+func (h WebhookConfig) IsEnabled() bool {
+	return h.Enabled == nil || *h.Enabled
 }
 
 type WebhookProcessorConfig struct {
-	TelegramChatID  string `mapstructure:"telegram_chat_id"`
-	TelegramMessage string `mapstructure:"telegram_message"`
+	TelegramChatID      string `mapstructure:"telegram_chat_id"` // uno o varios IDs separados por comas
+	TelegramMessage     string `mapstructure:"telegram_message"`
+	DisableNotification bool   `mapstructure:"disable_notification"` // entrega silenciosa, sin sonido
+	ReplyToMessageID    int    `mapstructure:"reply_to_message_id"`  // responder a este mensaje, 0 = ninguno
 }
 
 func Load() (*Config, error) {
@@ -61,18 +284,61 @@ func Load() (*Config, error) {
 	viper.AddConfigPath("/app/configs")
 	viper.AddConfigPath(".")
 
-	// Environment variables override
+	// Environment variables override, e.g. AUTOMATION_SERVER_LOG_LEVEL for server.log_level
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("AUTOMATION")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	viper.SetDefault("telegram.parse_mode", "Markdown")
+	// Defaults make the keys known to viper so env overrides apply without them in the file
+	viper.SetDefault("server.log_level", "info")
+	viper.SetDefault("server.log_format", "json")
+
+	return Reload()
+}
 
+// Reload re-reads the config file located by Load, migrates older layouts to
+// CurrentVersion and decodes it into a new Config
+func Reload() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	// Settings include environment overrides and defaults; the migrated copy is
+	// decoded by a separate instance so the global one keeps the file as read
+	settings := viper.AllSettings()
+	version, err := migrate(settings)
+	if err != nil {
+		return nil, err
+	}
+	singleAccount := foldSingleAccount(settings)
+	migrated := viper.New()
+	if err := migrated.MergeConfigMap(settings); err != nil {
+		return nil, err
+	}
+
+	// Keys that match no field are collected rather than silently dropped
+	var metadata mapstructure.Metadata
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := migrated.Unmarshal(&config, func(dc *mapstructure.DecoderConfig) { dc.Metadata = &metadata }); err != nil {
 		return nil, err
 	}
+	config.UnknownKeys = metadata.Unused
+	if singleAccount {
+		// Report typos under the email: section they were written in
+		for i, key := range config.UnknownKeys {
+			if rest, ok := strings.CutPrefix(key, "emails[0]."); ok {
+				config.UnknownKeys[i] = "email." + rest
+			}
+		}
+	}
+	sort.Strings(config.UnknownKeys)
+	if version != CurrentVersion {
+		config.MigratedFrom = version
+	}
+	if err := config.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("failed to resolve config secrets: %w", err)
+	}
 
 	return &config, nil
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/spf13/viper"
@@ -36,6 +37,9 @@ telegram:
   bot_token: "test_bot_token"
   chat_ids:
     admin: "123456"
+discord:
+  webhooks:
+    codes: "https://discord.com/api/webhooks/1/token"
 hook:
   - name: "qbittorrent"
     path: "/webhook/qbittorrent"
@@ -61,27 +65,74 @@ hook:
 	if cfg.Server.Address != ":8080" {
 		t.Errorf("Expected Server.Address :8080, got %s", cfg.Server.Address)
 	}
-	if cfg.Email.Host != "imap.example.com" {
-		t.Errorf("Expected Email.Host imap.example.com, got %s", cfg.Email.Host)
+	if cfg.Emails[0].Host != "imap.example.com" {
+		t.Errorf("Expected Emails[0].Host imap.example.com, got %s", cfg.Emails[0].Host)
 	}
-	if cfg.Email.Port != 993 {
-		t.Errorf("Expected Email.Port 993, got %d", cfg.Email.Port)
+	if cfg.Emails[0].Port != 993 {
+		t.Errorf("Expected Emails[0].Port 993, got %d", cfg.Emails[0].Port)
 	}
-	if len(cfg.Email.Services) != 1 {
-		t.Fatalf("Expected 1 service, got %d", len(cfg.Email.Services))
+	if len(cfg.Emails[0].Services) != 1 {
+		t.Fatalf("Expected 1 service, got %d", len(cfg.Emails[0].Services))
 	}
-	if cfg.Email.Services[0].Name != "cloudflare" {
-		t.Errorf("Expected service name cloudflare, got %s", cfg.Email.Services[0].Name)
+	if cfg.Emails[0].Services[0].Name != "cloudflare" {
+		t.Errorf("Expected service name cloudflare, got %s", cfg.Emails[0].Services[0].Name)
+	}
+	// A single email_from string decodes into a one-element list
+	if from := cfg.Emails[0].Services[0].Config.EmailFrom; len(from) != 1 || from[0] != "no-reply@cloudflare.com" {
+		t.Errorf("Expected EmailFrom [no-reply@cloudflare.com], got %v", from)
 	}
 	if cfg.Telegram.BotToken != "test_bot_token" {
 		t.Errorf("Expected Telegram.BotToken test_bot_token, got %s", cfg.Telegram.BotToken)
 	}
+	if got := cfg.Discord.Webhooks["codes"]; got != "https://discord.com/api/webhooks/1/token" {
+		t.Errorf("Expected Discord webhook codes, got %q", string(got))
+	}
 	if len(cfg.Hook) != 1 {
 		t.Fatalf("Expected 1 hook, got %d", len(cfg.Hook))
 	}
 	if cfg.Hook[0].Name != "qbittorrent" {
 		t.Errorf("Expected hook name qbittorrent, got %s", cfg.Hook[0].Name)
 	}
+	if len(cfg.UnknownKeys) != 0 {
+		t.Errorf("Expected no unknown keys, got %v", cfg.UnknownKeys)
+	}
+}
+
+func TestLoadUnknownKeys(t *testing.T) {
+	cfg, err := loadYAML(t, `
+version: 2
+server:
+  address: ":8080"
+  adress: ":9090"
+email:
+  polling_intervall: 30
+  move_to_folder: ""
+  services:
+    - name: "cloudflare"
+      config:
+        email_from: ["noreply@notify.cloudflare.com"]
+        email_subjetc: ["Your login code"]
+        notify_on_failure: true
+hook:
+  - name: "qbittorrent"
+    dedup_seconds: 30
+    config:
+      telegram_mesage: "{{.TorrentName}}"
+`)
+	if err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+
+	// Optional keys that are set, even to empty values, are known
+	expected := []string{
+		"email.polling_intervall",
+		"email.services[0].config.email_subjetc",
+		"hook[0].config.telegram_mesage",
+		"server.adress",
+	}
+	if !slices.Equal(cfg.UnknownKeys, expected) {
+		t.Errorf("UnknownKeys = %v, expected %v", cfg.UnknownKeys, expected)
+	}
 }
 
 func TestLoadErrorMissingConfig(t *testing.T) {
@@ -123,3 +174,85 @@ email:
 		t.Error("Expected error for invalid YAML syntax, got nil")
 	}
 }
+
+func TestLoadLogSettingsFromEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `
+server:
+  address: ":8080"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(tmpDir)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+	if cfg.Server.LogLevel != "info" || cfg.Server.LogFormat != "json" {
+		t.Errorf("Expected default log settings info/json, got %s/%s", cfg.Server.LogLevel, cfg.Server.LogFormat)
+	}
+
+	t.Setenv("AUTOMATION_SERVER_LOG_LEVEL", "debug")
+	cfg, err = Reload()
+	if err != nil {
+		t.Fatalf("Reload() returned unexpected error: %v", err)
+	}
+	if cfg.Server.LogLevel != "debug" {
+		t.Errorf("Expected log level debug from environment, got %s", cfg.Server.LogLevel)
+	}
+}
+
+func TestLoadMultipleAccounts(t *testing.T) {
+	cfg, err := loadYAML(t, `
+version: 2
+emails:
+  - name: "personal"
+    host: "imap.gmail.com"
+    shared_services: ["github"]
+    services:
+      - name: "cloudflare"
+        config:
+          email_from: ["noreply@notify.cloudflare.com"]
+  - name: "work"
+    host: "outlook.office365.com"
+    shared_services: ["github"]
+services:
+  - name: "github"
+    config:
+      email_from: ["noreply@github.com"]
+`)
+	if err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+	if len(cfg.UnknownKeys) != 0 {
+		t.Errorf("Expected no unknown keys, got %v", cfg.UnknownKeys)
+	}
+
+	accounts := cfg.Accounts()
+	if len(accounts) != 2 {
+		t.Fatalf("Accounts() returned %d accounts, expected 2", len(accounts))
+	}
+	names := func(services []ServiceConfig) []string {
+		var result []string
+		for _, service := range services {
+			result = append(result, service.Name)
+		}
+		return result
+	}
+	if accounts[0].AccountName() != "personal" || !slices.Equal(names(accounts[0].Services), []string{"cloudflare", "github"}) {
+		t.Errorf("Account 0 = %s with %v, expected personal with cloudflare and github", accounts[0].AccountName(), names(accounts[0].Services))
+	}
+	if accounts[1].Host != "outlook.office365.com" || !slices.Equal(names(accounts[1].Services), []string{"github"}) {
+		t.Errorf("Account 1 = %s with %v, expected outlook.office365.com with github", accounts[1].Host, names(accounts[1].Services))
+	}
+	// Shared services are copied, not aliased, into every account
+	if len(cfg.Emails[0].Services) != 1 {
+		t.Errorf("Accounts() modified the configured services: %v", names(cfg.Emails[0].Services))
+	}
+}
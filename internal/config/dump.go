@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Dump renders the config as YAML with the same keys as config.yaml, in field
+// order. Secrets are masked, so the output is safe to print or keep in CI logs.
+func (c *Config) Dump() ([]byte, error) {
+	node, err := dumpNode(reflect.ValueOf(*c))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func dumpNode(v reflect.Value) (*yaml.Node, error) {
+	if v.Type() == secretType {
+		return scalarNode(v.Interface().(Secret).String(), "!!str"), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		return dumpNode(v.Elem())
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if key == "" || key == "-" || !field.IsExported() {
+				continue
+			}
+			// Unset optional fields, such as enabled, are left to their default
+			if field.Type.Kind() == reflect.Pointer && v.Field(i).IsNil() {
+				continue
+			}
+			value, err := dumpNode(v.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			node.Content = append(node.Content, scalarNode(key, "!!str"), value)
+		}
+		return node, nil
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			value, err := dumpNode(v.MapIndex(key))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key.String(), err)
+			}
+			node.Content = append(node.Content, scalarNode(key.String(), "!!str"), value)
+		}
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			value, err := dumpNode(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	case reflect.String:
+		return scalarNode(v.String(), "!!str"), nil
+	case reflect.Bool:
+		return scalarNode(fmt.Sprint(v.Bool()), "!!bool"), nil
+	case reflect.Int, reflect.Int64:
+		return scalarNode(fmt.Sprint(v.Int()), "!!int"), nil
+	}
+	return nil, fmt.Errorf("unsupported config type %s", v.Type())
+}
+
+func scalarNode(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
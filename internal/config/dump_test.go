@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func TestDump(t *testing.T) {
+	cfg := validConfig()
+	cfg.Emails[0].Password = "imap-password"
+	cfg.Emails[0].Port = 993
+	cfg.Emails[0].Dedup = true
+	cfg.Telegram.ChatIDs = map[string]string{"family": "-100123"}
+	cfg.Discord.Webhooks = map[string]Secret{"codes": "https://discord.com/api/webhooks/1/s3cr3t"}
+	cfg.Hook[0].Secret = "hmac-secret"
+
+	out, err := cfg.Dump()
+	if err != nil {
+		t.Fatalf("Dump() returned unexpected error: %v", err)
+	}
+	dump := string(out)
+
+	for _, secret := range []string{"imap-password", "s3cr3t", "hmac-secret"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("Dump() leaked %q:\n%s", secret, dump)
+		}
+	}
+
+	// Keys follow config.yaml and the output reads back as YAML
+	var parsed struct {
+		Emails []struct {
+			Port     int    `yaml:"port"`
+			Password string `yaml:"password"`
+			Dedup    bool   `yaml:"dedup"`
+			Services []struct {
+				Name   string `yaml:"name"`
+				Config struct {
+					TelegramChatID string `yaml:"telegram_chat_id"`
+				} `yaml:"config"`
+			} `yaml:"services"`
+		} `yaml:"emails"`
+		Telegram struct {
+			BotToken string            `yaml:"bot_token"`
+			ChatIDs  map[string]string `yaml:"chat_ids"`
+		} `yaml:"telegram"`
+	}
+	if err := yaml.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("Dump() output is not valid YAML: %v\n%s", err, dump)
+	}
+	if len(parsed.Emails) != 1 {
+		t.Fatalf("emails = %+v, expected one account", parsed.Emails)
+	}
+	if parsed.Emails[0].Port != 993 || !parsed.Emails[0].Dedup {
+		t.Errorf("emails[0].port = %d, emails[0].dedup = %v, expected 993 and true", parsed.Emails[0].Port, parsed.Emails[0].Dedup)
+	}
+	if parsed.Emails[0].Password != redacted || parsed.Telegram.BotToken != redacted {
+		t.Errorf("Secrets dumped as %q and %q, expected %q", parsed.Emails[0].Password, parsed.Telegram.BotToken, redacted)
+	}
+	if len(parsed.Emails[0].Services) != 1 || parsed.Emails[0].Services[0].Config.TelegramChatID != "123" {
+		t.Errorf("emails[0].services = %+v, expected cloudflare with chat 123", parsed.Emails[0].Services)
+	}
+	if parsed.Telegram.ChatIDs["family"] != "-100123" {
+		t.Errorf("telegram.chat_ids = %v, expected family: -100123", parsed.Telegram.ChatIDs)
+	}
+	if !strings.HasPrefix(dump, "version: 0\nserver:\n") {
+		t.Errorf("Dump() should start with version and server like config.yaml, got:\n%s", dump)
+	}
+}
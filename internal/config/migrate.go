@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion is the config layout this build reads. Files without a
+// version are version 1, the layout before versioning was introduced.
+const CurrentVersion = 2
+
+// migrations[i] upgrades the raw settings from version i+1 to version i+2
+var migrations = []func(settings map[string]any){
+	migrateV1,
+}
+
+// migrate upgrades the raw settings read by viper to CurrentVersion in place and
+// returns the version the file was written for. Versions newer than this build
+// are rejected rather than decoded with their new fields silently ignored.
+func migrate(settings map[string]any) (int, error) {
+	version := 1
+	if raw, ok := settings["version"]; ok && raw != nil {
+		v, ok := raw.(int)
+		if !ok {
+			return 0, fmt.Errorf("version must be a number, got %v", raw)
+		}
+		version = v
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("version must be at least 1, got %d", version)
+	}
+	if version > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is newer than the supported version %d, upgrade automation-hub", version, CurrentVersion)
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		migrations[v-1](settings)
+	}
+	settings["version"] = CurrentVersion
+	return version, nil
+}
+
+// migrateV1 upgrades the original layout:
+//   - email_from as a single sender becomes a list
+//   - telegram_chat_id written as a YAML list becomes the comma-separated form
+//   - the qbittorrent message with positional %s placeholders becomes a template
+//   - the perplexity service gets the code_marker it used to have built in
+func migrateV1(settings map[string]any) {
+	email, _ := settings["email"].(map[string]any)
+	services, _ := email["services"].([]any)
+	for _, service := range services {
+		cfg := nestedMap(service, "config")
+		if cfg == nil {
+			continue
+		}
+		name, _ := service.(map[string]any)["name"].(string)
+		if _, ok := cfg["code_marker"]; !ok && strings.EqualFold(name, "perplexity") {
+			cfg["code_marker"] = []any{"directly:", "directamente:"}
+		}
+		if from, ok := cfg["email_from"].(string); ok {
+			var senders []any
+			for _, sender := range strings.Split(from, ",") {
+				if sender = strings.TrimSpace(sender); sender != "" {
+					senders = append(senders, sender)
+				}
+			}
+			cfg["email_from"] = senders
+		}
+		joinChatIDs(cfg)
+	}
+
+	hooks, _ := settings["hook"].([]any)
+	for _, hook := range hooks {
+		cfg := nestedMap(hook, "config")
+		if cfg == nil {
+			continue
+		}
+		joinChatIDs(cfg)
+		if name, _ := hook.(map[string]any)["name"].(string); name == "qbittorrent" {
+			if message, ok := cfg["telegram_message"].(string); ok {
+				cfg["telegram_message"] = torrentTemplate(message)
+			}
+		}
+	}
+}
+
+// foldSingleAccount turns the email: section, the single account form, into the
+// first entry of emails and reports whether there was one. It is not a
+// migration: both forms stay valid.
+func foldSingleAccount(settings map[string]any) bool {
+	email, ok := settings["email"]
+	delete(settings, "email")
+	if !ok || email == nil {
+		return false
+	}
+	emails, _ := settings["emails"].([]any)
+	settings["emails"] = append([]any{email}, emails...)
+	return true
+}
+
+func nestedMap(value any, key string) map[string]any {
+	m, _ := value.(map[string]any)
+	nested, _ := m[key].(map[string]any)
+	return nested
+}
+
+// joinChatIDs turns a telegram_chat_id list into "id1,id2"
+func joinChatIDs(cfg map[string]any) {
+	list, ok := cfg["telegram_chat_id"].([]any)
+	if !ok {
+		return
+	}
+	ids := make([]string, 0, len(list))
+	for _, id := range list {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	cfg["telegram_chat_id"] = strings.Join(ids, ",")
+}
+
+// torrentTemplate rewrites "%s ... %s" (name, then path) as {{.TorrentName}}
+// and {{.SavePath}}. Messages with other verbs are left to the processor's
+// legacy Sprintf path.
+func torrentTemplate(message string) string {
+	if strings.Contains(message, "{{") || strings.Count(message, "%") != 2 || strings.Count(message, "%s") != 2 {
+		return message
+	}
+	message = strings.Replace(message, "%s", "{{.TorrentName}}", 1)
+	return strings.Replace(message, "%s", "{{.SavePath}}", 1)
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// loadYAML writes content as config.yaml in a temporary directory and loads it
+func loadYAML(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(tmpDir)
+	return Load()
+}
+
+func TestLoadMigratesVersion1(t *testing.T) {
+	cfg, err := loadYAML(t, `
+server:
+  address: ":8080"
+email:
+  services:
+    - name: "cloudflare"
+      config:
+        email_from: "noreply@notify.cloudflare.com"
+        telegram_chat_id: ["123", -100456]
+    - name: "Perplexity"
+      config:
+        email_from: "team@mail.perplexity.ai"
+        telegram_chat_id: "123"
+hook:
+  - name: "qbittorrent"
+    path: "/webhook/qbittorrent"
+    config:
+      telegram_chat_id: "789"
+      telegram_message: "Downloaded %s to %s"
+`)
+	if err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+
+	if cfg.Version != CurrentVersion || cfg.MigratedFrom != 1 {
+		t.Errorf("Version = %d, MigratedFrom = %d, expected %d and 1", cfg.Version, cfg.MigratedFrom, CurrentVersion)
+	}
+	service := cfg.Emails[0].Services[0].Config
+	if !slices.Equal(service.EmailFrom, []string{"noreply@notify.cloudflare.com"}) {
+		t.Errorf("email_from = %v, expected a single sender", service.EmailFrom)
+	}
+	if service.TelegramChatID != "123,-100456" {
+		t.Errorf("telegram_chat_id = %q, expected %q", service.TelegramChatID, "123,-100456")
+	}
+	if got := cfg.Emails[0].Services[1].Config.CodeMarker; !slices.Equal(got, []string{"directly:", "directamente:"}) {
+		t.Errorf("perplexity code_marker = %v, expected the markers it used to have built in", got)
+	}
+	if got := service.CodeMarker; got != nil {
+		t.Errorf("cloudflare code_marker = %v, expected none", got)
+	}
+	if got := cfg.Hook[0].Config.TelegramMessage; got != "Downloaded {{.TorrentName}} to {{.SavePath}}" {
+		t.Errorf("qbittorrent telegram_message = %q, expected the template form", got)
+	}
+}
+
+func TestLoadCurrentVersion(t *testing.T) {
+	cfg, err := loadYAML(t, `
+version: 2
+server:
+  address: ":8080"
+hook:
+  - name: "qbittorrent"
+    config:
+      telegram_message: "Downloaded %s to %s"
+`)
+	if err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+	if cfg.Version != 2 || cfg.MigratedFrom != 0 {
+		t.Errorf("Version = %d, MigratedFrom = %d, expected 2 and 0", cfg.Version, cfg.MigratedFrom)
+	}
+	// Current files are not rewritten, %s keeps going through the legacy path
+	if got := cfg.Hook[0].Config.TelegramMessage; got != "Downloaded %s to %s" {
+		t.Errorf("telegram_message = %q, expected it unchanged", got)
+	}
+}
+
+func TestLoadUnsupportedVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+	}{
+		{"Future version", "3", "config version 3 is newer than the supported version 2"},
+		{"Zero", "0", "version must be at least 1"},
+		{"Not a number", `"two"`, "version must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, "version: "+tt.version+"\nserver:\n  address: \":8080\"\n")
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Load() error = %v, expected %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTorrentTemplate(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Done: %s at %s", "Done: {{.TorrentName}} at {{.SavePath}}"},
+		{"Done: %s", "Done: %s"},
+		{"Done: %s at %s, 100%%", "Done: %s at %s, 100%%"},
+		{"{{.TorrentName}} %s %s", "{{.TorrentName}} %s %s"},
+	}
+
+	for _, tt := range tests {
+		if got := torrentTemplate(tt.message); got != tt.expected {
+			t.Errorf("torrentTemplate(%q) = %q, expected %q", tt.message, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envPattern only matches the braced ${VAR} form so passwords containing a bare $ are left alone
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSecrets expands ${ENV_VAR} references in credential and chat fields and
+// loads *_file secrets from disk. Every missing variable or unreadable file is reported.
+func (c *Config) resolveSecrets() error {
+	var errs []error
+	expand := func(field string, value *string) {
+		expanded, err := expandEnv(*value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+		*value = expanded
+	}
+	expandService := func(prefix string, service *ServiceProcessorConfig) {
+		expand(prefix+".telegram_chat_id", &service.TelegramChatID)
+		expand(prefix+".discord_webhook", &service.DiscordWebhook)
+	}
+	fromFile := func(field string, value *string, path string) {
+		if path == "" {
+			return
+		}
+		expand(field+"_file", &path)
+		if *value != "" {
+			errs = append(errs, fmt.Errorf("set either %s or %s_file, not both", field, field))
+			return
+		}
+		secret, err := readSecretFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_file: %w", field, err))
+			return
+		}
+		*value = secret
+	}
+
+	for i := range c.Emails {
+		account := &c.Emails[i]
+		prefix := "email"
+		if len(c.Emails) > 1 {
+			prefix = fmt.Sprintf("emails[%d]", i)
+		}
+		expand(prefix+".host", &account.Host)
+		expand(prefix+".username", &account.Username)
+		expand(prefix+".password", (*string)(&account.Password))
+		fromFile(prefix+".password", (*string)(&account.Password), account.PasswordFile)
+		for j := range account.Services {
+			expandService(fmt.Sprintf("%s.services[%d]", prefix, j), &account.Services[j].Config)
+		}
+	}
+	for i := range c.Services {
+		expandService(fmt.Sprintf("services[%d]", i), &c.Services[i].Config)
+	}
+
+	expand("server.admin_token", (*string)(&c.Server.AdminToken))
+	fromFile("server.admin_token", (*string)(&c.Server.AdminToken), c.Server.AdminTokenFile)
+	expand("telegram.bot_token", (*string)(&c.Telegram.BotToken))
+	fromFile("telegram.bot_token", (*string)(&c.Telegram.BotToken), c.Telegram.BotTokenFile)
+	for alias, id := range c.Telegram.ChatIDs {
+		expand("telegram.chat_ids."+alias, &id)
+		c.Telegram.ChatIDs[alias] = id
+	}
+	for alias, url := range c.Discord.Webhooks {
+		expand("discord.webhooks."+alias, (*string)(&url))
+		c.Discord.Webhooks[alias] = url
+	}
+	expand("gotify.url", &c.Gotify.URL)
+	expand("gotify.token", (*string)(&c.Gotify.Token))
+	fromFile("gotify.token", (*string)(&c.Gotify.Token), c.Gotify.TokenFile)
+	for alias, webhook := range c.NotifyWebhooks {
+		expand("notify_webhooks."+alias+".url", (*string)(&webhook.URL))
+		for name, value := range webhook.Headers {
+			expand("notify_webhooks."+alias+".headers."+name, (*string)(&value))
+			webhook.Headers[name] = value
+		}
+		c.NotifyWebhooks[alias] = webhook
+	}
+
+	for i := range c.Hook {
+		hook := &c.Hook[i]
+		field := fmt.Sprintf("hook[%d].secret", i)
+		expand(field, (*string)(&hook.Secret))
+		fromFile(field, (*string)(&hook.Secret), hook.SecretFile)
+		field = fmt.Sprintf("hook[%d].auth_token", i)
+		expand(field, (*string)(&hook.AuthToken))
+		fromFile(field, (*string)(&hook.AuthToken), hook.AuthTokenFile)
+		expand(fmt.Sprintf("hook[%d].telegram_chat_id", i), &hook.Config.TelegramChatID)
+	}
+
+	return errors.Join(errs...)
+}
+
+func expandEnv(s string) (string, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return expanded, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// readSecretFile reads a secret such as a Docker secret, dropping the trailing newline
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("AH_TEST_USER", "alice")
+	t.Setenv("AH_TEST_EMPTY", "")
+
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"plain", "plain", false},
+		{"${AH_TEST_USER}@example.com", "alice@example.com", false},
+		{"${AH_TEST_EMPTY}", "", false},
+		{"pa$$word$AH_TEST_USER", "pa$$word$AH_TEST_USER", false},
+		{"${AH_TEST_MISSING}", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := expandEnv(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandEnv(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("expandEnv(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "imap")
+	if err := os.WriteFile(secretPath, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("AH_TEST_TOKEN", "bot-token")
+	t.Setenv("AH_TEST_SECRET_DIR", dir)
+
+	t.Run("Env vars and secret files", func(t *testing.T) {
+		cfg := &Config{
+			Emails:   []EmailConfig{{PasswordFile: "${AH_TEST_SECRET_DIR}/imap"}},
+			Telegram: TelegramConfig{BotToken: "${AH_TEST_TOKEN}", ChatIDs: map[string]string{"family": "123"}},
+			Hook:     []WebhookConfig{{Name: "sonarr", SecretFile: secretPath, AuthToken: "${AH_TEST_TOKEN}"}},
+		}
+		if err := cfg.resolveSecrets(); err != nil {
+			t.Fatalf("resolveSecrets() returned unexpected error: %v", err)
+		}
+		if cfg.Emails[0].Password != "s3cret" {
+			t.Errorf("Emails[0].Password = %q, expected %q", cfg.Emails[0].Password, "s3cret")
+		}
+		if cfg.Telegram.BotToken != "bot-token" {
+			t.Errorf("Telegram.BotToken = %q, expected %q", cfg.Telegram.BotToken, "bot-token")
+		}
+		if cfg.Hook[0].Secret != "s3cret" {
+			t.Errorf("Hook[0].Secret = %q, expected %q", cfg.Hook[0].Secret, "s3cret")
+		}
+		if cfg.Hook[0].AuthToken != "bot-token" {
+			t.Errorf("Hook[0].AuthToken = %q, expected %q", cfg.Hook[0].AuthToken, "bot-token")
+		}
+	})
+
+	t.Run("Problems are reported together", func(t *testing.T) {
+		cfg := &Config{
+			Emails:   []EmailConfig{{Password: "inline", PasswordFile: secretPath}},
+			Telegram: TelegramConfig{BotTokenFile: filepath.Join(dir, "missing")},
+			Hook:     []WebhookConfig{{Config: WebhookProcessorConfig{TelegramChatID: "${AH_TEST_MISSING_CHAT}"}}},
+		}
+		err := cfg.resolveSecrets()
+		if err == nil {
+			t.Fatal("resolveSecrets() = nil, expected error")
+		}
+		for _, want := range []string{
+			"set either email.password or email.password_file",
+			"telegram.bot_token_file",
+			"AH_TEST_MISSING_CHAT is not set",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("resolveSecrets() = %q, expected it to contain %q", err, want)
+			}
+		}
+	})
+}
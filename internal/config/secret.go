@@ -0,0 +1,22 @@
+package config
+
+// Secret holds a credential such as the IMAP password or the bot token. It prints
+// and marshals as a placeholder so it never ends up in logs; use string(s) to read it.
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
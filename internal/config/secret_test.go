@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretIsRedacted(t *testing.T) {
+	cfg := EmailConfig{Username: "user", Password: "hunter2"}
+
+	jsonData, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"String", cfg.Password.String()},
+		{"Sprintf %v", fmt.Sprintf("%v", cfg)},
+		{"Sprintf %+v", fmt.Sprintf("%+v", cfg)},
+		{"Sprintf %#v", fmt.Sprintf("%#v", cfg)},
+		{"JSON", string(jsonData)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.output, "hunter2") {
+				t.Errorf("%s leaked the secret: %s", tt.name, tt.output)
+			}
+		})
+	}
+
+	if got := string(cfg.Password); got != "hunter2" {
+		t.Errorf("string(Secret) = %q, expected the raw value", got)
+	}
+	if got := Secret("").String(); got != "" {
+		t.Errorf("Secret(\"\").String() = %q, expected empty", got)
+	}
+}
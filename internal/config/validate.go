@@ -0,0 +1,304 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Validate checks the required settings and returns every problem found joined
+// into a single error, so all of them can be fixed in one go
+func (c *Config) Validate() error {
+	var errs []error
+	missing := func(field string) {
+		errs = append(errs, fmt.Errorf("%s is required", field))
+	}
+
+	if c.Server.Address == "" {
+		missing("server.address")
+	}
+	if c.Telegram.BotToken == "" {
+		missing("telegram.bot_token")
+	}
+	if c.Telegram.BreakerThreshold < -1 {
+		errs = append(errs, fmt.Errorf("telegram.breaker_threshold must be -1 (disabled), 0 (default) or positive, got %d", c.Telegram.BreakerThreshold))
+	}
+	if c.Telegram.BreakerCooldownSeconds < 0 {
+		errs = append(errs, fmt.Errorf("telegram.breaker_cooldown_seconds must not be negative"))
+	}
+	for i, origin := range c.Server.CORSAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		// Browsers send the origin as scheme://host[:port], without a path
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			errs = append(errs, fmt.Errorf("server.cors_allowed_origins[%d] must be \"*\" or an origin like https://dashboard.example.com, got %q", i, origin))
+		}
+	}
+	for _, timeout := range []struct {
+		field   string
+		seconds int
+	}{
+		{"read", c.Server.Timeouts.Read},
+		{"write", c.Server.Timeouts.Write},
+		{"idle", c.Server.Timeouts.Idle},
+		{"read_header", c.Server.Timeouts.ReadHeader},
+	} {
+		if timeout.seconds < 0 {
+			errs = append(errs, fmt.Errorf("server.timeouts.%s must not be negative", timeout.field))
+		}
+	}
+	switch {
+	case c.Server.TLS.CertFile == "" && c.Server.TLS.KeyFile != "":
+		missing("server.tls.cert_file")
+	case c.Server.TLS.CertFile != "" && c.Server.TLS.KeyFile == "":
+		missing("server.tls.key_file")
+	case c.Server.TLS.CertFile != "":
+		if _, err := tls.LoadX509KeyPair(c.Server.TLS.CertFile, c.Server.TLS.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("server.tls: %w", err))
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes must not be negative"))
+	}
+	if c.Server.RecentEvents < 0 {
+		errs = append(errs, fmt.Errorf("server.recent_events must not be negative"))
+	}
+	if !c.Server.IsEnabled() && c.Server.AdminToken != "" {
+		errs = append(errs, fmt.Errorf("server.admin_token needs the HTTP server, remove server.enabled: false or the token"))
+	}
+
+	usesGotify := false
+	// checkServices validates a services list, field being its key
+	checkServices := func(field string, services []ServiceConfig) {
+		for i, service := range services {
+			prefix := fmt.Sprintf("%s[%d]", field, i)
+			if service.Name == "" {
+				missing(prefix + ".name")
+			} else {
+				prefix = fmt.Sprintf("%s (%s)", prefix, service.Name)
+			}
+			// Disabled services may be left incomplete until they are turned back on
+			if !service.IsEnabled() {
+				continue
+			}
+
+			if len(service.Config.EmailFrom) == 0 {
+				missing(prefix + ".email_from")
+			}
+			switch service.Config.FromMatch {
+			case "", FromMatchContains, FromMatchExact, FromMatchDomain:
+			default:
+				errs = append(errs, fmt.Errorf("%s.from_match must be %q, %q or %q, got %q",
+					prefix, FromMatchContains, FromMatchExact, FromMatchDomain, service.Config.FromMatch))
+			}
+			if len(service.Config.EmailSubject) == 0 {
+				missing(prefix + ".email_subject")
+			}
+			switch service.Config.Notifier {
+			case "", NotifierTelegram:
+				if service.Config.TelegramChatID == "" {
+					missing(prefix + ".telegram_chat_id")
+				}
+			case NotifierDiscord:
+				if service.Config.DiscordWebhook == "" {
+					missing(prefix + ".discord_webhook")
+				}
+			case NotifierWebhook:
+				if service.Config.NotifyWebhook == "" {
+					missing(prefix + ".notify_webhook")
+				} else if _, ok := c.NotifyWebhooks[service.Config.NotifyWebhook]; !ok {
+					errs = append(errs, fmt.Errorf("%s.notify_webhook: unknown alias %q in notify_webhooks",
+						prefix, service.Config.NotifyWebhook))
+				}
+			case NotifierGotify:
+				usesGotify = true
+			default:
+				errs = append(errs, fmt.Errorf("%s.notifier must be %q, %q, %q or %q, got %q",
+					prefix, NotifierTelegram, NotifierDiscord, NotifierWebhook, NotifierGotify, service.Config.Notifier))
+			}
+			if priority := service.Config.GotifyPriority; priority != nil && (*priority < 0 || *priority > 10) {
+				errs = append(errs, fmt.Errorf("%s.gotify_priority must be between 0 and 10, got %d", prefix, *priority))
+			}
+			switch service.Config.SubjectMatch {
+			case "", SubjectMatchContains:
+			case SubjectMatchRegex:
+				for j, subject := range service.Config.EmailSubject {
+					if _, err := regexp.Compile(subject); err != nil {
+						errs = append(errs, fmt.Errorf("%s.email_subject[%d] is not a valid regex: %w", prefix, j, err))
+					}
+				}
+			default:
+				errs = append(errs, fmt.Errorf("%s.subject_match must be %q or %q, got %q",
+					prefix, SubjectMatchContains, SubjectMatchRegex, service.Config.SubjectMatch))
+			}
+			if service.Config.CodePattern != "" {
+				if _, err := regexp.Compile(service.Config.CodePattern); err != nil {
+					errs = append(errs, fmt.Errorf("%s.code_pattern is not a valid regex: %w", prefix, err))
+				}
+			}
+			if service.Config.BodyRegex != "" {
+				if _, err := regexp.Compile(service.Config.BodyRegex); err != nil {
+					errs = append(errs, fmt.Errorf("%s.body_regex is not a valid regex: %w", prefix, err))
+				}
+			}
+			if service.Config.MaxAgeMinutes < 0 {
+				errs = append(errs, fmt.Errorf("%s.max_age_minutes must not be negative", prefix))
+			}
+			if service.Config.CooldownSeconds < 0 {
+				errs = append(errs, fmt.Errorf("%s.cooldown_seconds must not be negative", prefix))
+			}
+			for j, pattern := range service.Config.ForwardAttachments {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, fmt.Errorf("%s.forward_attachments[%d] is not a valid MIME type pattern: %w", prefix, j, err))
+				}
+			}
+		}
+	}
+
+	accounts := make(map[string]bool, len(c.Emails))
+	stateFiles := make(map[string]bool, len(c.Emails))
+	for i, account := range c.Emails {
+		// A single account reads as the email: section it is usually written as
+		prefix := "email"
+		if len(c.Emails) > 1 {
+			prefix = fmt.Sprintf("emails[%d] (%s)", i, account.AccountName())
+			if accounts[account.AccountName()] {
+				errs = append(errs, fmt.Errorf("%s: account name %q is used more than once, set name", prefix, account.AccountName()))
+			}
+			accounts[account.AccountName()] = true
+			if account.StateFile != "" {
+				if stateFiles[account.StateFile] {
+					errs = append(errs, fmt.Errorf("%s.state_file %q is shared with another account", prefix, account.StateFile))
+				}
+				stateFiles[account.StateFile] = true
+			}
+		}
+
+		switch account.TLSMode {
+		case "", TLSModeTLS, TLSModeStartTLS:
+		case TLSModeNone:
+			if !account.AllowInsecure {
+				errs = append(errs, fmt.Errorf("%s.tls_mode %q sends the IMAP password in the clear, set %s.allow_insecure to confirm", prefix, TLSModeNone, prefix))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s.tls_mode must be %q, %q or %q, got %q",
+				prefix, TLSModeTLS, TLSModeStartTLS, TLSModeNone, account.TLSMode))
+		}
+
+		if account.PollingJitter < 0 || account.PollingJitter > 50 {
+			errs = append(errs, fmt.Errorf("%s.polling_jitter must be between 0 and 50 (percent), got %d", prefix, account.PollingJitter))
+		}
+		if account.DialTimeout < 0 {
+			errs = append(errs, fmt.Errorf("%s.dial_timeout must not be negative", prefix))
+		}
+		if account.CommandTimeout < 0 {
+			errs = append(errs, fmt.Errorf("%s.command_timeout must not be negative", prefix))
+		}
+		if account.MaxPerCycle < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_per_cycle must not be negative", prefix))
+		}
+		if account.MaxConcurrency < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_concurrency must not be negative", prefix))
+		}
+		if account.MaxAttempts < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_attempts must not be negative", prefix))
+		}
+		if account.DeadLetter != "" && account.MaxAttempts == 0 {
+			errs = append(errs, fmt.Errorf("%s.dead_letter requires %s.max_attempts, emails are retried forever without it", prefix, prefix))
+		}
+		if account.ReadOnly && account.MoveToFolder != "" {
+			errs = append(errs, fmt.Errorf("%s.read_only cannot be combined with %s.move_to_folder", prefix, prefix))
+		}
+		if account.ReadOnly && account.MaxAttempts > 0 {
+			errs = append(errs, fmt.Errorf("%s.read_only cannot be combined with %s.max_attempts, given-up emails are marked as read", prefix, prefix))
+		}
+		if account.Fallback.TelegramMessage != "" && !account.Fallback.Enabled() {
+			missing(prefix + ".fallback.telegram_chat_id")
+		}
+
+		folders := make(map[string]bool, len(account.Folders))
+		for j, folder := range account.Folders {
+			field := fmt.Sprintf("%s.folders[%d]", prefix, j)
+			if folder.Name == "" {
+				missing(field + ".name")
+			} else if folders[folder.Name] {
+				errs = append(errs, fmt.Errorf("%s: folder %q is listed more than once", field, folder.Name))
+			}
+			folders[folder.Name] = true
+			if folder.PollingInterval < 0 {
+				errs = append(errs, fmt.Errorf("%s.polling_interval must not be negative", field))
+			}
+		}
+
+		if account.TLS.CAFile != "" {
+			if _, err := LoadCertPool(account.TLS.CAFile); err != nil {
+				errs = append(errs, fmt.Errorf("%s.tls.ca_file: %w", prefix, err))
+			}
+		}
+
+		checkServices(prefix+".services", account.Services)
+		for _, name := range account.SharedServices {
+			if !slices.ContainsFunc(c.Services, func(service ServiceConfig) bool { return service.Name == name }) {
+				errs = append(errs, fmt.Errorf("%s.shared_services: unknown service %q in services", prefix, name))
+			}
+		}
+	}
+	checkServices("services", c.Services)
+
+	if usesGotify || c.Gotify.URL != "" {
+		if c.Gotify.URL == "" {
+			missing("gotify.url")
+		} else if u, err := url.Parse(c.Gotify.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("gotify.url must be an http:// or https:// URL"))
+		}
+		if c.Gotify.Token == "" {
+			missing("gotify.token")
+		}
+	}
+
+	for alias, webhook := range c.NotifyWebhooks {
+		prefix := "notify_webhooks." + alias
+		if webhook.URL == "" {
+			missing(prefix + ".url")
+		} else if u, err := url.Parse(string(webhook.URL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.url must be an http:// or https:// URL", prefix))
+		}
+		switch strings.ToUpper(webhook.Method) {
+		case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			errs = append(errs, fmt.Errorf("%s.method must be %q, %q or %q, got %q",
+				prefix, http.MethodPost, http.MethodPut, http.MethodPatch, webhook.Method))
+		}
+	}
+
+	for i, hook := range c.Hook {
+		prefix := fmt.Sprintf("hook[%d]", i)
+		if hook.Name == "" {
+			missing(prefix + ".name")
+		} else {
+			prefix = fmt.Sprintf("%s (%s)", prefix, hook.Name)
+		}
+		if !hook.IsEnabled() {
+			continue
+		}
+		if !c.Server.IsEnabled() {
+			errs = append(errs, fmt.Errorf("%s needs the HTTP server, remove server.enabled: false or disable the hook", prefix))
+		}
+
+		if hook.Path == "" {
+			missing(prefix + ".path")
+		}
+		if hook.Config.TelegramChatID == "" {
+			missing(prefix + ".telegram_chat_id")
+		}
+	}
+
+	return errors.Join(errs...)
+}
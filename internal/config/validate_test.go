@@ -0,0 +1,457 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	return &Config{
+		Server:   ServerConfig{Address: ":8080"},
+		Telegram: TelegramConfig{BotToken: "token"},
+		Emails: []EmailConfig{{
+			Services: []ServiceConfig{{
+				Name: "cloudflare",
+				Config: ServiceProcessorConfig{
+					EmailFrom:      []string{"noreply@notify.cloudflare.com"},
+					EmailSubject:   []string{"Code"},
+					TelegramChatID: "123",
+					CodePattern:    `\b\d{6}\b`,
+				},
+			}},
+		}},
+		Hook: []WebhookConfig{{
+			Name:   "qbittorrent",
+			Path:   "/webhook/qbittorrent",
+			Config: WebhookProcessorConfig{TelegramChatID: "123"},
+		}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(c *Config)
+		expected []string
+	}{
+		{
+			name:   "Valid config",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "Missing top-level fields",
+			modify: func(c *Config) {
+				c.Server.Address = ""
+				c.Telegram.BotToken = ""
+			},
+			expected: []string{"server.address is required", "telegram.bot_token is required"},
+		},
+		{
+			name: "Invalid Telegram circuit breaker",
+			modify: func(c *Config) {
+				c.Telegram.BreakerThreshold = -2
+				c.Telegram.BreakerCooldownSeconds = -1
+			},
+			expected: []string{
+				"telegram.breaker_threshold must be -1 (disabled), 0 (default) or positive, got -2",
+				"telegram.breaker_cooldown_seconds must not be negative",
+			},
+		},
+		{
+			name: "Negative server timeouts",
+			modify: func(c *Config) {
+				c.Server.Timeouts = ServerTimeouts{Read: -1, Idle: -1}
+				c.Server.MaxHeaderBytes = -1
+			},
+			expected: []string{
+				"server.timeouts.read must not be negative",
+				"server.timeouts.idle must not be negative",
+				"server.max_header_bytes must not be negative",
+			},
+		},
+		{
+			name: "Server TLS without a key",
+			modify: func(c *Config) {
+				c.Server.TLS.CertFile = "/etc/automation-hub/cert.pem"
+			},
+			expected: []string{"server.tls.key_file is required"},
+		},
+		{
+			name: "Unreadable server TLS files",
+			modify: func(c *Config) {
+				c.Server.TLS = ServerTLSConfig{CertFile: "/nonexistent/cert.pem", KeyFile: "/nonexistent/key.pem"}
+			},
+			expected: []string{"server.tls: open /nonexistent/cert.pem"},
+		},
+		{
+			name: "Invalid CORS origins",
+			modify: func(c *Config) {
+				c.Server.CORSAllowedOrigins = []string{"*", "https://dashboard.example.com", "dashboard.example.com", "https://dashboard.example.com/"}
+			},
+			expected: []string{
+				`server.cors_allowed_origins[2] must be "*" or an origin like https://dashboard.example.com, got "dashboard.example.com"`,
+				`server.cors_allowed_origins[3] must be "*" or an origin like https://dashboard.example.com, got "https://dashboard.example.com/"`,
+			},
+		},
+		{
+			name: "Incomplete service",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config = ServiceProcessorConfig{CodePattern: "(["}
+			},
+			expected: []string{
+				"email.services[0] (cloudflare).email_from is required",
+				"email.services[0] (cloudflare).email_subject is required",
+				"email.services[0] (cloudflare).telegram_chat_id is required",
+				"email.services[0] (cloudflare).code_pattern is not a valid regex",
+			},
+		},
+		{
+			name: "Disabled entries are not validated",
+			modify: func(c *Config) {
+				disabled := false
+				c.Emails[0].Services[0].Enabled = &disabled
+				c.Emails[0].Services[0].Config = ServiceProcessorConfig{CodePattern: "(["}
+				c.Hook[0].Enabled = &disabled
+				c.Hook[0].Path = ""
+			},
+		},
+		{
+			name: "Invalid body regex",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.BodyRegex = "(["
+			},
+			expected: []string{
+				"email.services[0] (cloudflare).body_regex is not a valid regex",
+			},
+		},
+		{
+			name: "Invalid attachment pattern",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.ForwardAttachments = []string{"image/*", "image/["}
+			},
+			expected: []string{
+				"email.services[0] (cloudflare).forward_attachments[1] is not a valid MIME type pattern",
+			},
+		},
+		{
+			name: "Regex subjects",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.SubjectMatch = SubjectMatchRegex
+				c.Emails[0].Services[0].Config.EmailSubject = []string{`^Code \d+$`, "(["}
+			},
+			expected: []string{"email.services[0] (cloudflare).email_subject[1] is not a valid regex"},
+		},
+		{
+			name: "Negative max age",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.MaxAgeMinutes = -1
+			},
+			expected: []string{"email.services[0] (cloudflare).max_age_minutes must not be negative"},
+		},
+		{
+			name: "Negative cooldown",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.CooldownSeconds = -1
+			},
+			expected: []string{"email.services[0] (cloudflare).cooldown_seconds must not be negative"},
+		},
+		{
+			name: "Unknown from match mode",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.FromMatch = "regex"
+			},
+			expected: []string{`from_match must be "contains", "exact" or "domain", got "regex"`},
+		},
+		{
+			name: "Unknown subject match mode",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.SubjectMatch = "glob"
+			},
+			expected: []string{`subject_match must be "contains" or "regex", got "glob"`},
+		},
+		{
+			name: "STARTTLS",
+			modify: func(c *Config) {
+				c.Emails[0].TLSMode = TLSModeStartTLS
+			},
+		},
+		{
+			name: "Plaintext IMAP without acknowledgement",
+			modify: func(c *Config) {
+				c.Emails[0].TLSMode = TLSModeNone
+			},
+			expected: []string{`email.tls_mode "none" sends the IMAP password in the clear, set email.allow_insecure to confirm`},
+		},
+		{
+			name: "Plaintext IMAP acknowledged",
+			modify: func(c *Config) {
+				c.Emails[0].TLSMode = TLSModeNone
+				c.Emails[0].AllowInsecure = true
+			},
+		},
+		{
+			name: "Polling jitter out of range",
+			modify: func(c *Config) {
+				c.Emails[0].PollingJitter = 80
+			},
+			expected: []string{"email.polling_jitter must be between 0 and 50 (percent), got 80"},
+		},
+		{
+			name: "Negative IMAP timeouts",
+			modify: func(c *Config) {
+				c.Emails[0].DialTimeout = -1
+				c.Emails[0].CommandTimeout = -5
+			},
+			expected: []string{"email.dial_timeout must not be negative", "email.command_timeout must not be negative"},
+		},
+		{
+			name: "Negative recent events",
+			modify: func(c *Config) {
+				c.Server.RecentEvents = -1
+			},
+			expected: []string{"server.recent_events must not be negative"},
+		},
+		{
+			name: "Server disabled with webhooks and admin endpoints",
+			modify: func(c *Config) {
+				disabled := false
+				c.Server.Enabled = &disabled
+				c.Server.AdminToken = "secret"
+			},
+			expected: []string{
+				"hook[0] (qbittorrent) needs the HTTP server",
+				"server.admin_token needs the HTTP server",
+			},
+		},
+		{
+			name: "Server disabled without webhooks",
+			modify: func(c *Config) {
+				disabled := false
+				c.Server.Enabled = &disabled
+				c.Hook[0].Enabled = &disabled
+			},
+		},
+		{
+			name: "Negative max per cycle",
+			modify: func(c *Config) {
+				c.Emails[0].MaxPerCycle = -1
+			},
+			expected: []string{"email.max_per_cycle must not be negative"},
+		},
+		{
+			name: "Dead letter",
+			modify: func(c *Config) {
+				c.Emails[0].MaxAttempts = 5
+				c.Emails[0].DeadLetter = "/app/data/dead-letter.log"
+			},
+		},
+		{
+			name: "Dead letter without max attempts",
+			modify: func(c *Config) {
+				c.Emails[0].DeadLetter = "/app/data/dead-letter.log"
+			},
+			expected: []string{"email.dead_letter requires email.max_attempts"},
+		},
+		{
+			name: "Fallback",
+			modify: func(c *Config) {
+				c.Emails[0].Fallback = FallbackConfig{TelegramChatID: "999", TelegramMessage: "{{.From}}: {{.Subject}}"}
+			},
+		},
+		{
+			name: "Fallback message without chat ID",
+			modify: func(c *Config) {
+				c.Emails[0].Fallback.TelegramMessage = "{{.From}}: {{.Subject}}"
+			},
+			expected: []string{"email.fallback.telegram_chat_id"},
+		},
+		{
+			name: "Read only with writes",
+			modify: func(c *Config) {
+				c.Emails[0].ReadOnly = true
+				c.Emails[0].MoveToFolder = "Processed"
+				c.Emails[0].MaxAttempts = 5
+			},
+			expected: []string{
+				"email.read_only cannot be combined with email.move_to_folder",
+				"email.read_only cannot be combined with email.max_attempts",
+			},
+		},
+		{
+			name: "Negative max concurrency",
+			modify: func(c *Config) {
+				c.Emails[0].MaxConcurrency = -1
+			},
+			expected: []string{"email.max_concurrency must not be negative"},
+		},
+		{
+			name: "Negative max attempts",
+			modify: func(c *Config) {
+				c.Emails[0].MaxAttempts = -1
+			},
+			expected: []string{"email.max_attempts must not be negative"},
+		},
+		{
+			name: "Folders",
+			modify: func(c *Config) {
+				c.Emails[0].Folders = []FolderConfig{{Name: "INBOX", PollingInterval: 10}, {Name: "Newsletters"}}
+			},
+		},
+		{
+			name: "Invalid folders",
+			modify: func(c *Config) {
+				c.Emails[0].Folders = []FolderConfig{{Name: "INBOX"}, {Name: "INBOX", PollingInterval: -1}, {}}
+			},
+			expected: []string{
+				`email.folders[1]: folder "INBOX" is listed more than once`,
+				"email.folders[1].polling_interval must not be negative",
+				"email.folders[2].name is required",
+			},
+		},
+		{
+			name: "Unreadable CA file",
+			modify: func(c *Config) {
+				c.Emails[0].TLS.CAFile = "/nonexistent/ca.pem"
+			},
+			expected: []string{"email.tls.ca_file: open /nonexistent/ca.pem"},
+		},
+		{
+			name: "Unknown TLS mode",
+			modify: func(c *Config) {
+				c.Emails[0].TLSMode = "ssl"
+			},
+			expected: []string{`email.tls_mode must be "tls", "starttls" or "none", got "ssl"`},
+		},
+		{
+			name: "Discord service without webhook",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.Notifier = NotifierDiscord
+				c.Emails[0].Services[0].Config.TelegramChatID = ""
+			},
+			expected: []string{"email.services[0] (cloudflare).discord_webhook is required"},
+		},
+		{
+			name: "Discord service",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.Notifier = NotifierDiscord
+				c.Emails[0].Services[0].Config.TelegramChatID = ""
+				c.Emails[0].Services[0].Config.DiscordWebhook = "codes"
+			},
+		},
+		{
+			name: "Unknown notifier",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.Notifier = "slack"
+			},
+			expected: []string{`notifier must be "telegram", "discord", "webhook" or "gotify", got "slack"`},
+		},
+		{
+			name: "Gotify service",
+			modify: func(c *Config) {
+				priority := 8
+				c.Gotify = GotifyConfig{URL: "https://push.example.com", Token: "AbCdEf"}
+				c.Emails[0].Services[0].Config.Notifier = NotifierGotify
+				c.Emails[0].Services[0].Config.TelegramChatID = ""
+				c.Emails[0].Services[0].Config.GotifyPriority = &priority
+			},
+		},
+		{
+			name: "Gotify service without server",
+			modify: func(c *Config) {
+				priority := 11
+				c.Emails[0].Services[0].Config.Notifier = NotifierGotify
+				c.Emails[0].Services[0].Config.GotifyPriority = &priority
+			},
+			expected: []string{
+				"email.services[0] (cloudflare).gotify_priority must be between 0 and 10, got 11",
+				"gotify.url is required",
+				"gotify.token is required",
+			},
+		},
+		{
+			name: "Invalid Gotify URL",
+			modify: func(c *Config) {
+				c.Gotify = GotifyConfig{URL: "push.example.com", Token: "AbCdEf"}
+			},
+			expected: []string{"gotify.url must be an http:// or https:// URL"},
+		},
+		{
+			name: "Webhook service",
+			modify: func(c *Config) {
+				c.NotifyWebhooks = map[string]NotifyWebhookConfig{"dashboard": {URL: "https://dash.local/codes"}}
+				c.Emails[0].Services[0].Config.Notifier = NotifierWebhook
+				c.Emails[0].Services[0].Config.TelegramChatID = ""
+				c.Emails[0].Services[0].Config.NotifyWebhook = "dashboard"
+			},
+		},
+		{
+			name: "Webhook service with unknown alias",
+			modify: func(c *Config) {
+				c.Emails[0].Services[0].Config.Notifier = NotifierWebhook
+				c.Emails[0].Services[0].Config.NotifyWebhook = "dashboard"
+			},
+			expected: []string{`email.services[0] (cloudflare).notify_webhook: unknown alias "dashboard"`},
+		},
+		{
+			name: "Invalid notify webhook",
+			modify: func(c *Config) {
+				c.NotifyWebhooks = map[string]NotifyWebhookConfig{
+					"dashboard": {URL: "dash.local/codes", Method: "GET"},
+					"empty":     {},
+				}
+			},
+			expected: []string{
+				"notify_webhooks.dashboard.url must be an http:// or https:// URL",
+				`notify_webhooks.dashboard.method must be "POST", "PUT" or "PATCH", got "GET"`,
+				"notify_webhooks.empty.url is required",
+			},
+		},
+		{
+			name: "Multiple accounts",
+			modify: func(c *Config) {
+				c.Emails[0].Name = "personal"
+				c.Emails[0].StateFile = "/data/state.json"
+				c.Emails[0].SharedServices = []string{"github", "gitlab"}
+				c.Emails = append(c.Emails, EmailConfig{Name: "personal", StateFile: "/data/state.json", PollingJitter: 60})
+				c.Services = []ServiceConfig{{Name: "github"}}
+			},
+			expected: []string{
+				`emails[1] (personal): account name "personal" is used more than once, set name`,
+				`emails[1] (personal).state_file "/data/state.json" is shared with another account`,
+				"emails[1] (personal).polling_jitter must be between 0 and 50 (percent), got 60",
+				`emails[0] (personal).shared_services: unknown service "gitlab" in services`,
+				"services[0] (github).email_from is required",
+			},
+		},
+		{
+			name: "Incomplete webhook",
+			modify: func(c *Config) {
+				c.Hook[0] = WebhookConfig{}
+			},
+			expected: []string{"hook[0].name is required", "hook[0].path is required", "hook[0].telegram_chat_id is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if len(tt.expected) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Validate() = nil, expected error")
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %q, expected it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/processor"
+	"automation-hub/internal/services/telegram"
+)
+
+// Poller triggers an immediate mailbox check
+type Poller interface {
+	CheckOnce(ctx context.Context) (found, processed int, err error)
+}
+
+// TelegramSender sends a message to a chat ID, alias or comma-separated list
+type TelegramSender interface {
+	Send(ctx context.Context, req telegram.SendRequest) ([]telegram.SendResult, error)
+}
+
+// ProcessorLister describes the loaded email processors, see processor.Manager
+type ProcessorLister interface {
+	Describe() []processor.Info
+}
+
+// EventLister returns the last processed emails, see processor.Recent
+type EventLister interface {
+	Events() []processor.Event
+}
+
+// TelegramTestMessage is sent by POST /admin/telegram-test
+const TelegramTestMessage = "automation-hub test"
+
+// AdminHandler serves maintenance endpoints protected by server.admin_token
+type AdminHandler struct {
+	poller     Poller
+	telegram   TelegramSender
+	processors ProcessorLister
+	recent     EventLister
+	token      config.Secret
+	logger     *zap.Logger
+}
+
+type pollResponse struct {
+	Status    string `json:"status"`
+	Found     int    `json:"found"`
+	Processed int    `json:"processed"`
+}
+
+type processorsResponse struct {
+	Processors []processor.Info `json:"processors"`
+}
+
+type recentResponse struct {
+	Events []processor.Event `json:"events"`
+}
+
+type capabilitiesResponse struct {
+	Capabilities []string            `json:"capabilities"`
+	Accounts     map[string][]string `json:"accounts,omitempty"`
+}
+
+type telegramTestRequest struct {
+	ChatID string `json:"chat_id"`
+}
+
+type telegramTestResponse struct {
+	Status   string                `json:"status"`
+	Messages []telegram.SendResult `json:"messages"`
+}
+
+func NewAdminHandler(poller Poller, telegram TelegramSender, processors ProcessorLister, recent EventLister, token config.Secret, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{
+		poller:     poller,
+		telegram:   telegram,
+		processors: processors,
+		recent:     recent,
+		token:      token,
+		logger:     logger,
+	}
+}
+
+// RequireToken rejects requests without "Authorization: Bearer <admin_token>".
+// Without a token configured every request is rejected.
+func (h *AdminHandler) RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.token == "" || !validBearerToken(string(h.token), r.Header.Get("Authorization")) {
+			h.logger.Warn("Rejected admin request with missing or invalid token",
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// HandlePoll checks the mailbox once and reports how many unread emails were
+// found and processed
+func (h *AdminHandler) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	found, processed, err := h.poller.CheckOnce(r.Context())
+	if err != nil {
+		h.logger.Error("Manual mailbox check failed", zap.Error(err))
+		writeJSONError(w, http.StatusBadGateway, "mailbox check failed: "+err.Error())
+		return
+	}
+
+	h.logger.Info("Manual mailbox check completed",
+		zap.Int("found", found),
+		zap.Int("processed", processed))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(pollResponse{Status: "success", Found: found, Processed: processed}); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleTelegramTest sends TelegramTestMessage to the chat ID or alias in the
+// {"chat_id": "..."} body, reporting Telegram errors such as a wrong token or
+// unknown chat in the response
+func (h *AdminHandler) HandleTelegramTest(w http.ResponseWriter, r *http.Request) {
+	var req telegramTestRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON payload: %v", err))
+		return
+	}
+	if strings.TrimSpace(req.ChatID) == "" {
+		writeJSONError(w, http.StatusBadRequest, "chat_id is required")
+		return
+	}
+
+	results, err := h.telegram.Send(r.Context(), telegram.SendRequest{ChatID: req.ChatID, Text: TelegramTestMessage})
+	if err != nil {
+		h.logger.Warn("Telegram test message failed",
+			zap.String("chat_id", req.ChatID),
+			zap.Error(err))
+		writeJSONError(w, http.StatusBadGateway, "telegram send failed: "+err.Error())
+		return
+	}
+
+	h.logger.Info("Telegram test message sent", zap.String("chat_id", req.ChatID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(telegramTestResponse{Status: "success", Messages: results}); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleProcessors lists the loaded email processors in the order emails are
+// matched against them, with their effective senders, subjects and code pattern
+func (h *AdminHandler) HandleProcessors(w http.ResponseWriter, r *http.Request) {
+	resp := processorsResponse{Processors: []processor.Info{}}
+	if h.processors != nil {
+		resp.Processors = h.processors.Describe()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleRecent lists the last emails that went through the processors, newest
+// first, with their outcome and masked code
+func (h *AdminHandler) HandleRecent(w http.ResponseWriter, r *http.Request) {
+	resp := recentResponse{Events: []processor.Event{}}
+	if h.recent != nil {
+		resp.Events = h.recent.Events()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleCapabilities lists the capabilities the IMAP server advertised after
+// login, empty until the first login or when the poller doesn't report them.
+// With several accounts "capabilities" holds the ones every server advertised
+// and "accounts" each account's own list.
+func (h *AdminHandler) HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	resp := capabilitiesResponse{Capabilities: []string{}}
+	switch lister := h.poller.(type) {
+	case interface{ AccountCapabilities() map[string][]string }:
+		resp.Accounts = lister.AccountCapabilities()
+		resp.Capabilities = commonCapabilities(resp.Accounts)
+	case interface{ Capabilities() []string }:
+		if capabilities := lister.Capabilities(); capabilities != nil {
+			resp.Capabilities = capabilities
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// commonCapabilities returns the capabilities advertised by every account, in
+// sorted, since accounts have no order
+func commonCapabilities(accounts map[string][]string) []string {
+	common := []string{}
+	first := true
+	for _, capabilities := range accounts {
+		if first {
+			common = append(common, capabilities...)
+			first = false
+			continue
+		}
+		common = slices.DeleteFunc(common, func(capability string) bool {
+			return !slices.Contains(capabilities, capability)
+		})
+	}
+	slices.Sort(common)
+	return common
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/processor"
+	"automation-hub/internal/services/telegram"
+)
+
+type fakePoller struct {
+	found, processed int
+	err              error
+	calls            int
+}
+
+func (p *fakePoller) CheckOnce(ctx context.Context) (int, int, error) {
+	p.calls++
+	return p.found, p.processed, p.err
+}
+
+func TestAdminHandlePoll(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         config.Secret
+		authorization string
+		pollErr       error
+		expected      int
+		wantCalls     int
+	}{
+		{"Valid token", "adm1n", "Bearer adm1n", nil, http.StatusOK, 1},
+		{"Wrong token", "adm1n", "Bearer nope", nil, http.StatusUnauthorized, 0},
+		{"No token configured", "", "Bearer ", nil, http.StatusUnauthorized, 0},
+		{"Mailbox check fails", "adm1n", "Bearer adm1n", errors.New("connection refused"), http.StatusBadGateway, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poller := &fakePoller{found: 3, processed: 2, err: tt.pollErr}
+			handler := NewAdminHandler(poller, nil, nil, nil, tt.token, zap.NewNop())
+			h := handler.RequireToken(handler.HandlePoll)
+
+			req := httptest.NewRequest("POST", "/admin/poll", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if poller.calls != tt.wantCalls {
+				t.Errorf("CheckOnce() called %d times, expected %d", poller.calls, tt.wantCalls)
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			var resp pollResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Found != 3 || resp.Processed != 2 {
+				t.Errorf("HandlePoll() = %+v, expected found 3 and processed 2", resp)
+			}
+		})
+	}
+}
+
+type fakeSender struct {
+	chatID, message string
+	err             error
+}
+
+func (s *fakeSender) Send(ctx context.Context, req telegram.SendRequest) ([]telegram.SendResult, error) {
+	s.chatID, s.message = req.ChatID, req.Text
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []telegram.SendResult{{ChatID: 123, MessageID: 42, Attempts: 1}}, nil
+}
+
+func TestAdminHandleTelegramTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		sendErr  error
+		expected int
+	}{
+		{"Alias", `{"chat_id": "family"}`, nil, http.StatusOK},
+		{"Telegram error", `{"chat_id": "123"}`, errors.New("Bad Request: chat not found"), http.StatusBadGateway},
+		{"Missing chat ID", `{}`, nil, http.StatusBadRequest},
+		{"Invalid JSON", `{chat`, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &fakeSender{err: tt.sendErr}
+			handler := NewAdminHandler(nil, sender, nil, nil, "adm1n", zap.NewNop())
+
+			req := httptest.NewRequest("POST", "/admin/telegram-test", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.HandleTelegramTest(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected == http.StatusBadRequest {
+				if sender.message != "" {
+					t.Error("Expected no message to be sent for an invalid request")
+				}
+				return
+			}
+			if sender.message != TelegramTestMessage {
+				t.Errorf("Sent %q, expected %q", sender.message, TelegramTestMessage)
+			}
+			if tt.sendErr != nil && !strings.Contains(w.Body.String(), "chat not found") {
+				t.Errorf("Expected the Telegram error in the response, got %s", w.Body.String())
+			}
+			if tt.sendErr == nil && !strings.Contains(w.Body.String(), `"message_id":42`) {
+				t.Errorf("Expected the message ID in the response, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type fakeProcessorLister []processor.Info
+
+func (l fakeProcessorLister) Describe() []processor.Info { return l }
+
+func TestAdminHandleProcessors(t *testing.T) {
+	lister := fakeProcessorLister{
+		{Name: "cloudflare", Type: "generic", EmailFrom: []string{"noreply@notify.cloudflare.com"}, CodePattern: `\b\d{6}\b`, CodePatternSource: "custom", MarkAsRead: true},
+	}
+
+	tests := []struct {
+		name     string
+		lister   ProcessorLister
+		expected int // processors listed
+	}{
+		{"Loaded processors", lister, 1},
+		{"No processors", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(nil, nil, tt.lister, nil, "adm1n", zap.NewNop())
+			h := handler.RequireToken(handler.HandleProcessors)
+
+			req := httptest.NewRequest("GET", "/admin/processors", nil)
+			req.Header.Set("Authorization", "Bearer adm1n")
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			var resp struct {
+				Processors []map[string]any `json:"processors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Processors == nil {
+				t.Fatalf("Expected a processors list, got %s", w.Body.String())
+			}
+			if len(resp.Processors) != tt.expected {
+				t.Fatalf("Listed %d processors, expected %d", len(resp.Processors), tt.expected)
+			}
+			if tt.expected > 0 {
+				got := resp.Processors[0]
+				if got["name"] != "cloudflare" || got["code_pattern_source"] != "custom" || got["mark_as_read"] != true {
+					t.Errorf("Processor = %v, expected cloudflare with a custom pattern, marked as read", got)
+				}
+			}
+		})
+	}
+
+	// Read-only endpoints still require the admin token
+	handler := NewAdminHandler(nil, nil, lister, nil, "adm1n", zap.NewNop())
+	w := httptest.NewRecorder()
+	handler.RequireToken(handler.HandleProcessors)(w, httptest.NewRequest("GET", "/admin/processors", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", w.Code)
+	}
+}
+
+type fakeEventLister []processor.Event
+
+func (l fakeEventLister) Events() []processor.Event { return l }
+
+func TestAdminHandleRecent(t *testing.T) {
+	tests := []struct {
+		name     string
+		lister   EventLister
+		expected int // events listed
+	}{
+		{"Recorded events", fakeEventLister{{Service: "cloudflare", Code: "1***6", Outcome: processor.OutcomeProcessed}}, 1},
+		{"No recorder", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(nil, nil, nil, tt.lister, "adm1n", zap.NewNop())
+			req := httptest.NewRequest("GET", "/admin/recent", nil)
+			req.Header.Set("Authorization", "Bearer adm1n")
+			w := httptest.NewRecorder()
+			handler.RequireToken(handler.HandleRecent)(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			var resp struct {
+				Events []map[string]any `json:"events"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Events == nil {
+				t.Fatalf("Expected an events list, got %s", w.Body.String())
+			}
+			if len(resp.Events) != tt.expected {
+				t.Fatalf("Listed %d events, expected %d", len(resp.Events), tt.expected)
+			}
+			if tt.expected > 0 && (resp.Events[0]["code"] != "1***6" || resp.Events[0]["outcome"] != "processed") {
+				t.Errorf("Event = %v, expected a processed cloudflare event with a masked code", resp.Events[0])
+			}
+		})
+	}
+}
+
+type capablePoller struct {
+	fakePoller
+	capabilities []string
+}
+
+func (p *capablePoller) Capabilities() []string { return p.capabilities }
+
+type accountsPoller struct {
+	fakePoller
+	accounts map[string][]string
+}
+
+func (p *accountsPoller) AccountCapabilities() map[string][]string { return p.accounts }
+
+func TestAdminHandleCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		poller   Poller
+		expected []string
+	}{
+		{"Logged in", &capablePoller{capabilities: []string{"IDLE", "IMAP4rev1", "MOVE"}}, []string{"IDLE", "IMAP4rev1", "MOVE"}},
+		{"Not logged in yet", &capablePoller{}, []string{}},
+		{"Poller without capabilities", &fakePoller{}, []string{}},
+		{"Several accounts", &accountsPoller{accounts: map[string][]string{
+			"personal": {"MOVE", "IMAP4rev1", "IDLE"},
+			"work":     {"IMAP4rev1", "IDLE"},
+		}}, []string{"IDLE", "IMAP4rev1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(tt.poller, nil, nil, nil, "adm1n", zap.NewNop())
+			req := httptest.NewRequest("GET", "/admin/capabilities", nil)
+			req.Header.Set("Authorization", "Bearer adm1n")
+			w := httptest.NewRecorder()
+			handler.RequireToken(handler.HandleCapabilities)(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			var resp struct {
+				Capabilities []string `json:"capabilities"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Capabilities == nil {
+				t.Fatalf("Expected a capabilities list, got %s", w.Body.String())
+			}
+			if strings.Join(resp.Capabilities, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Capabilities = %v, expected %v", resp.Capabilities, tt.expected)
+			}
+		})
+	}
+}
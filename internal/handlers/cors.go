@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsMaxAge lets browsers cache a preflight response for ten minutes
+const corsMaxAge = "600"
+
+// CORS lets browser pages served from the allowed origins call the wrapped
+// routes. "*" allows any origin. Preflight requests are answered here, so the
+// routes must also accept OPTIONS; preflights from other origins get 403.
+func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
+	allowAll := slices.Contains(allowedOrigins, "*")
+	allowed := func(origin string) bool {
+		return origin != "" && (allowAll || slices.Contains(allowedOrigins, origin))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			if r.Method == http.MethodOptions {
+				if !allowed(origin) || r.Header.Get("Access-Control-Request-Method") == "" {
+					writeJSONError(w, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MethodNotAllowed answers requests whose path exists on the router with another
+// method, e.g. GET to a POST-only webhook, with 405 and the accepted methods in Allow
+func MethodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow := allowedMethods(router, r); len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+		}
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+}
+
+// allowedMethods lists the methods the router accepts for the request's path
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allow []string
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			req := r.Clone(r.Context())
+			req.Method = method
+			var match mux.RouteMatch
+			if route.Match(req, &match) && match.MatchErr == nil && !slices.Contains(allow, method) {
+				allow = append(allow, method)
+			}
+		}
+		return nil
+	})
+	sort.Strings(allow)
+	return allow
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORS(t *testing.T) {
+	router := mux.NewRouter()
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(CORS([]string{"https://dashboard.example.com"}))
+	admin.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodPost, http.MethodOptions)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		expected    int
+		allowOrigin string
+	}{
+		{"Preflight from allowed origin", http.MethodOptions, "https://dashboard.example.com", true, http.StatusNoContent, "https://dashboard.example.com"},
+		{"Preflight from other origin", http.MethodOptions, "https://evil.example.com", true, http.StatusForbidden, ""},
+		{"OPTIONS without preflight headers", http.MethodOptions, "https://dashboard.example.com", false, http.StatusForbidden, ""},
+		{"POST from allowed origin", http.MethodPost, "https://dashboard.example.com", false, http.StatusOK, "https://dashboard.example.com"},
+		{"POST from other origin", http.MethodPost, "https://evil.example.com", false, http.StatusOK, ""},
+		{"POST without origin", http.MethodPost, "", false, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/poll", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, expected %q", got, tt.allowOrigin)
+			}
+			if tt.expected == http.StatusNoContent && w.Header().Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" {
+				t.Errorf("Access-Control-Allow-Headers = %q, expected Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	h := CORS([]string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/poll", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("Access-Control-Allow-Origin = %q, expected the request origin", got)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := mux.NewRouter()
+	router.MethodNotAllowedHandler = MethodNotAllowed(router)
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/webhook/qbittorrent", noop).Methods(http.MethodPost)
+	router.HandleFunc("/healthz", noop).Methods(http.MethodGet)
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/poll", noop).Methods(http.MethodPost, http.MethodOptions)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+		allow    string
+	}{
+		{"GET to POST-only webhook", http.MethodGet, "/webhook/qbittorrent", http.StatusMethodNotAllowed, "POST"},
+		{"POST to GET-only probe", http.MethodPost, "/healthz", http.StatusMethodNotAllowed, "GET"},
+		{"GET to admin subrouter", http.MethodGet, "/admin/poll", http.StatusMethodNotAllowed, "OPTIONS, POST"},
+		{"Unknown path", http.MethodGet, "/nope", http.StatusNotFound, ""},
+		{"Allowed method", http.MethodPost, "/webhook/qbittorrent", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, expected %q", got, tt.allow)
+			}
+			if tt.expected == http.StatusMethodNotAllowed && !strings.Contains(w.Body.String(), `"error":"method not allowed"`) {
+				t.Errorf("Body = %q, expected a JSON method not allowed error", w.Body.String())
+			}
+		})
+	}
+}
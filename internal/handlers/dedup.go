@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/models"
+)
+
+const defaultTorrentDedupWindow = time.Minute
+
+// dedupSet remembers recently seen webhook keys for a short window, so a
+// notification fired twice in a row is only processed once
+type dedupSet struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	clock  clock.Clock
+}
+
+// newDedupSet returns nil for a negative window, which disables deduplication
+func newDedupSet(window time.Duration) *dedupSet {
+	if window < 0 {
+		return nil
+	}
+	if window == 0 {
+		window = defaultTorrentDedupWindow
+	}
+	return &dedupSet{
+		window: window,
+		seen:   make(map[string]time.Time),
+		clock:  clock.Real,
+	}
+}
+
+// Claim records key and reports whether it was free, i.e. not claimed within
+// the window. A nil set claims everything.
+func (d *dedupSet) Claim(key string) bool {
+	if d == nil {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	for k, claimed := range d.seen {
+		if now.Sub(claimed) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// Release forgets key, so a notification that failed can be retried
+func (d *dedupSet) Release(key string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// torrentDedupKey identifies a torrent by its info hash, falling back to its
+// name and save path when the hash is not sent
+func torrentDedupKey(notification models.TorrentNotification) string {
+	if notification.InfoHash != "" {
+		return "hash:" + strings.ToLower(notification.InfoHash)
+	}
+	return "name:" + notification.TorrentName + "\x00" + notification.SavePath
+}
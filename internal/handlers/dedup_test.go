@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/models"
+)
+
+func TestDedupSet(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	d := newDedupSet(time.Minute)
+	d.clock = clk
+
+	if !d.Claim("a") {
+		t.Fatal("Claim() = false for a new key, expected true")
+	}
+	if d.Claim("a") {
+		t.Error("Claim() = true for a repeated key, expected false")
+	}
+
+	d.Release("a")
+	if !d.Claim("a") {
+		t.Error("Claim() = false after Release(), expected true")
+	}
+
+	clk.Advance(time.Minute)
+	if !d.Claim("a") {
+		t.Error("Claim() = false after the window, expected true")
+	}
+
+	disabled := newDedupSet(-1)
+	if !disabled.Claim("a") || !disabled.Claim("a") {
+		t.Error("Claim() on a disabled set should always be true")
+	}
+}
+
+func TestTorrentDedupKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     models.TorrentNotification
+		expected bool // same key
+	}{
+		{
+			name:     "Same hash, different case",
+			a:        models.TorrentNotification{InfoHash: "ABC123", TorrentName: "ISO"},
+			b:        models.TorrentNotification{InfoHash: "abc123", TorrentName: "ISO (1)"},
+			expected: true,
+		},
+		{
+			name:     "Different hashes",
+			a:        models.TorrentNotification{InfoHash: "abc123", TorrentName: "ISO"},
+			b:        models.TorrentNotification{InfoHash: "def456", TorrentName: "ISO"},
+			expected: false,
+		},
+		{
+			name:     "No hash, same name and path",
+			a:        models.TorrentNotification{TorrentName: "ISO", SavePath: "/downloads"},
+			b:        models.TorrentNotification{TorrentName: "ISO", SavePath: "/downloads"},
+			expected: true,
+		},
+		{
+			name:     "No hash, different path",
+			a:        models.TorrentNotification{TorrentName: "ISO", SavePath: "/downloads"},
+			b:        models.TorrentNotification{TorrentName: "ISO", SavePath: "/backup"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := torrentDedupKey(tt.a) == torrentDedupKey(tt.b); got != tt.expected {
+				t.Errorf("torrentDedupKey() equal = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// readyPollIntervals is how many polling intervals may pass without a successful
+// IMAP check before the service is reported as not ready
+const readyPollIntervals = 3
+
+// IMAPStatus exposes the polling state of the IMAP monitor
+type IMAPStatus interface {
+	LastPoll() time.Time
+	PollingInterval() time.Duration
+	LastError() (error, time.Time)
+}
+
+// TelegramStatus checks that the Telegram Bot API is reachable
+type TelegramStatus interface {
+	Ping() error
+}
+
+type HealthHandler struct {
+	imap      IMAPStatus
+	telegram  TelegramStatus
+	logger    *zap.Logger
+	startedAt time.Time
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// NewHealthHandler takes a nil imap when email monitoring isn't running, which
+// readiness then reports as disabled instead of checking it
+func NewHealthHandler(imap IMAPStatus, telegram TelegramStatus, logger *zap.Logger) *HealthHandler {
+	return &HealthHandler{
+		imap:      imap,
+		telegram:  telegram,
+		logger:    logger,
+		startedAt: time.Now(),
+	}
+}
+
+// HandleHealthz reports that the process is up
+func (h *HealthHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// HandleReadyz reports whether IMAP polling and Telegram are healthy
+func (h *HealthHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	if h.imap == nil {
+		checks["imap"] = "disabled"
+	} else if err := h.checkIMAP(); err != nil {
+		checks["imap"] = err.Error()
+		ready = false
+	} else {
+		checks["imap"] = "ok"
+	}
+
+	if err := h.telegram.Ping(); err != nil {
+		checks["telegram"] = err.Error()
+		ready = false
+	} else {
+		checks["telegram"] = "ok"
+	}
+
+	if !ready {
+		h.logger.Warn("Readiness check failed", zap.Any("checks", checks))
+		h.writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+	h.writeJSON(w, http.StatusOK, healthResponse{Status: "ok", Checks: checks})
+}
+
+func (h *HealthHandler) checkIMAP() error {
+	maxAge := readyPollIntervals * h.imap.PollingInterval()
+
+	lastPoll := h.imap.LastPoll()
+	if lastPoll.IsZero() {
+		// Give the monitor time to complete its first poll after startup
+		if time.Since(h.startedAt) <= maxAge {
+			return nil
+		}
+		return fmt.Errorf("no successful poll since startup %s ago%s", time.Since(h.startedAt).Round(time.Second), h.lastIMAPError(lastPoll))
+	}
+
+	if age := time.Since(lastPoll); age > maxAge {
+		return fmt.Errorf("last successful poll %s ago%s", age.Round(time.Second), h.lastIMAPError(lastPoll))
+	}
+	return nil
+}
+
+// lastIMAPError describes the error behind a stale poll, if one happened
+// after the last successful poll
+func (h *HealthHandler) lastIMAPError(lastPoll time.Time) string {
+	err, at := h.imap.LastError()
+	if err == nil || at.Before(lastPoll) {
+		return ""
+	}
+	return fmt.Sprintf(", last error %s ago: %v", time.Since(at).Round(time.Second), err)
+}
+
+func (h *HealthHandler) writeJSON(w http.ResponseWriter, status int, body healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
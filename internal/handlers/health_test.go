@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type fakeIMAPStatus struct {
+	lastPoll  time.Time
+	interval  time.Duration
+	lastErr   error
+	lastErrAt time.Time
+}
+
+func (f fakeIMAPStatus) LastPoll() time.Time            { return f.lastPoll }
+func (f fakeIMAPStatus) PollingInterval() time.Duration { return f.interval }
+func (f fakeIMAPStatus) LastError() (error, time.Time)  { return f.lastErr, f.lastErrAt }
+
+type fakeTelegramStatus struct {
+	err error
+}
+
+func (f fakeTelegramStatus) Ping() error { return f.err }
+
+func TestHandleHealthz(t *testing.T) {
+	handler := NewHealthHandler(fakeIMAPStatus{}, fakeTelegramStatus{}, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	handler.HandleHealthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", w.Code)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	tests := []struct {
+		name      string
+		imap      fakeIMAPStatus
+		telegram  fakeTelegramStatus
+		startedAt time.Time
+		expected  int
+		unhealthy string
+		contains  string
+	}{
+		{
+			name:     "Recent poll and telegram reachable",
+			imap:     fakeIMAPStatus{lastPoll: time.Now(), interval: time.Minute},
+			expected: http.StatusOK,
+		},
+		{
+			name:      "Stale poll",
+			imap:      fakeIMAPStatus{lastPoll: time.Now().Add(-10 * time.Minute), interval: time.Minute},
+			expected:  http.StatusServiceUnavailable,
+			unhealthy: "imap",
+		},
+		{
+			name: "Stale poll after a fetch error",
+			imap: fakeIMAPStatus{
+				lastPoll:  time.Now().Add(-10 * time.Minute),
+				interval:  time.Minute,
+				lastErr:   errors.New("INBOX: failed to fetch messages: connection reset"),
+				lastErrAt: time.Now(),
+			},
+			expected:  http.StatusServiceUnavailable,
+			unhealthy: "imap",
+			contains:  "connection reset",
+		},
+		{
+			name: "Recent poll after an old error",
+			imap: fakeIMAPStatus{
+				lastPoll:  time.Now(),
+				interval:  time.Minute,
+				lastErr:   errors.New("INBOX: connection reset"),
+				lastErrAt: time.Now().Add(-time.Hour),
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name:      "Telegram unreachable",
+			imap:      fakeIMAPStatus{lastPoll: time.Now(), interval: time.Minute},
+			telegram:  fakeTelegramStatus{err: errors.New("unauthorized")},
+			expected:  http.StatusServiceUnavailable,
+			unhealthy: "telegram",
+		},
+		{
+			name:      "No poll yet within startup grace period",
+			imap:      fakeIMAPStatus{interval: time.Minute},
+			startedAt: time.Now(),
+			expected:  http.StatusOK,
+		},
+		{
+			name:      "No poll since long after startup",
+			imap:      fakeIMAPStatus{interval: time.Minute},
+			startedAt: time.Now().Add(-time.Hour),
+			expected:  http.StatusServiceUnavailable,
+			unhealthy: "imap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHealthHandler(tt.imap, tt.telegram, zap.NewNop())
+			if !tt.startedAt.IsZero() {
+				handler.startedAt = tt.startedAt
+			}
+
+			w := httptest.NewRecorder()
+			handler.HandleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+
+			var body healthResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if tt.unhealthy != "" && body.Checks[tt.unhealthy] == "ok" {
+				t.Errorf("Expected %s check to report a problem, got %v", tt.unhealthy, body.Checks)
+			}
+			if tt.contains != "" && !strings.Contains(body.Checks[tt.unhealthy], tt.contains) {
+				t.Errorf("Expected %s check to mention %q, got %q", tt.unhealthy, tt.contains, body.Checks[tt.unhealthy])
+			}
+		})
+	}
+}
+
+func TestHandleReadyzIMAPDisabled(t *testing.T) {
+	handler := NewHealthHandler(nil, fakeTelegramStatus{}, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	handler.HandleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", w.Code)
+	}
+
+	var body healthResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Checks["imap"] != "disabled" {
+		t.Errorf("Expected imap check disabled, got %q", body.Checks["imap"])
+	}
+}
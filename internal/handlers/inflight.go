@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// InFlightRequest is a webhook request still being handled
+type InFlightRequest struct {
+	ID      string // X-Request-ID
+	Path    string
+	Started time.Time
+}
+
+// InFlight tracks the webhook requests being handled across config reloads, so
+// a shutdown can report what it is waiting for. A nil InFlight tracks nothing.
+type InFlight struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]InFlightRequest
+}
+
+func NewInFlight() *InFlight {
+	return &InFlight{requests: make(map[uint64]InFlightRequest)}
+}
+
+// add tracks req until the returned function is called
+func (f *InFlight) add(req InFlightRequest) (done func()) {
+	if f == nil {
+		return func() {}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := f.next
+	f.next++
+	f.requests[key] = req
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.requests, key)
+	}
+}
+
+// Requests returns the requests in flight, oldest first
+func (f *InFlight) Requests() []InFlightRequest {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	requests := make([]InFlightRequest, 0, len(f.requests))
+	for _, req := range f.requests {
+		requests = append(requests, req)
+	}
+	slices.SortFunc(requests, func(a, b InFlightRequest) int {
+		return a.Started.Compare(b.Started)
+	})
+	return requests
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/metrics"
+)
+
+const SignatureHeader = "X-Signature"
+
+// VerifySignature rejects requests whose X-Signature header is not the hex
+// HMAC-SHA256 of the raw body keyed with the hook secret. Hooks without a
+// secret are passed through unchanged.
+func (h *WebhookHandler) VerifySignature(hook config.WebhookConfig, next http.HandlerFunc) http.HandlerFunc {
+	if hook.Secret == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes()))
+		if err != nil {
+			h.requestLogger(r).Error("Failed to read request body", zap.String("webhook", hook.Name), zap.Error(err))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+
+		if !validSignature(string(hook.Secret), body, r.Header.Get(SignatureHeader)) {
+			h.requestLogger(r).Warn("Rejected webhook request with invalid signature",
+				zap.String("webhook", hook.Name),
+				zap.String("remote_addr", r.RemoteAddr))
+			metrics.WebhookAuthFailures.WithLabelValues(hook.Name).Inc()
+			writeJSONError(w, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// RequireToken rejects requests whose Authorization header is not
+// "Bearer <auth_token>". Hooks without an auth_token are passed through unchanged.
+func (h *WebhookHandler) RequireToken(hook config.WebhookConfig, next http.HandlerFunc) http.HandlerFunc {
+	if hook.AuthToken == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !validBearerToken(string(hook.AuthToken), r.Header.Get("Authorization")) {
+			h.requestLogger(r).Warn("Rejected webhook request with missing or invalid token",
+				zap.String("webhook", hook.Name),
+				zap.String("remote_addr", r.RemoteAddr))
+			metrics.WebhookAuthFailures.WithLabelValues(hook.Name).Inc()
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func validBearerToken(token, header string) bool {
+	scheme, received, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(received)), []byte(token)) == 1
+}
+
+func validSignature(secret string, body []byte, signature string) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	received, err := hex.DecodeString(signature)
+	if err != nil || len(received) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Instrument counts webhook requests by hook name and response status
+func (h *WebhookHandler) Instrument(hook config.WebhookConfig, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		metrics.WebhookRequests.WithLabelValues(hook.Name, strconv.Itoa(rec.status)).Inc()
+	}
+}
+
+// Recover turns a panicking handler into a 500 response, logging the panic with
+// its stack trace so one bad request cannot take the server down.
+// http.ErrAbortHandler is re-raised, since it deliberately aborts the response.
+func Recover(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logger.Error("Recovered from panic in HTTP handler",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Any("panic", err),
+					zap.Stack("stack"))
+				writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
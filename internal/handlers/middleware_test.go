@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/metrics"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+	hook := config.WebhookConfig{Name: "qbittorrent", Secret: "s3cret"}
+	body := `{"torrent_name": "Debian ISO", "save_path": "/downloads"}`
+
+	var received string
+	next := func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		w.WriteHeader(http.StatusOK)
+	}
+	h := handler.VerifySignature(hook, next)
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  int
+	}{
+		{name: "Valid signature", signature: sign("s3cret", body), expected: http.StatusOK},
+		{name: "Valid signature with sha256 prefix", signature: "sha256=" + sign("s3cret", body), expected: http.StatusOK},
+		{name: "Wrong secret", signature: sign("other", body), expected: http.StatusUnauthorized},
+		{name: "Missing signature", signature: "", expected: http.StatusUnauthorized},
+		{name: "Non-hex signature", signature: "not-hex", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString(body))
+			if tt.signature != "" {
+				req.Header.Set(SignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusOK && received != body {
+				t.Errorf("Expected body to be passed through, got %q", received)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureWithoutSecret(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+
+	called := false
+	h := handler.VerifySignature(config.WebhookConfig{Name: "qbittorrent"}, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	h(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString("{}")))
+	if !called {
+		t.Error("Expected request without secret configured to pass through")
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+	hook := config.WebhookConfig{Name: "tokened", AuthToken: "t0ken"}
+
+	h := handler.RequireToken(hook, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{name: "Valid token", authorization: "Bearer t0ken", expected: http.StatusOK},
+		{name: "Lowercase scheme", authorization: "bearer t0ken", expected: http.StatusOK},
+		{name: "Wrong token", authorization: "Bearer other", expected: http.StatusUnauthorized},
+		{name: "Basic scheme", authorization: "Basic t0ken", expected: http.StatusUnauthorized},
+		{name: "Missing header", authorization: "", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/webhook/tokened", bytes.NewBufferString("{}"))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `automation_hub_webhook_auth_failures_total{webhook="tokened"} 3`
+	if !strings.Contains(scrape.Body.String(), expected) {
+		t.Errorf("Expected metrics output to contain %q", expected)
+	}
+
+	called := false
+	open := handler.RequireToken(config.WebhookConfig{Name: "open"}, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	open(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook/open", nil))
+	if !called {
+		t.Error("Expected request without auth_token configured to pass through")
+	}
+}
+
+func TestInstrumentRecordsStatus(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+	hook := config.WebhookConfig{Name: "instrumented"}
+
+	h := handler.Instrument(hook, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+	})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/webhook/instrumented", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request to be passed through, got %d", w.Code)
+	}
+
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `automation_hub_webhook_requests_total{status="400",webhook="instrumented"} 1`
+	if !strings.Contains(scrape.Body.String(), expected) {
+		t.Errorf("Expected metrics output to contain %q", expected)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Recover(zap.NewNop()))
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var hooks map[string]int
+		hooks["qbittorrent"]++ // nil map write
+	})
+	router.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatalf("Request to panicking handler failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), `"status":"error"`) {
+		t.Errorf("Expected a JSON error body, got %s", body)
+	}
+
+	// The server keeps serving after the panic
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatalf("Request after panic failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 after panic, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+
+	"automation-hub/internal/config"
+)
+
+// WebhookFactory builds the HTTP handler for a configured webhook
+type WebhookFactory func(h *WebhookHandler, hook config.WebhookConfig) (http.HandlerFunc, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]WebhookFactory{
+		"qbittorrent": torrentWebhookFactory,
+	}
+)
+
+// RegisterWebhook registers a factory for webhooks with the given name,
+// replacing any existing registration
+func RegisterWebhook(name string, factory WebhookFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// HandlerFor returns the handler for a configured webhook. Webhooks without a
+// registered factory fall back to the generic JSON payload handler.
+func (h *WebhookHandler) HandlerFor(hook config.WebhookConfig) (http.HandlerFunc, error) {
+	registryMu.RLock()
+	factory, ok := registry[hook.Name]
+	registryMu.RUnlock()
+
+	if !ok {
+		factory = genericWebhookFactory
+	}
+	return factory(h, hook)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+func TestHandlerForGenericWebhook(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+
+	hook := config.WebhookConfig{
+		Name: "sonarr",
+		Path: "/webhook/sonarr",
+		Config: config.WebhookProcessorConfig{
+			TelegramChatID:  "123",
+			TelegramMessage: "📺 {{.series.title}} imported",
+		},
+	}
+
+	h, err := handler.HandlerFor(hook)
+	if err != nil {
+		t.Fatalf("HandlerFor() returned unexpected error: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", hook.Path, bytes.NewBufferString(`{"series": {"title": "Severance"}}`))
+	w := httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", hook.Path, bytes.NewBufferString("{invalid_json"))
+	w = httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func TestHandlerForInvalidTemplate(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+
+	hook := config.WebhookConfig{
+		Name: "radarr",
+		Config: config.WebhookProcessorConfig{
+			TelegramMessage: "🎬 {{.movie.title",
+		},
+	}
+
+	if _, err := handler.HandlerFor(hook); err == nil {
+		t.Error("Expected error for invalid message template, got nil")
+	}
+}
+
+func TestHandlerForTorrentInvalidTemplate(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+
+	hook := config.WebhookConfig{
+		Name: "qbittorrent",
+		Config: config.WebhookProcessorConfig{
+			TelegramMessage: "📥 {{.TorrentName",
+		},
+	}
+
+	if _, err := handler.HandlerFor(hook); err == nil {
+		t.Error("Expected startup error for invalid torrent template, got nil")
+	}
+}
+
+func TestRegisterWebhook(t *testing.T) {
+	logger := zap.NewNop()
+	handler := NewWebhookHandler(nil, &config.Config{}, logger)
+
+	called := false
+	RegisterWebhook("custom", func(h *WebhookHandler, hook config.WebhookConfig) (http.HandlerFunc, error) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}, nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "custom")
+		registryMu.Unlock()
+	}()
+
+	h, err := handler.HandlerFor(config.WebhookConfig{Name: "custom"})
+	if err != nil {
+		t.Fatalf("HandlerFor() returned unexpected error: %v", err)
+	}
+	h(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	if !called {
+		t.Error("Expected registered factory handler to be used")
+	}
+}
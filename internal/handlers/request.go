@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// defaultMaxBodyBytes caps webhook bodies when server.max_body_bytes is unset
+const defaultMaxBodyBytes = 1 << 20
+
+// maxBodyBytes returns the configured webhook body limit
+func (h *WebhookHandler) maxBodyBytes() int64 {
+	if h.config == nil || h.config.Server.MaxBodyBytes <= 0 {
+		return defaultMaxBodyBytes
+	}
+	return h.config.Server.MaxBodyBytes
+}
+
+// decodeBody decodes a JSON or form-encoded request body into v. It answers 415
+// for other content types, 413 for bodies over the limit and 400 for invalid
+// payloads, returning false once the error response has been written. A missing
+// Content-Type is read as JSON for clients that do not send one.
+func (h *WebhookHandler) decodeBody(w http.ResponseWriter, r *http.Request, webhook string, v any, strict bool) bool {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && mediaType != "application/x-www-form-urlencoded") {
+			h.requestLogger(r).Warn("Rejected webhook request with unsupported content type",
+				zap.String("webhook", webhook),
+				zap.String("content_type", contentType))
+			writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json or application/x-www-form-urlencoded")
+			return false
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes())
+	var err error
+	if mediaType == "application/x-www-form-urlencoded" {
+		// PostForm leaves out the query string, which may carry a token
+		if err = r.ParseForm(); err == nil {
+			err = decodeForm(r.PostForm, v, strict)
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		err = decoder.Decode(v)
+	}
+
+	if err != nil {
+		h.requestLogger(r).Error("Failed to decode request", zap.String("webhook", webhook), zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return false
+		}
+		if mediaType == "application/x-www-form-urlencoded" {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid form payload: %v", err))
+			return false
+		}
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON payload: %v", err))
+		return false
+	}
+	return true
+}
+
+// decodeForm fills a generic payload map or a struct with JSON tags from form
+// values. Map entries are strings, or lists of strings for repeated keys;
+// struct fields take the first value, parsed for integer fields. Unknown keys
+// are ignored unless strict.
+func decodeForm(values url.Values, v any, strict bool) error {
+	if payload, ok := v.(*map[string]interface{}); ok {
+		*payload = make(map[string]interface{}, len(values))
+		for key, list := range values {
+			if len(list) == 1 {
+				(*payload)[key] = list[0]
+				continue
+			}
+			items := make([]interface{}, len(list))
+			for i, item := range list {
+				items[i] = item
+			}
+			(*payload)[key] = items
+		}
+		return nil
+	}
+
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode a form into %T", v)
+	}
+	target = target.Elem()
+	fields := make(map[string]reflect.Value, target.NumField())
+	for i := range target.NumField() {
+		name, _, _ := strings.Cut(target.Type().Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = target.Field(i)
+		}
+	}
+
+	for key := range values {
+		field, ok := fields[key]
+		if !ok {
+			if strict {
+				return fmt.Errorf("unknown field %q", key)
+			}
+			continue
+		}
+		value := values.Get(key)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("field %q must be an integer, got %q", key, value)
+			}
+			field.SetInt(n)
+		default:
+			return fmt.Errorf("field %q cannot be set from a form", key)
+		}
+	}
+	return nil
+}
+
+// writeJSONError writes {"status":"error","error":message} with the given status
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "error", "error": message})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		strict      bool
+		expected    int
+	}{
+		{"Valid JSON", "application/json", `{"torrent_name":"ISO"}`, false, http.StatusOK},
+		{"JSON with charset", "application/json; charset=utf-8", `{"torrent_name":"ISO"}`, false, http.StatusOK},
+		{"Missing content type", "", `{"torrent_name":"ISO"}`, false, http.StatusOK},
+		{"Form", "application/x-www-form-urlencoded", `torrent_name=ISO&size=1024`, false, http.StatusOK},
+		{"Form invalid integer", "application/x-www-form-urlencoded", `torrent_name=ISO&size=big`, false, http.StatusBadRequest},
+		{"Form unknown field strict", "application/x-www-form-urlencoded", `torrent_nam=ISO`, true, http.StatusBadRequest},
+		{"Form too large", "application/x-www-form-urlencoded", `torrent_name=` + strings.Repeat("a", 64), false, http.StatusRequestEntityTooLarge},
+		{"Unsupported content type", "text/plain", `torrent_name=ISO`, false, http.StatusUnsupportedMediaType},
+		{"Invalid JSON", "application/json", `{invalid`, false, http.StatusBadRequest},
+		{"Too large", "application/json", `{"torrent_name":"` + strings.Repeat("a", 64) + `"}`, false, http.StatusRequestEntityTooLarge},
+		{"Unknown field allowed", "application/json", `{"torrent_nam":"ISO"}`, false, http.StatusOK},
+		{"Unknown field strict", "application/json", `{"torrent_nam":"ISO"}`, true, http.StatusBadRequest},
+		{"Optional fields strict", "application/json", `{"category":"tv","size":1024}`, true, http.StatusOK},
+	}
+
+	handler := NewWebhookHandler(nil, &config.Config{Server: config.ServerConfig{MaxBodyBytes: 64}}, zap.NewNop())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook/test", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			var notification models.TorrentNotification
+			ok := handler.decodeBody(w, req, "test", &notification, tt.strict)
+			if ok != (tt.expected == http.StatusOK) {
+				t.Fatalf("decodeBody() = %v with status %d, expected %d", ok, w.Code, tt.expected)
+			}
+			if ok {
+				return
+			}
+			if w.Code != tt.expected {
+				t.Errorf("decodeBody() status = %d, expected %d", w.Code, tt.expected)
+			}
+
+			var resp map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["status"] != "error" || resp["error"] == "" {
+				t.Errorf("decodeBody() body = %s, expected a JSON error", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDecodeBodyForm(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/test?token=secret", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	var notification models.TorrentNotification
+	if !handler.decodeBody(httptest.NewRecorder(), newRequest("torrent_name=Ubuntu+24.04&save_path=%2Fdownloads&size=1024"), "test", &notification, true) {
+		t.Fatal("decodeBody() = false, expected the form to decode")
+	}
+	expected := models.TorrentNotification{TorrentName: "Ubuntu 24.04", SavePath: "/downloads", Size: 1024}
+	if notification != expected {
+		t.Errorf("Notification = %+v, expected %+v", notification, expected)
+	}
+
+	var payload map[string]interface{}
+	if !handler.decodeBody(httptest.NewRecorder(), newRequest("title=Backup+done&tag=nightly&tag=nas"), "test", &payload, false) {
+		t.Fatal("decodeBody() = false, expected the form to decode")
+	}
+	// The query string is not part of the payload
+	if payload["title"] != "Backup done" || len(payload) != 2 {
+		t.Errorf("Payload = %v, expected title and tag only", payload)
+	}
+	if tags, ok := payload["tag"].([]interface{}); !ok || len(tags) != 2 || tags[1] != "nas" {
+		t.Errorf("Payload tag = %v, expected both values", payload["tag"])
+	}
+}
+
+func TestMaxBodyBytesDefault(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	if got := handler.maxBodyBytes(); got != defaultMaxBodyBytes {
+		t.Errorf("maxBodyBytes() = %d, expected %d", got, defaultMaxBodyBytes)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// defaultWebhookTimeout bounds a webhook request when no timeout is configured
+const defaultWebhookTimeout = 10 * time.Second
+
+// validRequestID limits propagated IDs to short, log-safe values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type loggerKey struct{}
+
+// WithRequestID reuses the caller's X-Request-ID or generates one, echoes it in
+// the response and attaches it to the logger returned by requestLogger. The
+// request is tracked as in flight until the handler returns.
+func (h *WebhookHandler) WithRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := h.logger.With(zap.String("request_id", id))
+		logger.Debug("Webhook request received",
+			zap.String("path", r.URL.Path),
+			zap.String("remote_addr", r.RemoteAddr))
+		done := h.inFlight.add(InFlightRequest{ID: id, Path: r.URL.Path, Started: time.Now()})
+		defer done()
+		next(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+	}
+}
+
+// WithTimeout cancels the request context after the hook's timeout_seconds,
+// or server.webhook_timeout_seconds when the hook does not set one
+func (h *WebhookHandler) WithTimeout(hook config.WebhookConfig, next http.HandlerFunc) http.HandlerFunc {
+	timeout := h.webhookTimeout(hook)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (h *WebhookHandler) webhookTimeout(hook config.WebhookConfig) time.Duration {
+	if hook.TimeoutSeconds > 0 {
+		return time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+	if h.config != nil && h.config.Server.WebhookTimeoutSeconds > 0 {
+		return time.Duration(h.config.Server.WebhookTimeoutSeconds) * time.Second
+	}
+	return defaultWebhookTimeout
+}
+
+// requestLogger returns the request-scoped logger, or the handler logger for
+// requests that did not go through WithRequestID
+func (h *WebhookHandler) requestLogger(r *http.Request) *zap.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return h.logger
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
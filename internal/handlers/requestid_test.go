@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"automation-hub/internal/config"
+)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"Propagates caller ID", "qbt-42", true},
+		{"Generates when missing", "", false},
+		{"Replaces unsafe ID", "bad id\nwith newline", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			handler := NewWebhookHandler(nil, &config.Config{}, zap.New(core))
+
+			h := handler.WithRequestID(func(w http.ResponseWriter, r *http.Request) {
+				handler.requestLogger(r).Info("handled")
+			})
+
+			req := httptest.NewRequest("POST", "/webhook/test", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.reused && id != tt.incoming {
+				t.Errorf("%s = %q, expected %q", RequestIDHeader, id, tt.incoming)
+			}
+			if !tt.reused && (id == "" || id == tt.incoming) {
+				t.Errorf("%s = %q, expected a generated ID", RequestIDHeader, id)
+			}
+
+			entries := logs.FilterMessage("handled").All()
+			if len(entries) != 1 || entries[0].ContextMap()["request_id"] != id {
+				t.Errorf("Expected handler log to carry request_id %q, got %v", id, entries)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   int
+		hook     int
+		expected time.Duration
+	}{
+		{"Default", 0, 0, defaultWebhookTimeout},
+		{"Server setting", 5, 0, 5 * time.Second},
+		{"Hook override", 5, 30, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Server: config.ServerConfig{WebhookTimeoutSeconds: tt.server}}
+			handler := NewWebhookHandler(nil, cfg, zap.NewNop())
+
+			var remaining time.Duration
+			h := handler.WithTimeout(config.WebhookConfig{TimeoutSeconds: tt.hook}, func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				if !ok {
+					t.Fatal("Expected request context to have a deadline")
+				}
+				remaining = time.Until(deadline)
+			})
+			h(httptest.NewRecorder(), httptest.NewRequest("POST", "/webhook/test", nil))
+
+			if remaining > tt.expected || remaining < tt.expected-time.Second {
+				t.Errorf("Deadline in %v, expected about %v", remaining, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteProcessingError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{fmt.Errorf("send aborted: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{fmt.Errorf("chat not found"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeProcessingError(w, tt.err)
+		if w.Code != tt.expected {
+			t.Errorf("writeProcessingError(%v) status = %d, expected %d", tt.err, w.Code, tt.expected)
+		}
+	}
+}
+
+func TestWithRequestIDTracksInFlight(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	inFlight := NewInFlight()
+	handler.SetInFlight(inFlight)
+
+	var during []InFlightRequest
+	wrapped := handler.WithRequestID(func(w http.ResponseWriter, r *http.Request) {
+		during = inFlight.Requests()
+	})
+	req := httptest.NewRequest(http.MethodPost, "/webhook/sonarr", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	wrapped(httptest.NewRecorder(), req)
+
+	if len(during) != 1 || during[0].ID != "abc-123" || during[0].Path != "/webhook/sonarr" {
+		t.Errorf("Requests() during the handler = %+v, expected abc-123 on /webhook/sonarr", during)
+	}
+	if after := inFlight.Requests(); len(after) != 0 {
+		t.Errorf("Requests() after the handler = %+v, expected none", after)
+	}
+}
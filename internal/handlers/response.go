@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/telegram"
+)
+
+// webhookReply writes the answer to a successfully processed webhook: the
+// hook's response_template rendered with the request payload, or the default
+// {"status":"success","messages":[...]}
+type webhookReply struct {
+	template    *template.Template // nil for the default JSON
+	contentType string
+}
+
+// newWebhookReply parses the hook's response_template, so template errors fail
+// the route at startup. Payload values can be JSON-encoded with {{json .name}}.
+func newWebhookReply(hook config.WebhookConfig) (webhookReply, error) {
+	if hook.ResponseTemplate == "" {
+		return webhookReply{}, nil
+	}
+
+	tmpl, err := template.New(hook.Name + " response").
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		}}).
+		Parse(hook.ResponseTemplate)
+	if err != nil {
+		return webhookReply{}, fmt.Errorf("invalid response_template: %w", err)
+	}
+	return webhookReply{
+		template:    tmpl,
+		contentType: cmp.Or(hook.ResponseContentType, "application/json"),
+	}, nil
+}
+
+// write renders the template with payload. The notification has been sent by
+// then, so a template that fails to render falls back to the default JSON
+// instead of an error the sender would retry.
+func (reply webhookReply) write(h *WebhookHandler, w http.ResponseWriter, r *http.Request, payload any, results []telegram.SendResult) {
+	if reply.template == nil {
+		h.writeSuccess(w, r, results)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := reply.template.Execute(&body, payload); err != nil {
+		h.requestLogger(r).Error("Failed to render response_template, sending the default response", zap.Error(err))
+		h.writeSuccess(w, r, results)
+		return
+	}
+	w.Header().Set("Content-Type", reply.contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body.Bytes())
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -12,9 +15,15 @@ import (
 	"automation-hub/internal/services/telegram"
 )
 
+type webhookResponse struct {
+	Status   string                `json:"status"`
+	Messages []telegram.SendResult `json:"messages,omitempty"`
+}
+
 type WebhookHandler struct {
 	telegramClient *telegram.Client
 	config         *config.Config
+	inFlight       *InFlight
 	logger         *zap.Logger
 }
 
@@ -26,35 +35,118 @@ func NewWebhookHandler(telegramClient *telegram.Client, config *config.Config, l
 	}
 }
 
-func (h *WebhookHandler) HandleTorrentComplete(w http.ResponseWriter, r *http.Request) {
-	var notification models.TorrentNotification
+// SetInFlight tracks the requests going through WithRequestID in inFlight
+func (h *WebhookHandler) SetInFlight(inFlight *InFlight) {
+	h.inFlight = inFlight
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
-		h.logger.Error("Failed to decode request", zap.Error(err))
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+func torrentWebhookFactory(h *WebhookHandler, hook config.WebhookConfig) (http.HandlerFunc, error) {
+	// Parse the message template once, so configuration errors surface at startup
+	torrentProc, err := processor.NewTorrentProcessor(h.telegramClient, &hook.Config, h.logger)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := newWebhookReply(hook)
+	if err != nil {
+		return nil, err
 	}
 
-	// Find qbittorrent webhook configuration
-	webhookConfig := processor.GetWebhookConfig(h.config, "qbittorrent")
-	if webhookConfig == nil {
-		h.logger.Error("qbittorrent webhook configuration not found")
-		http.Error(w, "Webhook configuration not found", http.StatusInternalServerError)
-		return
+	// qBittorrent sometimes fires the completion hook twice for the same torrent
+	dedup := newDedupSet(time.Duration(hook.DedupSeconds) * time.Second)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var notification models.TorrentNotification
+		if !h.decodeBody(w, r, hook.Name, &notification, hook.Strict) {
+			return
+		}
+
+		key := torrentDedupKey(notification)
+		if !dedup.Claim(key) {
+			h.requestLogger(r).Info("Skipping repeated torrent notification",
+				zap.String("torrent_name", notification.TorrentName),
+				zap.String("info_hash", notification.InfoHash))
+			h.writeDuplicate(w, r)
+			return
+		}
+		if !h.processTorrent(w, r, notification, torrentProc, reply) {
+			dedup.Release(key)
+		}
+	}, nil
+}
+
+// processTorrent sends the notification and reports whether it succeeded
+func (h *WebhookHandler) processTorrent(w http.ResponseWriter, r *http.Request, notification models.TorrentNotification, torrentProc *processor.TorrentProcessor, reply webhookReply) bool {
+	results, err := torrentProc.ProcessContext(r.Context(), notification)
+	if err != nil {
+		h.requestLogger(r).Error("Failed to process torrent notification", zap.Error(err))
+		writeProcessingError(w, err)
+		return false
 	}
+	h.requestLogger(r).Info("Torrent notification processed",
+		zap.String("torrent_name", notification.TorrentName))
 
-	// Create processor dynamically
-	torrentProc := processor.NewTorrentProcessor(h.telegramClient, webhookConfig, h.logger)
+	reply.write(h, w, r, notification, results)
+	return true
+}
 
-	if err := torrentProc.Process(notification); err != nil {
-		h.logger.Error("Failed to process torrent notification", zap.Error(err))
-		http.Error(w, "Processing failed", http.StatusInternalServerError)
-		return
+// writeDuplicate answers {"status":"duplicate"} for notifications already sent
+// within the dedup window, with 200 so the sender does not retry
+func (h *WebhookHandler) writeDuplicate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(webhookResponse{Status: "duplicate"}); err != nil {
+		h.requestLogger(r).Error("Failed to encode response", zap.Error(err))
 	}
+}
 
+// writeSuccess answers {"status":"success","messages":[...]} with the Telegram
+// messages sent, so callers can keep their IDs
+func (h *WebhookHandler) writeSuccess(w http.ResponseWriter, r *http.Request, results []telegram.SendResult) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "success"}); err != nil {
-		h.logger.Error("Failed to encode response", zap.Error(err))
+	if err := json.NewEncoder(w).Encode(webhookResponse{Status: "success", Messages: results}); err != nil {
+		h.requestLogger(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// writeProcessingError answers 504 when the request timeout cut processing short
+func writeProcessingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeJSONError(w, http.StatusGatewayTimeout, "processing timed out")
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, "processing failed")
+}
+
+func genericWebhookFactory(h *WebhookHandler, hook config.WebhookConfig) (http.HandlerFunc, error) {
+	webhookProc, err := processor.NewGenericWebhookProcessor(hook.Name, h.telegramClient, &hook.Config, h.logger)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := newWebhookReply(hook)
+	if err != nil {
+		return nil, err
+	}
+	return h.handleGenericWebhook(webhookProc, reply), nil
+}
+
+func (h *WebhookHandler) handleGenericWebhook(webhookProc *processor.GenericWebhookProcessor, reply webhookReply) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if !h.decodeBody(w, r, webhookProc.GetName(), &payload, false) {
+			return
+		}
+
+		results, err := webhookProc.ProcessContext(r.Context(), payload)
+		if err != nil {
+			h.requestLogger(r).Error("Failed to process webhook",
+				zap.String("webhook", webhookProc.GetName()),
+				zap.Error(err))
+			writeProcessingError(w, err)
+			return
+		}
+		h.requestLogger(r).Info("Webhook processed", zap.String("webhook", webhookProc.GetName()))
+
+		reply.write(h, w, r, payload, results)
 	}
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,15 +22,28 @@ func TestNewWebhookHandler(t *testing.T) {
 	}
 }
 
-func TestHandleTorrentComplete_InvalidJSON(t *testing.T) {
-	logger := zap.NewNop()
-	cfg := &config.Config{}
-	handler := NewWebhookHandler(nil, cfg, logger)
+// torrentHook is a qbittorrent webhook as the router builds it
+func torrentHook(message string) config.WebhookConfig {
+	return config.WebhookConfig{
+		Name: "qbittorrent",
+		Path: "/webhook/qbittorrent",
+		Config: config.WebhookProcessorConfig{
+			TelegramChatID:  "123",
+			TelegramMessage: message,
+		},
+	}
+}
+
+func TestTorrentWebhook_InvalidJSON(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	h, err := handler.HandlerFor(torrentHook("Downloaded: %s at %s"))
+	if err != nil {
+		t.Fatalf("HandlerFor() returned unexpected error: %v", err)
+	}
 
 	req := httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString("{invalid_json"))
 	w := httptest.NewRecorder()
-
-	handler.HandleTorrentComplete(w, req)
+	h(w, req)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusBadRequest {
@@ -37,49 +51,157 @@ func TestHandleTorrentComplete_InvalidJSON(t *testing.T) {
 	}
 }
 
-func TestHandleTorrentComplete_MissingWebhookConfig(t *testing.T) {
-	logger := zap.NewNop()
-	cfg := &config.Config{
-		Hook: []config.WebhookConfig{}, // No qbittorrent hook configured
+func TestTorrentWebhook_InvalidTemplate(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+
+	// Template errors surface when the router is built, not per request
+	if _, err := handler.HandlerFor(torrentHook("Downloaded: {{.TorrentName")); err == nil {
+		t.Error("HandlerFor() with an invalid template = nil, expected error")
+	}
+}
+
+func TestTorrentWebhook_Success(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	h, err := handler.HandlerFor(torrentHook("Downloaded: %s at %s"))
+	if err != nil {
+		t.Fatalf("HandlerFor() returned unexpected error: %v", err)
 	}
-	handler := NewWebhookHandler(nil, cfg, logger)
 
-	validPayload := `{"torrent_name": "Ubuntu 24.04 ISO", "save_path": "/downloads"}`
+	validPayload := `{"torrent_name": "Debian ISO", "save_path": "/downloads/iso"}`
 	req := httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString(validPayload))
 	w := httptest.NewRecorder()
-
-	handler.HandleTorrentComplete(w, req)
+	h(w, req)
 
 	resp := w.Result()
-	if resp.StatusCode != http.StatusInternalServerError {
-		t.Errorf("Expected status 500 Internal Server Error, got %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", resp.StatusCode)
 	}
 }
 
-func TestHandleTorrentComplete_Success(t *testing.T) {
-	logger := zap.NewNop()
-	cfg := &config.Config{
-		Hook: []config.WebhookConfig{
-			{
-				Name: "qbittorrent",
-				Path: "/webhook/qbittorrent",
+func TestTorrentWebhookDedup(t *testing.T) {
+	tests := []struct {
+		name         string
+		dedupSeconds int
+		second       string
+		expected     string // status of the second request
+	}{
+		{"Repeated hash", 0, `{"torrent_name": "Debian ISO (copy)", "info_hash": "ABC123"}`, "duplicate"},
+		{"Different hash", 0, `{"torrent_name": "Debian ISO", "info_hash": "def456"}`, "success"},
+		{"Dedup disabled", -1, `{"torrent_name": "Debian ISO", "info_hash": "abc123"}`, "success"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+			h, err := handler.HandlerFor(config.WebhookConfig{
+				Name:         "qbittorrent",
+				Path:         "/webhook/qbittorrent",
+				DedupSeconds: tt.dedupSeconds,
 				Config: config.WebhookProcessorConfig{
 					TelegramChatID:  "123",
-					TelegramMessage: "Downloaded: %s at %s",
+					TelegramMessage: "Downloaded: {{.TorrentName}}",
 				},
+			})
+			if err != nil {
+				t.Fatalf("HandlerFor() returned unexpected error: %v", err)
+			}
+
+			var statuses []string
+			for _, body := range []string{`{"torrent_name": "Debian ISO", "info_hash": "abc123"}`, tt.second} {
+				w := httptest.NewRecorder()
+				h(w, httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString(body)))
+				var resp webhookResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+					t.Fatalf("Response %d %s, expected 200 with JSON", w.Code, w.Body.String())
+				}
+				statuses = append(statuses, resp.Status)
+			}
+			if statuses[0] != "success" || statuses[1] != tt.expected {
+				t.Errorf("Statuses = %v, expected [success %s]", statuses, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWebhookResponseTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		hook        config.WebhookConfig
+		body        string
+		contentType string
+		expected    string
+	}{
+		{
+			name: "Generic payload",
+			hook: config.WebhookConfig{
+				Name:             "sonarr",
+				ResponseTemplate: `{"ok":true,"series":{{json .series.title}}}`,
 			},
+			body:        `{"series": {"title": "Severance"}}`,
+			contentType: "application/json",
+			expected:    `{"ok":true,"series":"Severance"}`,
+		},
+		{
+			name: "Torrent notification",
+			hook: config.WebhookConfig{
+				Name:                "qbittorrent",
+				ResponseTemplate:    "queued {{.TorrentName}}",
+				ResponseContentType: "text/plain",
+			},
+			body:        `{"torrent_name": "Debian ISO"}`,
+			contentType: "text/plain",
+			expected:    "queued Debian ISO",
+		},
+		{
+			name: "Render error falls back to the default",
+			hook: config.WebhookConfig{
+				Name:             "sonarr",
+				ResponseTemplate: `{{json .series.title.nested}}`,
+			},
+			body:        `{"series": {"title": "Severance"}}`,
+			contentType: "application/json",
 		},
 	}
-	handler := NewWebhookHandler(nil, cfg, logger)
 
-	validPayload := `{"torrent_name": "Debian ISO", "save_path": "/downloads/iso"}`
-	req := httptest.NewRequest("POST", "/webhook/qbittorrent", bytes.NewBufferString(validPayload))
-	w := httptest.NewRecorder()
-
-	handler.HandleTorrentComplete(w, req)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+			tt.hook.Config = config.WebhookProcessorConfig{TelegramChatID: "123", TelegramMessage: "done"}
+			h, err := handler.HandlerFor(tt.hook)
+			if err != nil {
+				t.Fatalf("HandlerFor() returned unexpected error: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(tt.body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200 OK, got %d", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, expected %q", got, tt.contentType)
+			}
+			if tt.expected == "" {
+				var resp webhookResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Status != "success" {
+					t.Errorf("Body = %s, expected the default success response", w.Body.String())
+				}
+				return
+			}
+			if w.Body.String() != tt.expected {
+				t.Errorf("Body = %s, expected %s", w.Body.String(), tt.expected)
+			}
+		})
+	}
+}
 
-	resp := w.Result()
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("Expected status 200 OK, got %d", resp.StatusCode)
+func TestWebhookResponseTemplateInvalid(t *testing.T) {
+	handler := NewWebhookHandler(nil, &config.Config{}, zap.NewNop())
+	_, err := handler.HandlerFor(config.WebhookConfig{
+		Name:             "sonarr",
+		ResponseTemplate: "{{.series",
+		Config:           config.WebhookProcessorConfig{TelegramMessage: "done"},
+	})
+	if err == nil {
+		t.Error("Expected startup error for invalid response_template, got nil")
 	}
 }
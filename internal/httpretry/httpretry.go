@@ -0,0 +1,167 @@
+// Package httpretry sends the JSON requests of the HTTP notifiers (Discord,
+// Gotify and notify_webhooks), retrying network errors, 429 and 5xx responses
+// with exponential backoff. Other 4xx responses are not retried.
+package httpretry
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 1 * time.Second
+)
+
+// Request is one JSON request. The URL may carry a token, so it never shows up
+// in the errors returned.
+type Request struct {
+	Method  string            // POST if empty
+	URL     string            // destination, left out of errors
+	Headers map[string]string // sent after Content-Type, which they may override
+	Payload []byte            // JSON body
+}
+
+// RetryAfterFunc reads how long a 429 response asks to wait, 0 if it doesn't say
+type RetryAfterFunc func(resp *http.Response, body []byte) time.Duration
+
+// Client sends Requests with retries
+type Client struct {
+	httpClient  *http.Client
+	logger      *zap.Logger
+	maxAttempts int
+	baseDelay   time.Duration
+	clock       clock.Clock
+	retryAfter  RetryAfterFunc
+}
+
+// New returns a Client making 3 attempts, 1s apart and doubling. retryAfter
+// reads the wait of 429 responses; nil reads the Retry-After header in seconds.
+func New(logger *zap.Logger, retryAfter RetryAfterFunc) *Client {
+	if retryAfter == nil {
+		retryAfter = RetryAfterHeader
+	}
+	return &Client{
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		logger:      logger,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		clock:       clock.Real,
+		retryAfter:  retryAfter,
+	}
+}
+
+// SetClock replaces the clock used to wait between attempts, for tests
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Send sends req until it succeeds, is rejected with a 4xx other than 429, or
+// runs out of attempts. Every failed attempt is logged as "Failed to send
+// <what>" with fields. It returns how many attempts were made and the status
+// of the last response, 0 if there was none.
+func (c *Client) Send(ctx context.Context, what string, req Request, fields ...zap.Field) (attempts, status int, err error) {
+	var lastErr error
+	for attempt := 1; attempt <= c.maxAttempts; attempt++ {
+		code, backoff, retryable, err := c.do(ctx, req, attempt)
+		status = code
+		if err == nil {
+			return attempt, status, nil
+		}
+		if ctx.Err() != nil {
+			return attempt, status, fmt.Errorf("send aborted: %w", ctx.Err())
+		}
+
+		lastErr = err
+		c.logger.Warn("Failed to send "+what, slices.Concat(fields, []zap.Field{
+			zap.Int("status", status),
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+			zap.Int("maxAttempts", c.maxAttempts),
+		})...)
+		if !retryable {
+			return attempt, status, fmt.Errorf("failed to send %s: %w", what, err)
+		}
+		if attempt < c.maxAttempts {
+			if err := c.wait(ctx, backoff); err != nil {
+				return attempt, status, fmt.Errorf("send aborted during backoff: %w (last error: %v)", err, lastErr)
+			}
+		}
+	}
+	return c.maxAttempts, status, fmt.Errorf("failed to send %s after %d attempts: %w", what, c.maxAttempts, lastErr)
+}
+
+// do sends one request and returns the response status (0 if there was none)
+// and, on failure, whether and after how long to retry
+func (c *Client) do(ctx context.Context, r Request, attempt int) (int, time.Duration, bool, error) {
+	backoff := c.baseDelay * time.Duration(1<<uint(attempt-1))
+
+	req, err := http.NewRequestWithContext(ctx, cmp.Or(r.Method, http.MethodPost), r.URL, bytes.NewReader(r.Payload))
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid URL: %w", redactURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, backoff, true, redactURL(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, 0, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if retryAfter := c.retryAfter(resp, body); retryAfter > 0 {
+			backoff = retryAfter
+		}
+		return resp.StatusCode, backoff, true, fmt.Errorf("rate limited (HTTP 429)")
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return resp.StatusCode, 0, false, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, backoff, true, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.clock.After(d):
+		return nil
+	}
+}
+
+// RetryAfterHeader reads the Retry-After header of a 429 response, in seconds
+func RetryAfterHeader(resp *http.Response, _ []byte) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// redactURL drops the request URL, which may carry a token, from net/http errors
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package httpretry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+)
+
+// newTestServer returns a server answering with the given statuses in turn,
+// and the requests it received
+func newTestServer(t *testing.T, statuses ...int) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		status := statuses[min(len(requests), len(statuses))-1]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "5")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("rejected"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      string
+		wantAttempts int
+		wantStatus   int
+		wantSleeps   []time.Duration
+	}{
+		{"Success", []int{http.StatusOK}, "", 1, http.StatusOK, nil},
+		{"Rate limited, then sent", []int{http.StatusTooManyRequests, http.StatusNoContent}, "", 2, http.StatusNoContent, []time.Duration{5 * time.Second}},
+		{"Server error retried with backoff", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, "", 3, http.StatusOK, []time.Duration{time.Second, 2 * time.Second}},
+		{"Client error not retried", []int{http.StatusUnauthorized}, "failed to send test message: HTTP 401: rejected", 1, http.StatusUnauthorized, nil},
+		{"Gives up after max attempts", []int{http.StatusInternalServerError}, "failed to send test message after 3 attempts: HTTP 500", 3, http.StatusInternalServerError, []time.Duration{time.Second, 2 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newTestServer(t, tt.statuses...)
+			c := New(zap.NewNop(), nil)
+			clk := clock.NewFake(time.Now())
+			c.SetClock(clk)
+
+			attempts, status, err := c.Send(context.Background(), "test message", Request{URL: srv.URL, Payload: []byte(`{}`)})
+			if (err != nil) != (tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Fatalf("Send() error = %v, expected %q", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts || len(*requests) != tt.wantAttempts || status != tt.wantStatus {
+				t.Errorf("Send() = %d attempts (%d requests) and status %d, expected %d and %d",
+					attempts, len(*requests), status, tt.wantAttempts, tt.wantStatus)
+			}
+			if got := clk.Waits(); len(got) != len(tt.wantSleeps) {
+				t.Fatalf("Slept %v, expected %v", got, tt.wantSleeps)
+			}
+			for i := range tt.wantSleeps {
+				if clk.Waits()[i] != tt.wantSleeps[i] {
+					t.Errorf("Sleep %d = %v, expected %v", i, clk.Waits()[i], tt.wantSleeps[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSendRequest(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK)
+	c := New(zap.NewNop(), nil)
+
+	req := Request{
+		Method:  http.MethodPut,
+		URL:     srv.URL + "/codes",
+		Headers: map[string]string{"Authorization": "Bearer token", "Content-Type": "application/vnd.api+json"},
+		Payload: []byte(`{}`),
+	}
+	if _, _, err := c.Send(context.Background(), "test message", req); err != nil {
+		t.Fatalf("Send() returned unexpected error: %v", err)
+	}
+	got := (*requests)[0]
+	if got.Method != http.MethodPut || got.URL.Path != "/codes" {
+		t.Errorf("Sent %s %s, expected PUT /codes", got.Method, got.URL.Path)
+	}
+	if got.Header.Get("Authorization") != "Bearer token" || got.Header.Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("Sent headers %v, expected the request headers over the default Content-Type", got.Header)
+	}
+}
+
+func TestSendRetryAfterFunc(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusTooManyRequests, http.StatusOK)
+	c := New(zap.NewNop(), func(_ *http.Response, body []byte) time.Duration {
+		if string(body) != "rejected" {
+			t.Errorf("RetryAfterFunc got body %q, expected the response body", body)
+		}
+		return 500 * time.Millisecond
+	})
+	clk := clock.NewFake(time.Now())
+	c.SetClock(clk)
+
+	if _, _, err := c.Send(context.Background(), "test message", Request{URL: srv.URL}); err != nil {
+		t.Fatalf("Send() returned unexpected error: %v", err)
+	}
+	if got := clk.Waits(); len(got) != 1 || got[0] != 500*time.Millisecond {
+		t.Errorf("Slept %v, expected the wait from RetryAfterFunc", got)
+	}
+}
+
+func TestSendRedactsURL(t *testing.T) {
+	// Nothing listens on the port, so every attempt fails with the URL in the error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	c := New(zap.NewNop(), nil)
+	c.SetClock(clock.NewFake(time.Now()))
+	_, status, err := c.Send(context.Background(), "test message", Request{URL: "http://" + addr + "/secret-token"})
+	if err == nil || status != 0 {
+		t.Fatalf("Send() = status %d and %v, expected a network error without status", status, err)
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("Send() leaked the URL: %v", err)
+	}
+}
+
+func TestSendAborted(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusBadGateway)
+	c := New(zap.NewNop(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := c.Send(ctx, "test message", Request{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "send aborted") {
+		t.Errorf("Send() = %v, expected the send aborted", err)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Sent %d requests, expected none after the context was canceled", len(*requests))
+	}
+}
@@ -0,0 +1,27 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewAudit builds the logger for a record trail such as server.audit_log or
+// email.dead_letter: one JSON line per entry, always at Info whatever
+// server.log_level says. The sink is a file path, "stdout" or "stderr"; an
+// empty sink disables it.
+func NewAudit(sink string) (*zap.Logger, error) {
+	if sink == "" {
+		return zap.NewNop(), nil
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	cfg.Sampling = nil // every entry must be recorded
+	cfg.DisableCaller = true
+	cfg.DisableStacktrace = true
+	cfg.EncoderConfig.TimeKey = "time"
+	cfg.EncoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	cfg.OutputPaths = []string{sink}
+	cfg.ErrorOutputPaths = []string{"stderr"}
+	return cfg.Build()
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewAudit(t *testing.T) {
+	disabled, err := NewAudit("")
+	if err != nil {
+		t.Fatalf("NewAudit(\"\") returned unexpected error: %v", err)
+	}
+	if disabled.Core().Enabled(zap.InfoLevel) {
+		t.Error("NewAudit(\"\") logs, expected a no-op logger")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAudit(path)
+	if err != nil {
+		t.Fatalf("NewAudit() returned unexpected error: %v", err)
+	}
+	audit.Info("code forwarded", zap.String("service", "github"))
+	_ = audit.Sync()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("Audit log line is not JSON: %v (%s)", err, data)
+	}
+	if line["service"] != "github" || line["msg"] != "code forwarded" || line["time"] == nil {
+		t.Errorf("Audit log line = %v, expected time, msg and service", line)
+	}
+}
@@ -0,0 +1,37 @@
+// Package logging builds the application zap logger from the server config.
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New builds a logger for the given level (debug, info, warn or error; default info)
+// and format: json (default) for production, or console for the human-readable
+// development encoder
+func New(level, format string) (*zap.Logger, error) {
+	var cfg zap.Config
+	switch strings.ToLower(format) {
+	case "", "json":
+		cfg = zap.NewProductionConfig()
+	case "console":
+		cfg = zap.NewDevelopmentConfig()
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use json or console)", format)
+	}
+
+	lvl := zapcore.InfoLevel
+	if level != "" {
+		parsed, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+		lvl = parsed
+	}
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+
+	return cfg.Build()
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    string
+		format   string
+		expected zapcore.Level
+		wantErr  bool
+	}{
+		{"Defaults", "", "", zapcore.InfoLevel, false},
+		{"Debug JSON", "debug", "json", zapcore.DebugLevel, false},
+		{"Console defaults to info", "", "console", zapcore.InfoLevel, false},
+		{"Warn console", "WARN", "Console", zapcore.WarnLevel, false},
+		{"Invalid level", "verbose", "", zapcore.InfoLevel, true},
+		{"Invalid format", "info", "xml", zapcore.InfoLevel, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := New(tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !logger.Core().Enabled(tt.expected) {
+				t.Errorf("New() logger does not log at %v", tt.expected)
+			}
+			if tt.expected > zapcore.DebugLevel && logger.Core().Enabled(tt.expected-1) {
+				t.Errorf("New() logger logs below %v", tt.expected)
+			}
+		})
+	}
+}
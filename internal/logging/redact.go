@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// sensitive permite registrar códigos y cuerpos sin enmascarar (server.log_sensitive)
+var sensitive atomic.Bool
+
+// SetSensitive enables or disables logging of raw codes and email bodies
+func SetSensitive(enabled bool) {
+	sensitive.Store(enabled)
+}
+
+// Code returns a field holding value masked to its first and last character,
+// or the raw value when sensitive logging is enabled
+func Code(key, value string) zap.Field {
+	if sensitive.Load() {
+		return zap.String(key, value)
+	}
+	return zap.String(key, MaskCode(value))
+}
+
+// Text returns a field that only records the length of text, or text
+// truncated to maxLen runes when sensitive logging is enabled
+func Text(key, text string, maxLen int) zap.Field {
+	if sensitive.Load() {
+		return zap.String(key, truncate(text, maxLen))
+	}
+	return zap.String(key, fmt.Sprintf("[redacted %d bytes]", len(text)))
+}
+
+// MaskCode keeps the first and last character of code and masks the rest
+func MaskCode(code string) string {
+	runes := []rune(code)
+	if len(runes) <= 2 {
+		return "***"
+	}
+	return string(runes[0]) + "***" + string(runes[len(runes)-1])
+}
+
+func truncate(s string, maxLen int) string {
+	runes := []rune(s)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return s
+	}
+	return string(runes[:maxLen]) + "..."
+}
@@ -0,0 +1,56 @@
+package logging
+
+import "testing"
+
+func TestMaskCode(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"123456", "1***6"},
+		{"abc-def", "a***f"},
+		{"12", "***"},
+		{"", "***"},
+	}
+
+	for _, tt := range tests {
+		if got := MaskCode(tt.code); got != tt.expected {
+			t.Errorf("MaskCode(%q) = %s, expected %s", tt.code, got, tt.expected)
+		}
+	}
+}
+
+func TestSensitiveFields(t *testing.T) {
+	defer SetSensitive(false)
+
+	tests := []struct {
+		name      string
+		sensitive bool
+		code      string
+		text      string
+	}{
+		{"Redacted by default", false, "1***6", "[redacted 11 bytes]"},
+		{"Sensitive logging", true, "123456", "hello..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSensitive(tt.sensitive)
+			if got := Code("code", "123456").String; got != tt.code {
+				t.Errorf("Code() = %s, expected %s", got, tt.code)
+			}
+			if got := Text("body", "hello world", 5).String; got != tt.text {
+				t.Errorf("Text() = %s, expected %s", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("hello world", 5); got != "hello..." {
+		t.Errorf("truncate() = %s, expected hello...", got)
+	}
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("truncate() = %s, expected short", got)
+	}
+}
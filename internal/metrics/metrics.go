@@ -0,0 +1,115 @@
+// Package metrics holds the Prometheus collectors shared by handlers and services.
+// It has no dependencies on other internal packages so anything can import it.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "automation_hub"
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	EmailsFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_fetched_total",
+		Help:      "Emails fetched from the IMAP server.",
+	}, []string{"account"})
+
+	IMAPPollErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "imap_poll_errors_total",
+		Help:      "IMAP polling cycles that failed to connect, search or fetch.",
+	}, []string{"account"})
+
+	IMAPLastErrorTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "imap_last_error_timestamp_seconds",
+		Help:      "Unix time of the last IMAP polling cycle that failed, 0 if none.",
+	}, []string{"account"})
+
+	EmailsMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_matched_total",
+		Help:      "Emails claimed by a processor.",
+	}, []string{"account", "processor"})
+
+	ProcessingErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processing_errors_total",
+		Help:      "Emails a processor failed to process.",
+	}, []string{"account", "processor"})
+
+	EmailsDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_dead_lettered_total",
+		Help:      "Emails given up on after email.max_attempts failed cycles.",
+	}, []string{"account", "processor"})
+
+	TelegramSendFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_send_failures_total",
+		Help:      "Telegram messages that could not be sent after retries.",
+	})
+
+	TelegramCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "telegram_circuit_state",
+		Help:      "State of the Telegram circuit breaker: 0 closed, 1 open (sends fail fast), 2 half-open (probing).",
+	})
+
+	WebhookRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_requests_total",
+		Help:      "Webhook requests by hook name and HTTP status code.",
+	}, []string{"webhook", "status"})
+
+	WebhookAuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_auth_failures_total",
+		Help:      "Webhook requests rejected for a missing or invalid bearer token or signature.",
+	}, []string{"webhook"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EmailsFetched,
+		IMAPPollErrors,
+		IMAPLastErrorTimestamp,
+		EmailsMatched,
+		ProcessingErrors,
+		EmailsDeadLettered,
+		TelegramSendFailures,
+		TelegramCircuitState,
+		WebhookRequests,
+		WebhookAuthFailures,
+	)
+}
+
+// InitAccount pre-creates the per-account IMAP series so they are exported at
+// zero before the first poll
+func InitAccount(account string) {
+	EmailsFetched.WithLabelValues(account)
+	IMAPPollErrors.WithLabelValues(account)
+	IMAPLastErrorTimestamp.WithLabelValues(account)
+}
+
+// InitProcessor pre-creates the per-processor series of an account so they are
+// exported at zero before the first email arrives
+func InitProcessor(account, name string) {
+	EmailsMatched.WithLabelValues(account, name)
+	ProcessingErrors.WithLabelValues(account, name)
+	EmailsDeadLettered.WithLabelValues(account, name)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
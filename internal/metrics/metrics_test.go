@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerExposesCollectors(t *testing.T) {
+	InitAccount("personal")
+	InitProcessor("personal", "cloudflare")
+	EmailsFetched.WithLabelValues("personal").Inc()
+	WebhookRequests.WithLabelValues("qbittorrent", "200").Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics response: %v", err)
+	}
+
+	for _, expected := range []string{
+		`automation_hub_emails_fetched_total{account="personal"} 1`,
+		`automation_hub_emails_matched_total{account="personal",processor="cloudflare"} 0`,
+		`automation_hub_processing_errors_total{account="personal",processor="cloudflare"} 0`,
+		`automation_hub_webhook_requests_total{status="200",webhook="qbittorrent"}`,
+		"automation_hub_imap_poll_errors_total",
+		"automation_hub_telegram_send_failures_total",
+		"automation_hub_telegram_circuit_state",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected metrics output to contain %q", expected)
+		}
+	}
+}
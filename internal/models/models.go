@@ -1,22 +1,62 @@
 package models
 
+import (
+	"context"
+	"time"
+)
+
 // Email represents an email message
 type Email struct {
-	Subject   string
-	From      string
-	TextPlain string
-	ID        string
+	Subject          string
+	From             string
+	TextPlain        string
+	ID               string
+	UID              uint32       // IMAP UID, used to mark as read or move after processing
+	Date             time.Time    // Date header, zero if missing
+	Charset          string       // charset declared by the text part, kept for debugging
+	TransferEncoding string       // Content-Transfer-Encoding of the text part, empty once decoded
+	Attachments      []Attachment // decoded attachments, empty for single-part emails
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename string
+	MIMEType string
+	Data     []byte
 }
 
 // TorrentNotification represents a torrent completion notification
 type TorrentNotification struct {
 	TorrentName string `json:"torrent_name"`
 	SavePath    string `json:"save_path"`
+	// Optional, sent by qBittorrent when the command line includes them
+	Category    string `json:"category"`
+	Size        int64  `json:"size"` // bytes
+	Tracker     string `json:"tracker"`
+	ContentPath string `json:"content_path"`
+	InfoHash    string `json:"info_hash"` // used to drop repeated notifications
+}
+
+// CodeNotification is the JSON body posted to notify_webhooks endpoints
+type CodeNotification struct {
+	Service string `json:"service"`
+	Code    string `json:"code"`
+	Subject string `json:"subject"`
+	From    string `json:"from"`
+}
+
+// ProcessingResult is what processing an email produced
+type ProcessingResult struct {
+	Service string // processor that handled the email
+	Code    string // extracted code, empty when none was found
+	Matched bool   // false when no processor handled the email
+	Sent    bool   // a notifier accepted the message or an attachment
+	Skipped string // why a matched email was left unsent without an error, empty otherwise
 }
 
 // EmailProcessor Processor interface for email processors
 type EmailProcessor interface {
 	ShouldProcess(email Email) bool
-	Process(email Email) error
+	Process(ctx context.Context, email Email) error
 	GetSender() string
 }
@@ -0,0 +1,147 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/httpretry"
+)
+
+// maxContentLength is the longest message a Discord webhook accepts
+const maxContentLength = 2000
+
+// Client posts messages to Discord channels through incoming webhooks
+type Client struct {
+	retry    *httpretry.Client
+	logger   *zap.Logger
+	webhooks map[string]string
+	dryRun   atomic.Bool
+}
+
+func NewClient(cfg config.DiscordConfig, logger *zap.Logger) *Client {
+	webhooks := make(map[string]string, len(cfg.Webhooks))
+	for alias, webhookURL := range cfg.Webhooks {
+		webhooks[alias] = string(webhookURL)
+	}
+
+	return &Client{
+		retry:    httpretry.New(logger, parseRetryAfter),
+		logger:   logger,
+		webhooks: webhooks,
+	}
+}
+
+// SetDryRun makes SendMessageContext log messages instead of posting them
+func (c *Client) SetDryRun(enabled bool) {
+	c.dryRun.Store(enabled)
+}
+
+// SendMessageContext posts a message to a webhook, given as an alias from
+// discord.webhooks or a full URL. Rate limits, network errors and 5xx responses
+// are retried; other 4xx responses are not.
+func (c *Client) SendMessageContext(ctx context.Context, webhook, message string) error {
+	if c == nil {
+		return nil
+	}
+
+	webhookURL, err := c.resolveWebhook(webhook)
+	if err != nil {
+		return err
+	}
+
+	if utf8.RuneCountInString(message) > maxContentLength {
+		c.logger.Warn("Discord message too long, truncating",
+			zap.String("webhook", webhookName(webhook)),
+			zap.Int("length", utf8.RuneCountInString(message)))
+		message = string([]rune(message)[:maxContentLength-1]) + "…"
+	}
+
+	if c.dryRun.Load() {
+		c.logger.Info("Dry run: Discord message not sent",
+			zap.String("webhook", webhookName(webhook)),
+			zap.String("message", message))
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{"content": message})
+	if err != nil {
+		return fmt.Errorf("failed to encode Discord message: %w", err)
+	}
+
+	attempt, _, err := c.retry.Send(ctx, "Discord message", httpretry.Request{URL: webhookURL, Payload: payload},
+		zap.String("webhook", webhookName(webhook)))
+	if err != nil {
+		return err
+	}
+	c.logger.Info("Discord message sent successfully",
+		zap.String("webhook", webhookName(webhook)),
+		zap.Int("attempt", attempt))
+	return nil
+}
+
+// parseRetryAfter reads the retry_after seconds of a Discord 429 response
+func parseRetryAfter(_ *http.Response, body []byte) time.Duration {
+	var rateLimit struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &rateLimit); err != nil {
+		return 0
+	}
+	return time.Duration(rateLimit.RetryAfter * float64(time.Second))
+}
+
+// resolveWebhook maps an alias from discord.webhooks to its URL. Full https://
+// URLs are returned unchanged.
+func (c *Client) resolveWebhook(webhook string) (string, error) {
+	webhook = strings.TrimSpace(webhook)
+	if strings.HasPrefix(webhook, "https://") {
+		return webhook, nil
+	}
+	if webhookURL, ok := c.webhooks[webhook]; ok && webhookURL != "" {
+		return webhookURL, nil
+	}
+	return "", fmt.Errorf("unknown Discord webhook alias %q", webhook)
+}
+
+// CheckWebhooks verifies that every webhook is a known alias or an https:// URL,
+// so configuration mistakes surface at startup
+func (c *Client) CheckWebhooks(webhooks ...string) error {
+	var errs []error
+	for _, webhook := range webhooks {
+		if _, err := c.resolveWebhook(webhook); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Escape escapes Discord's inline markdown so text such as an extracted code is
+// shown literally. Hyphens and other block markers are left alone.
+func (c *Client) Escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\*_~`|", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// webhookName is the webhook as logged: aliases as is, URLs without their token
+func webhookName(webhook string) string {
+	if strings.HasPrefix(webhook, "https://") {
+		return "[URL]"
+	}
+	return webhook
+}
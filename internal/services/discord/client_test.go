@@ -0,0 +1,146 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+// newTestClient returns a Client whose "codes" webhook points at a fake Discord
+// answering with status, and the contents it received. Retries are left to
+// httpretry.
+func newTestClient(t *testing.T, status int) (*Client, *[]string) {
+	t.Helper()
+
+	var contents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Content string `json:"content"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Invalid JSON payload: %v", err)
+		}
+		contents = append(contents, payload.Content)
+
+		w.WriteHeader(status)
+		if status == http.StatusNotFound {
+			_, _ = w.Write([]byte(`{"message":"Unknown Webhook","code":10015}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(config.DiscordConfig{
+		Webhooks: map[string]config.Secret{"codes": config.Secret(srv.URL + "/api/webhooks/1/secret-token")},
+	}, zap.NewNop())
+	return client, &contents
+}
+
+func TestSendMessageContext(t *testing.T) {
+	client, contents := newTestClient(t, http.StatusNoContent)
+
+	if err := client.SendMessageContext(context.Background(), "codes", "Code: 123456"); err != nil {
+		t.Fatalf("SendMessageContext() returned unexpected error: %v", err)
+	}
+	if len(*contents) != 1 || (*contents)[0] != "Code: 123456" {
+		t.Errorf("Posted contents = %q, expected one post of %q", *contents, "Code: 123456")
+	}
+}
+
+func TestSendMessageContextUnknownWebhook(t *testing.T) {
+	// A deleted webhook is permanent, so it is posted once
+	client, contents := newTestClient(t, http.StatusNotFound)
+
+	err := client.SendMessageContext(context.Background(), "codes", "Code: 123456")
+	if err == nil || !strings.Contains(err.Error(), "Unknown Webhook") {
+		t.Fatalf("SendMessageContext() = %v, expected the Unknown Webhook error", err)
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("SendMessageContext() leaked the webhook token: %v", err)
+	}
+	if len(*contents) != 1 {
+		t.Errorf("Expected 1 post, got %d", len(*contents))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected time.Duration
+	}{
+		{`{"message":"You are being rate limited.","retry_after":0.5,"global":false}`, 500 * time.Millisecond},
+		{`{"message":"You are being rate limited."}`, 0},
+		{`<html>Too Many Requests</html>`, 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(nil, []byte(tt.body)); got != tt.expected {
+			t.Errorf("parseRetryAfter(%s) = %v, expected %v", tt.body, got, tt.expected)
+		}
+	}
+}
+
+func TestSendMessageContextDryRunAndTruncation(t *testing.T) {
+	client, contents := newTestClient(t, http.StatusNoContent)
+
+	client.SetDryRun(true)
+	if err := client.SendMessageContext(context.Background(), "codes", "Code: 123456"); err != nil {
+		t.Errorf("SendMessageContext() in dry run = %v, expected nil", err)
+	}
+	if len(*contents) != 0 {
+		t.Errorf("Expected no posts in dry run, got %d", len(*contents))
+	}
+
+	client.SetDryRun(false)
+	if err := client.SendMessageContext(context.Background(), "codes", strings.Repeat("é", 2500)); err != nil {
+		t.Fatalf("SendMessageContext() returned unexpected error: %v", err)
+	}
+	if got := utf8.RuneCountInString((*contents)[0]); got != maxContentLength {
+		t.Errorf("Posted %d characters, expected %d", got, maxContentLength)
+	}
+}
+
+func TestCheckWebhooks(t *testing.T) {
+	client := NewClient(config.DiscordConfig{
+		Webhooks: map[string]config.Secret{"codes": "https://discord.com/api/webhooks/1/token"},
+	}, zap.NewNop())
+
+	if err := client.CheckWebhooks("codes", "https://discord.com/api/webhooks/2/token"); err != nil {
+		t.Errorf("CheckWebhooks() = %v, expected nil", err)
+	}
+	err := client.CheckWebhooks("codes", "alerts")
+	if err == nil || !strings.Contains(err.Error(), `"alerts"`) {
+		t.Errorf("CheckWebhooks() = %v, expected error naming alerts", err)
+	}
+	if err := client.SendMessageContext(context.Background(), "alerts", "Hi"); err == nil {
+		t.Error("SendMessageContext() = nil, expected error for unknown alias")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"123456", "123456"},
+		{"aw9s5-y1zoy", "aw9s5-y1zoy"},
+		{"a_b*c", `a\_b\*c`},
+		{"`code`", "\\`code\\`"},
+		{"||x|| ~~y~~", `\|\|x\|\| \~\~y\~\~`},
+	}
+
+	client := NewClient(config.DiscordConfig{}, zap.NewNop())
+	for _, tt := range tests {
+		if got := client.Escape(tt.input); got != tt.expected {
+			t.Errorf("Escape(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
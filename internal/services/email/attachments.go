@@ -0,0 +1,79 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+
+	"github.com/emersion/go-imap"
+
+	"automation-hub/internal/models"
+)
+
+// parseAttachments extracts the files attached to a multipart message from its
+// BODY[TEXT], using the boundary declared in the body structure. Parts that
+// fail to parse are skipped so a malformed attachment never loses the text.
+func parseAttachments(bs *imap.BodyStructure, body []byte) []models.Attachment {
+	if bs == nil || !strings.EqualFold(bs.MIMEType, "multipart") || bs.Params["boundary"] == "" {
+		return nil
+	}
+	return readMultipart(bytes.NewReader(body), bs.Params["boundary"])
+}
+
+func readMultipart(r io.Reader, boundary string) []models.Attachment {
+	var attachments []models.Attachment
+	reader := multipart.NewReader(r, boundary)
+	for {
+		// NextPart decodes quoted-printable parts transparently
+		part, err := reader.NextPart()
+		if err != nil {
+			return attachments
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "application/octet-stream"
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			attachments = append(attachments, readMultipart(part, params["boundary"])...)
+			continue
+		}
+
+		filename := attachmentFilename(part.Header.Get("Content-Disposition"), params)
+		if filename == "" {
+			continue
+		}
+
+		var data io.Reader = part
+		if strings.EqualFold(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding")), "base64") {
+			data = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		content, err := io.ReadAll(data)
+		if err != nil {
+			continue
+		}
+
+		attachments = append(attachments, models.Attachment{
+			Filename: filename,
+			MIMEType: mediaType,
+			Data:     content,
+		})
+	}
+}
+
+// attachmentFilename returns the filename of a part that is an attachment or
+// an inline file, falling back to the legacy Content-Type name parameter
+func attachmentFilename(disposition string, contentTypeParams map[string]string) string {
+	kind, params, err := mime.ParseMediaType(disposition)
+	name := params["filename"]
+	if err != nil || name == "" {
+		name = contentTypeParams["name"]
+	}
+	if name == "" && err == nil && kind == "attachment" {
+		name = "attachment"
+	}
+	return decodeHeader(name)
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestParseAttachments(t *testing.T) {
+	body := "--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"See the attached code\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"code.pdf\"\r\n" +
+		"Content-Disposition: attachment; filename=\"code.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0x\r\nLjQ=\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png; name=\"=?UTF-8?Q?c=C3=B3digo.png?=\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"iVBORw==\r\n" +
+		"--outer--\r\n"
+
+	bs := &imap.BodyStructure{
+		MIMEType:    "multipart",
+		MIMESubType: "mixed",
+		Params:      map[string]string{"boundary": "outer"},
+	}
+
+	attachments := parseAttachments(bs, []byte(body))
+	if len(attachments) != 2 {
+		t.Fatalf("parseAttachments() returned %d attachments, expected 2", len(attachments))
+	}
+
+	tests := []struct {
+		filename string
+		mimeType string
+		data     string
+	}{
+		{"code.pdf", "application/pdf", "%PDF-1.4"},
+		{"código.png", "image/png", "\x89PNG"},
+	}
+	for i, tt := range tests {
+		got := attachments[i]
+		if got.Filename != tt.filename || got.MIMEType != tt.mimeType || string(got.Data) != tt.data {
+			t.Errorf("attachments[%d] = {%s %s %q}, expected {%s %s %q}",
+				i, got.Filename, got.MIMEType, got.Data, tt.filename, tt.mimeType, tt.data)
+		}
+	}
+}
+
+func TestParseAttachmentsSinglePart(t *testing.T) {
+	bs := &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain"}
+	if got := parseAttachments(bs, []byte("Your code is 123456")); got != nil {
+		t.Errorf("parseAttachments() = %v, expected nil", got)
+	}
+	if got := parseAttachments(nil, nil); got != nil {
+		t.Errorf("parseAttachments(nil) = %v, expected nil", got)
+	}
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-imap/client"
+	"go.uber.org/zap"
+)
+
+// moveCapability is advertised by servers implementing RFC 6851
+const moveCapability = "MOVE"
+
+// recordCapabilities queries the capabilities after the first login and caches
+// them, since they only change with a server upgrade. Optional behaviors check
+// the cache with supports instead of trying commands and handling the errors.
+func (c *IMAPClient) recordCapabilities(imapClient *client.Client) {
+	c.mu.RLock()
+	known := c.capabilities != nil
+	c.mu.RUnlock()
+	if known {
+		return
+	}
+
+	caps, err := imapClient.Capability()
+	if err != nil {
+		c.logger.Warn("Failed to list IMAP capabilities", zap.Error(err))
+		return
+	}
+	capabilities := make([]string, 0, len(caps))
+	for name, supported := range caps {
+		if supported {
+			capabilities = append(capabilities, name)
+		}
+	}
+	slices.Sort(capabilities)
+
+	c.mu.Lock()
+	if c.capabilities != nil {
+		// Another folder got there first
+		c.mu.Unlock()
+		return
+	}
+	c.capabilities = capabilities
+	c.mu.Unlock()
+
+	c.logger.Info("IMAP server capabilities", zap.Strings("capabilities", capabilities))
+	if c.config.MoveToFolder != "" && !c.supports(moveCapability) {
+		c.logger.Info("IMAP server has no MOVE, processed emails are moved with COPY, STORE and EXPUNGE")
+	}
+	if c.config.Compress && !c.supports(compressCapability) {
+		c.logger.Info("IMAP server does not offer compression, email.compress has no effect")
+	}
+}
+
+// Capabilities returns the capabilities the server advertised after login,
+// sorted, or nil until the first successful login
+func (c *IMAPClient) Capabilities() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.capabilities)
+}
+
+// supports reports whether the server advertised the capability, which are
+// case-insensitive
+func (c *IMAPClient) supports(capability string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.ContainsFunc(c.capabilities, func(name string) bool {
+		return strings.EqualFold(name, capability)
+	})
+}
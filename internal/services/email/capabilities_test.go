@@ -0,0 +1,37 @@
+package email
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCapabilitiesCachedAfterLogin(t *testing.T) {
+	cfg, _ := startIMAPServer(t, true, false)
+	c := NewIMAPClient(cfg, zap.NewNop())
+
+	if caps := c.Capabilities(); caps != nil {
+		t.Fatalf("Capabilities() before login = %v, expected nil", caps)
+	}
+	if _, err := c.Check(context.Background()); err != nil {
+		t.Fatalf("Check() returned unexpected error: %v", err)
+	}
+
+	caps := c.Capabilities()
+	if !slices.Contains(caps, "IMAP4rev1") || !slices.IsSorted(caps) {
+		t.Errorf("Capabilities() = %v, expected a sorted list with IMAP4rev1", caps)
+	}
+	if !c.supports("imap4rev1") {
+		t.Error("supports(imap4rev1) = false, expected a case-insensitive match")
+	}
+	if c.supports(compressCapability) {
+		t.Errorf("supports(%s) = true for a server without compression", compressCapability)
+	}
+
+	caps[0] = "changed"
+	if c.Capabilities()[0] == "changed" {
+		t.Error("Capabilities() returned the cached slice instead of a copy")
+	}
+}
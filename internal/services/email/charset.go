@@ -0,0 +1,102 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// wordDecoder decodes RFC 2047 encoded-words (=?charset?Q?...?=) in header fields
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: charsetReader,
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeHeader decodes any encoded-words left in a header value, returning the input unchanged on error
+func decodeHeader(s string) string {
+	decoded, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// bodyCharset returns the charset and transfer encoding of the text part of a message,
+// preferring text/plain over other text/* parts
+func bodyCharset(bs *imap.BodyStructure) (charset, encoding string) {
+	if bs == nil {
+		return "", ""
+	}
+
+	var fallback *imap.BodyStructure
+	var plain *imap.BodyStructure
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if !strings.EqualFold(part.MIMEType, "text") {
+			return true
+		}
+		if plain == nil && strings.EqualFold(part.MIMESubType, "plain") {
+			plain = part
+		}
+		if fallback == nil {
+			fallback = part
+		}
+		return true
+	})
+
+	part := plain
+	if part == nil {
+		part = fallback
+	}
+	if part == nil {
+		return "", ""
+	}
+	return strings.ToLower(part.Params["charset"]), strings.ToLower(part.Encoding)
+}
+
+// isUTF8Compatible reports whether text in the given charset can be used as-is
+func isUTF8Compatible(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// toUTF8 converts a body in the given charset to UTF-8. Quoted-printable bodies are
+// decoded first so that escaped 8-bit sequences (e.g. =E9) are converted correctly.
+func toUTF8(body, charset, encoding string) (string, error) {
+	if isUTF8Compatible(charset) {
+		return body, nil
+	}
+
+	if encoding == "quoted-printable" {
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+		if err != nil {
+			return body, fmt.Errorf("failed to decode quoted-printable body: %w", err)
+		}
+		body = string(decoded)
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return body, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+
+	converted, err := enc.NewDecoder().String(body)
+	if err != nil {
+		return body, fmt.Errorf("failed to convert body from %q: %w", charset, err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,206 @@
+package email
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+func TestDecodeHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Plain subject",
+			input:    "Your verification code",
+			expected: "Your verification code",
+		},
+		{
+			name:     "UTF-8 Q-encoded subject",
+			input:    "=?UTF-8?Q?Inicia_sesi=C3=B3n_en_Perplexity?=",
+			expected: "Inicia sesión en Perplexity",
+		},
+		{
+			name:     "Latin-1 Q-encoded subject",
+			input:    "=?ISO-8859-1?Q?C=F3digo_de_verificaci=F3n?=",
+			expected: "Código de verificación",
+		},
+		{
+			name:     "UTF-8 B-encoded subject",
+			input:    "=?UTF-8?B?Q8OzZGlnbw==?=",
+			expected: "Código",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeHeader(tt.input); got != tt.expected {
+				t.Errorf("decodeHeader() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBodyCharset(t *testing.T) {
+	single := &imap.BodyStructure{
+		MIMEType:    "text",
+		MIMESubType: "plain",
+		Params:      map[string]string{"charset": "ISO-8859-1"},
+		Encoding:    "quoted-printable",
+	}
+	charset, encoding := bodyCharset(single)
+	if charset != "iso-8859-1" || encoding != "quoted-printable" {
+		t.Errorf("bodyCharset() = %q, %q, expected iso-8859-1, quoted-printable", charset, encoding)
+	}
+
+	multipart := &imap.BodyStructure{
+		MIMEType:    "multipart",
+		MIMESubType: "alternative",
+		Parts: []*imap.BodyStructure{
+			{MIMEType: "text", MIMESubType: "html", Params: map[string]string{"charset": "utf-8"}},
+			{MIMEType: "text", MIMESubType: "plain", Params: map[string]string{"charset": "windows-1252"}, Encoding: "8bit"},
+		},
+	}
+	charset, encoding = bodyCharset(multipart)
+	if charset != "windows-1252" || encoding != "8bit" {
+		t.Errorf("bodyCharset() = %q, %q, expected windows-1252, 8bit", charset, encoding)
+	}
+
+	if charset, encoding := bodyCharset(nil); charset != "" || encoding != "" {
+		t.Errorf("bodyCharset(nil) = %q, %q, expected empty", charset, encoding)
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		charset  string
+		encoding string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "UTF-8 body unchanged",
+			body:     "Tu código es 123456",
+			charset:  "utf-8",
+			expected: "Tu código es 123456",
+		},
+		{
+			name:     "Latin-1 8bit body",
+			body:     "Tu c\xf3digo es 123456",
+			charset:  "iso-8859-1",
+			encoding: "8bit",
+			expected: "Tu código es 123456",
+		},
+		{
+			name:     "Latin-1 quoted-printable body",
+			body:     "Tu c=F3digo es 123456",
+			charset:  "iso-8859-1",
+			encoding: "quoted-printable",
+			expected: "Tu código es 123456",
+		},
+		{
+			name:     "Unknown charset",
+			body:     "Tu codigo es 123456",
+			charset:  "x-unknown",
+			expected: "Tu codigo es 123456",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toUTF8(tt.body, tt.charset, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toUTF8() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("toUTF8() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseMessageLatin1(t *testing.T) {
+	logger := zap.NewNop()
+	client := NewIMAPClient(config.EmailConfig{}, logger)
+
+	section, err := imap.ParseBodySectionName("BODY[TEXT]")
+	if err != nil {
+		t.Fatalf("Failed to parse section name: %v", err)
+	}
+
+	msg := &imap.Message{
+		Envelope: &imap.Envelope{
+			MessageId: "msg-latin1",
+			Subject:   "=?ISO-8859-1?Q?C=F3digo?=",
+		},
+		BodyStructure: &imap.BodyStructure{
+			MIMEType:    "text",
+			MIMESubType: "plain",
+			Params:      map[string]string{"charset": "iso-8859-1"},
+			Encoding:    "quoted-printable",
+		},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			section: bytes.NewBufferString("Tu c=F3digo es 654321"),
+		},
+	}
+
+	email, err := client.parseMessage(msg)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if email.Subject != "Código" {
+		t.Errorf("Expected Subject Código, got %q", email.Subject)
+	}
+	if email.Charset != "iso-8859-1" {
+		t.Errorf("Expected Charset iso-8859-1, got %q", email.Charset)
+	}
+	if email.TextPlain != "Tu código es 654321" {
+		t.Errorf("Expected decoded body, got %q", email.TextPlain)
+	}
+	if email.TransferEncoding != "" {
+		t.Errorf("Expected no TransferEncoding once decoded, got %q", email.TransferEncoding)
+	}
+}
+
+func TestParseMessageKeepsQuotedPrintableUTF8(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{}, zap.NewNop())
+
+	section, err := imap.ParseBodySectionName("BODY[TEXT]")
+	if err != nil {
+		t.Fatalf("Failed to parse section name: %v", err)
+	}
+
+	// UTF-8 bodies are left encoded for the processors, which decode them
+	msg := &imap.Message{
+		Envelope: &imap.Envelope{MessageId: "msg-qp"},
+		BodyStructure: &imap.BodyStructure{
+			MIMEType:    "text",
+			MIMESubType: "plain",
+			Params:      map[string]string{"charset": "utf-8"},
+			Encoding:    "quoted-printable",
+		},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			section: bytes.NewBufferString("Tu c=C3=B3digo es 654321"),
+		},
+	}
+
+	email, err := client.parseMessage(msg)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if email.TransferEncoding != "quoted-printable" {
+		t.Errorf("Expected TransferEncoding quoted-printable, got %q", email.TransferEncoding)
+	}
+	if email.TextPlain != "Tu c=C3=B3digo es 654321" {
+		t.Errorf("Expected body left encoded, got %q", email.TextPlain)
+	}
+}
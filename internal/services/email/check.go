@@ -0,0 +1,16 @@
+package email
+
+import "context"
+
+// Check connects, logs in and opens the first folder read-only, the way every
+// poll does, and returns the capabilities the server advertises. It lets bad
+// credentials or an unreachable host surface at startup instead of on the
+// first poll.
+func (c *IMAPClient) Check(ctx context.Context) ([]string, error) {
+	imapClient, err := c.connectAndLogin(ctx, c.folders[0].name, true)
+	if err != nil {
+		return nil, err
+	}
+	defer c.logout(imapClient)
+	return c.Capabilities(), nil
+}
@@ -0,0 +1,26 @@
+package email
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheck(t *testing.T) {
+	cfg, _ := startIMAPServer(t, true, false)
+
+	capabilities, err := NewIMAPClient(cfg, zap.NewNop()).Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check() returned unexpected error: %v", err)
+	}
+	if !slices.Contains(capabilities, "IMAP4rev1") {
+		t.Errorf("Check() capabilities = %v, expected IMAP4rev1", capabilities)
+	}
+
+	cfg.Password = "wrong"
+	if _, err := NewIMAPClient(cfg, zap.NewNop()).Check(context.Background()); err == nil {
+		t.Error("Expected error for invalid credentials, got nil")
+	}
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"go.uber.org/zap"
+)
+
+// compressCapability is advertised by servers implementing RFC 4978
+const compressCapability = "COMPRESS=DEFLATE"
+
+// compressCommand is COMPRESS DEFLATE. go-imap v1 has no client for the
+// extension, so the command and the deflate stream live here.
+type compressCommand struct{}
+
+func (compressCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "COMPRESS",
+		Arguments: []interface{}{imap.RawString("DEFLATE")},
+	}
+}
+
+// deflateConn passes bytes through until enable is called, then inflates what
+// it reads and deflates what it writes, flushing after every write.
+//
+// It sits under the go-imap client from the start instead of being swapped in
+// with Client.Upgrade: the client's reader goroutine is already blocked in a
+// read when the server's OK arrives, and an upgrade would reset its buffer
+// underneath it. The server only sends compressed data in reply to the next
+// command, which is written after enable, so Read can decide per read.
+type deflateConn struct {
+	net.Conn
+
+	enabled atomic.Bool
+	r       io.Reader // inflater, only touched by the reading goroutine
+
+	wmu sync.Mutex
+	w   *flate.Writer
+}
+
+func newDeflateConn(conn net.Conn) *deflateConn {
+	return &deflateConn{Conn: conn}
+}
+
+func (c *deflateConn) enable() error {
+	w, err := flate.NewWriter(c.Conn, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	c.w = w
+	c.wmu.Unlock()
+	c.enabled.Store(true)
+	return nil
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	if c.r != nil {
+		return c.r.Read(p)
+	}
+	n, err := c.Conn.Read(p)
+	if n == 0 || !c.enabled.Load() {
+		return n, err
+	}
+	// The first compressed bytes arrived in a read started before enable
+	pending := bytes.Clone(p[:n])
+	c.r = flate.NewReader(io.MultiReader(bytes.NewReader(pending), c.Conn))
+	return c.r.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+	if !c.enabled.Load() {
+		return c.Conn.Write(p)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+// deflateDialer wraps every connection, on top of TLS when tlsConfig is set,
+// so compression can be enabled after login
+type deflateDialer struct {
+	dialer    client.Dialer
+	tlsConfig *tls.Config
+	conn      *deflateConn
+}
+
+func (d *deflateDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.tlsConfig != nil {
+		conn = tls.Client(conn, d.tlsConfig)
+	}
+	d.conn = newDeflateConn(conn)
+	return d.conn, nil
+}
+
+// compress enables COMPRESS=DEFLATE when email.compress is set and the server
+// advertises it. Any failure leaves the connection uncompressed.
+func (c *IMAPClient) compress(imapClient *client.Client, conn *deflateConn) {
+	if conn == nil {
+		return
+	}
+	if !c.supports(compressCapability) {
+		c.logger.Debug("IMAP server does not support compression")
+		return
+	}
+
+	status, err := imapClient.Execute(compressCommand{}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err == nil {
+		err = conn.enable()
+	}
+	if err != nil {
+		c.logger.Warn("Failed to enable IMAP compression, continuing uncompressed", zap.Error(err))
+		return
+	}
+	c.logger.Debug("IMAP compression enabled")
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/emersion/go-imap/server"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+// compressExtension implements COMPRESS=DEFLATE on the test server
+type compressExtension struct {
+	enabled atomic.Int32
+}
+
+func (e *compressExtension) Capabilities(server.Conn) []string {
+	return []string{compressCapability}
+}
+
+func (e *compressExtension) Command(name string) server.HandlerFactory {
+	if name != "COMPRESS" {
+		return nil
+	}
+	return func() server.Handler { return &compressHandler{ext: e} }
+}
+
+type compressHandler struct {
+	ext *compressExtension
+}
+
+func (h *compressHandler) Parse(fields []interface{}) error {
+	return nil
+}
+
+func (h *compressHandler) Handle(conn server.Conn) error {
+	return nil
+}
+
+func (h *compressHandler) Upgrade(conn server.Conn) error {
+	return conn.Upgrade(func(c net.Conn) (net.Conn, error) {
+		conn.WaitReady()
+		deflate := newDeflateConn(c)
+		if err := deflate.enable(); err != nil {
+			return nil, err
+		}
+		h.ext.enabled.Add(1)
+		return deflate, nil
+	})
+}
+
+func TestConnectAndLoginCompress(t *testing.T) {
+	tests := []struct {
+		name        string
+		tlsMode     string
+		implicitTLS bool
+		compress    bool
+		advertised  bool
+		expected    int32
+	}{
+		{"Plaintext", config.TLSModeNone, false, true, true, 1},
+		{"Implicit TLS", config.TLSModeTLS, true, true, true, 1},
+		{"Not advertised", config.TLSModeNone, false, true, false, 0},
+		{"Disabled", config.TLSModeNone, false, false, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := &compressExtension{}
+			var extensions []server.Extension
+			if tt.advertised {
+				extensions = append(extensions, ext)
+			}
+			cfg, be := startIMAPServer(t, tt.implicitTLS, false, extensions...)
+			cfg.TLSMode = tt.tlsMode
+			cfg.AllowInsecure = !tt.implicitTLS
+			cfg.Compress = tt.compress
+			addUnreadMessage(t, be)
+			c := NewIMAPClient(cfg, zap.NewNop())
+
+			imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+			if err != nil {
+				t.Fatalf("connectAndLogin() error = %v", err)
+			}
+			defer c.logout(imapClient)
+
+			if got := ext.enabled.Load(); got != tt.expected {
+				t.Errorf("Compressed connections = %d, expected %d", got, tt.expected)
+			}
+			// SELECT and SEARCH both travel over the compressed stream. The
+			// memory backend starts with one read message of its own.
+			if imapClient.Mailbox() == nil || imapClient.Mailbox().Messages != 2 {
+				t.Errorf("Selected mailbox = %v, expected INBOX with 2 messages", imapClient.Mailbox())
+			}
+			ids, err := imapClient.Search(c.unreadCriteria())
+			if err != nil || len(ids) != 1 {
+				t.Errorf("Search() = %v, %v, expected 1 message", ids, err)
+			}
+		})
+	}
+}
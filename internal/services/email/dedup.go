@@ -0,0 +1,148 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"automation-hub/internal/clock"
+)
+
+const defaultDedupWindow = 10 * time.Minute
+
+// dedupCache remembers recently processed emails for a fixed window so the same
+// message is not forwarded twice when polls overlap or marking as read fails.
+// With a state file the entries are also persisted so they survive restarts.
+type dedupCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	clock  clock.Clock
+	path   string // optional JSON state file
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	return &dedupCache{
+		window: window,
+		seen:   make(map[string]time.Time),
+		clock:  clock.Real,
+	}
+}
+
+// Seen reports whether key was added within the window. A nil cache never has seen anything.
+func (d *dedupCache) Seen(key string) bool {
+	if d == nil || key == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	added, ok := d.seen[key]
+	return ok && d.clock.Now().Sub(added) < d.window
+}
+
+// Renew reports whether key was added within the window and, if so, starts
+// its window again, for keys that must be remembered as long as their email
+// keeps turning up. The renewal reaches the state file with the next Add.
+func (d *dedupCache) Renew(key string) bool {
+	if d == nil || key == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	added, ok := d.seen[key]
+	if !ok || now.Sub(added) >= d.window {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// Add records key, drops expired entries so memory stays bounded by the window
+// and writes the state file if one is configured
+func (d *dedupCache) Add(key string) error {
+	if d == nil || key == "" {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.prune()
+	d.seen[key] = d.clock.Now()
+	return d.save()
+}
+
+// Load reads the state file, keeping only entries still inside the window.
+// A missing file is not an error, it is created on the first Add.
+func (d *dedupCache) Load(path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dedup state: %w", err)
+	}
+
+	var seen map[string]time.Time
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return fmt.Errorf("failed to parse dedup state %s: %w", path, err)
+	}
+	for key, added := range seen {
+		d.seen[key] = added
+	}
+	d.prune()
+	return nil
+}
+
+func (d *dedupCache) prune() {
+	now := d.clock.Now()
+	for k, added := range d.seen {
+		if now.Sub(added) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+}
+
+// save writes the state atomically through a temp file so a crash mid-write
+// never leaves a truncated file behind. Callers must hold d.mu.
+func (d *dedupCache) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(d.seen)
+	if err != nil {
+		return fmt.Errorf("failed to encode dedup state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+func TestDedupCache(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	cache := newDedupCache(5 * time.Minute)
+	cache.clock = clk
+
+	if cache.Seen("a") {
+		t.Error("Seen(a) = true before Add, expected false")
+	}
+	cache.Add("a")
+	if !cache.Seen("a") {
+		t.Error("Seen(a) = false after Add, expected true")
+	}
+
+	clk.Advance(5 * time.Minute)
+	if cache.Seen("a") {
+		t.Error("Seen(a) = true after window, expected false")
+	}
+
+	// Adding another key purges expired entries
+	cache.Add("b")
+	if _, ok := cache.seen["a"]; ok {
+		t.Error("Expected expired entry a to be purged")
+	}
+
+	cache.Add("")
+	if cache.Seen("") {
+		t.Error("Seen(\"\") = true, expected empty keys to be ignored")
+	}
+
+	var nilCache *dedupCache
+	nilCache.Add("a")
+	if nilCache.Seen("a") {
+		t.Error("Seen() on nil cache = true, expected false")
+	}
+}
+
+func TestDedupCacheRenew(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	cache := newDedupCache(5 * time.Minute)
+	cache.clock = clk
+
+	if cache.Renew("a") {
+		t.Error("Renew(a) = true before Add, expected false")
+	}
+	cache.Add("a")
+	for range 3 {
+		clk.Advance(4 * time.Minute)
+		if !cache.Renew("a") {
+			t.Fatal("Renew(a) = false within the window, expected true")
+		}
+	}
+	clk.Advance(5 * time.Minute)
+	if cache.Renew("a") {
+		t.Error("Renew(a) = true once the window passed, expected false")
+	}
+}
+
+func TestNewDedupCacheDefaultWindow(t *testing.T) {
+	if got := newDedupCache(0).window; got != defaultDedupWindow {
+		t.Errorf("window = %v, expected %v", got, defaultDedupWindow)
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    models.Email
+		expected string
+	}{
+		{"Message-ID", models.Email{ID: "<abc@mail>", UID: 7}, "<abc@mail>"},
+		{"UID fallback", models.Email{UID: 7}, "uid:7"},
+		{"No identifier", models.Email{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dedupKey(tt.email); got != tt.expected {
+				t.Errorf("dedupKey() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDedupCacheStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	first := newDedupCache(10 * time.Minute)
+	first.clock = clk
+	if err := first.Load(path); err != nil {
+		t.Fatalf("Load() on missing file = %v, expected nil", err)
+	}
+	if err := first.Add("old"); err != nil {
+		t.Fatalf("Add() returned unexpected error: %v", err)
+	}
+	clk.Advance(8 * time.Minute)
+	if err := first.Add("recent"); err != nil {
+		t.Fatalf("Add() returned unexpected error: %v", err)
+	}
+
+	// A restart after the window of "old" keeps only "recent"
+	clk.Advance(5 * time.Minute)
+	second := newDedupCache(10 * time.Minute)
+	second.clock = clk
+	if err := second.Load(path); err != nil {
+		t.Fatalf("Load() returned unexpected error: %v", err)
+	}
+	if !second.Seen("recent") {
+		t.Error("Seen(recent) = false after reload, expected true")
+	}
+	if _, ok := second.seen["old"]; ok {
+		t.Error("Expected expired entry old to be pruned on load")
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	if err := newDedupCache(0).Load(path); err == nil {
+		t.Error("Load() on corrupt file = nil, expected error")
+	}
+}
+
+func TestNewIMAPClientStateFileEnablesDedup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	client := NewIMAPClient(config.EmailConfig{StateFile: path}, zap.NewNop())
+	if client.dedup == nil {
+		t.Fatal("Expected state_file to enable dedup")
+	}
+
+	emails := []models.Email{{ID: "otp-1", UID: 1}}
+	dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{&mockNamedProcessor{name: "generic"}}}
+	client.dispatch(context.Background(), nil, nil, emails, dispatcher)
+
+	// A new client, as after a restart, skips the already forwarded email
+	restarted := NewIMAPClient(config.EmailConfig{StateFile: path}, zap.NewNop())
+	proc := &mockNamedProcessor{name: "generic"}
+	restarted.dispatch(context.Background(), nil, nil, emails, &fakeDispatcher{processors: []models.EmailProcessor{proc}})
+	if proc.processed != 0 {
+		t.Errorf("Process() called %d times after restart, expected 0", proc.processed)
+	}
+}
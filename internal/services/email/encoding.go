@@ -0,0 +1,122 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// decodeBase64Body decodes a base64 single-part body, or the base64 text parts of
+// a multipart one, so processors always receive readable text. Bodies without
+// base64 text (including those with no Content-Transfer-Encoding at all) are
+// returned unchanged.
+func decodeBase64Body(bs *imap.BodyStructure, body string) (string, error) {
+	if bs == nil {
+		return body, nil
+	}
+
+	if strings.EqualFold(bs.MIMEType, "multipart") {
+		if bs.Params["boundary"] == "" {
+			return body, nil
+		}
+		decoded, changed, err := decodeBase64Parts([]byte(body), bs.Params["boundary"])
+		if err != nil || !changed {
+			return body, err
+		}
+		return string(decoded), nil
+	}
+
+	if !strings.EqualFold(bs.Encoding, "base64") {
+		return body, nil
+	}
+	decoded, err := decodeBase64(body)
+	if err != nil {
+		return body, err
+	}
+	return string(decoded), nil
+}
+
+// decodeBase64Parts rewrites the base64 text parts of a multipart body as 8bit,
+// recursing into nested multiparts. changed is false when there was nothing to
+// decode, so the caller can keep the original bytes.
+func decodeBase64Parts(body []byte, boundary string) (decoded []byte, changed bool, err error) {
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, false, err
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		// Raw parts keep their Content-Transfer-Encoding, NextPart would drop it
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, false, err
+		}
+
+		header := part.Header
+		mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		switch {
+		case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+			if nested, ok, err := decodeBase64Parts(content, params["boundary"]); err == nil && ok {
+				content, changed = nested, true
+			}
+		case isBase64Text(mediaType, header):
+			if text, err := decodeBase64(string(content)); err == nil {
+				content, changed = text, true
+				header.Set("Content-Transfer-Encoding", "8bit")
+			}
+		}
+
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, false, err
+	}
+	return out.Bytes(), changed, nil
+}
+
+// isBase64Text reports whether a part is base64 body text rather than an
+// attachment. Parts without a Content-Type are text/plain.
+func isBase64Text(mediaType string, header textproto.MIMEHeader) bool {
+	if mediaType != "" && !strings.HasPrefix(mediaType, "text/") {
+		return false
+	}
+	if !strings.EqualFold(strings.TrimSpace(header.Get("Content-Transfer-Encoding")), "base64") {
+		return false
+	}
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	return disposition != "attachment"
+}
+
+// decodeBase64 decodes base64 split across lines, tolerating missing padding
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s)
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,141 @@
+package email
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+func TestDecodeBase64Body(t *testing.T) {
+	plain := &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain"}
+	base64Plain := &imap.BodyStructure{MIMEType: "text", MIMESubType: "plain", Encoding: "base64"}
+	multipartAlt := &imap.BodyStructure{MIMEType: "multipart", MIMESubType: "alternative", Params: map[string]string{"boundary": "b1"}}
+
+	multipartBase64 := "--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"WW91ciBjb2RlIGlz\r\nIDEyMzQ1Ng==\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+		"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"bm90ZXM=\r\n" +
+		"--b1--\r\n"
+
+	multipartPlain := "--b1\nContent-Type: text/plain\n\nYour code is 123456\n--b1--\n"
+
+	tests := []struct {
+		name     string
+		bs       *imap.BodyStructure
+		body     string
+		contains []string
+		expected string // exact result, when set
+		wantErr  bool
+	}{
+		{
+			name:     "No encoding header leaves plain body",
+			bs:       plain,
+			body:     "Your code is 123456",
+			expected: "Your code is 123456",
+		},
+		{
+			name:     "Nil body structure",
+			bs:       nil,
+			body:     "WW91ciBjb2RlIGlzIDEyMzQ1Ng==",
+			expected: "WW91ciBjb2RlIGlzIDEyMzQ1Ng==",
+		},
+		{
+			name:     "Base64 split across lines",
+			bs:       base64Plain,
+			body:     "WW91ciBjb2RlIGlz\r\nIDEyMzQ1Ng==\r\n",
+			expected: "Your code is 123456",
+		},
+		{
+			name:     "Base64 without padding",
+			bs:       base64Plain,
+			body:     "WW91ciBjb2RlIGlzIDEyMzQ1Ng",
+			expected: "Your code is 123456",
+		},
+		{
+			name:     "Invalid base64 is returned unchanged",
+			bs:       base64Plain,
+			body:     "not base64!",
+			expected: "not base64!",
+			wantErr:  true,
+		},
+		{
+			name:     "Multipart text part decoded, attachment kept",
+			bs:       multipartAlt,
+			body:     multipartBase64,
+			contains: []string{"Your code is 123456", "Content-Transfer-Encoding: 8bit", "bm90ZXM="},
+		},
+		{
+			name:     "Multipart without base64 is untouched",
+			bs:       multipartAlt,
+			body:     multipartPlain,
+			expected: multipartPlain,
+		},
+		{
+			name:     "Multipart part without Content-Type is text",
+			bs:       multipartAlt,
+			body:     "--b1\r\nContent-Transfer-Encoding: base64\r\n\r\nMTIzNDU2\r\n--b1--\r\n",
+			contains: []string{"123456"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBase64Body(tt.bs, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeBase64Body() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.expected != "" && got != tt.expected {
+				t.Errorf("decodeBase64Body() = %q, expected %q", got, tt.expected)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("decodeBase64Body() = %q, expected it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMessageBase64Latin1(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{}, zap.NewNop())
+
+	section, err := imap.ParseBodySectionName("BODY[TEXT]")
+	if err != nil {
+		t.Fatalf("Failed to parse section name: %v", err)
+	}
+
+	// "Tu código es 654321" in ISO-8859-1
+	msg := &imap.Message{
+		Envelope: &imap.Envelope{MessageId: "msg-base64"},
+		BodyStructure: &imap.BodyStructure{
+			MIMEType:    "text",
+			MIMESubType: "plain",
+			Params:      map[string]string{"charset": "iso-8859-1"},
+			Encoding:    "base64",
+		},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			section: bytes.NewBufferString("VHUgY/NkaWdvIGVzIDY1NDMyMQ==\r\n"),
+		},
+	}
+
+	email, err := client.parseMessage(msg)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if email.TextPlain != "Tu código es 654321" {
+		t.Errorf("Expected decoded body, got %q", email.TextPlain)
+	}
+	if email.TransferEncoding != "" {
+		t.Errorf("Expected no TransferEncoding once decoded, got %q", email.TransferEncoding)
+	}
+}
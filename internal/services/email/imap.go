@@ -1,99 +1,384 @@
 package email
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
 	"go.uber.org/zap"
 
+	"automation-hub/internal/clock"
 	"automation-hub/internal/config"
+	"automation-hub/internal/metrics"
 	"automation-hub/internal/models"
+	"automation-hub/internal/services/processor"
 )
 
+// Defaults for email.dial_timeout and email.command_timeout, so a hung server
+// fails the poll instead of blocking its folder indefinitely
+const (
+	defaultDialTimeout    = 30 * time.Second
+	defaultCommandTimeout = 2 * time.Minute
+)
+
+// Dispatcher hands fetched emails to the processors, see processor.Manager.
+// onProcessed is called for every email a processor handled successfully.
+type Dispatcher interface {
+	GetProcessors() []models.EmailProcessor
+	ProcessEmailsConcurrently(ctx context.Context, emails []models.Email, onProcessed func(models.EmailProcessor, models.Email))
+	Wait()
+}
+
 type IMAPClient struct {
-	config config.EmailConfig
-	logger *zap.Logger
+	config       config.EmailConfig
+	account      string // config.AccountName, tags logs and metrics
+	logger       *zap.Logger
+	mu           sync.RWMutex
+	folders      []*folder
+	dispatcher   Dispatcher
+	dedup        *dedupCache // nil when email.dedup and email.state_file are unset
+	forwarded    *dedupCache // emails sent to email.fallback, the dedup cache when there is one, nil without a fallback
+	deadLetter   *zap.Logger // nil until SetDeadLetter
+	capabilities []string    // advertised after login, guarded by mu, nil until the first login
+	clock        clock.Clock
+	dryRun       atomic.Bool
+}
+
+// folder is a mailbox polled on its own ticker
+type folder struct {
+	name      string
+	interval  time.Duration
+	pollMu    sync.Mutex      // one check of this folder at a time, monitor or CheckOnce
+	attempts  map[uint32]int  // failed cycles by UID with email.max_attempts, guarded by pollMu
+	handled   map[uint32]bool // UIDs dispatched without failing that are still unread, guarded by pollMu
+	lastPoll  time.Time       // guarded by IMAPClient.mu, like lastErr and lastErrAt
+	lastErr   error
+	lastErrAt time.Time
 }
 
 func NewIMAPClient(config config.EmailConfig, logger *zap.Logger) *IMAPClient {
-	return &IMAPClient{
-		config: config,
-		logger: logger,
+	account := config.AccountName()
+	metrics.InitAccount(account)
+	logger = logger.With(zap.String("account", account))
+	c := &IMAPClient{
+		config:  config,
+		account: account,
+		logger:  logger,
+		folders: newFolders(config),
+		clock:   clock.Real,
+	}
+	if config.Dedup || config.StateFile != "" {
+		c.dedup = newDedupCache(time.Duration(config.DedupWindowMinutes) * time.Minute)
+	}
+	if config.StateFile != "" {
+		if err := c.dedup.Load(config.StateFile); err != nil {
+			logger.Warn("Starting with empty dedup state", zap.Error(err))
+		}
+	}
+	if config.Fallback.Enabled() {
+		c.forwarded = c.dedup
+		if c.forwarded == nil {
+			c.forwarded = newDedupCache(time.Duration(config.DedupWindowMinutes) * time.Minute)
+		}
+	}
+	return c
+}
+
+// Account returns the name of the account in logs and metrics, see
+// config.EmailConfig.AccountName
+func (c *IMAPClient) Account() string {
+	return c.account
+}
+
+// SetClock replaces the system clock used for polling, the search window and
+// the dedup cache, so tests can control time
+func (c *IMAPClient) SetClock(clk clock.Clock) {
+	c.clock = clk
+	if c.dedup != nil {
+		c.dedup.clock = clk
+	}
+	if c.forwarded != nil {
+		c.forwarded.clock = clk
+	}
+}
+
+// SetDeadLetter writes one line per email given up on after email.max_attempts
+// failed cycles to deadLetter, see logging.NewAudit
+func (c *IMAPClient) SetDeadLetter(deadLetter *zap.Logger) {
+	c.deadLetter = deadLetter
+}
+
+// SetDryRun leaves processed emails untouched (unread, in place and not
+// recorded as seen) so the same message can be processed again
+func (c *IMAPClient) SetDryRun(enabled bool) {
+	c.dryRun.Store(enabled)
+}
+
+// newFolders lists email.folders with their intervals resolved, INBOX alone
+// when none are configured
+func newFolders(cfg config.EmailConfig) []*folder {
+	defaultInterval := 60 * time.Second
+	if cfg.PollingInterval != 0 {
+		defaultInterval = time.Duration(cfg.PollingInterval) * time.Second
+	}
+	if len(cfg.Folders) == 0 {
+		return []*folder{{name: "INBOX", interval: defaultInterval}}
+	}
+
+	folders := make([]*folder, 0, len(cfg.Folders))
+	for _, f := range cfg.Folders {
+		interval := defaultInterval
+		if f.PollingInterval != 0 {
+			interval = time.Duration(f.PollingInterval) * time.Second
+		}
+		folders = append(folders, &folder{name: f.Name, interval: interval})
+	}
+	return folders
+}
+
+// PollingInterval returns the longest folder polling interval, default 60
+// seconds if not configured. With LastPoll it bounds how stale the slowest
+// folder may get.
+func (c *IMAPClient) PollingInterval() time.Duration {
+	var longest time.Duration
+	for _, f := range c.folders {
+		longest = max(longest, f.interval)
 	}
+	return longest
 }
 
-func (c *IMAPClient) StartMonitoring(ctx context.Context, processors ...models.EmailProcessor) {
-	// Use the polling interval from the configuration, default 60 seconds if not configured
-	pollingInterval := time.Duration(c.config.PollingInterval) * time.Second
-	if c.config.PollingInterval == 0 {
-		pollingInterval = 60 * time.Second
+// LastPoll returns the time of the oldest last successful check across the
+// folders, zero until every folder has been checked once
+func (c *IMAPClient) LastPoll() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var oldest time.Time
+	for _, f := range c.folders {
+		if f.lastPoll.IsZero() {
+			return time.Time{}
+		}
+		if oldest.IsZero() || f.lastPoll.Before(oldest) {
+			oldest = f.lastPoll
+		}
 	}
+	return oldest
+}
+
+// LastError returns the most recent failed check of any folder and when it
+// happened, nil if none failed yet. It stays set after later successful checks;
+// compare its time with LastPoll to tell whether it is current.
+func (c *IMAPClient) LastError() (error, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var lastErr error
+	var lastErrAt time.Time
+	for _, f := range c.folders {
+		if f.lastErr != nil && f.lastErrAt.After(lastErrAt) {
+			lastErr, lastErrAt = f.lastErr, f.lastErrAt
+		}
+	}
+	return lastErr, lastErrAt
+}
+
+func (c *IMAPClient) recordPoll(f *folder) {
+	c.mu.Lock()
+	f.lastPoll = c.clock.Now()
+	c.mu.Unlock()
+}
+
+// recordError counts a failed check and keeps it for LastError
+func (c *IMAPClient) recordError(f *folder, err error) {
+	metrics.IMAPPollErrors.WithLabelValues(c.account).Inc()
+	c.mu.Lock()
+	f.lastErr = fmt.Errorf("%s: %w", f.name, err)
+	f.lastErrAt = c.clock.Now()
+	c.mu.Unlock()
+	metrics.IMAPLastErrorTimestamp.WithLabelValues(c.account).SetToCurrentTime()
+}
+
+// SetDispatcher replaces the dispatcher used by the monitor from the next cycle
+func (c *IMAPClient) SetDispatcher(dispatcher Dispatcher) {
+	c.mu.Lock()
+	c.dispatcher = dispatcher
+	c.mu.Unlock()
+}
+
+func (c *IMAPClient) currentDispatcher() Dispatcher {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dispatcher
+}
+
+// StartMonitoring polls every folder on its own ticker until ctx is canceled.
+// Checks and the sends they trigger run with sendCtx instead, so canceling ctx
+// lets a check in progress finish; canceling sendCtx aborts it. It returns once
+// the cycles in progress have finished and the dispatcher has no pending sends.
+func (c *IMAPClient) StartMonitoring(ctx, sendCtx context.Context, dispatcher Dispatcher) {
+	c.SetDispatcher(dispatcher)
 
-	c.logger.Info("Starting email monitoring",
-		zap.Duration("polling_interval", pollingInterval))
+	var wg sync.WaitGroup
+	for _, f := range c.folders {
+		c.logger.Info("Starting email monitoring",
+			zap.String("folder", f.name),
+			zap.Duration("polling_interval", f.interval))
 
-	ticker := time.NewTicker(pollingInterval)
-	defer ticker.Stop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.monitorFolder(ctx, sendCtx, f)
+		}()
+	}
+
+	wg.Wait()
+	c.currentDispatcher().Wait()
+	c.logger.Info("Email monitoring stopped")
+}
 
+// monitorFolder checks a folder every interval, randomized by email.polling_jitter.
+// The wait starts after each check, so checks never overlap.
+func (c *IMAPClient) monitorFolder(ctx, sendCtx context.Context, f *folder) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			c.checkEmails(processors...)
+		case <-c.clock.After(jitter(f.interval, c.config.PollingJitter, rand.Float64())):
+			_, _, _ = c.checkEmails(sendCtx, c.currentDispatcher(), f)
+		}
+	}
+}
+
+// jitter spreads interval by up to ±percent, r being uniform in [0, 1), so
+// instances sharing a provider drift apart instead of polling in lockstep
+func jitter(interval time.Duration, percent int, r float64) time.Duration {
+	if percent <= 0 {
+		return interval
+	}
+	spread := float64(interval) * float64(percent) / 100
+	return interval + time.Duration((2*r-1)*spread)
+}
+
+// CheckOnce checks every folder immediately with the current dispatcher and
+// returns how many unread emails were found and how many were processed. It
+// waits for a check of the same folder already in progress instead of running
+// alongside it, and reports the errors of every folder that failed.
+func (c *IMAPClient) CheckOnce(ctx context.Context) (found, processed int, err error) {
+	dispatcher := c.currentDispatcher()
+	if dispatcher == nil {
+		return 0, 0, errors.New("email monitoring has not started")
+	}
+
+	var errs []error
+	for _, f := range c.folders {
+		folderFound, folderProcessed, err := c.checkEmails(ctx, dispatcher, f)
+		found += folderFound
+		processed += folderProcessed
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
 		}
 	}
+	return found, processed, errors.Join(errs...)
 }
 
-func (c *IMAPClient) checkEmails(processors ...models.EmailProcessor) {
-	imapClient, err := c.connectAndLogin()
+// checkEmails checks one folder. A failed connection, search or fetch is
+// returned and recorded for LastError; emails fetched before a fetch error are
+// still processed.
+func (c *IMAPClient) checkEmails(ctx context.Context, dispatcher Dispatcher, f *folder) (found, processed int, err error) {
+	f.pollMu.Lock()
+	defer f.pollMu.Unlock()
+
+	imapClient, err := c.connectAndLogin(ctx, f.name, c.readOnly(dispatcher.GetProcessors()))
 	if err != nil {
-		return
+		c.recordError(f, err)
+		return 0, 0, err
 	}
 	defer c.logout(imapClient)
 
+	// With email.fallback unmatched emails are forwarded too, so all unread
+	// emails are searched instead of those from the processors' senders
 	var senders []string
-	for _, p := range processors {
-		if s := p.GetSender(); s != "" {
-			senders = append(senders, s)
+	if !c.config.Fallback.Enabled() {
+		for _, p := range dispatcher.GetProcessors() {
+			for _, s := range processor.Senders(p) {
+				if s != "" {
+					senders = append(senders, strings.TrimPrefix(s, "@"))
+				}
+			}
 		}
 	}
 
-	ids, err := c.searchUnreadEmails(imapClient, senders)
-	if err != nil {
-		return
+	// Emails found by the senders searched successfully are still processed,
+	// but a failed search fails the poll
+	ids, searchErr := c.searchUnreadEmails(imapClient, senders)
+	if len(ids) == 0 {
+		if searchErr != nil {
+			c.recordError(f, searchErr)
+			return 0, 0, searchErr
+		}
+		c.recordPoll(f)
+		return 0, 0, nil
 	}
 
-	if len(ids) == 0 {
-		return
+	processed, err = c.fetchAndProcessMessages(ctx, imapClient, f, ids, dispatcher)
+	if err = errors.Join(searchErr, err); err != nil {
+		c.recordError(f, err)
+		return len(ids), processed, err
 	}
+	c.recordPoll(f)
+	return len(ids), processed, nil
+}
 
-	c.fetchAndProcessMessages(imapClient, ids, processors...)
+// readOnly reports whether a poll can select its folder read-only: always with
+// email.read_only, otherwise when no email would be marked or moved, i.e. no
+// processor marks as read, move_to_folder is unset and max_attempts never gives up
+func (c *IMAPClient) readOnly(processors []models.EmailProcessor) bool {
+	if c.config.ReadOnly {
+		return true
+	}
+	if c.config.MoveToFolder != "" || c.config.MaxAttempts > 0 {
+		return false
+	}
+	return !slices.ContainsFunc(processors, processor.MarksAsRead)
 }
 
-func (c *IMAPClient) connectAndLogin() (*client.Client, error) {
-	imapClient, err := client.DialTLS(fmt.Sprintf("%s:%d", c.config.Host, c.config.Port), nil)
+// connectAndLogin opens a connection with the given folder selected, read-only
+// (EXAMINE) when nothing will be marked or moved. Every command on it is bounded
+// by email.command_timeout.
+func (c *IMAPClient) connectAndLogin(ctx context.Context, folder string, readOnly bool) (*client.Client, error) {
+	imapClient, deflate, err := c.dial(ctx)
 	if err != nil {
-		c.logger.Error("Failed to connect to IMAP server", zap.Error(err))
+		c.logger.Error("Failed to connect to IMAP server", zap.String("tls_mode", c.tlsMode()), zap.Error(err))
 		return nil, err
 	}
+	imapClient.Timeout = durationOr(c.config.CommandTimeout, defaultCommandTimeout)
 
-	if err := imapClient.Login(c.config.Username, c.config.Password); err != nil {
+	if err := imapClient.Login(c.config.Username, string(c.config.Password)); err != nil {
 		c.logger.Error("Failed to login", zap.Error(err))
 		if logoutErr := imapClient.Logout(); logoutErr != nil {
 			c.logger.Error("Failed to logout after login failure", zap.Error(logoutErr))
 		}
 		return nil, err
 	}
+	c.recordCapabilities(imapClient)
+	c.compress(imapClient, deflate)
 
-	_, err = imapClient.Select("INBOX", false)
+	_, err = imapClient.Select(folder, readOnly)
 	if err != nil {
-		c.logger.Error("Failed to select INBOX", zap.Error(err))
+		c.logger.Error("Failed to select folder", zap.String("folder", folder), zap.Error(err))
 		if logoutErr := imapClient.Logout(); logoutErr != nil {
 			c.logger.Error("Failed to logout after select failure", zap.Error(logoutErr))
 		}
@@ -103,6 +388,118 @@ func (c *IMAPClient) connectAndLogin() (*client.Client, error) {
 	return imapClient, nil
 }
 
+// dial connects according to email.tls_mode: implicit TLS, plaintext upgraded
+// with STARTTLS, or plaintext. STARTTLS never falls back to plaintext when the
+// server doesn't offer it. With email.compress it also returns the connection
+// compression can later be enabled on; STARTTLS connections don't get one, as
+// go-imap layers TLS over whatever connection the client was created with.
+func (c *IMAPClient) dial(ctx context.Context) (*client.Client, *deflateConn, error) {
+	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	dialer := contextDialer{ctx: ctx, timeout: durationOr(c.config.DialTimeout, defaultDialTimeout)}
+
+	mode := c.tlsMode()
+	if mode == config.TLSModeNone {
+		c.logger.Debug("Connecting to IMAP without TLS", zap.String("address", addr))
+		if c.config.Compress {
+			deflate := &deflateDialer{dialer: dialer}
+			imapClient, err := client.DialWithDialer(deflate, addr)
+			return imapClient, deflate.conn, err
+		}
+		imapClient, err := client.DialWithDialer(dialer, addr)
+		return imapClient, nil, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode == config.TLSModeStartTLS {
+		imapClient, err := client.DialWithDialer(dialer, addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		supported, err := imapClient.SupportStartTLS()
+		if err == nil && !supported {
+			err = errors.New("server does not support STARTTLS")
+		}
+		if err == nil {
+			err = imapClient.StartTLS(tlsConfig)
+		}
+		if err != nil {
+			_ = imapClient.Terminate()
+			return nil, nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+		if c.config.Compress {
+			c.logger.Debug("IMAP compression is not available with STARTTLS")
+		}
+		return imapClient, nil, nil
+	}
+	if c.config.Compress {
+		deflate := &deflateDialer{dialer: dialer, tlsConfig: tlsConfig}
+		imapClient, err := client.DialWithDialer(deflate, addr)
+		return imapClient, deflate.conn, err
+	}
+	imapClient, err := client.DialWithDialerTLS(dialer, addr, tlsConfig)
+	return imapClient, nil, err
+}
+
+// contextDialer connects within timeout, or until ctx is canceled. go-imap
+// reads the greeting, and for implicit TLS completes the handshake, before the
+// client's command Timeout applies, so the connection gets the same deadline.
+type contextDialer struct {
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// durationOr converts a setting in seconds, using def when it is unset
+func durationOr(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+func (c *IMAPClient) tlsMode() string {
+	if c.config.TLSMode == "" {
+		return config.TLSModeTLS
+	}
+	return c.config.TLSMode
+}
+
+// tlsConfig verifies the server certificate against email.host and the system
+// roots plus email.tls.ca_file, read on every connection so a renewed CA is
+// picked up without a restart
+func (c *IMAPClient) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.config.Host,
+		InsecureSkipVerify: c.config.TLS.InsecureSkipVerify, // opt-in, warned about at startup
+	}
+	if c.config.TLS.CAFile != "" {
+		pool, err := config.LoadCertPool(c.config.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load email.tls.ca_file: %w", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
 func (c *IMAPClient) logout(imapClient *client.Client) {
 	if err := imapClient.Logout(); err != nil {
 		c.logger.Error("Failed to logout from IMAP server", zap.Error(err))
@@ -112,8 +509,7 @@ func (c *IMAPClient) logout(imapClient *client.Client) {
 func (c *IMAPClient) searchUnreadEmails(imapClient *client.Client, senders []string) ([]uint32, error) {
 	if len(senders) == 0 {
 		// Fallback to searching all unread emails if no senders specified
-		criteria := imap.NewSearchCriteria()
-		criteria.WithoutFlags = []string{imap.SeenFlag}
+		criteria := c.unreadCriteria()
 
 		ids, err := imapClient.Search(criteria)
 		if err != nil {
@@ -126,15 +522,18 @@ func (c *IMAPClient) searchUnreadEmails(imapClient *client.Client, senders []str
 		return ids, nil
 	}
 
+	// A sender whose search fails doesn't hold up the others, but its error is
+	// returned along with the emails found
 	uniqueIDs := make(map[uint32]struct{})
+	var errs []error
 	for _, sender := range senders {
-		criteria := imap.NewSearchCriteria()
-		criteria.WithoutFlags = []string{imap.SeenFlag}
+		criteria := c.unreadCriteria()
 		criteria.Header.Add("From", sender)
 
 		ids, err := imapClient.Search(criteria)
 		if err != nil {
 			c.logger.Error("Failed to search emails for sender", zap.String("sender", sender), zap.Error(err))
+			errs = append(errs, fmt.Errorf("search for %s: %w", sender, err))
 			continue
 		}
 		for _, id := range ids {
@@ -151,10 +550,191 @@ func (c *IMAPClient) searchUnreadEmails(imapClient *client.Client, senders []str
 		c.logger.Info("Found unread emails from allowed senders", zap.Int("count", len(allIDs)))
 	}
 
-	return allIDs, nil
+	return allIDs, errors.Join(errs...)
 }
 
-func (c *IMAPClient) fetchAndProcessMessages(imapClient *client.Client, ids []uint32, processors ...models.EmailProcessor) {
+// unreadCriteria builds the base search criteria for unread emails, limited to
+// recent messages when search_since_minutes is configured
+func (c *IMAPClient) unreadCriteria() *imap.SearchCriteria {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+
+	if c.config.SearchSinceMinutes > 0 {
+		// IMAP SINCE/SENTSINCE only have day granularity, the server ignores the time part
+		since := c.clock.Now().Add(-time.Duration(c.config.SearchSinceMinutes) * time.Minute)
+		criteria.Since = since
+		criteria.SentSince = since
+	}
+
+	return criteria
+}
+
+// fetchAndProcessMessages fetches the headers of the given messages, then the
+// bodies of those a processor may handle, and dispatches them. It returns how
+// many were processed and the fetch error, if any, after dispatching whatever
+// arrived before it.
+func (c *IMAPClient) fetchAndProcessMessages(ctx context.Context, imapClient *client.Client, f *folder, ids []uint32, dispatcher Dispatcher) (int, error) {
+	found, err := c.fetchCandidates(imapClient, f, ids, dispatcher.GetProcessors())
+	c.forwardUnmatched(ctx, dispatcher, found.unmatched)
+	if len(found.uids) == 0 {
+		return 0, err
+	}
+	uids := c.capPerCycle(found.uids, found.handled)
+	emails, bodyErr := c.fetchBodies(imapClient, uids, fetchItems(dispatcher.GetProcessors()))
+	return c.dispatch(ctx, imapClient, f, emails, dispatcher), errors.Join(err, bodyErr)
+}
+
+// candidates sorts the unread emails of a poll by their envelopes
+type candidates struct {
+	uids      []uint32        // a processor may handle them, their bodies are fetched
+	handled   map[uint32]bool // of uids, those already handled in the folder or by dedup
+	unmatched []models.Email  // envelopes of the others with email.fallback
+}
+
+// capPerCycle keeps email.max_per_cycle UIDs, leaving the rest unread for the
+// next cycles. Emails not handled yet come first, oldest first, so emails that
+// stay unread after being handled (not whitelisted to be marked as read, or
+// duplicates) can't take every slot and hold back new ones for good.
+func (c *IMAPClient) capPerCycle(uids []uint32, handled map[uint32]bool) []uint32 {
+	if c.config.MaxPerCycle <= 0 || len(uids) <= c.config.MaxPerCycle {
+		return uids
+	}
+	slices.SortFunc(uids, func(a, b uint32) int {
+		if handled[a] != handled[b] {
+			if handled[a] {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a, b)
+	})
+	c.logger.Warn("Per-cycle email cap reached, deferring the rest to the next cycles",
+		zap.Int("max_per_cycle", c.config.MaxPerCycle),
+		zap.Int("deferred", len(uids)-c.config.MaxPerCycle))
+	return uids[:c.config.MaxPerCycle]
+}
+
+// defaultFetchItems is fetched for processors that don't declare what they
+// need with RequiredFetchItems
+var defaultFetchItems = []imap.FetchItem{
+	imap.FetchEnvelope,
+	imap.FetchBodyStructure,
+	processor.TextSection,
+	imap.FetchFlags,
+	imap.FetchUid,
+}
+
+// fetchItems returns the union of the items the processors need. The envelope
+// and UID are always included, dedup and post-processing rely on them.
+func fetchItems(processors []models.EmailProcessor) []imap.FetchItem {
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid}
+	for _, p := range processors {
+		required := defaultFetchItems
+		if declared, ok := p.(interface{ RequiredFetchItems() []imap.FetchItem }); ok {
+			required = declared.RequiredFetchItems()
+		}
+		for _, item := range required {
+			if !slices.Contains(items, item) {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// fetchCandidates fetches only the envelopes of the given messages and returns
+// the UIDs of those from allowed senders that a processor may handle by sender
+// and subject, and with email.fallback the envelopes of the others. The size of
+// the messages whose body is skipped is logged.
+func (c *IMAPClient) fetchCandidates(imapClient *client.Client, f *folder, ids []uint32, processors []models.EmailProcessor) (candidates, error) {
+	found := candidates{handled: make(map[uint32]bool)}
+	var skipped int
+	var skippedBytes int64
+	err := c.fetch(imapClient, ids, false, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchRFC822Size}, func(msg *imap.Message) {
+		metrics.EmailsFetched.WithLabelValues(c.account).Inc()
+		email, err := parseEnvelope(msg)
+		if err != nil {
+			c.skipMalformed(msg, err)
+			return
+		}
+		switch {
+		case !c.senderAllowed(email.From):
+		case processor.MayMatch(email, processors):
+			found.uids = append(found.uids, msg.Uid)
+			if (f != nil && f.handled[msg.Uid]) || c.dedup.Seen(dedupKey(email)) {
+				found.handled[msg.Uid] = true
+			}
+			return
+		case c.config.Fallback.Enabled():
+			found.unmatched = append(found.unmatched, email)
+		}
+		skipped++
+		skippedBytes += int64(msg.Size)
+	})
+	if f != nil && err == nil {
+		// Forget emails no longer unread, so the set stays bounded
+		maps.DeleteFunc(f.handled, func(uid uint32, _ bool) bool { return !found.handled[uid] })
+	}
+
+	if skipped > 0 {
+		c.logger.Info("Skipped fetching bodies of emails no processor handles",
+			zap.Int("emails", skipped),
+			zap.Int64("bytes_saved", skippedBytes))
+	}
+	return found, err
+}
+
+// fetchBodies fetches the given items of the given messages by UID and parses
+// them without marking them as read. On a fetch error the emails received
+// before it are returned along with the error.
+func (c *IMAPClient) fetchBodies(imapClient *client.Client, uids []uint32, items []imap.FetchItem) ([]models.Email, error) {
+	parse := c.parser(items)
+	var emails []models.Email
+	err := c.fetch(imapClient, uids, true, items, func(msg *imap.Message) {
+		email, err := parse(msg)
+		if err != nil {
+			c.skipMalformed(msg, err)
+			return
+		}
+		emails = append(emails, email)
+	})
+	return emails, err
+}
+
+// fetchEmails fetches the given items of the given messages and parses them
+// without marking them as read, dropping those from senders that are not
+// allowed. On a fetch error the emails received before it are returned along
+// with the error.
+func (c *IMAPClient) fetchEmails(imapClient *client.Client, ids []uint32, items []imap.FetchItem) ([]models.Email, error) {
+	parse := c.parser(items)
+	var emails []models.Email
+	err := c.fetch(imapClient, ids, false, items, func(msg *imap.Message) {
+		metrics.EmailsFetched.WithLabelValues(c.account).Inc()
+		email, err := parse(msg)
+		if err != nil {
+			c.skipMalformed(msg, err)
+			return
+		}
+		if c.senderAllowed(email.From) {
+			emails = append(emails, email)
+		}
+	})
+	return emails, err
+}
+
+// parser parses full messages, or only the envelope when no processor asked
+// for the body
+func (c *IMAPClient) parser(items []imap.FetchItem) func(*imap.Message) (models.Email, error) {
+	if slices.Contains(items, processor.TextSection) {
+		return c.parseMessage
+	}
+	return parseEnvelope
+}
+
+// fetch runs a FETCH, or UID FETCH when byUID is set, handing every message to
+// handle. The whole batch is handled before fetch returns, so no STORE/MOVE runs
+// while the FETCH is in progress.
+func (c *IMAPClient) fetch(imapClient *client.Client, ids []uint32, byUID bool, items []imap.FetchItem, handle func(*imap.Message)) error {
 	seqset := new(imap.SeqSet)
 	seqset.AddNum(ids...)
 
@@ -162,60 +742,173 @@ func (c *IMAPClient) fetchAndProcessMessages(imapClient *client.Client, ids []ui
 	done := make(chan error, 1)
 
 	go func() {
-		done <- imapClient.Fetch(seqset, []imap.FetchItem{
-			imap.FetchEnvelope,
-			imap.FetchBodyStructure,
-			"BODY.PEEK[TEXT]",
-			imap.FetchFlags,
-			imap.FetchUid,
-		}, messages)
+		if byUID {
+			done <- imapClient.UidFetch(seqset, items, messages)
+		} else {
+			done <- imapClient.Fetch(seqset, items, messages)
+		}
 	}()
 
 	for msg := range messages {
-		c.processMessage(imapClient, msg, processors...)
+		handle(msg)
 	}
 
 	if err := <-done; err != nil {
 		c.logger.Error("Failed to fetch messages", zap.Error(err))
+		return fmt.Errorf("failed to fetch messages: %w", err)
 	}
+	return nil
 }
 
-func (c *IMAPClient) processMessage(imapClient *client.Client, msg *imap.Message, processors ...models.EmailProcessor) {
-	email := c.parseMessage(msg)
+// dispatch skips already forwarded emails and processes the rest concurrently.
+// Post-processing shares the IMAP connection, so it is serialized with a mutex.
+// Failures are counted against email.max_attempts for f. It returns how many
+// emails were processed successfully.
+func (c *IMAPClient) dispatch(ctx context.Context, imapClient *client.Client, f *folder, emails []models.Email, dispatcher Dispatcher) int {
+	var postMu sync.Mutex
+	postProcess := func(processor models.EmailProcessor, email models.Email) {
+		if c.dryRun.Load() {
+			c.logger.Info("Dry run: leaving email untouched",
+				zap.String("from", email.From),
+				zap.String("subject", email.Subject))
+			return
+		}
+		postMu.Lock()
+		defer postMu.Unlock()
+		c.handlePostProcessing(imapClient, processor, email)
+	}
 
-	for _, processor := range processors {
-		if processor.ShouldProcess(email) {
-			c.logger.Info("Processing email",
+	batch := make([]models.Email, 0, len(emails))
+	for _, email := range emails {
+		if c.deadLettered(f, email) {
+			// Already given up on, marking it as read must have failed
+			c.markAsRead(imapClient, email.UID)
+			continue
+		}
+		if !c.dedup.Seen(dedupKey(email)) {
+			batch = append(batch, email)
+			continue
+		}
+		c.markHandled(f, email.UID)
+		if matched := processor.Match(email, dispatcher.GetProcessors()); matched != nil {
+			c.logger.Info("Skipping duplicate email",
 				zap.String("subject", email.Subject),
 				zap.String("from", email.From))
+			// Retry post-processing, a failed mark as read is the usual cause
+			postProcess(matched, email)
+		}
+	}
 
-			// Try to process the email
-			if err := processor.Process(email); err != nil {
-				c.logger.Error("Failed to process email",
-					zap.String("subject", email.Subject),
-					zap.String("from", email.From),
-					zap.Error(err))
-				return
+	var processed atomic.Int64
+	var succeeded sync.Map // UIDs processed successfully
+	dispatcher.ProcessEmailsConcurrently(ctx, batch, func(processor models.EmailProcessor, email models.Email) {
+		processed.Add(1)
+		succeeded.Store(email.UID, true)
+		if !c.dryRun.Load() {
+			if err := c.dedup.Add(dedupKey(email)); err != nil {
+				c.logger.Warn("Failed to persist processed email", zap.Error(err))
 			}
+		}
+		postProcess(processor, email)
+	})
+	if ctx.Err() == nil {
+		c.countAttempts(imapClient, f, batch, &succeeded, dispatcher.GetProcessors())
+	}
+	var unmatched []models.Email
+	for _, email := range batch {
+		_, ok := succeeded.Load(email.UID)
+		if !ok && processor.Match(email, dispatcher.GetProcessors()) == nil {
+			// Its body ruled out the processors its envelope may match
+			unmatched = append(unmatched, email)
+			ok = true
+		}
+		if ok {
+			c.markHandled(f, email.UID)
+		}
+	}
+	c.forwardUnmatched(ctx, dispatcher, unmatched)
+	return int(processed.Load())
+}
 
-			c.logger.Info("Email processed successfully",
+// forwardUnmatched hands emails no service matched to email.fallback, once
+// each. They are never marked as read, so the forwarded ones are remembered in
+// the dedup cache, which outlives config reloads and, with email.state_file,
+// restarts. Each poll that finds one still unread renews it.
+func (c *IMAPClient) forwardUnmatched(ctx context.Context, dispatcher Dispatcher, emails []models.Email) {
+	fallback, ok := dispatcher.(interface {
+		ForwardUnmatched(context.Context, models.Email) error
+	})
+	if !ok || c.forwarded == nil {
+		return
+	}
+	for _, email := range emails {
+		key := dedupKey(email)
+		if key != "" {
+			key = "fallback:" + key
+		}
+		if c.forwarded.Renew(key) || ctx.Err() != nil {
+			continue
+		}
+		if err := fallback.ForwardUnmatched(ctx, email); err != nil {
+			c.logger.Error("Failed to forward unmatched email to the fallback chat",
 				zap.String("subject", email.Subject),
-				zap.String("from", email.From))
-
-			// Handle post-processing (marking as read only for Perplexity/Cloudflare)
-			c.handlePostProcessing(imapClient, processor, msg, email)
-			return
+				zap.String("from", email.From),
+				zap.Error(err))
+			continue
 		}
+		if c.dryRun.Load() {
+			continue
+		}
+		if err := c.forwarded.Add(key); err != nil {
+			c.logger.Warn("Failed to persist forwarded email", zap.Error(err))
+		}
+	}
+}
+
+// markHandled records that an email of f was dispatched without failing, so
+// max_per_cycle serves it after the emails not handled yet
+func (c *IMAPClient) markHandled(f *folder, uid uint32) {
+	if f == nil || uid == 0 {
+		return
 	}
+	if f.handled == nil {
+		f.handled = make(map[uint32]bool)
+	}
+	f.handled[uid] = true
+}
 
-	// No processor matched this email, leave it unread
-	c.logger.Info("Email ignored (no matching processor)",
-		zap.String("subject", email.Subject),
-		zap.String("from", email.From))
+// dedupKey identifies an email by its Message-ID, falling back to the mailbox UID
+func dedupKey(email models.Email) string {
+	if email.ID != "" {
+		return email.ID
+	}
+	if email.UID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("uid:%d", email.UID)
 }
 
-func (c *IMAPClient) handlePostProcessing(imapClient *client.Client, processor models.EmailProcessor, msg *imap.Message, email models.Email) {
-	named, ok := processor.(interface{ GetName() string })
+func (c *IMAPClient) handlePostProcessing(imapClient *client.Client, processor models.EmailProcessor, email models.Email) {
+	if c.config.ReadOnly {
+		c.logger.Debug("Read-only mailbox, leaving email untouched",
+			zap.String("from", email.From),
+			zap.String("subject", email.Subject))
+		return
+	}
+
+	c.handleMarkAsRead(imapClient, processor, email)
+
+	if c.config.MoveToFolder != "" {
+		c.logger.Info("Moving processed email",
+			zap.String("folder", c.config.MoveToFolder),
+			zap.String("from", email.From),
+			zap.String("subject", email.Subject))
+		c.moveToFolder(imapClient, email.UID, c.config.MoveToFolder)
+	}
+}
+
+func (c *IMAPClient) handleMarkAsRead(imapClient *client.Client, emailProcessor models.EmailProcessor, email models.Email) {
+	named, ok := emailProcessor.(interface{ GetName() string })
 	if !ok {
 		c.logger.Debug("Processor has no GetName, not marking as read",
 			zap.String("subject", email.Subject))
@@ -223,13 +916,12 @@ func (c *IMAPClient) handlePostProcessing(imapClient *client.Client, processor m
 	}
 
 	name := strings.ToLower(named.GetName())
-	// Only mark as read for Perplexity and Cloudflare processors
-	if name == "perplexity" || name == "cloudflare" {
+	if processor.MarksAsRead(emailProcessor) {
 		c.logger.Info("Marking email as read (whitelisted processor)",
 			zap.String("processor", name),
 			zap.String("from", email.From),
 			zap.String("subject", email.Subject))
-		c.markAsRead(imapClient, msg.SeqNum)
+		c.markAsRead(imapClient, email.UID)
 	} else {
 		c.logger.Info("Email processed but NOT marked as read (processor not whitelisted)",
 			zap.String("processor", name),
@@ -238,53 +930,133 @@ func (c *IMAPClient) handlePostProcessing(imapClient *client.Client, processor m
 	}
 }
 
-func (c *IMAPClient) markAsRead(imapClient *client.Client, seqNum uint32) {
+// markAsRead flags a message as seen. Messages are addressed by UID because a MOVE
+// fallback expunges the source message, shifting the sequence numbers of the rest.
+func (c *IMAPClient) markAsRead(imapClient *client.Client, uid uint32) {
 	if imapClient == nil {
 		return
 	}
 	seqSet := new(imap.SeqSet)
-	seqSet.AddNum(seqNum)
+	seqSet.AddNum(uid)
 	flags := []interface{}{imap.SeenFlag}
-	if err := imapClient.Store(seqSet, "+FLAGS", flags, nil); err != nil {
+	if err := imapClient.UidStore(seqSet, "+FLAGS", flags, nil); err != nil {
 		c.logger.Error("Failed to mark email as read", zap.Error(err))
 	}
 }
 
-func (c *IMAPClient) markAsUnread(imapClient *client.Client, seqNum uint32) {
+func (c *IMAPClient) markAsUnread(imapClient *client.Client, uid uint32) {
 	if imapClient == nil {
 		return
 	}
 	seqSet := new(imap.SeqSet)
-	seqSet.AddNum(seqNum)
+	seqSet.AddNum(uid)
 	flags := []interface{}{imap.SeenFlag}
-	if err := imapClient.Store(seqSet, "-FLAGS", flags, nil); err != nil {
+	if err := imapClient.UidStore(seqSet, "-FLAGS", flags, nil); err != nil {
 		c.logger.Error("Failed to mark email as unread", zap.Error(err))
 	}
 }
 
-func (c *IMAPClient) parseMessage(msg *imap.Message) models.Email {
-	email := models.Email{
-		ID: msg.Envelope.MessageId,
+// moveToFolder moves a message to the given folder. go-imap falls back to
+// COPY + STORE \Deleted + EXPUNGE when the server does not support MOVE.
+func (c *IMAPClient) moveToFolder(imapClient *client.Client, uid uint32, folder string) {
+	if imapClient == nil {
+		return
 	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+	if err := imapClient.UidMove(seqSet, folder); err != nil {
+		c.logger.Error("Failed to move email",
+			zap.String("folder", folder),
+			zap.Error(err))
+	}
+}
 
-	if msg.Envelope != nil {
-		email.Subject = msg.Envelope.Subject
-		if len(msg.Envelope.From) > 0 {
-			email.From = msg.Envelope.From[0].Address()
+// Malformed messages that are skipped instead of processed
+var (
+	errNoEnvelope = errors.New("message has no envelope")
+	errNoBody     = errors.New("message has no body")
+)
+
+// skipMalformed logs a message the server returned without the parts
+// processing needs, so one bad message doesn't stop the rest of the batch
+func (c *IMAPClient) skipMalformed(msg *imap.Message, err error) {
+	c.logger.Warn("Skipping malformed email",
+		zap.Uint32("seq", msg.SeqNum),
+		zap.Uint32("uid", msg.Uid),
+		zap.Error(err))
+}
+
+// parseEnvelope fills the fields available without the body
+func parseEnvelope(msg *imap.Message) (models.Email, error) {
+	if msg.Envelope == nil {
+		return models.Email{}, errNoEnvelope
+	}
+	email := models.Email{
+		ID:      msg.Envelope.MessageId,
+		UID:     msg.Uid,
+		Subject: decodeHeader(msg.Envelope.Subject),
+		Date:    msg.Envelope.Date,
+	}
+	// Servers may send an empty or partly nil From, which no processor matches
+	for _, from := range msg.Envelope.From {
+		if from != nil {
+			email.From = from.Address()
+			break
 		}
 	}
+	return email, nil
+}
+
+func (c *IMAPClient) parseMessage(msg *imap.Message) (models.Email, error) {
+	email, err := parseEnvelope(msg)
+	if err != nil {
+		return models.Email{}, err
+	}
+
+	charset, encoding := bodyCharset(msg.BodyStructure)
+	email.Charset = charset
 
 	// Parse body - look for BODY[TEXT] section
+	var text imap.Literal
 	for sectionName, body := range msg.Body {
 		sectionStr := string(sectionName.FetchItem())
 		c.logger.Info("Found email section", zap.String("section", sectionStr))
 		if strings.Contains(sectionStr, "TEXT") {
-			email.TextPlain = c.extractTextPlain(body)
+			text = body
 			break
 		}
 	}
+	if text == nil {
+		return models.Email{}, errNoBody
+	}
+	email.TextPlain = c.extractTextPlain(text)
+
+	email.Attachments = parseAttachments(msg.BodyStructure, []byte(email.TextPlain))
+
+	if text, err := decodeBase64Body(msg.BodyStructure, email.TextPlain); err != nil {
+		c.logger.Warn("Failed to decode base64 email body", zap.Error(err))
+	} else if text != email.TextPlain {
+		email.TextPlain = text
+		if encoding == "base64" {
+			encoding = ""
+		}
+	}
+
+	email.TransferEncoding = encoding
+	if text, err := toUTF8(email.TextPlain, charset, encoding); err != nil {
+		c.logger.Warn("Failed to convert email body to UTF-8",
+			zap.String("charset", charset),
+			zap.String("encoding", encoding),
+			zap.Error(err))
+	} else {
+		email.TextPlain = text
+		// toUTF8 decodes quoted-printable before converting other charsets
+		if encoding == "quoted-printable" && !isUTF8Compatible(charset) {
+			email.TransferEncoding = ""
+		}
+	}
 
-	return email
+	return email, nil
 }
 
 func (c *IMAPClient) extractTextPlain(body imap.Literal) string {
@@ -2,18 +2,36 @@ package email
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
 	"go.uber.org/zap"
 
+	"automation-hub/internal/clock"
 	"automation-hub/internal/config"
 	"automation-hub/internal/models"
+	"automation-hub/internal/services/processor"
 )
 
 type mockNamedProcessor struct {
-	name   string
-	sender string
+	name      string
+	sender    string
+	processed int
 }
 
 func (m *mockNamedProcessor) GetName() string {
@@ -28,7 +46,8 @@ func (m *mockNamedProcessor) ShouldProcess(email models.Email) bool {
 	return true
 }
 
-func (m *mockNamedProcessor) Process(email models.Email) error {
+func (m *mockNamedProcessor) Process(ctx context.Context, email models.Email) error {
+	m.processed++
 	return nil
 }
 
@@ -64,6 +83,10 @@ func TestParseMessage(t *testing.T) {
 	logger := zap.NewNop()
 	client := NewIMAPClient(config.EmailConfig{}, logger)
 
+	section, err := imap.ParseBodySectionName("BODY[TEXT]")
+	if err != nil {
+		t.Fatalf("Failed to parse section name: %v", err)
+	}
 	msg := &imap.Message{
 		Envelope: &imap.Envelope{
 			MessageId: "msg-123",
@@ -76,9 +99,15 @@ func TestParseMessage(t *testing.T) {
 				},
 			},
 		},
+		Body: map[*imap.BodySectionName]imap.Literal{
+			section: bytes.NewBufferString("Body"),
+		},
 	}
 
-	email := client.parseMessage(msg)
+	email, err := client.parseMessage(msg)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
 	if email.ID != "msg-123" {
 		t.Errorf("Expected ID msg-123, got %s", email.ID)
 	}
@@ -90,29 +119,66 @@ func TestParseMessage(t *testing.T) {
 	}
 }
 
+func TestParseMessageMalformed(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{}, zap.NewNop())
+
+	section, err := imap.ParseBodySectionName("BODY[TEXT]")
+	if err != nil {
+		t.Fatalf("Failed to parse section name: %v", err)
+	}
+	body := func() map[*imap.BodySectionName]imap.Literal {
+		return map[*imap.BodySectionName]imap.Literal{section: bytes.NewBufferString("Your code is 123456")}
+	}
+
+	tests := []struct {
+		name         string
+		msg          *imap.Message
+		expectedErr  error
+		expectedFrom string
+	}{
+		{"Nil envelope", &imap.Message{Uid: 1, Body: body()}, errNoEnvelope, ""},
+		{"Missing body", &imap.Message{Uid: 2, Envelope: &imap.Envelope{Subject: "Code"}}, errNoBody, ""},
+		{"No sender", &imap.Message{Uid: 3, Envelope: &imap.Envelope{Subject: "Code"}, Body: body()}, nil, ""},
+		{"Nil sender skipped", &imap.Message{Uid: 4, Envelope: &imap.Envelope{
+			From: []*imap.Address{nil, {MailboxName: "codes", HostName: "example.org"}},
+		}, Body: body()}, nil, "codes@example.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := client.parseMessage(tt.msg)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("parseMessage() error = %v, expected %v", err, tt.expectedErr)
+			}
+			if email.From != tt.expectedFrom {
+				t.Errorf("parseMessage() From = %q, expected %q", email.From, tt.expectedFrom)
+			}
+		})
+	}
+}
+
 func TestHandlePostProcessing(t *testing.T) {
 	logger := zap.NewNop()
 	client := NewIMAPClient(config.EmailConfig{}, logger)
 
-	email := models.Email{Subject: "Test"}
-	msg := &imap.Message{SeqNum: 1}
+	email := models.Email{Subject: "Test", UID: 1}
 
 	// Processor without GetName interface
 	structProcessor := &models.TorrentNotification{}
-	client.handlePostProcessing(nil, nil, msg, email)
+	client.handlePostProcessing(nil, nil, email)
 	_ = structProcessor
 
 	// Processor named "perplexity"
 	perplexityProc := &mockNamedProcessor{name: "perplexity", sender: "perplexity@test.com"}
-	client.handlePostProcessing(nil, perplexityProc, msg, email)
+	client.handlePostProcessing(nil, perplexityProc, email)
 
 	// Processor named "cloudflare"
 	cfProc := &mockNamedProcessor{name: "cloudflare", sender: "cf@test.com"}
-	client.handlePostProcessing(nil, cfProc, msg, email)
+	client.handlePostProcessing(nil, cfProc, email)
 
 	// Processor named "other"
 	otherProc := &mockNamedProcessor{name: "generic", sender: "other@test.com"}
-	client.handlePostProcessing(nil, otherProc, msg, email)
+	client.handlePostProcessing(nil, otherProc, email)
 }
 
 func TestMarkAsReadAndUnreadNilClient(t *testing.T) {
@@ -122,3 +188,830 @@ func TestMarkAsReadAndUnreadNilClient(t *testing.T) {
 	client.markAsRead(nil, 1)
 	client.markAsUnread(nil, 1)
 }
+
+func TestUnreadCriteria(t *testing.T) {
+	logger := zap.NewNop()
+
+	client := NewIMAPClient(config.EmailConfig{}, logger)
+	criteria := client.unreadCriteria()
+	if len(criteria.WithoutFlags) != 1 || criteria.WithoutFlags[0] != imap.SeenFlag {
+		t.Errorf("Expected criteria without \\Seen flag, got %v", criteria.WithoutFlags)
+	}
+	if !criteria.Since.IsZero() || !criteria.SentSince.IsZero() {
+		t.Error("Expected no date filter when search_since_minutes is not set")
+	}
+
+	client = NewIMAPClient(config.EmailConfig{SearchSinceMinutes: 30}, logger)
+	criteria = client.unreadCriteria()
+	expected := time.Now().Add(-30 * time.Minute)
+	if criteria.Since.IsZero() || criteria.Since.Sub(expected).Abs() > time.Minute {
+		t.Errorf("Expected Since around %v, got %v", expected, criteria.Since)
+	}
+	if !criteria.SentSince.Equal(criteria.Since) {
+		t.Errorf("Expected SentSince to equal Since, got %v", criteria.SentSince)
+	}
+}
+
+func TestHandlePostProcessingMoveToFolder(t *testing.T) {
+	logger := zap.NewNop()
+	client := NewIMAPClient(config.EmailConfig{MoveToFolder: "Processed"}, logger)
+
+	email := models.Email{Subject: "Test", UID: 42}
+
+	// Nil IMAP connection must not panic, with or without a named processor
+	client.handlePostProcessing(nil, nil, email)
+	client.handlePostProcessing(nil, &mockNamedProcessor{name: "cloudflare"}, email)
+	client.moveToFolder(nil, 42, "Processed")
+}
+
+func TestReadOnly(t *testing.T) {
+	generic := &mockNamedProcessor{name: "generic"}
+	cloudflare := &mockNamedProcessor{name: "cloudflare"}
+	tests := []struct {
+		name       string
+		config     config.EmailConfig
+		processors []models.EmailProcessor
+		expected   bool
+	}{
+		{"No processor marks as read", config.EmailConfig{}, []models.EmailProcessor{generic}, true},
+		{"Processor marks as read", config.EmailConfig{}, []models.EmailProcessor{generic, cloudflare}, false},
+		{"Move to folder", config.EmailConfig{MoveToFolder: "Processed"}, []models.EmailProcessor{generic}, false},
+		{"Max attempts", config.EmailConfig{MaxAttempts: 3}, []models.EmailProcessor{generic}, false},
+		{"Explicit read only", config.EmailConfig{ReadOnly: true}, []models.EmailProcessor{cloudflare}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewIMAPClient(tt.config, zap.NewNop())
+			if got := c.readOnly(tt.processors); got != tt.expected {
+				t.Errorf("readOnly() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPollingIntervalAndLastPoll(t *testing.T) {
+	logger := zap.NewNop()
+
+	client := NewIMAPClient(config.EmailConfig{}, logger)
+	if got := client.PollingInterval(); got != 60*time.Second {
+		t.Errorf("Expected default polling interval 60s, got %v", got)
+	}
+	if !client.LastPoll().IsZero() {
+		t.Error("Expected zero LastPoll before any poll")
+	}
+
+	client.recordPoll(client.folders[0])
+	if time.Since(client.LastPoll()) > time.Second {
+		t.Errorf("Expected LastPoll to be recent, got %v", client.LastPoll())
+	}
+
+	client = NewIMAPClient(config.EmailConfig{PollingInterval: 15}, logger)
+	if got := client.PollingInterval(); got != 15*time.Second {
+		t.Errorf("Expected polling interval 15s, got %v", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		percent  int
+		r        float64
+		expected time.Duration
+	}{
+		{"Disabled", 0, 0.9, 60 * time.Second},
+		{"Lowest", 10, 0, 54 * time.Second},
+		{"Middle", 10, 0.5, 60 * time.Second},
+		{"Near highest", 10, 0.75, 63 * time.Second},
+		{"Half", 50, 0, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jitter(60*time.Second, tt.percent, tt.r); got != tt.expected {
+				t.Errorf("jitter() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFolders(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{
+		PollingInterval: 120,
+		Folders:         []config.FolderConfig{{Name: "INBOX", PollingInterval: 10}, {Name: "Newsletters"}},
+	}, zap.NewNop())
+
+	if len(client.folders) != 2 {
+		t.Fatalf("Expected 2 folders, got %d", len(client.folders))
+	}
+	if got := client.folders[0].interval; got != 10*time.Second {
+		t.Errorf("INBOX interval = %v, expected 10s", got)
+	}
+	if got := client.folders[1].interval; got != 120*time.Second {
+		t.Errorf("Newsletters interval = %v, expected the global 2m0s", got)
+	}
+
+	// Readiness follows the slowest folder
+	if got := client.PollingInterval(); got != 120*time.Second {
+		t.Errorf("PollingInterval() = %v, expected 2m0s", got)
+	}
+	client.recordPoll(client.folders[0])
+	if !client.LastPoll().IsZero() {
+		t.Error("LastPoll() is set before every folder was checked")
+	}
+	client.recordPoll(client.folders[1])
+	if client.LastPoll().IsZero() {
+		t.Error("LastPoll() is zero after every folder was checked")
+	}
+}
+
+// fakeDispatcher processes emails serially with first-match semantics like processor.Manager
+type fakeDispatcher struct {
+	processors []models.EmailProcessor
+	waited     bool
+}
+
+func (d *fakeDispatcher) GetProcessors() []models.EmailProcessor {
+	return d.processors
+}
+
+func (d *fakeDispatcher) ProcessEmailsConcurrently(ctx context.Context, emails []models.Email, onProcessed func(models.EmailProcessor, models.Email)) {
+	for _, email := range emails {
+		for _, p := range d.processors {
+			if p.ShouldProcess(email) {
+				if err := p.Process(ctx, email); err == nil && onProcessed != nil {
+					onProcessed(p, email)
+				}
+				break
+			}
+		}
+	}
+}
+
+func (d *fakeDispatcher) Wait() {
+	d.waited = true
+}
+
+func TestStartMonitoringWaitsForDispatcher(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{}, zap.NewNop())
+	dispatcher := &fakeDispatcher{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		client.StartMonitoring(ctx, context.Background(), dispatcher)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("StartMonitoring() did not return after the context was canceled")
+	}
+	if !dispatcher.waited {
+		t.Error("Expected StartMonitoring() to wait for pending sends before returning")
+	}
+}
+
+func TestSetDispatcher(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{}, zap.NewNop())
+	if got := client.currentDispatcher(); got != nil {
+		t.Fatalf("currentDispatcher() = %v, expected nil", got)
+	}
+
+	first := &fakeDispatcher{}
+	second := &fakeDispatcher{}
+	client.SetDispatcher(first)
+	client.SetDispatcher(second)
+
+	if got := client.currentDispatcher(); got != second {
+		t.Errorf("currentDispatcher() = %v, expected the last dispatcher set", got)
+	}
+}
+
+func TestDispatchDedup(t *testing.T) {
+	email := models.Email{ID: "otp-1", UID: 42, Subject: "Your code"}
+
+	tests := []struct {
+		name     string
+		dedup    bool
+		dryRun   bool
+		expected int
+	}{
+		{"Disabled processes every time", false, false, 2},
+		{"Enabled skips the duplicate", true, false, 1},
+		{"Dry run does not record the email", true, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewIMAPClient(config.EmailConfig{Dedup: tt.dedup}, zap.NewNop())
+			client.SetDryRun(tt.dryRun)
+			proc := &mockNamedProcessor{name: "generic"}
+			dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{proc}}
+
+			processed := client.dispatch(context.Background(), nil, nil, []models.Email{email}, dispatcher)
+			processed += client.dispatch(context.Background(), nil, nil, []models.Email{email}, dispatcher)
+
+			if proc.processed != tt.expected {
+				t.Errorf("Process() called %d times, expected %d", proc.processed, tt.expected)
+			}
+			if processed != tt.expected {
+				t.Errorf("dispatch() reported %d processed, expected %d", processed, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckOnce(t *testing.T) {
+	client := NewIMAPClient(config.EmailConfig{Host: "127.0.0.1", Port: 1}, zap.NewNop())
+
+	if _, _, err := client.CheckOnce(context.Background()); err == nil {
+		t.Error("CheckOnce() = nil, expected error before monitoring starts")
+	}
+
+	client.SetDispatcher(&fakeDispatcher{})
+	if _, _, err := client.CheckOnce(context.Background()); err == nil {
+		t.Error("CheckOnce() = nil, expected connection error")
+	}
+	if !client.LastPoll().IsZero() {
+		t.Error("LastPoll() was updated by a failed check")
+	}
+	if err, at := client.LastError(); err == nil || !strings.HasPrefix(err.Error(), "INBOX: ") || time.Since(at) > time.Second {
+		t.Errorf("LastError() = %v at %v, expected a recent INBOX connection error", err, at)
+	}
+}
+
+// startIMAPServer serves the go-imap memory backend (user "username", password
+// "password") on a random local port. implicitTLS wraps the listener in TLS,
+// startTLS offers STARTTLS on a plaintext one, extensions are enabled on the server.
+func startIMAPServer(t *testing.T, implicitTLS, startTLS bool, extensions ...server.Extension) (config.EmailConfig, *memory.Backend) {
+	t.Helper()
+
+	// httptest's certificate is valid for 127.0.0.1, written out as the CA file
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	certSrv.Close()
+	tlsConfig := &tls.Config{Certificates: certSrv.TLS.Certificates}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certSrv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if implicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	be := memory.New()
+	srv := server.New(be)
+	srv.AllowInsecureAuth = !implicitTLS && !startTLS
+	if startTLS {
+		srv.TLSConfig = tlsConfig
+	}
+	srv.Enable(extensions...)
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return config.EmailConfig{
+		Host:     "127.0.0.1",
+		Port:     addr.Port,
+		Username: "username",
+		Password: "password",
+		TLS:      config.IMAPTLSConfig{CAFile: caFile},
+	}, be
+}
+
+// addUnreadMessage delivers an unread email from contact@example.org to the INBOX
+func addUnreadMessage(t *testing.T, be *memory.Backend) {
+	t.Helper()
+
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	body := "From: contact@example.org\r\nSubject: Code\r\nDate: " + time.Now().Format(time.RFC1123Z) + "\r\nMessage-ID: <code@example.org>\r\nContent-Type: text/plain\r\n\r\nYour code is 123456"
+	if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+		t.Fatalf("Failed to add message: %v", err)
+	}
+}
+
+func TestConnectAndLoginTLSModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		tlsMode     string
+		implicitTLS bool
+		startTLS    bool
+		wantErr     bool
+	}{
+		{"Implicit TLS by default", "", true, false, false},
+		{"Implicit TLS", config.TLSModeTLS, true, false, false},
+		{"STARTTLS", config.TLSModeStartTLS, false, true, false},
+		{"STARTTLS not offered", config.TLSModeStartTLS, false, false, true},
+		{"Plaintext", config.TLSModeNone, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := startIMAPServer(t, tt.implicitTLS, tt.startTLS)
+			cfg.TLSMode = tt.tlsMode
+			c := NewIMAPClient(cfg, zap.NewNop())
+
+			imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connectAndLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.logout(imapClient)
+
+			if tt.startTLS && !imapClient.IsTLS() {
+				t.Error("Expected the connection to be upgraded to TLS")
+			}
+			if imapClient.Mailbox() == nil || imapClient.Mailbox().Name != "INBOX" {
+				t.Errorf("Selected mailbox = %v, expected INBOX", imapClient.Mailbox())
+			}
+		})
+	}
+}
+
+func TestConnectAndLoginCertificateVerification(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     config.IMAPTLSConfig
+		wantErr bool
+	}{
+		{"Self-signed rejected with system roots", config.IMAPTLSConfig{}, true},
+		{"Missing CA file", config.IMAPTLSConfig{CAFile: "/nonexistent/ca.pem"}, true},
+		{"Verification skipped", config.IMAPTLSConfig{InsecureSkipVerify: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := startIMAPServer(t, true, false)
+			cfg.TLS = tt.tls
+			c := NewIMAPClient(cfg, zap.NewNop())
+
+			imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connectAndLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				c.logout(imapClient)
+			}
+		})
+	}
+}
+
+func TestCheckOnceFolders(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	addUnreadMessage(t, be)
+	cfg.Folders = []config.FolderConfig{{Name: "INBOX"}, {Name: "Missing"}}
+
+	c := NewIMAPClient(cfg, zap.NewNop())
+	c.SetDryRun(true)
+	proc := &mockNamedProcessor{name: "codes", sender: "example.org"}
+	c.SetDispatcher(&fakeDispatcher{processors: []models.EmailProcessor{proc}})
+
+	found, processed, err := c.CheckOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("CheckOnce() error = %v, expected the Missing folder to fail", err)
+	}
+	if found != 1 || processed != 1 {
+		t.Errorf("CheckOnce() = %d found, %d processed, expected 1 and 1", found, processed)
+	}
+	// A folder that was never checked keeps the service unready
+	if !c.LastPoll().IsZero() {
+		t.Errorf("LastPoll() = %v, expected zero while Missing fails", c.LastPoll())
+	}
+}
+
+// headerProcessor handles emails with the given subject and can tell so from
+// the headers, so other emails are not downloaded for it
+type headerProcessor struct {
+	mockNamedProcessor
+	subject string
+	bodies  []string
+}
+
+func (p *headerProcessor) MatchesHeaders(email models.Email) bool {
+	return email.Subject == p.subject
+}
+
+func (p *headerProcessor) ShouldProcess(email models.Email) bool {
+	return p.MatchesHeaders(email)
+}
+
+func (p *headerProcessor) Process(ctx context.Context, email models.Email) error {
+	p.bodies = append(p.bodies, email.TextPlain)
+	return nil
+}
+
+func TestFetchAndProcessMessagesSkipsUnmatchedBodies(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	addUnreadMessage(t, be)
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	newsletter := "From: contact@example.org\r\nSubject: Newsletter\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("news ", 1000)
+	if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(newsletter)); err != nil {
+		t.Fatalf("Failed to add message: %v", err)
+	}
+
+	c := NewIMAPClient(cfg, zap.NewNop())
+	imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+	if err != nil {
+		t.Fatalf("connectAndLogin() error = %v", err)
+	}
+	defer c.logout(imapClient)
+
+	ids, err := c.searchUnreadEmails(imapClient, nil)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("searchUnreadEmails() = %v, %v, expected 2 messages", ids, err)
+	}
+
+	proc := &headerProcessor{subject: "Code"}
+	dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{proc}}
+	found, err := c.fetchCandidates(imapClient, nil, ids, dispatcher.GetProcessors())
+	if err != nil || len(found.uids) != 1 || len(found.unmatched) != 0 {
+		t.Fatalf("fetchCandidates() = %+v, %v, expected 1 candidate", found, err)
+	}
+
+	processed, err := c.fetchAndProcessMessages(context.Background(), imapClient, nil, ids, dispatcher)
+	if err != nil || processed != 1 {
+		t.Fatalf("fetchAndProcessMessages() = %d, %v, expected 1 processed", processed, err)
+	}
+	if len(proc.bodies) != 1 || proc.bodies[0] != "Your code is 123456" {
+		t.Errorf("Processed bodies = %q, expected the code email's body", proc.bodies)
+	}
+
+	// With a fallback, unmatched emails are kept by their envelopes alone
+	c.config.Fallback.TelegramChatID = "999"
+	found, err = c.fetchCandidates(imapClient, nil, ids, dispatcher.GetProcessors())
+	if err != nil || len(found.uids) != 1 || len(found.unmatched) != 1 || found.unmatched[0].Subject != "Newsletter" {
+		t.Errorf("fetchCandidates() with a fallback = %+v, %v, expected 1 candidate and the newsletter unmatched", found, err)
+	}
+}
+
+// fallbackDispatcher counts the emails handed to email.fallback
+type fallbackDispatcher struct {
+	fakeDispatcher
+	forwarded []string // subjects
+}
+
+func (d *fallbackDispatcher) ForwardUnmatched(ctx context.Context, email models.Email) error {
+	d.forwarded = append(d.forwarded, email.Subject)
+	return nil
+}
+
+func TestForwardUnmatchedAcrossReloads(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	newsletter := "From: contact@example.org\r\nSubject: Newsletter\r\nMessage-ID: <news@example.org>\r\nContent-Type: text/plain\r\n\r\nNews"
+	if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(newsletter)); err != nil {
+		t.Fatalf("Failed to add message: %v", err)
+	}
+
+	cfg.Fallback.TelegramChatID = "999"
+	c := NewIMAPClient(cfg, zap.NewNop())
+	clk := clock.NewFake(time.Now())
+	c.SetClock(clk)
+	proc := &headerProcessor{subject: "Code"}
+	poll := func() *fallbackDispatcher {
+		t.Helper()
+		// Every poll gets a new dispatcher, as after a config reload
+		dispatcher := &fallbackDispatcher{fakeDispatcher: fakeDispatcher{processors: []models.EmailProcessor{proc}}}
+		if _, _, err := c.checkEmails(context.Background(), dispatcher, c.folders[0]); err != nil {
+			t.Fatalf("checkEmails() returned unexpected error: %v", err)
+		}
+		return dispatcher
+	}
+
+	if forwarded := poll().forwarded; !slices.Equal(forwarded, []string{"Newsletter"}) {
+		t.Fatalf("Forwarded %q, expected the newsletter", forwarded)
+	}
+	if len(proc.bodies) != 0 {
+		t.Errorf("Fetched bodies %q, expected none for an unmatched email", proc.bodies)
+	}
+
+	// Still unread well past the dedup window, but renewed by every poll
+	for range 3 {
+		clk.Advance(6 * time.Minute)
+		if forwarded := poll().forwarded; len(forwarded) != 0 {
+			t.Fatalf("Forwarded %q again, expected it to be remembered", forwarded)
+		}
+	}
+}
+
+// envelopeProcessor only needs the headers
+type envelopeProcessor struct {
+	mockNamedProcessor
+}
+
+func (p *envelopeProcessor) RequiredFetchItems() []imap.FetchItem {
+	return []imap.FetchItem{imap.FetchEnvelope}
+}
+
+func TestFetchItems(t *testing.T) {
+	generic := processor.NewGenericEmailProcessor("codes", config.ServiceProcessorConfig{}, nil, zap.NewNop())
+
+	tests := []struct {
+		name       string
+		processors []models.EmailProcessor
+		expected   []imap.FetchItem
+	}{
+		{"No processors", nil, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid}},
+		{"Headers only", []models.EmailProcessor{&envelopeProcessor{}}, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid}},
+		{"Declared items", []models.EmailProcessor{generic}, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchBodyStructure, processor.TextSection}},
+		{"Undeclared gets the default set", []models.EmailProcessor{&envelopeProcessor{}, &mockNamedProcessor{}}, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchBodyStructure, processor.TextSection, imap.FetchFlags}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fetchItems(tt.processors); !slices.Equal(got, tt.expected) {
+				t.Errorf("fetchItems() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchBodiesHeadersOnly(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	addUnreadMessage(t, be)
+	c := NewIMAPClient(cfg, zap.NewNop())
+	imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+	if err != nil {
+		t.Fatalf("connectAndLogin() error = %v", err)
+	}
+	defer c.logout(imapClient)
+
+	processors := []models.EmailProcessor{&envelopeProcessor{}}
+	ids, err := c.searchUnreadEmails(imapClient, nil)
+	if err != nil {
+		t.Fatalf("searchUnreadEmails() error = %v", err)
+	}
+	found, err := c.fetchCandidates(imapClient, nil, ids, processors)
+	if err != nil {
+		t.Fatalf("fetchCandidates() error = %v", err)
+	}
+
+	emails, err := c.fetchBodies(imapClient, found.uids, fetchItems(processors))
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("fetchBodies() = %v, %v, expected 1 email", emails, err)
+	}
+	if emails[0].Subject != "Code" || emails[0].TextPlain != "" {
+		t.Errorf("fetchBodies() = %+v, expected the headers without the body", emails[0])
+	}
+}
+
+func TestSearchUnreadEmailsReportsFailedSenders(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	addUnreadMessage(t, be)
+	c := NewIMAPClient(cfg, zap.NewNop())
+	imapClient, err := c.connectAndLogin(context.Background(), "INBOX", false)
+	if err != nil {
+		t.Fatalf("connectAndLogin() error = %v", err)
+	}
+	defer c.logout(imapClient)
+
+	ids, err := c.searchUnreadEmails(imapClient, []string{"example.org"})
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("searchUnreadEmails() = %v, %v, expected 1 message", ids, err)
+	}
+
+	// Every search fails once the connection is closed, which must not look
+	// like a mailbox without new emails
+	if err := imapClient.Terminate(); err != nil {
+		t.Fatalf("Terminate() error = %v", err)
+	}
+	ids, err = c.searchUnreadEmails(imapClient, []string{"example.org", "github.com"})
+	if err == nil || len(ids) != 0 {
+		t.Fatalf("searchUnreadEmails() = %v, %v, expected an error", ids, err)
+	}
+	for _, sender := range []string{"example.org", "github.com"} {
+		if !strings.Contains(err.Error(), "search for "+sender) {
+			t.Errorf("searchUnreadEmails() error = %v, expected the failed search for %s", err, sender)
+		}
+	}
+}
+
+func TestCapPerCycle(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPerCycle int
+		uids        []uint32
+		handled     map[uint32]bool
+		expected    []uint32
+	}{
+		{"Unlimited", 0, []uint32{7, 3, 5}, nil, []uint32{7, 3, 5}},
+		{"Under the cap", 5, []uint32{7, 3, 5}, nil, []uint32{7, 3, 5}},
+		{"Oldest first", 2, []uint32{7, 3, 5}, nil, []uint32{3, 5}},
+		{"Handled last", 2, []uint32{7, 3, 5}, map[uint32]bool{3: true}, []uint32{5, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewIMAPClient(config.EmailConfig{MaxPerCycle: tt.maxPerCycle}, zap.NewNop())
+			if got := c.capPerCycle(tt.uids, tt.handled); !slices.Equal(got, tt.expected) {
+				t.Errorf("capPerCycle() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCapPerCycleServesNewEmailsFirst(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	addMessage := func(n int) {
+		body := fmt.Sprintf("From: contact@example.org\r\nSubject: Code\r\nMessage-ID: <code-%d@example.org>\r\nContent-Type: text/plain\r\n\r\nYour code is %d", n, n)
+		if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+			t.Fatalf("Failed to add message: %v", err)
+		}
+	}
+	addMessage(1)
+	addMessage(2)
+
+	// Not whitelisted, so handled emails stay unread ahead of new ones
+	cfg.MaxPerCycle = 2
+	proc := &headerProcessor{mockNamedProcessor: mockNamedProcessor{name: "generic"}, subject: "Code"}
+	dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{proc}}
+	c := NewIMAPClient(cfg, zap.NewNop())
+	if _, processed, err := c.checkEmails(context.Background(), dispatcher, c.folders[0]); err != nil || processed != 2 {
+		t.Fatalf("checkEmails() processed %d (%v), expected both emails", processed, err)
+	}
+
+	addMessage(3)
+	if _, _, err := c.checkEmails(context.Background(), dispatcher, c.folders[0]); err != nil {
+		t.Fatalf("checkEmails() returned unexpected error: %v", err)
+	}
+	if !slices.Contains(proc.bodies, "Your code is 3") {
+		t.Errorf("Processed bodies = %q, expected the new email despite the cap", proc.bodies)
+	}
+}
+
+// blockingProcessor holds Process until the context is canceled
+type blockingProcessor struct {
+	mockNamedProcessor
+	started chan struct{}
+}
+
+func (p *blockingProcessor) Process(ctx context.Context, email models.Email) error {
+	close(p.started)
+	<-ctx.Done()
+	p.processed++
+	return ctx.Err()
+}
+
+func TestStartMonitoringFinishesInFlightCheck(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	addUnreadMessage(t, be)
+	cfg.Folders = []config.FolderConfig{{Name: "INBOX", PollingInterval: 1}, {Name: "Archive", PollingInterval: 3600}}
+
+	c := NewIMAPClient(cfg, zap.NewNop())
+	proc := &blockingProcessor{mockNamedProcessor: mockNamedProcessor{sender: "example.org"}, started: make(chan struct{})}
+	dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{proc}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sendCtx, cancelSends := context.WithCancel(context.Background())
+	defer cancelSends()
+	done := make(chan struct{})
+	go func() {
+		c.StartMonitoring(ctx, sendCtx, dispatcher)
+		close(done)
+	}()
+
+	select {
+	case <-proc.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("INBOX was not polled on its own interval")
+	}
+	cancel()
+
+	// Stopping the polling leaves the send in flight running
+	select {
+	case <-done:
+		t.Fatal("StartMonitoring() returned before the send in flight was finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancelSends()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartMonitoring() did not return after the context was canceled")
+	}
+	if proc.processed != 1 {
+		t.Errorf("Expected the in-flight email to finish before returning, processed %d", proc.processed)
+	}
+	if !dispatcher.waited {
+		t.Error("Expected StartMonitoring() to wait for pending sends before returning")
+	}
+}
+
+// startHungServer accepts IMAP connections, optionally sends the greeting, and
+// then never answers
+func startHungServer(t *testing.T, greet bool) config.EmailConfig {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			if greet {
+				_, _ = conn.Write([]byte("* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] ready\r\n"))
+			}
+		}
+	}()
+
+	return config.EmailConfig{
+		Host:          "127.0.0.1",
+		Port:          listener.Addr().(*net.TCPAddr).Port,
+		Username:      "username",
+		Password:      "password",
+		TLSMode:       config.TLSModeNone,
+		AllowInsecure: true,
+	}
+}
+
+func TestIMAPTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		greet   bool
+		tlsMode string
+	}{
+		{"No greeting, plaintext", false, config.TLSModeNone},
+		{"No TLS handshake", false, config.TLSModeTLS},
+		{"No answer to LOGIN", true, config.TLSModeNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := startHungServer(t, tt.greet)
+			cfg.TLSMode = tt.tlsMode
+			cfg.DialTimeout = 1
+			cfg.CommandTimeout = 1
+			c := NewIMAPClient(cfg, zap.NewNop())
+			c.SetDispatcher(&fakeDispatcher{})
+
+			start := time.Now()
+			_, _, err := c.CheckOnce(context.Background())
+			if err == nil {
+				t.Fatal("CheckOnce() = nil, expected a timeout error")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("CheckOnce() took %v, expected it to give up after about 1s", elapsed)
+			}
+			if lastErr, _ := c.LastError(); lastErr == nil {
+				t.Error("LastError() = nil, expected the timeout to be recorded")
+			}
+		})
+	}
+}
+
+func TestDialCanceled(t *testing.T) {
+	cfg := startHungServer(t, false)
+	c := NewIMAPClient(cfg, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.connectAndLogin(ctx, "INBOX", false); !errors.Is(err, context.Canceled) {
+		t.Errorf("connectAndLogin() error = %v, expected context.Canceled", err)
+	}
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/processor"
+	"automation-hub/internal/services/telegram"
+)
+
+// recordingSender stands in for the Bot API, recording the texts sent
+type recordingSender struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *recordingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg, ok := c.(tgbotapi.MessageConfig); ok {
+		s.texts = append(s.texts, msg.Text)
+	}
+	return tgbotapi.Message{MessageID: len(s.texts)}, nil
+}
+
+// TestCheckEmailsEndToEnd runs a poll against an in-process IMAP server with
+// the real processors: search, fetch, decoding, code extraction, Telegram send
+// and marking the email as read
+func TestCheckEmailsEndToEnd(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	body := "From: Perplexity <team@mail.perplexity.ai>\r\n" +
+		"Subject: Sign in to Perplexity\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Message-ID: <signin-1@mail.perplexity.ai>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"b1\"\r\n\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Sign in by entering this code directly: 482913\r\n\r\n" +
+		"If you didn=E2=80=99t request this, ignore this email.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>Sign in by entering this code directly: <b>482913</b></p>\r\n" +
+		"--b1--\r\n"
+	if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+		t.Fatalf("Failed to add message: %v", err)
+	}
+	cfg.Services = []config.ServiceConfig{{
+		Name: "perplexity", // whitelisted, so the email is marked as read
+		Config: config.ServiceProcessorConfig{
+			EmailFrom:       []string{"perplexity.ai"},
+			EmailSubject:    []string{"Sign in"},
+			TelegramChatID:  "123",
+			TelegramMessage: "🔮 Perplexity Code: %s",
+		},
+	}}
+
+	sender := &recordingSender{}
+	telegramClient, err := telegram.NewClientWithSender(config.TelegramConfig{}, sender, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClientWithSender() returned unexpected error: %v", err)
+	}
+	manager, err := processor.NewProcessorManager(cfg, processor.Notifiers{Telegram: telegramClient}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	c := NewIMAPClient(cfg, zap.NewNop())
+	found, processed, err := c.checkEmails(context.Background(), manager, c.folders[0])
+	if err != nil || found != 1 || processed != 1 {
+		t.Fatalf("checkEmails() = %d, %d, %v, expected 1 found and processed", found, processed, err)
+	}
+	if len(sender.texts) != 1 || sender.texts[0] != "🔮 Perplexity Code: 482913" {
+		t.Errorf("Sent %q, expected the extracted code", sender.texts)
+	}
+
+	status, err := mailbox.Status([]imap.StatusItem{imap.StatusUnseen})
+	if err != nil || status.Unseen != 0 {
+		t.Errorf("INBOX has %d unseen emails (%v), expected the processed one marked as read", status.Unseen, err)
+	}
+
+	// Marked as read, so the next poll finds nothing to send
+	found, _, err = c.checkEmails(context.Background(), manager, c.folders[0])
+	if err != nil || found != 0 || len(sender.texts) != 1 {
+		t.Errorf("Second checkEmails() found %d, sent %d (%v), expected nothing new", found, len(sender.texts), err)
+	}
+	if c.LastPoll().IsZero() {
+		t.Error("LastPoll() is zero after successful checks")
+	}
+}
+
+// TestCheckEmailsReadOnly checks that email.read_only leaves a processed email
+// unread even when its processor marks as read
+func TestCheckEmailsReadOnly(t *testing.T) {
+	cfg, be := startIMAPServer(t, true, false)
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("Failed to log in to the backend: %v", err)
+	}
+	mailbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Failed to open INBOX: %v", err)
+	}
+	body := "From: Perplexity <team@mail.perplexity.ai>\r\n" +
+		"Subject: Sign in to Perplexity\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"Sign in by entering this code directly: 482913\r\n"
+	if err := mailbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+		t.Fatalf("Failed to add message: %v", err)
+	}
+	cfg.ReadOnly = true
+	cfg.Services = []config.ServiceConfig{{
+		Name: "perplexity",
+		Config: config.ServiceProcessorConfig{
+			EmailFrom:       []string{"perplexity.ai"},
+			EmailSubject:    []string{"Sign in"},
+			TelegramChatID:  "123",
+			TelegramMessage: "🔮 Perplexity Code: %s",
+		},
+	}}
+
+	sender := &recordingSender{}
+	telegramClient, err := telegram.NewClientWithSender(config.TelegramConfig{}, sender, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClientWithSender() returned unexpected error: %v", err)
+	}
+	manager, err := processor.NewProcessorManager(cfg, processor.Notifiers{Telegram: telegramClient}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	c := NewIMAPClient(cfg, zap.NewNop())
+	found, processed, err := c.checkEmails(context.Background(), manager, c.folders[0])
+	if err != nil || found != 1 || processed != 1 {
+		t.Fatalf("checkEmails() = %d, %d, %v, expected 1 found and processed", found, processed, err)
+	}
+	// The memory backend doesn't count unseen emails in STATUS, so check the flags
+	messages := mailbox.(*memory.Mailbox).Messages
+	if flags := messages[len(messages)-1].Flags; slices.Contains(flags, imap.SeenFlag) {
+		t.Errorf("Email flags = %v, expected the email left unread", flags)
+	}
+}
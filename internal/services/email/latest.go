@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/models"
+	"automation-hub/internal/services/processor"
+)
+
+// ErrNoMatchingEmail is returned by FindLatest when no recent email matches
+var ErrNoMatchingEmail = errors.New("no matching email found")
+
+// FindLatest returns the most recent email, read or unread, that the processor
+// would handle, and the folder it is in. Only the last limit messages from the
+// processor's senders are checked in each folder. Folders are opened read-only,
+// so nothing is marked as read or moved.
+func (c *IMAPClient) FindLatest(processor models.EmailProcessor, limit int) (models.Email, string, error) {
+	var latest models.Email
+	var latestFolder string
+	var errs []error
+	for _, f := range c.folders {
+		email, ok, err := c.findLatestInFolder(f.name, processor, limit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+			continue
+		}
+		if ok && (latestFolder == "" || email.Date.After(latest.Date)) {
+			latest, latestFolder = email, f.name
+		}
+	}
+
+	if latestFolder != "" {
+		return latest, latestFolder, nil
+	}
+	if len(errs) > 0 {
+		return models.Email{}, "", errors.Join(errs...)
+	}
+	return models.Email{}, "", ErrNoMatchingEmail
+}
+
+func (c *IMAPClient) findLatestInFolder(folder string, emailProcessor models.EmailProcessor, limit int) (models.Email, bool, error) {
+	imapClient, err := c.connectAndLogin(context.Background(), folder, true)
+	if err != nil {
+		return models.Email{}, false, err
+	}
+	defer c.logout(imapClient)
+
+	var criteria []*imap.SearchCriteria
+	for _, sender := range processor.Senders(emailProcessor) {
+		if sender = strings.TrimPrefix(sender, "@"); sender != "" {
+			criteria = append(criteria, &imap.SearchCriteria{Header: map[string][]string{"From": {sender}}})
+		}
+	}
+	if len(criteria) == 0 {
+		criteria = append(criteria, imap.NewSearchCriteria())
+	}
+
+	var ids []uint32
+	for _, criterion := range criteria {
+		found, err := imapClient.Search(criterion)
+		if err != nil {
+			return models.Email{}, false, fmt.Errorf("failed to search emails: %w", err)
+		}
+		ids = append(ids, found...)
+	}
+	if len(ids) == 0 {
+		return models.Email{}, false, nil
+	}
+
+	// Sequence numbers grow with arrival, so the last ones are the newest
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[len(ids)-limit:]
+	}
+
+	emails, err := c.fetchEmails(imapClient, ids, fetchItems([]models.EmailProcessor{emailProcessor}))
+	if err != nil {
+		return models.Email{}, false, err
+	}
+	c.logger.Debug("Looking for the latest matching email",
+		zap.String("folder", folder),
+		zap.Int("candidates", len(emails)))
+
+	var latest models.Email
+	found := false
+	for _, email := range emails {
+		if emailProcessor.ShouldProcess(email) && (!found || !email.Date.Before(latest.Date)) {
+			latest, found = email, true
+		}
+	}
+	return latest, found, nil
+}
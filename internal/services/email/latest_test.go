@@ -0,0 +1,81 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// subjectProcessor matches emails by exact subject
+type subjectProcessor struct {
+	mockNamedProcessor
+	subject string
+}
+
+func (p *subjectProcessor) ShouldProcess(email models.Email) bool {
+	return email.Subject == p.subject
+}
+
+func TestFindLatest(t *testing.T) {
+	tests := []struct {
+		name        string
+		processor   models.EmailProcessor
+		folders     []config.FolderConfig
+		wantSubject string
+		wantErr     error
+	}{
+		{
+			name:        "Newest of several matches",
+			processor:   &mockNamedProcessor{sender: "example.org"},
+			wantSubject: "Code",
+		},
+		{
+			name:        "Older read email",
+			processor:   &subjectProcessor{mockNamedProcessor: mockNamedProcessor{sender: "example.org"}, subject: "A little message, just for you"},
+			wantSubject: "A little message, just for you",
+		},
+		{
+			name:      "No sender match",
+			processor: &mockNamedProcessor{sender: "other.org"},
+			wantErr:   ErrNoMatchingEmail,
+		},
+		{
+			name:        "Unreadable folder skipped",
+			processor:   &mockNamedProcessor{sender: "example.org"},
+			folders:     []config.FolderConfig{{Name: "Missing"}, {Name: "INBOX"}},
+			wantSubject: "Code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, be := startIMAPServer(t, true, false)
+			addUnreadMessage(t, be)
+			cfg.Folders = tt.folders
+			c := NewIMAPClient(cfg, zap.NewNop())
+
+			email, folder, err := c.FindLatest(tt.processor, 10)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FindLatest() error = %v, expected %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if email.Subject != tt.wantSubject || folder != "INBOX" {
+				t.Errorf("FindLatest() = %q in %s, expected %q in INBOX", email.Subject, folder, tt.wantSubject)
+			}
+
+			// The mailbox was only examined: the new email is still unread
+			c.SetDryRun(true)
+			c.SetDispatcher(&fakeDispatcher{})
+			if found, _, _ := c.CheckOnce(context.Background()); found != 1 {
+				t.Errorf("CheckOnce() found %d unread emails after FindLatest(), expected 1", found)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package email
+
+import (
+	"sync"
+
+	"github.com/emersion/go-imap/client"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/metrics"
+	"automation-hub/internal/models"
+	"automation-hub/internal/services/processor"
+)
+
+// countAttempts counts a failed cycle for every email of the batch a processor
+// matched but did not process successfully, and gives up on those that reached
+// email.max_attempts. Emails no processor handles are not failures, and those
+// processed successfully start over. Without max_attempts, or in dry run, failed
+// emails are simply retried on every cycle.
+func (c *IMAPClient) countAttempts(imapClient *client.Client, f *folder, batch []models.Email, succeeded *sync.Map, processors []models.EmailProcessor) {
+	if f == nil || c.config.MaxAttempts <= 0 || c.dryRun.Load() {
+		return
+	}
+	if f.attempts == nil {
+		f.attempts = make(map[uint32]int)
+	}
+
+	for _, email := range batch {
+		if email.UID == 0 {
+			continue
+		}
+		if _, ok := succeeded.Load(email.UID); ok {
+			delete(f.attempts, email.UID)
+			continue
+		}
+		matched := processor.Match(email, processors)
+		if matched == nil {
+			continue
+		}
+
+		f.attempts[email.UID]++
+		attempts := f.attempts[email.UID]
+		if attempts < c.config.MaxAttempts {
+			c.logger.Warn("Email processing failed, retrying next cycle",
+				zap.String("folder", f.name),
+				zap.Uint32("uid", email.UID),
+				zap.Int("attempt", attempts),
+				zap.Int("max_attempts", c.config.MaxAttempts))
+			continue
+		}
+		c.giveUp(imapClient, f, matched, email, attempts)
+	}
+}
+
+// giveUp records the email in the dead letter sink and marks it as read so it
+// is no longer searched for. Its attempts are kept, so it is skipped and marked
+// again if marking fails.
+func (c *IMAPClient) giveUp(imapClient *client.Client, f *folder, matched models.EmailProcessor, email models.Email, attempts int) {
+	name := processorName(matched)
+	metrics.EmailsDeadLettered.WithLabelValues(c.account, name).Inc()
+	c.logger.Error("Giving up on email after repeated failures",
+		zap.String("folder", f.name),
+		zap.Uint32("uid", email.UID),
+		zap.String("processor", name),
+		zap.String("from", email.From),
+		zap.String("subject", email.Subject),
+		zap.Int("attempts", attempts))
+
+	if c.deadLetter != nil {
+		c.deadLetter.Info("email dead-lettered",
+			zap.String("folder", f.name),
+			zap.Uint32("uid", email.UID),
+			zap.String("message_id", email.ID),
+			zap.String("processor", name),
+			zap.String("from", email.From),
+			zap.String("subject", email.Subject),
+			zap.Time("date", email.Date),
+			zap.Int("attempts", attempts))
+	}
+	c.markAsRead(imapClient, email.UID)
+}
+
+// deadLettered reports whether the email was already given up on in f
+func (c *IMAPClient) deadLettered(f *folder, email models.Email) bool {
+	if f == nil || c.config.MaxAttempts <= 0 || email.UID == 0 {
+		return false
+	}
+	return f.attempts[email.UID] >= c.config.MaxAttempts
+}
+
+func processorName(p models.EmailProcessor) string {
+	if named, ok := p.(interface{ GetName() string }); ok {
+		return named.GetName()
+	}
+	return p.GetSender()
+}
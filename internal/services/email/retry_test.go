@@ -0,0 +1,82 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// failingProcessor fails every email until fail is cleared
+type failingProcessor struct {
+	mockNamedProcessor
+	fail bool
+}
+
+func (p *failingProcessor) Process(ctx context.Context, email models.Email) error {
+	p.processed++
+	if p.fail {
+		return errors.New("telegram unavailable")
+	}
+	return nil
+}
+
+func TestDispatchDeadLetter(t *testing.T) {
+	email := models.Email{ID: "otp-1", UID: 42, From: "noreply@github.com", Subject: "Your code"}
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		dryRun       bool
+		cycles       int // cycles the email is found unread in
+		failures     int // cycles that fail before the processor recovers
+		expected     int // Process() calls
+		deadLettered int
+	}{
+		{"Given up after max attempts", 3, false, 5, 5, 3, 1},
+		{"Unlimited retries", 0, false, 5, 5, 5, 0},
+		{"Dry run retries", 3, true, 5, 5, 5, 0},
+		{"Success resets the attempts", 3, false, 3, 2, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewIMAPClient(config.EmailConfig{MaxAttempts: tt.maxAttempts}, zap.NewNop())
+			client.SetDryRun(tt.dryRun)
+			core, logs := observer.New(zapcore.InfoLevel)
+			client.SetDeadLetter(zap.New(core))
+
+			proc := &failingProcessor{mockNamedProcessor: mockNamedProcessor{name: "github"}}
+			dispatcher := &fakeDispatcher{processors: []models.EmailProcessor{proc}}
+			f := client.folders[0]
+
+			for cycle := 1; cycle <= tt.cycles; cycle++ {
+				proc.fail = cycle <= tt.failures
+				client.dispatch(context.Background(), nil, f, []models.Email{email}, dispatcher)
+			}
+
+			if proc.processed != tt.expected {
+				t.Errorf("Process() called %d times, expected %d", proc.processed, tt.expected)
+			}
+			entries := logs.FilterMessage("email dead-lettered").All()
+			if len(entries) != tt.deadLettered {
+				t.Fatalf("Dead letter has %d entries, expected %d", len(entries), tt.deadLettered)
+			}
+			if tt.deadLettered > 0 {
+				fields := entries[0].ContextMap()
+				if fields["uid"] != uint32(42) || fields["processor"] != "github" || fields["attempts"] != int64(3) {
+					t.Errorf("Dead letter entry = %v, expected uid, processor and attempts", fields)
+				}
+			}
+			if tt.failures < tt.cycles && len(f.attempts) != 0 {
+				t.Errorf("Attempts = %v, expected none after a success", f.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// senderAllowed applies email.blocked_senders and email.allowed_senders before
+// any processor sees the email. Blocked entries win; an empty allow list lets
+// every sender that is not blocked through.
+func (c *IMAPClient) senderAllowed(from string) bool {
+	if matchesSenderList(from, c.config.BlockedSenders) {
+		c.logger.Debug("Skipping email from blocked sender", zap.String("from", from))
+		return false
+	}
+	if len(c.config.AllowedSenders) > 0 && !matchesSenderList(from, c.config.AllowedSenders) {
+		c.logger.Debug("Skipping email from sender not in allowed_senders", zap.String("from", from))
+		return false
+	}
+	return true
+}
+
+// matchesSenderList compares the address against entries that are either a
+// full address or a domain (with or without a leading @), case-insensitively.
+// Domains match exactly, so evil-example.com does not match example.com.
+func matchesSenderList(from string, entries []string) bool {
+	from = strings.ToLower(strings.TrimSpace(from))
+	_, domain, _ := strings.Cut(from, "@")
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(strings.TrimPrefix(entry, "@"), "@") {
+			if from == entry {
+				return true
+			}
+			continue
+		}
+		if domain != "" && domain == strings.TrimPrefix(entry, "@") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package email
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+func TestSenderAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		blocked  []string
+		from     string
+		expected bool
+	}{
+		{"No lists", nil, nil, "anyone@example.com", true},
+		{"Allowed address", []string{"noreply@cloudflare.com"}, nil, "NoReply@Cloudflare.com", true},
+		{"Allowed domain", []string{"perplexity.ai"}, nil, "team@perplexity.ai", true},
+		{"Allowed domain with @", []string{"@perplexity.ai"}, nil, "team@perplexity.ai", true},
+		{"Lookalike domain", []string{"cloudflare.com"}, nil, "notify@evil-cloudflare.com", false},
+		{"Unknown sender", []string{"cloudflare.com"}, nil, "spam@example.com", false},
+		{"Blocked domain", nil, []string{"spam.example"}, "offers@spam.example", false},
+		{"Blocked wins over allowed", []string{"cloudflare.com"}, []string{"phish@cloudflare.com"}, "phish@cloudflare.com", false},
+		{"Missing sender", []string{"cloudflare.com"}, nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewIMAPClient(config.EmailConfig{AllowedSenders: tt.allowed, BlockedSenders: tt.blocked}, zap.NewNop())
+			if got := client.senderAllowed(tt.from); got != tt.expected {
+				t.Errorf("senderAllowed(%q) = %v, expected %v", tt.from, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package gotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/httpretry"
+)
+
+// Message is a Gotify push notification. Without a priority the server uses
+// the application's default one.
+type Message struct {
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
+// Client pushes messages to a Gotify server as the application owning the token
+type Client struct {
+	retry  *httpretry.Client
+	logger *zap.Logger
+	url    string
+	token  string
+	dryRun atomic.Bool
+}
+
+func NewClient(cfg config.GotifyConfig, logger *zap.Logger) *Client {
+	return &Client{
+		retry:  httpretry.New(logger, nil),
+		logger: logger,
+		url:    strings.TrimRight(cfg.URL, "/") + "/message",
+		token:  string(cfg.Token),
+	}
+}
+
+// SetDryRun makes the client log messages instead of pushing them
+func (c *Client) SetDryRun(enabled bool) {
+	c.dryRun.Store(enabled)
+}
+
+// SendMessageContext pushes a message with the given title and the
+// application's default priority
+func (c *Client) SendMessageContext(ctx context.Context, title, message string) error {
+	return c.SendPushContext(ctx, Message{Title: title, Message: message})
+}
+
+// Escape returns text unchanged: Gotify shows messages as plain text
+func (c *Client) Escape(text string) string {
+	return text
+}
+
+// SendPushContext pushes a message, retrying network errors, 429 and 5xx
+// responses with exponential backoff. Other 4xx responses, such as an invalid
+// token, are not retried.
+func (c *Client) SendPushContext(ctx context.Context, msg Message) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.dryRun.Load() {
+		c.logger.Info("Dry run: Gotify message not sent",
+			zap.String("title", msg.Title),
+			zap.String("message", msg.Message))
+		return nil
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode Gotify message: %w", err)
+	}
+
+	// The X-Gotify-Key header keeps the token out of the URL and so out of error messages
+	attempt, _, err := c.retry.Send(ctx, "Gotify message",
+		httpretry.Request{URL: c.url, Headers: map[string]string{"X-Gotify-Key": c.token}, Payload: payload},
+		zap.String("title", msg.Title))
+	if err != nil {
+		return err
+	}
+	c.logger.Info("Gotify message sent successfully",
+		zap.String("title", msg.Title),
+		zap.Int("attempt", attempt))
+	return nil
+}
@@ -0,0 +1,96 @@
+package gotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+// received is one request seen by the fake Gotify server
+type received struct {
+	path  string
+	token string
+	body  map[string]any
+}
+
+// newTestClient returns a Client whose server answers with status, and the
+// requests it received. Retries are left to httpretry.
+func newTestClient(t *testing.T, status int) (*Client, *[]received) {
+	t.Helper()
+
+	var requests []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := received{path: r.URL.Path, token: r.Header.Get("X-Gotify-Key")}
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			t.Errorf("Invalid JSON payload: %v", err)
+		}
+		requests = append(requests, req)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(config.GotifyConfig{URL: srv.URL + "/", Token: "AbCdEf"}, zap.NewNop())
+	return client, &requests
+}
+
+func TestSendPushContext(t *testing.T) {
+	client, requests := newTestClient(t, http.StatusOK)
+
+	priority := 8
+	if err := client.SendPushContext(context.Background(), Message{Title: "cloudflare", Message: "Code: 123456", Priority: &priority}); err != nil {
+		t.Fatalf("SendPushContext() returned unexpected error: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("Expected 1 post, got %d", len(*requests))
+	}
+	got := (*requests)[0]
+	if got.path != "/message" || got.token != "AbCdEf" {
+		t.Errorf("Posted to %s with token %q, expected /message with the app token", got.path, got.token)
+	}
+	if got.body["title"] != "cloudflare" || got.body["message"] != "Code: 123456" || got.body["priority"] != float64(8) {
+		t.Errorf("Payload = %v, expected title, message and priority 8", got.body)
+	}
+}
+
+func TestSendPushContextInvalidToken(t *testing.T) {
+	// An invalid token is permanent, so it is sent once
+	client, requests := newTestClient(t, http.StatusUnauthorized)
+
+	err := client.SendPushContext(context.Background(), Message{Message: "Code: 123456"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("SendPushContext() = %v, expected the HTTP 401 error", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("Expected 1 post, got %d", len(*requests))
+	}
+}
+
+func TestSendMessageContext(t *testing.T) {
+	client, requests := newTestClient(t, http.StatusOK)
+
+	client.SetDryRun(true)
+	if err := client.SendMessageContext(context.Background(), "acme", "Not found"); err != nil {
+		t.Errorf("SendMessageContext() in dry run = %v, expected nil", err)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Expected no posts in dry run, got %d", len(*requests))
+	}
+
+	client.SetDryRun(false)
+	if err := client.SendMessageContext(context.Background(), "acme", "Not found"); err != nil {
+		t.Fatalf("SendMessageContext() returned unexpected error: %v", err)
+	}
+	// Without a priority the field is left out so the application's default applies
+	if got := (*requests)[0]; got.body["message"] != "Not found" || got.body["title"] != "acme" {
+		t.Errorf("Payload = %v, expected title and message", got.body)
+	} else if _, ok := got.body["priority"]; ok {
+		t.Errorf("Payload = %v, expected no priority", got.body)
+	}
+}
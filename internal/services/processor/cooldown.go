@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"sync"
+	"time"
+)
+
+// cooldown suppresses a service's sends for cooldown_seconds after each one,
+// so a provider resending the same code doesn't flood the chat. A nil
+// cooldown never suppresses.
+type cooldown struct {
+	period time.Duration
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// newCooldown returns nil when seconds is not positive
+func newCooldown(seconds int) *cooldown {
+	if seconds <= 0 {
+		return nil
+	}
+	return &cooldown{period: time.Duration(seconds) * time.Second}
+}
+
+// start begins a cooldown at now, reporting false when one is still running
+func (c *cooldown) start(now time.Time) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Before(c.until) {
+		return false
+	}
+	c.until = now.Add(c.period)
+	return true
+}
+
+// cancel ends the cooldown started for a send that failed, so the next email
+// is sent instead of suppressed
+func (c *cooldown) cancel() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until = time.Time{}
+}
+
+// remaining is how long the cooldown still runs at now
+func (c *cooldown) remaining(now time.Time) time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return max(c.until.Sub(now), 0)
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// defaultFallbackMessage is sent for unmatched emails without a
+// fallback.telegram_message
+const defaultFallbackMessage = "📨 Unmatched email\nFrom: {{.From}}\nSubject: {{.Subject}}"
+
+// fallback forwards the sender and subject of emails no service matched to
+// email.fallback, to spot new services worth automating. Unmatched emails are
+// never marked as read; the IMAP client remembers which ones it forwarded.
+type fallback struct {
+	chatID   string
+	message  *template.Template
+	notifier Notifier
+	logger   *zap.Logger
+	clock    clock.Clock
+}
+
+func newFallback(cfg config.FallbackConfig, notifier Notifier, logger *zap.Logger) (*fallback, error) {
+	message := cfg.TelegramMessage
+	if message == "" {
+		message = defaultFallbackMessage
+	}
+	tmpl, err := template.New("fallback").Funcs(messageFuncs).Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("email.fallback: invalid telegram_message template: %w", err)
+	}
+	return &fallback{
+		chatID:   cfg.TelegramChatID,
+		message:  tmpl,
+		notifier: notifier,
+		logger:   logger,
+		clock:    clock.Real,
+	}, nil
+}
+
+// Forward sends the email's sender and subject to the fallback chat
+func (f *fallback) Forward(ctx context.Context, email models.Email) error {
+	data := codeMessage{
+		From:    f.notifier.Escape(email.From),
+		Subject: f.notifier.Escape(email.Subject),
+		Now:     f.clock.Now(),
+	}
+	var sb strings.Builder
+	if err := f.message.Execute(&sb, data); err != nil {
+		return fmt.Errorf("failed to render fallback.telegram_message: %w", err)
+	}
+	if err := f.notifier.SendMessageContext(ctx, f.chatID, sb.String()); err != nil {
+		return err
+	}
+
+	f.logger.Info("Forwarded unmatched email to the fallback chat",
+		zap.String("from", email.From),
+		zap.String("subject", email.Subject))
+	return nil
+}
@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+func TestManagerFallback(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	cfg := config.EmailConfig{
+		Fallback: config.FallbackConfig{TelegramChatID: "999"},
+		Services: []config.ServiceConfig{{
+			Name: "cloudflare",
+			Config: config.ServiceProcessorConfig{
+				EmailFrom:       []string{"cloudflare.com"},
+				EmailSubject:    []string{"Verification"},
+				TelegramChatID:  "123",
+				TelegramMessage: "Code: %s",
+			},
+		}},
+	}
+	mgr, err := NewProcessorManager(cfg, Notifiers{Telegram: client}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	// Unmatched emails are left to ForwardUnmatched, which the IMAP client
+	// calls once per email
+	unmatched := models.Email{ID: "<news-1@example.com>", From: "news@example.com", Subject: "Weekly digest"}
+	var processed int
+	mgr.ProcessEmailsConcurrently(context.Background(), []models.Email{unmatched}, func(models.EmailProcessor, models.Email) { processed++ })
+	if len(sender.sent) != 0 || processed != 0 {
+		t.Fatalf("Sent %d messages and processed %d emails, expected the unmatched email left alone", len(sender.sent), processed)
+	}
+
+	if err := mgr.ForwardUnmatched(context.Background(), unmatched); err != nil {
+		t.Fatalf("ForwardUnmatched() returned unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("Sent %d messages, expected the unmatched email forwarded", len(sender.sent))
+	}
+	msg := sender.sent[0]
+	if msg.ChatID != 999 || !strings.Contains(msg.Text, "news@example.com") || !strings.Contains(msg.Text, "Weekly digest") {
+		t.Errorf("Sent %q to %d, expected the sender and subject in chat 999", msg.Text, msg.ChatID)
+	}
+
+	// Without a fallback nothing is forwarded
+	cfg.Fallback = config.FallbackConfig{}
+	mgr, err = NewProcessorManager(cfg, Notifiers{Telegram: client}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+	if err := mgr.ForwardUnmatched(context.Background(), unmatched); err != nil || len(sender.sent) != 1 {
+		t.Errorf("ForwardUnmatched() without a fallback = %v and %d messages, expected nothing sent", err, len(sender.sent))
+	}
+}
+
+func TestNewFallbackTemplate(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	f, err := newFallback(config.FallbackConfig{
+		TelegramChatID:  "999",
+		TelegramMessage: "{{.From}}: {{.Subject | upper}}",
+	}, client, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newFallback() returned unexpected error: %v", err)
+	}
+	if err := f.Forward(context.Background(), models.Email{From: "a@example.com", Subject: "hello"}); err != nil {
+		t.Fatalf("Forward() returned unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].Text != "a@example.com: HELLO" {
+		t.Errorf("Sent %v, expected the rendered template", sender.sent)
+	}
+
+	if _, err := newFallback(config.FallbackConfig{TelegramChatID: "999", TelegramMessage: "{{.From"}, client, zap.NewNop()); err == nil {
+		t.Error("newFallback() with an invalid template = nil, expected error")
+	}
+}
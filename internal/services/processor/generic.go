@@ -1,16 +1,24 @@
 package processor
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"mime/quotedprintable"
+	"path"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/emersion/go-imap"
 	"go.uber.org/zap"
 
+	"automation-hub/internal/clock"
 	"automation-hub/internal/config"
+	"automation-hub/internal/logging"
 	"automation-hub/internal/models"
+	"automation-hub/internal/services/gotify"
 	"automation-hub/internal/services/telegram"
 )
 
@@ -19,24 +27,35 @@ const NotFoundCode = "Not found"
 type GenericEmailProcessor struct {
 	name            string
 	config          config.ServiceProcessorConfig
-	telegram        *telegram.Client
+	notifier        Notifier
 	logger          *zap.Logger
 	codePattern     *regexp.Regexp
 	defaultPatterns map[string]*regexp.Regexp
+	codeMarkers     []string
+	markerPatterns  []*regexp.Regexp   // codeMarkers, case-insensitive
+	subjectPatterns []*regexp.Regexp   // set when subject_match is regex
+	bodyPattern     *regexp.Regexp     // set when body_regex is configured
+	message         *template.Template // nil for the %s Sprintf format
+	messageErr      error              // invalid telegram_message template
+	cooldown        *cooldown          // nil without cooldown_seconds
+	clock           clock.Clock
 }
 
-func NewGenericEmailProcessor(name string, serviceConfig config.ServiceProcessorConfig, telegram *telegram.Client, logger *zap.Logger) *GenericEmailProcessor {
+func NewGenericEmailProcessor(name string, serviceConfig config.ServiceProcessorConfig, notifier Notifier, logger *zap.Logger) *GenericEmailProcessor {
+	return NewGenericEmailProcessorWithDefaults(name, serviceConfig, nil, notifier, logger)
+}
+
+// NewGenericEmailProcessorWithDefaults also takes email.default_patterns, merged
+// over the built-in patterns and looked up by service name when there is no code_pattern
+func NewGenericEmailProcessorWithDefaults(name string, serviceConfig config.ServiceProcessorConfig, defaultPatterns map[string]string, notifier Notifier, logger *zap.Logger) *GenericEmailProcessor {
 	processor := &GenericEmailProcessor{
-		name:     name,
-		config:   serviceConfig,
-		telegram: telegram,
-		logger:   logger,
-		defaultPatterns: map[string]*regexp.Regexp{
-			"cloudflare": regexp.MustCompile(`\b\d{6}\b`),
-			// Perplexity pattern is now more flexible - handles both numeric and alphanumeric formats
-			"perplexity": regexp.MustCompile(`(?:\d{5,6}|[a-zA-Z0-9]+-[a-zA-Z0-9]+)`),
-			"default":    regexp.MustCompile(`\b[a-zA-Z0-9]{4,8}\b`), // generic pattern
-		},
+		name:            name,
+		config:          serviceConfig,
+		notifier:        notifier,
+		logger:          logger,
+		defaultPatterns: mergeDefaultPatterns(defaultPatterns, logger),
+		cooldown:        newCooldown(serviceConfig.CooldownSeconds),
+		clock:           clock.Real,
 	}
 
 	// If there is a custom pattern, use it
@@ -60,18 +79,140 @@ func NewGenericEmailProcessor(name string, serviceConfig config.ServiceProcessor
 		}
 	}
 
+	// Subjects are compiled once; invalid ones are rejected by config validation
+	if serviceConfig.SubjectMatch == config.SubjectMatchRegex {
+		processor.subjectPatterns = make([]*regexp.Regexp, 0, len(serviceConfig.EmailSubject))
+		for _, subject := range serviceConfig.EmailSubject {
+			if serviceConfig.CaseInsensitive {
+				subject = "(?i)" + subject
+			}
+			pattern, err := regexp.Compile(subject)
+			if err != nil {
+				logger.Warn("Invalid subject pattern, ignoring it",
+					zap.String("service", name),
+					zap.String("pattern", subject),
+					zap.Error(err))
+				continue
+			}
+			processor.subjectPatterns = append(processor.subjectPatterns, pattern)
+		}
+	}
+
+	// Invalid body regexes are rejected by config validation
+	if serviceConfig.BodyRegex != "" {
+		if pattern, err := regexp.Compile(serviceConfig.BodyRegex); err == nil {
+			processor.bodyPattern = pattern
+		} else {
+			logger.Warn("Invalid body pattern, ignoring it",
+				zap.String("service", name),
+				zap.String("pattern", serviceConfig.BodyRegex),
+				zap.Error(err))
+		}
+	}
+
+	// The factory rejects the service when the template doesn't parse
+	processor.message, processor.messageErr = parseCodeMessage(name, serviceConfig.TelegramMessage)
+	if processor.messageErr != nil {
+		logger.Error("Invalid telegram_message template",
+			zap.String("service", name),
+			zap.Error(processor.messageErr))
+	}
+
+	// The code is searched only after one of the markers, if any
+	processor.codeMarkers = serviceConfig.CodeMarker
+	processor.markerPatterns = compileMarkers(serviceConfig.CodeMarker)
+
 	return processor
 }
 
+// mergeDefaultPatterns compiles the configured default patterns over the built-in
+// ones. Invalid entries are skipped with a warning, so lookups fall back as if unset.
+func mergeDefaultPatterns(configured map[string]string, logger *zap.Logger) map[string]*regexp.Regexp {
+	patterns := map[string]*regexp.Regexp{
+		"cloudflare": regexp.MustCompile(`\b\d{6}\b`),
+		// Perplexity pattern is now more flexible - handles both numeric and alphanumeric formats
+		"perplexity": regexp.MustCompile(`(?:\d{5,6}|[a-zA-Z0-9]+-[a-zA-Z0-9]+)`),
+		"default":    regexp.MustCompile(`\b[a-zA-Z0-9]{4,8}\b`), // generic pattern
+	}
+
+	for name, expr := range configured {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			logger.Warn("Invalid default code pattern, ignoring it",
+				zap.String("service", name),
+				zap.String("pattern", expr),
+				zap.Error(err))
+			continue
+		}
+		patterns[strings.ToLower(name)] = pattern
+	}
+	return patterns
+}
+
+// Describe reports the effective matching config, including the code pattern
+// actually used and whether it is the service's custom one or a default
+func (p *GenericEmailProcessor) Describe() Info {
+	info := Info{
+		Name:              p.name,
+		EmailFrom:         p.config.EmailFrom,
+		FromMatch:         cmp.Or(p.config.FromMatch, config.FromMatchContains),
+		EmailSubject:      p.config.EmailSubject,
+		SubjectMatch:      cmp.Or(p.config.SubjectMatch, config.SubjectMatchContains),
+		CaseInsensitive:   p.config.CaseInsensitive,
+		BodyContains:      p.config.BodyContains,
+		BodyRegex:         p.config.BodyRegex,
+		CodePatternSource: "default",
+		CodeMarkers:       p.codeMarkers,
+		Notifier:          cmp.Or(p.config.Notifier, config.NotifierTelegram),
+	}
+	if p.codePattern != nil {
+		info.CodePattern = p.codePattern.String()
+		// An invalid code_pattern falls back to the default with a warning
+		if p.config.CodePattern != "" && info.CodePattern == p.config.CodePattern {
+			info.CodePatternSource = "custom"
+		}
+	}
+	return info
+}
+
 func (p *GenericEmailProcessor) ShouldProcess(email models.Email) bool {
-	// Check the sender
-	if !strings.Contains(email.From, p.config.EmailFrom) {
+	// Check the sender, at least one of the subjects, then the body filters if any
+	return p.MatchesHeaders(email) && p.matchesBody(email)
+}
+
+// TextSection is the fetch item of the text body the IMAP client parses
+const TextSection imap.FetchItem = "BODY.PEEK[TEXT]"
+
+// RequiredFetchItems is what the IMAP client must fetch for ShouldProcess and
+// Process: the headers, the text body the code is extracted from, and the body
+// structure its charset and attachments are read from
+func (p *GenericEmailProcessor) RequiredFetchItems() []imap.FetchItem {
+	return []imap.FetchItem{
+		imap.FetchEnvelope,
+		imap.FetchBodyStructure,
+		TextSection,
+		imap.FetchUid,
+	}
+}
+
+// MatchesHeaders checks the sender and subject only, so the IMAP client can
+// skip downloading the body of emails ShouldProcess would reject anyway
+func (p *GenericEmailProcessor) MatchesHeaders(email models.Email) bool {
+	return p.matchesSender(email.From) && p.matchesSubject(email.Subject)
+}
+
+func (p *GenericEmailProcessor) matchesSubject(subject string) bool {
+	if p.subjectPatterns != nil {
+		for _, pattern := range p.subjectPatterns {
+			if pattern.MatchString(subject) {
+				return true
+			}
+		}
 		return false
 	}
 
-	// Check at least one of the subjects
-	for _, subject := range p.config.EmailSubject {
-		if strings.Contains(email.Subject, subject) {
+	for _, expected := range p.config.EmailSubject {
+		if p.contains(subject, expected) {
 			return true
 		}
 	}
@@ -79,32 +220,341 @@ func (p *GenericEmailProcessor) ShouldProcess(email models.Email) bool {
 	return false
 }
 
-func (p *GenericEmailProcessor) Process(email models.Email) error {
-	// Decode quoted-printable content if necessary
-	decodedText := p.decodeQuotedPrintable(email.TextPlain)
+// matchesBody requires one of body_contains (case-insensitive) and body_regex
+// to match the decoded body; services without body filters match any body
+func (p *GenericEmailProcessor) matchesBody(email models.Email) bool {
+	if len(p.config.BodyContains) == 0 && p.bodyPattern == nil {
+		return true
+	}
+
+	body := decodeBody(email)
+	if p.bodyPattern != nil && !p.bodyPattern.MatchString(body) {
+		return false
+	}
+	if len(p.config.BodyContains) == 0 {
+		return true
+	}
+
+	lower := strings.ToLower(body)
+	for _, phrase := range p.config.BodyContains {
+		if strings.Contains(lower, strings.ToLower(phrase)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract returns the decoded email text and the code found in a QR attachment
+// or in the text, NotFoundCode if none, without sending anything
+func (p *GenericEmailProcessor) Extract(email models.Email) (decodedText, code string) {
+	// Decode quoted-printable content if the email declares it
+	decodedText = decodeBody(email)
 
 	// Log the decoded content for debugging
 	p.logger.Debug("Processing email content",
 		zap.String("service", p.name),
 		zap.String("from", email.From),
 		zap.String("subject", email.Subject),
-		zap.String("decoded_text", decodedText))
+		logging.Text("decoded_text", decodedText, 500))
 
 	// Extract the code using the configured pattern
-	code := p.extractCode(decodedText)
+	code = p.qrCode(email)
+	if code == "" {
+		code = p.extractCode(decodedText)
+	}
+	return decodedText, code
+}
+
+// Process sends the extracted code and matching attachments through the notifier. ctx
+// bounds the sends, so a shutdown cancels them in flight.
+func (p *GenericEmailProcessor) Process(ctx context.Context, email models.Email) error {
+	_, err := p.ProcessWithResult(ctx, email)
+	return err
+}
+
+// Reasons a matched email is left unsent, see models.ProcessingResult.Skipped
+const (
+	SkippedStale    = "stale"    // older than max_age_minutes
+	SkippedCooldown = "cooldown" // within the service's cooldown_seconds
+	SkippedNoCode   = "no_code"  // no code found and notify_on_failure is off
+)
+
+// ProcessWithResult is Process, also returning the extracted code and whether
+// anything was sent. The result is filled in even when sending fails; stale
+// emails and emails arriving during the service's cooldown are skipped with no
+// code.
+func (p *GenericEmailProcessor) ProcessWithResult(ctx context.Context, email models.Email) (models.ProcessingResult, error) {
+	result := models.ProcessingResult{Service: p.name, Matched: true}
+	if p.isStale(email) {
+		p.logger.Info("Skipping email older than max_age_minutes, its code has likely expired",
+			zap.String("service", p.name),
+			zap.String("subject", email.Subject),
+			zap.Time("date", email.Date),
+			zap.Int("max_age_minutes", p.config.MaxAgeMinutes))
+		result.Skipped = SkippedStale
+		return result, nil
+	}
+
+	_, code := p.Extract(email)
+	// Only emails that send something start or are held by the cooldown
+	cooling := p.cooldown != nil && p.sendsSomething(email, code)
+	if now := p.clock.Now(); cooling && !p.cooldown.start(now) {
+		p.logger.Info("Skipping email during the service's cooldown_seconds",
+			zap.String("service", p.name),
+			zap.String("subject", email.Subject),
+			zap.Duration("remaining", p.cooldown.remaining(now)))
+		result.Skipped = SkippedCooldown
+		return result, nil
+	}
+	if code != NotFoundCode {
+		result.Code = code
+	}
+	sent, err := p.send(ctx, email, code)
+	result.Sent = sent
+	if err != nil {
+		if cooling {
+			p.cooldown.cancel()
+		}
+		return result, err
+	}
+	if !sent {
+		result.Skipped = SkippedNoCode
+	}
+	return result, nil
+}
+
+// sendsSomething reports whether send would send a message or attachment
+func (p *GenericEmailProcessor) sendsSomething(email models.Email, code string) bool {
+	return code != NotFoundCode || p.config.NotifyOnFailure || len(p.matchingAttachments(email.Attachments)) > 0
+}
 
-	// Format the message
-	message := fmt.Sprintf(p.config.TelegramMessage, code)
+// send forwards the code, or the failure message, and the matching attachments.
+// It reports whether a notifier accepted any of them.
+func (p *GenericEmailProcessor) send(ctx context.Context, email models.Email, code string) (bool, error) {
+	attachments := p.matchingAttachments(email.Attachments)
+	if code == NotFoundCode && !p.config.NotifyOnFailure {
+		if len(attachments) == 0 {
+			p.logger.Warn("No code extracted, skipping Telegram message (set notify_on_failure to send it)",
+				zap.String("service", p.name),
+				zap.String("subject", email.Subject))
+			return false, nil
+		}
+		return p.forwardAttachments(ctx, email.Subject, attachments)
+	}
+
+	// Notifiers taking structured data get the code as is, "" when not found
+	if sender, ok := p.notifier.(codeSender); ok {
+		notification := models.CodeNotification{Service: p.name, Code: code, Subject: email.Subject, From: email.From}
+		if code == NotFoundCode {
+			notification.Code = ""
+		}
+		if err := sender.SendCodeContext(ctx, notifyTarget(p.config), notification); err != nil {
+			return false, err
+		}
+		_, err := p.forwardAttachments(ctx, email.Subject, attachments)
+		return true, err
+	}
+
+	message, err := p.renderMessage(email, code)
+	if err != nil {
+		return false, err
+	}
 
 	// Send message to Telegram
-	return p.telegram.SendMessage(p.config.TelegramChatID, message)
+	if err := p.sendMessage(ctx, message, code); err != nil {
+		return false, err
+	}
+	_, err = p.forwardAttachments(ctx, email.Subject, attachments)
+	return true, err
+}
+
+// sendMessage sends the rendered message, with the Telegram send options and
+// copy button or the Gotify title and priority when the notifier supports them
+func (p *GenericEmailProcessor) sendMessage(ctx context.Context, message, code string) error {
+	if sender, ok := p.notifier.(pushSender); ok {
+		return sender.SendPushContext(ctx, gotify.Message{Title: p.name, Message: message, Priority: p.config.GotifyPriority})
+	}
+	sender, ok := p.notifier.(requestSender)
+	if !ok {
+		return p.notifier.SendMessageContext(ctx, notifyTarget(p.config), message)
+	}
+	req := telegram.SendRequest{
+		ChatID:              notifyTarget(p.config),
+		Text:                message,
+		DisableNotification: p.config.DisableNotification,
+		ReplyToMessageID:    p.config.ReplyToMessageID,
+	}
+	if p.config.InlineCopyButton && code != NotFoundCode {
+		req.CopyText = code
+	}
+	_, err := sender.Send(ctx, req)
+	return err
+}
+
+// isStale reports whether the email's Date header is older than max_age_minutes.
+// Emails without a Date header are never stale.
+func (p *GenericEmailProcessor) isStale(email models.Email) bool {
+	if p.config.MaxAgeMinutes <= 0 || email.Date.IsZero() {
+		return false
+	}
+	return p.clock.Now().Sub(email.Date) > time.Duration(p.config.MaxAgeMinutes)*time.Minute
+}
+
+// renderMessage formats telegram_message, escaping the values for the configured
+// parse mode
+func (p *GenericEmailProcessor) renderMessage(email models.Email, code string) (string, error) {
+	if p.messageErr != nil {
+		return "", p.messageErr
+	}
+	if p.message == nil {
+		return fmt.Sprintf(p.config.TelegramMessage, p.notifier.Escape(code)), nil
+	}
+
+	data := codeMessage{
+		Service: p.notifier.Escape(p.name),
+		Code:    p.notifier.Escape(code),
+		From:    p.notifier.Escape(email.From),
+		Subject: p.notifier.Escape(email.Subject),
+		Now:     p.clock.Now(),
+	}
+	var sb strings.Builder
+	if err := p.message.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render telegram_message for %s: %w", p.name, err)
+	}
+	return sb.String(), nil
+}
+
+// qrCode returns the otpauth:// URI or code of a QR image attachment when
+// decode_qr is set, or "" to fall back to text extraction
+func (p *GenericEmailProcessor) qrCode(email models.Email) string {
+	if !p.config.DecodeQR {
+		return ""
+	}
+
+	text, err := decodeQRAttachments(email.Attachments)
+	if err != nil {
+		p.logger.Info("No QR code decoded, falling back to text extraction",
+			zap.String("service", p.name),
+			zap.Error(err))
+		return ""
+	}
+
+	code, ok := codeFromQR(p.codePattern, text)
+	if !ok {
+		p.logger.Info("QR code has no otpauth URI or code, falling back to text extraction",
+			zap.String("service", p.name),
+			logging.Text("qr_text", text, 200))
+		return ""
+	}
+	p.logger.Info("Code extracted from QR code",
+		zap.String("service", p.name),
+		logging.Code("code", code))
+	return code
+}
+
+// matchingAttachments returns the attachments whose MIME type matches one of
+// the forward_attachments patterns (e.g. application/pdf or image/*)
+func (p *GenericEmailProcessor) matchingAttachments(attachments []models.Attachment) []models.Attachment {
+	var matched []models.Attachment
+	for _, attachment := range attachments {
+		for _, pattern := range p.config.ForwardAttachments {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(attachment.MIMEType)); ok {
+				matched = append(matched, attachment)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// forwardAttachments sends each attachment as a Telegram document captioned with
+// the email subject. Files over the Bot API limit are logged and skipped, and so
+// are all attachments on notifiers that cannot send files. It reports whether any
+// attachment was sent.
+func (p *GenericEmailProcessor) forwardAttachments(ctx context.Context, subject string, attachments []models.Attachment) (bool, error) {
+	if len(attachments) == 0 {
+		return false, nil
+	}
+	sender, ok := p.notifier.(documentSender)
+	if !ok {
+		p.logger.Warn("Notifier cannot forward attachments, skipping them",
+			zap.String("service", p.name),
+			zap.String("notifier", p.config.Notifier),
+			zap.Int("attachments", len(attachments)))
+		return false, nil
+	}
+
+	sent := false
+	var errs []error
+	for _, attachment := range attachments {
+		err := sender.SendDocumentContext(ctx, notifyTarget(p.config), attachment, p.notifier.Escape(subject))
+		if errors.Is(err, telegram.ErrAttachmentTooLarge) {
+			p.logger.Warn("Skipping oversized attachment",
+				zap.String("service", p.name),
+				zap.String("filename", attachment.Filename),
+				zap.Int("size", len(attachment.Data)))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("attachment %s: %w", attachment.Filename, err))
+			continue
+		}
+		sent = true
+	}
+	return sent, errors.Join(errs...)
 }
 
 func (p *GenericEmailProcessor) GetName() string {
 	return p.name
 }
 
+// matchesSender checks the sender against every email_from entry using from_match:
+// contains (substring, the default), exact (whole address) or domain (part after @)
+func (p *GenericEmailProcessor) matchesSender(from string) bool {
+	for _, sender := range p.config.EmailFrom {
+		switch p.config.FromMatch {
+		case config.FromMatchExact:
+			if strings.EqualFold(from, sender) {
+				return true
+			}
+		case config.FromMatchDomain:
+			if strings.EqualFold(senderDomain(from), strings.TrimPrefix(sender, "@")) {
+				return true
+			}
+		default:
+			if p.contains(from, sender) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contains is strings.Contains, ignoring case with case_insensitive
+func (p *GenericEmailProcessor) contains(s, substr string) bool {
+	if p.config.CaseInsensitive {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+	return strings.Contains(s, substr)
+}
+
+func senderDomain(address string) string {
+	if idx := strings.LastIndex(address, "@"); idx != -1 {
+		return address[idx+1:]
+	}
+	return ""
+}
+
+// GetSender returns the first configured sender
 func (p *GenericEmailProcessor) GetSender() string {
+	if len(p.config.EmailFrom) == 0 {
+		return ""
+	}
+	return p.config.EmailFrom[0]
+}
+
+// GetSenders returns every configured sender, used to narrow the IMAP search
+func (p *GenericEmailProcessor) GetSenders() []string {
 	return p.config.EmailFrom
 }
 
@@ -116,72 +566,63 @@ func (p *GenericEmailProcessor) extractCode(text string) string {
 		body = p.stripMIMEHeaders(text)
 	}
 
-	// For Perplexity, find the code after "directamente:"
-	if strings.ToLower(p.name) == "perplexity" {
-		return p.extractPerplexityCode(body)
+	if len(p.markerPatterns) > 0 {
+		after, ok := textAfterMarker(body, p.markerPatterns)
+		if !ok {
+			p.logger.Warn("Code marker not found in email",
+				zap.String("service", p.name),
+				zap.Strings("markers", p.codeMarkers))
+			return NotFoundCode
+		}
+		body = after
 	}
 
-	matches := p.codePattern.FindStringSubmatch(body)
-	if len(matches) > 0 {
+	if code, ok := matchCode(p.codePattern, body); ok {
 		p.logger.Info("Code extracted successfully",
 			zap.String("service", p.name),
-			zap.String("code", matches[0]))
-		return matches[0]
+			logging.Code("code", code))
+		return code
 	}
 	p.logger.Warn("Code not found in email",
 		zap.String("service", p.name),
 		zap.String("pattern", p.codePattern.String()),
-		zap.String("text_preview", truncateString(body, 200)))
+		logging.Text("text_preview", body, 200))
 	return NotFoundCode
 }
 
-func (p *GenericEmailProcessor) extractPerplexityCode(text string) string {
-	// Find the position after "directamente:" (Spanish) or "directly:" (English)
-	markers := []string{"directly:", "directamente:"}
-	var searchText string
-	var markerFound bool
-
-	lowerText := strings.ToLower(text)
-	for _, marker := range markers {
-		if idx := strings.Index(lowerText, marker); idx != -1 {
-			searchText = text[idx+len(marker):]
-			markerFound = true
-			p.logger.Debug("Perplexity marker found", zap.String("marker", marker))
-			break
-		}
-	}
-
-	if !markerFound {
-		p.logger.Warn("Neither 'directly:' nor 'directamente:' marker found in Perplexity email")
-		return NotFoundCode
+// matchCode returns the first capture group of the pattern when it has one and it
+// matched, so patterns like `code:\s*([0-9]{6})` can anchor on surrounding text.
+// Otherwise the whole match is returned. Non-capturing (?:...) groups don't count.
+func matchCode(pattern *regexp.Regexp, text string) (string, bool) {
+	matches := pattern.FindStringSubmatch(text)
+	if len(matches) == 0 {
+		return "", false
 	}
-
-	// Try multiple patterns in order of preference
-	// Pattern 1: Numeric only (5-6 digits) - e.g., 36144
-	numericPattern := regexp.MustCompile(`\b(\d{5,6})\b`)
-	if matches := numericPattern.FindStringSubmatch(searchText); len(matches) > 0 {
-		code := matches[1]
-		p.logger.Info("Perplexity code extracted (numeric format)", zap.String("code", code))
-		return code
+	if len(matches) > 1 && matches[1] != "" {
+		return matches[1], true
 	}
+	return matches[0], true
+}
 
-	// Pattern 2: Alphanumeric with hyphen - e.g., aw9s5-y1zoy
-	alphanumericPattern := regexp.MustCompile(`\b([a-zA-Z0-9]+-[a-zA-Z0-9]+)\b`)
-	if matches := alphanumericPattern.FindStringSubmatch(searchText); len(matches) > 0 {
-		code := matches[1]
-		p.logger.Info("Perplexity code extracted (alphanumeric format)", zap.String("code", code))
-		return code
+// compileMarkers turns code_marker phrases into case-insensitive literal
+// patterns. They match on the text itself, since lowercasing it may change its
+// byte length (e.g. İ or the Kelvin sign).
+func compileMarkers(markers []string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, 0, len(markers))
+	for _, marker := range markers {
+		patterns = append(patterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(marker)))
 	}
+	return patterns
+}
 
-	// Pattern 3: Fallback to the configured pattern
-	if matches := p.codePattern.FindStringSubmatch(searchText); len(matches) > 0 {
-		p.logger.Info("Perplexity code extracted (fallback pattern)", zap.String("code", matches[0]))
-		return matches[0]
+// textAfterMarker returns the text following the first marker found, tried in order
+func textAfterMarker(text string, markers []*regexp.Regexp) (string, bool) {
+	for _, marker := range markers {
+		if loc := marker.FindStringIndex(text); loc != nil {
+			return text[loc[1]:], true
+		}
 	}
-
-	p.logger.Warn("Code not found after marker in Perplexity email",
-		zap.String("searchText_preview", truncateString(searchText, 300)))
-	return NotFoundCode
+	return "", false
 }
 
 func (p *GenericEmailProcessor) stripMIMEHeaders(text string) string {
@@ -198,23 +639,3 @@ func (p *GenericEmailProcessor) stripMIMEHeaders(text string) string {
 	}
 	return text[headerEnd:]
 }
-
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen] + "..."
-}
-
-func (p *GenericEmailProcessor) decodeQuotedPrintable(text string) string {
-	// Si el texto contiene caracteres quoted-printable, intentar decodificar
-	if strings.Contains(text, "=") {
-		reader := quotedprintable.NewReader(strings.NewReader(text))
-		if decoded, err := io.ReadAll(reader); err == nil {
-			return string(decoded)
-		} else {
-			p.logger.Warn("Failed to decode quoted-printable", zap.Error(err))
-		}
-	}
-	return text
-}
@@ -1,18 +1,27 @@
 package processor
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 
+	"automation-hub/internal/clock"
 	"automation-hub/internal/config"
 	"automation-hub/internal/models"
+	"automation-hub/internal/services/gotify"
 )
 
 func TestNewGenericEmailProcessor_CustomPattern(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom:       "test@example.com",
+		EmailFrom:       []string{"test@example.com"},
 		EmailSubject:    []string{"Security Code"},
 		TelegramChatID:  "123",
 		TelegramMessage: "Code is %s",
@@ -32,7 +41,7 @@ func TestNewGenericEmailProcessor_CustomPattern(t *testing.T) {
 func TestNewGenericEmailProcessor_InvalidCustomPatternFallback(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom:       "test@example.com",
+		EmailFrom:       []string{"test@example.com"},
 		EmailSubject:    []string{"Code"},
 		CodePattern:     `[invalid regex (`,
 	}
@@ -46,7 +55,7 @@ func TestNewGenericEmailProcessor_InvalidCustomPatternFallback(t *testing.T) {
 func TestNewGenericEmailProcessor_BuiltInPatterns(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom: "test@example.com",
+		EmailFrom: []string{"test@example.com"},
 	}
 
 	cfProcessor := NewGenericEmailProcessor("cloudflare", cfg, nil, logger)
@@ -60,10 +69,39 @@ func TestNewGenericEmailProcessor_BuiltInPatterns(t *testing.T) {
 	}
 }
 
+func TestNewGenericEmailProcessorWithDefaults(t *testing.T) {
+	defaults := map[string]string{
+		"github":     `\b\d{8}\b`,
+		"Cloudflare": `\b\d{4}\b`,
+		"broken":     `([`,
+	}
+
+	tests := []struct {
+		name     string
+		service  string
+		expected string
+	}{
+		{"Configured pattern for new service", "github", `\b\d{8}\b`},
+		{"Configured pattern overrides built-in", "cloudflare", `\b\d{4}\b`},
+		{"Built-in pattern kept", "perplexity", `(?:\d{5,6}|[a-zA-Z0-9]+-[a-zA-Z0-9]+)`},
+		{"Invalid pattern falls back to default", "broken", `\b[a-zA-Z0-9]{4,8}\b`},
+		{"Unknown service uses default", "other", `\b[a-zA-Z0-9]{4,8}\b`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewGenericEmailProcessorWithDefaults(tt.service, config.ServiceProcessorConfig{}, defaults, nil, zap.NewNop())
+			if got := p.codePattern.String(); got != tt.expected {
+				t.Errorf("codePattern = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestShouldProcess(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom:    "alert@service.com",
+		EmailFrom:    []string{"alert@service.com"},
 		EmailSubject: []string{"Verification", "Login Code"},
 	}
 
@@ -118,10 +156,148 @@ func TestShouldProcess(t *testing.T) {
 	}
 }
 
+func TestShouldProcessFromMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		fromMatch string
+		emailFrom []string
+		from      string
+		expected  bool
+	}{
+		{"Contains matches substring", "", []string{"cloudflare.com"}, "notify@evil-cloudflare.com", true},
+		{"Exact matches any listed address", config.FromMatchExact, []string{"a@cloudflare.com", "noreply@notify.cloudflare.com"}, "NoReply@notify.cloudflare.com", true},
+		{"Exact rejects other address", config.FromMatchExact, []string{"noreply@notify.cloudflare.com"}, "other@notify.cloudflare.com", false},
+		{"Domain matches part after @", config.FromMatchDomain, []string{"notify.cloudflare.com"}, "noreply@notify.cloudflare.com", true},
+		{"Domain accepts leading @", config.FromMatchDomain, []string{"@cloudflare.com"}, "noreply@cloudflare.com", true},
+		{"Domain rejects lookalike", config.FromMatchDomain, []string{"cloudflare.com"}, "notify@evil-cloudflare.com", false},
+		{"Domain rejects subdomain", config.FromMatchDomain, []string{"cloudflare.com"}, "noreply@notify.cloudflare.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServiceProcessorConfig{
+				EmailFrom:    tt.emailFrom,
+				FromMatch:    tt.fromMatch,
+				EmailSubject: []string{"Code"},
+			}
+			p := NewGenericEmailProcessor("test", cfg, nil, zap.NewNop())
+			email := models.Email{From: tt.from, Subject: "Code"}
+			if got := p.ShouldProcess(email); got != tt.expected {
+				t.Errorf("ShouldProcess() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	p := NewGenericEmailProcessor("test", config.ServiceProcessorConfig{EmailFrom: []string{"a@x.com", "b@x.com"}}, nil, zap.NewNop())
+	if p.GetSender() != "a@x.com" || len(p.GetSenders()) != 2 {
+		t.Errorf("GetSender() = %s, GetSenders() = %v, expected first sender and both", p.GetSender(), p.GetSenders())
+	}
+}
+
+func TestShouldProcessRegexSubjects(t *testing.T) {
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:    []string{"alert@service.com"},
+		EmailSubject: []string{`^Your code is \d{6}$`, `(?i)sign in`, `([`},
+		SubjectMatch: config.SubjectMatchRegex,
+	}
+	p := NewGenericEmailProcessor("test", cfg, nil, zap.NewNop())
+
+	tests := []struct {
+		subject  string
+		expected bool
+	}{
+		{"Your code is 123456", true},
+		{"SIGN IN to your account", true},
+		{"Your code is ready: weekly digest", false},
+		{"Your weekly digest", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			email := models.Email{From: "alert@service.com", Subject: tt.subject}
+			if got := p.ShouldProcess(email); got != tt.expected {
+				t.Errorf("ShouldProcess() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestShouldProcessCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		name            string
+		subjectMatch    string
+		caseInsensitive bool
+		from            string
+		subject         string
+		expected        bool
+	}{
+		{"Case-sensitive by default", "", false, "noreply@Service.com", "Your Verification Code", false},
+		{"Contains ignores case", "", true, "noreply@Service.com", "YOUR VERIFICATION CODE", true},
+		{"Regex ignores case", config.SubjectMatchRegex, true, "noreply@service.com", "YOUR VERIFICATION CODE", true},
+		{"Still requires a match", "", true, "noreply@service.com", "Weekly digest", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServiceProcessorConfig{
+				EmailFrom:       []string{"service.com"},
+				EmailSubject:    []string{"verification code"},
+				SubjectMatch:    tt.subjectMatch,
+				CaseInsensitive: tt.caseInsensitive,
+			}
+			p := NewGenericEmailProcessor("test", cfg, nil, zap.NewNop())
+			email := models.Email{From: tt.from, Subject: tt.subject}
+			if got := p.ShouldProcess(email); got != tt.expected {
+				t.Errorf("ShouldProcess() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestShouldProcessBody(t *testing.T) {
+	base := config.ServiceProcessorConfig{
+		EmailFrom:    []string{"no-reply@service.com"},
+		EmailSubject: []string{"Your code"},
+	}
+
+	tests := []struct {
+		name         string
+		bodyContains []string
+		bodyRegex    string
+		subject      string
+		body         string
+		expected     bool
+	}{
+		{"No body filter", nil, "", "Your code", "anything", true},
+		{"Contains matches case-insensitively", []string{"Sign in to Acme", "Workspace"}, "", "Your code", "use it to SIGN IN TO ACME", true},
+		{"Contains misses", []string{"Sign in to Acme"}, "", "Your code", "Sign in to Other", false},
+		{"Contains after quoted-printable decoding", []string{"sign in to acme"}, "", "Your code", "Content-Transfer-Encoding: quoted-printable\r\n\r\nsign in to a=\r\ncme", true},
+		{"Undeclared quoted-printable is not decoded", []string{"ref=3D1"}, "", "Your code", "link?ref=3D1", true},
+		{"Regex matches", nil, `account (?:ending|terminada) in \d{4}`, "Your code", "account ending in 1234", true},
+		{"Regex misses", nil, `account ending in \d{4}`, "Your code", "account ending in ****", false},
+		{"Both must match", []string{"acme"}, `\d{6}`, "Your code", "acme login", false},
+		{"Subject still gates", []string{"acme"}, "", "Newsletter", "acme", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.BodyContains = tt.bodyContains
+			cfg.BodyRegex = tt.bodyRegex
+			p := NewGenericEmailProcessor("acme", cfg, nil, zap.NewNop())
+
+			email := models.Email{From: "no-reply@service.com", Subject: tt.subject, TextPlain: tt.body}
+			if got := p.ShouldProcess(email); got != tt.expected {
+				t.Errorf("ShouldProcess() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestExtractCode(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom:   "test@example.com",
+		EmailFrom:   []string{"test@example.com"},
 		CodePattern: `\b\d{6}\b`,
 	}
 
@@ -139,17 +315,324 @@ func TestExtractCode(t *testing.T) {
 		t.Errorf("Expected %s, got %s", NotFoundCode, codeNotFound)
 	}
 
-	cfProc := NewGenericEmailProcessor("cloudflare", config.ServiceProcessorConfig{EmailFrom: "test@example.com"}, nil, logger)
+	cfProc := NewGenericEmailProcessor("cloudflare", config.ServiceProcessorConfig{EmailFrom: []string{"test@example.com"}}, nil, logger)
 	cfCode := cfProc.extractCode("Your Cloudflare verification code is 654321")
 	if cfCode != "654321" {
 		t.Errorf("Expected Cloudflare code 654321, got %s", cfCode)
 	}
 }
 
+func TestProcessSkipsWhenCodeNotFound(t *testing.T) {
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:       []string{"test@example.com"},
+		TelegramMessage: "Your code is %s",
+		CodePattern:     `\b\d{6}\b`,
+	}
+
+	// A nil Telegram client would panic if Process tried to send
+	p := NewGenericEmailProcessor("default", cfg, nil, zap.NewNop())
+	if err := p.Process(context.Background(), models.Email{TextPlain: "No numbers here"}); err != nil {
+		t.Errorf("Process() = %v, expected nil", err)
+	}
+}
+
+func TestGenericEmailProcessorProcess(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		notifyOnFailure bool
+		expected        []string
+	}{
+		{"Code found", "Your code is 123456", false, []string{"Your code is 123456"}},
+		{"No code", "No numbers here", false, nil},
+		{"No code with notify_on_failure", "No numbers here", true, []string{"Your code is Not found"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sender := newRecordingClient(t)
+			cfg := config.ServiceProcessorConfig{
+				EmailFrom:       []string{"test@example.com"},
+				TelegramChatID:  "123",
+				TelegramMessage: "Your code is %s",
+				CodePattern:     `\b\d{6}\b`,
+				NotifyOnFailure: tt.notifyOnFailure,
+			}
+			p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+
+			if err := p.Process(context.Background(), models.Email{TextPlain: tt.text}); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+			var got []string
+			for _, msg := range sender.sent {
+				got = append(got, msg.Text)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Sent messages = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenericEmailProcessorSendOptions(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	cfg := config.ServiceProcessorConfig{
+		TelegramChatID:      "123",
+		TelegramMessage:     "Your code is %s",
+		CodePattern:         `\b\d{6}\b`,
+		DisableNotification: true,
+		ReplyToMessageID:    42,
+	}
+	p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+
+	if err := p.Process(context.Background(), models.Email{TextPlain: "Your code is 123456"}); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("Expected 1 message sent, got %d", len(sender.sent))
+	}
+	if got := sender.sent[0]; !got.DisableNotification || got.ReplyToMessageID != 42 {
+		t.Errorf("Sent message = silent %v, reply to %d, expected silent reply to 42", got.DisableNotification, got.ReplyToMessageID)
+	}
+}
+
+func TestGenericEmailProcessorCopyButton(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		text     string
+		expected string
+	}{
+		{"Disabled", false, "Your code is 123456", ""},
+		{"Enabled", true, "Your code is 123456", `{"inline_keyboard":[[{"text":"📋 Copy code","copy_text":{"text":"123456"}}]]}`},
+		{"No code found", true, "No code here", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sender := newRecordingClient(t)
+			cfg := config.ServiceProcessorConfig{
+				TelegramChatID:   "123",
+				TelegramMessage:  "Your code is %s",
+				CodePattern:      `\b\d{6}\b`,
+				NotifyOnFailure:  true,
+				InlineCopyButton: tt.enabled,
+			}
+			p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+
+			if err := p.Process(context.Background(), models.Email{TextPlain: tt.text}); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+			if len(sender.sent) != 1 {
+				t.Fatalf("Expected 1 message sent, got %d", len(sender.sent))
+			}
+			var markup string
+			if sender.sent[0].ReplyMarkup != nil {
+				data, err := json.Marshal(sender.sent[0].ReplyMarkup)
+				if err != nil {
+					t.Fatalf("Failed to marshal reply markup: %v", err)
+				}
+				markup = string(data)
+			}
+			if markup != tt.expected {
+				t.Errorf("Reply markup = %s, expected %q", markup, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTextAfterMarker(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		markers  []string
+		expected string
+		found    bool
+	}{
+		{"Case-insensitive", "Enter this code DIRECTLY: 123456", []string{"directly:"}, " 123456", true},
+		{"First marker found wins", "Código directamente: 654321", []string{"directly:", "directamente:"}, " 654321", true},
+		{"Non-ASCII text before the marker", "İİİ \u212a code: 482913", []string{"code:"}, " 482913", true},
+		{"Marker at the end", "İİİİİİ code:", []string{"CODE:"}, "", true},
+		{"Marker missing", "Your code is 123456", []string{"directly:"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := textAfterMarker(tt.text, compileMarkers(tt.markers))
+			if got != tt.expected || found != tt.found {
+				t.Errorf("textAfterMarker() = %q, %v, expected %q, %v", got, found, tt.expected, tt.found)
+			}
+		})
+	}
+}
+
+func TestProcessMaxAge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		maxAge   int
+		date     time.Time
+		expected int
+	}{
+		{"No limit", 0, now.Add(-time.Hour), 1},
+		{"Fresh email", 10, now.Add(-10 * time.Minute), 1},
+		{"Stale email", 10, now.Add(-10*time.Minute - time.Second), 0},
+		{"Missing Date header", 10, time.Time{}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sender := newRecordingClient(t)
+			cfg := config.ServiceProcessorConfig{
+				TelegramChatID:  "123",
+				TelegramMessage: "Your code is %s",
+				CodePattern:     `\b\d{6}\b`,
+				MaxAgeMinutes:   tt.maxAge,
+			}
+			p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+			p.clock = clock.NewFake(now)
+
+			email := models.Email{TextPlain: "Your code is 123456", Date: tt.date}
+			if err := p.Process(context.Background(), email); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+			if len(sender.sent) != tt.expected {
+				t.Errorf("Sent %d messages, expected %d", len(sender.sent), tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessCooldown(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	cfg := config.ServiceProcessorConfig{
+		TelegramChatID:  "123",
+		TelegramMessage: "Your code is %s",
+		CodePattern:     `\b\d{6}\b`,
+		CooldownSeconds: 60,
+	}
+	p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+	clk := clock.NewFake(time.Now())
+	p.clock = clk
+
+	steps := []struct {
+		name       string
+		advance    time.Duration
+		body       string
+		expected   int // messages sent so far
+		suppressed bool
+	}{
+		{"Email without a code sends nothing", 0, "Welcome aboard", 0, false},
+		{"Code after it is not held back", 0, "Your code is 123456", 1, false},
+		{"Resent code is suppressed", 30 * time.Second, "Your code is 123456", 1, true},
+		{"Code after the cooldown is sent", 30 * time.Second, "Your code is 654321", 2, false},
+	}
+	for _, step := range steps {
+		clk.Advance(step.advance)
+		result, err := p.ProcessWithResult(context.Background(), models.Email{TextPlain: step.body})
+		if err != nil {
+			t.Fatalf("%s: ProcessWithResult() returned unexpected error: %v", step.name, err)
+		}
+		if len(sender.sent) != step.expected {
+			t.Errorf("%s: sent %d messages, expected %d", step.name, len(sender.sent), step.expected)
+		}
+		if step.suppressed && (result.Code != "" || result.Sent || result.Skipped != SkippedCooldown) {
+			t.Errorf("%s: result = %+v, expected no code and skipped for the cooldown", step.name, result)
+		}
+	}
+}
+
+func TestProcessWithResult(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		email    models.Email
+		expected string
+		sent     bool
+		skipped  string
+	}{
+		{"Code found", models.Email{TextPlain: "Your code is 123456", Date: now}, "123456", true, ""},
+		{"No code", models.Email{TextPlain: "Welcome aboard", Date: now}, "", false, SkippedNoCode},
+		{"Stale email", models.Email{TextPlain: "Your code is 123456", Date: now.Add(-time.Hour)}, "", false, SkippedStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newRecordingClient(t)
+			cfg := config.ServiceProcessorConfig{
+				TelegramChatID:  "123",
+				TelegramMessage: "Your code is %s",
+				CodePattern:     `\b\d{6}\b`,
+				MaxAgeMinutes:   10,
+			}
+			p := NewGenericEmailProcessor("default", cfg, client, zap.NewNop())
+			p.clock = clock.NewFake(now)
+
+			result, err := p.ProcessWithResult(context.Background(), tt.email)
+			if err != nil {
+				t.Fatalf("ProcessWithResult() returned unexpected error: %v", err)
+			}
+			expected := models.ProcessingResult{Service: "default", Code: tt.expected, Matched: true, Sent: tt.sent, Skipped: tt.skipped}
+			if result != expected {
+				t.Errorf("ProcessWithResult() = %+v, expected %+v", result, expected)
+			}
+		})
+	}
+}
+
+func TestMatchingAttachments(t *testing.T) {
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:          []string{"test@example.com"},
+		ForwardAttachments: []string{"application/pdf", "image/*"},
+	}
+	p := NewGenericEmailProcessor("default", cfg, nil, zap.NewNop())
+
+	attachments := []models.Attachment{
+		{Filename: "code.pdf", MIMEType: "application/pdf"},
+		{Filename: "qr.png", MIMEType: "Image/PNG"},
+		{Filename: "invite.ics", MIMEType: "text/calendar"},
+	}
+
+	got := p.matchingAttachments(attachments)
+	if len(got) != 2 || got[0].Filename != "code.pdf" || got[1].Filename != "qr.png" {
+		t.Errorf("matchingAttachments() = %v, expected code.pdf and qr.png", got)
+	}
+
+	p.config.ForwardAttachments = nil
+	if got := p.matchingAttachments(attachments); len(got) != 0 {
+		t.Errorf("matchingAttachments() = %v, expected none without forward_attachments", got)
+	}
+}
+
+func TestExtractCodeCaptureGroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		body     string
+		expected string
+	}{
+		{"Without group returns full match", `code:\s*[0-9]{6}`, "Your code: 123456", "code: 123456"},
+		{"First group is returned", `code:\s*([0-9]{6})`, "Ref 999999, code: 123456", "123456"},
+		{"Only the first of several groups", `([A-Z]+)-([0-9]+)`, "Use ABC-42 now", "ABC"},
+		{"Non-capturing group returns full match", `(?:pin|code)\s\d{4}`, "your pin 4321", "pin 4321"},
+		{"Unmatched optional group falls back to full match", `\d{6}(-[A-Z]+)?`, "code 123456", "123456"},
+		{"No match", `code:\s*([0-9]{6})`, "nothing here", NotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewGenericEmailProcessor("default", config.ServiceProcessorConfig{CodePattern: tt.pattern}, nil, zap.NewNop())
+			if got := p.extractCode(tt.body); got != tt.expected {
+				t.Errorf("extractCode() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestExtractPerplexityCode(t *testing.T) {
 	logger := zap.NewNop()
 	cfg := config.ServiceProcessorConfig{
-		EmailFrom: "perplexity@example.com",
+		EmailFrom: []string{"perplexity@example.com"},
 	}
 
 	p := NewGenericEmailProcessor("perplexity", cfg, nil, logger)
@@ -185,12 +668,42 @@ func TestExtractPerplexityCode(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			got := p.extractCode(tt.input)
 			if got != tt.expected {
-				t.Errorf("extractPerplexityCode() = %s, expected %s", got, tt.expected)
+				t.Errorf("extractCode() = %s, expected %s", got, tt.expected)
 			}
 		})
 	}
 }
 
+func TestExtractCodeWithMarker(t *testing.T) {
+	tests := []struct {
+		name     string
+		markers  []string
+		body     string
+		expected string
+	}{
+		{"No marker searches the whole body", nil, "Order 987654\nYour code: 123456", "987654"},
+		{"Code after marker", []string{"your code:"}, "Order 987654\nYour code: 123456", "123456"},
+		{"Markers are tried in order", []string{"codigo:", "code:"}, "code: 111111 codigo: 222222", "222222"},
+		{"Missing marker", []string{"your code:"}, "Order 987654", NotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ServiceProcessorConfig{CodePattern: `\b\d{6}\b`, CodeMarker: tt.markers}
+			p := NewGenericEmailProcessor("github", cfg, nil, zap.NewNop())
+			if got := p.extractCode(tt.body); got != tt.expected {
+				t.Errorf("extractCode() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	// The service name doesn't imply a marker
+	p := NewGenericEmailProcessor("perplexity", config.ServiceProcessorConfig{CodePattern: `\b\d{5}\b`}, nil, zap.NewNop())
+	if got := p.extractCode("code: 22222 directly: 11111"); got != "22222" {
+		t.Errorf("extractCode() = %q, expected %q", got, "22222")
+	}
+}
+
 func TestStripMIMEHeaders(t *testing.T) {
 	logger := zap.NewNop()
 	p := NewGenericEmailProcessor("test", config.ServiceProcessorConfig{}, nil, logger)
@@ -210,6 +723,11 @@ func TestStripMIMEHeaders(t *testing.T) {
 			input:    "From: foo\r\nSubject: bar\r\n\r\nBody content",
 			expected: "Body content",
 		},
+		{
+			name:     "Multipart part headers",
+			input:    "--b1\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nYour code: 123456",
+			expected: "Your code: 123456",
+		},
 		{
 			name:     "No header separator",
 			input:    "Plain body without headers",
@@ -227,27 +745,225 @@ func TestStripMIMEHeaders(t *testing.T) {
 	}
 }
 
-func TestTruncateString(t *testing.T) {
-	if got := truncateString("hello world", 5); got != "hello..." {
-		t.Errorf("truncateString() = %s, expected hello...", got)
+// TestProcessFixtures runs realistic email bodies, as fetched from IMAP, through
+// Process and checks the code sent to Telegram. Each fixture is also tried with
+// CRLF line endings, which is what servers return.
+func TestProcessFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		service  string
+		cfg      config.ServiceProcessorConfig
+		expected string
+	}{
+		// Headers are kept for Cloudflare; the digits in the boundary must not match
+		{"cloudflare.txt", "cloudflare", config.ServiceProcessorConfig{}, "482913"},
+		// Quoted-printable marker (sesi=C3=B3n) and a soft line break before it
+		{"perplexity_es.txt", "perplexity", config.ServiceProcessorConfig{}, "734021"},
+		{"perplexity_en.txt", "perplexity", config.ServiceProcessorConfig{}, "aw9s5-y1zoy"},
+		// "verification code" appears earlier in the text without the colon
+		{"github.txt", "github", config.ServiceProcessorConfig{
+			CodePattern: `\b\d{6}\b`,
+			CodeMarker:  []string{"verification code:"},
+		}, "305871"},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+
+		bodies := map[string]string{
+			"LF":   string(data),
+			"CRLF": strings.ReplaceAll(string(data), "\n", "\r\n"),
+		}
+		for lineEnding, body := range bodies {
+			t.Run(tt.fixture+"/"+lineEnding, func(t *testing.T) {
+				client, sender := newRecordingClient(t)
+				cfg := tt.cfg
+				cfg.TelegramChatID = "123"
+				cfg.TelegramMessage = "%s"
+				p := NewGenericEmailProcessor(tt.service, cfg, client, zap.NewNop())
+
+				if err := p.Process(context.Background(), models.Email{TextPlain: body}); err != nil {
+					t.Fatalf("Process() returned unexpected error: %v", err)
+				}
+				if len(sender.sent) != 1 {
+					t.Fatalf("Expected 1 message sent, got %d", len(sender.sent))
+				}
+				if got := sender.sent[0].Text; got != tt.expected {
+					t.Errorf("Sent code = %q, expected %q", got, tt.expected)
+				}
+			})
+		}
+	}
+}
+
+// fakeNotifier records messages and, like the Discord notifier, cannot send files
+type fakeNotifier struct {
+	targets  []string
+	messages []string
+}
+
+func (n *fakeNotifier) SendMessageContext(ctx context.Context, target, message string) error {
+	n.targets = append(n.targets, target)
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func (n *fakeNotifier) Escape(text string) string {
+	return strings.ReplaceAll(text, "_", `\_`)
+}
+
+func TestProcessWithDiscordNotifier(t *testing.T) {
+	notifier := &fakeNotifier{}
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:          []string{"test@example.com"},
+		TelegramChatID:     "123",
+		TelegramMessage:    "Code: %s",
+		CodePattern:        `code (\S+)`,
+		Notifier:           config.NotifierDiscord,
+		DiscordWebhook:     "codes",
+		ForwardAttachments: []string{"application/pdf"},
 	}
-	if got := truncateString("short", 10); got != "short" {
-		t.Errorf("truncateString() = %s, expected short", got)
+	p := NewGenericEmailProcessor("acme", cfg, notifier, zap.NewNop())
+
+	email := models.Email{
+		TextPlain:   "Your code a_b1",
+		Attachments: []models.Attachment{{Filename: "invoice.pdf", MIMEType: "application/pdf", Data: []byte("%PDF")}},
+	}
+	if err := p.Process(context.Background(), email); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+
+	// The Discord webhook is the target and the code is escaped by the notifier;
+	// the attachment is skipped since the notifier cannot send files
+	if !reflect.DeepEqual(notifier.targets, []string{"codes"}) {
+		t.Errorf("Sent to %v, expected [codes]", notifier.targets)
+	}
+	if !reflect.DeepEqual(notifier.messages, []string{`Code: a\_b1`}) {
+		t.Errorf("Sent messages = %q, expected %q", notifier.messages, []string{`Code: a\_b1`})
 	}
 }
 
-func TestDecodeQuotedPrintable(t *testing.T) {
-	logger := zap.NewNop()
-	p := NewGenericEmailProcessor("test", config.ServiceProcessorConfig{}, nil, logger)
+// fakeCodeSender records structured notifications like the webhook notifier
+type fakeCodeSender struct {
+	fakeNotifier
+	notifications []models.CodeNotification
+}
+
+func (n *fakeCodeSender) SendCodeContext(ctx context.Context, target string, notification models.CodeNotification) error {
+	n.targets = append(n.targets, target)
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func TestProcessWithWebhookNotifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"Code found", "Your code a_b1", "a_b1"},
+		{"Code not found", "Nothing to see", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &fakeCodeSender{}
+			cfg := config.ServiceProcessorConfig{
+				EmailFrom:       []string{"test@example.com"},
+				TelegramMessage: "Code: %s",
+				CodePattern:     `code (\S+)`,
+				NotifyOnFailure: true,
+				Notifier:        config.NotifierWebhook,
+				NotifyWebhook:   "dashboard",
+			}
+			p := NewGenericEmailProcessor("acme", cfg, notifier, zap.NewNop())
+
+			email := models.Email{From: "test@example.com", Subject: "Login", TextPlain: tt.text}
+			if err := p.Process(context.Background(), email); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+
+			// The code is sent unescaped as data, not through telegram_message
+			expected := []models.CodeNotification{{Service: "acme", Code: tt.expected, Subject: "Login", From: "test@example.com"}}
+			if !reflect.DeepEqual(notifier.notifications, expected) {
+				t.Errorf("Sent notifications = %+v, expected %+v", notifier.notifications, expected)
+			}
+			if !reflect.DeepEqual(notifier.targets, []string{"dashboard"}) {
+				t.Errorf("Sent to %v, expected [dashboard]", notifier.targets)
+			}
+			if len(notifier.messages) != 0 {
+				t.Errorf("Sent messages %q, expected none", notifier.messages)
+			}
+		})
+	}
+}
+
+// fakePushSender records Gotify messages like the gotify notifier
+type fakePushSender struct {
+	fakeNotifier
+	pushes []gotify.Message
+}
+
+func (n *fakePushSender) SendPushContext(ctx context.Context, msg gotify.Message) error {
+	n.pushes = append(n.pushes, msg)
+	return nil
+}
+
+func TestProcessWithGotifyNotifier(t *testing.T) {
+	notifier := &fakePushSender{}
+	priority := 8
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:       []string{"test@example.com"},
+		TelegramMessage: "Code: {{.Code}}",
+		CodePattern:     `code (\S+)`,
+		Notifier:        config.NotifierGotify,
+		GotifyPriority:  &priority,
+	}
+	p := NewGenericEmailProcessor("acme", cfg, notifier, zap.NewNop())
 
-	quoted := "Hello=20World=21"
-	decoded := p.decodeQuotedPrintable(quoted)
-	if decoded != "Hello World!" {
-		t.Errorf("decodeQuotedPrintable() = %s, expected Hello World!", decoded)
+	if err := p.Process(context.Background(), models.Email{TextPlain: "Your code a_b1"}); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
 	}
 
-	plain := "Hello World"
-	if p.decodeQuotedPrintable(plain) != plain {
-		t.Errorf("decodeQuotedPrintable() plain text modified")
+	// The rendered message is titled with the service name and keeps the priority
+	if len(notifier.pushes) != 1 {
+		t.Fatalf("Pushed %d messages, expected 1", len(notifier.pushes))
+	}
+	got := notifier.pushes[0]
+	if got.Title != "acme" || got.Message != `Code: a\_b1` || got.Priority == nil || *got.Priority != 8 {
+		t.Errorf("Pushed %+v, expected title acme, the rendered message and priority 8", got)
+	}
+	if len(notifier.messages) != 0 {
+		t.Errorf("Sent messages %q, expected none", notifier.messages)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:       []string{"test@example.com"},
+		TelegramMessage: "Code: %s",
+		CodePattern:     `code (\d{6})`,
+	}
+	p := NewGenericEmailProcessor("acme", cfg, &fakeNotifier{}, zap.NewNop())
+
+	tests := []struct {
+		name     string
+		email    models.Email
+		wantText string
+		wantCode string
+	}{
+		{"Quoted-printable", models.Email{TextPlain: "Your code=20123456", TransferEncoding: "quoted-printable"}, "Your code 123456", "123456"},
+		{"No code", models.Email{TextPlain: "Welcome"}, "Welcome", NotFoundCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, code := p.Extract(tt.email)
+			if text != tt.wantText || code != tt.wantCode {
+				t.Errorf("Extract() = %q, %q, expected %q, %q", text, code, tt.wantText, tt.wantCode)
+			}
+		})
 	}
 }
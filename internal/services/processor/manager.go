@@ -1,52 +1,200 @@
 package processor
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 
 	"go.uber.org/zap"
 
 	"automation-hub/internal/config"
+	"automation-hub/internal/metrics"
 	"automation-hub/internal/models"
-	"automation-hub/internal/services/telegram"
 )
 
+// defaultConcurrency is the number of emails processed at a time without
+// email.max_concurrency, low enough to stay within Telegram's rate limits
+const defaultConcurrency = 4
+
 type Manager struct {
+	account    string // config.EmailConfig.AccountName, tags logs, metrics and events
 	processors []models.EmailProcessor
-	telegram   *telegram.Client
+	services   []config.ServiceConfig // config of each processor, same order
+	recent     *Recent                // nil until SetRecent
+	audit      *zap.Logger            // nil until SetAudit
+	fallback   *fallback              // nil without email.fallback
+	slots      chan struct{}          // one per email being processed, nil = no limit
 	logger     *zap.Logger
 	wg         sync.WaitGroup
 }
 
-func NewProcessorManager(emailConfig config.EmailConfig, telegram *telegram.Client, logger *zap.Logger) *Manager {
+// NewProcessorManager builds a processor for every service of an account with
+// the factory registered for its type, failing on unknown types
+func NewProcessorManager(emailConfig config.EmailConfig, notifiers Notifiers, logger *zap.Logger) (*Manager, error) {
+	concurrency := emailConfig.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	account := emailConfig.AccountName()
+	logger = logger.With(zap.String("account", account))
 	manager := &Manager{
-		telegram: telegram,
-		logger:   logger,
+		account: account,
+		slots:   make(chan struct{}, concurrency),
+		logger:  logger,
 	}
 
+	// Highest priority first so specific services are not shadowed by catch-alls;
+	// the sort is stable so equal priorities keep the config order
+	services := slices.Clone(emailConfig.Services)
+	slices.SortStableFunc(services, func(a, b config.ServiceConfig) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+
 	// Create processors dynamically from the configuration
-	for _, serviceConfig := range emailConfig.Services {
-		processor := NewGenericEmailProcessor(
-			serviceConfig.Name,
-			serviceConfig.Config,
-			telegram,
-			logger,
-		)
+	for _, serviceConfig := range services {
+		if !serviceConfig.IsEnabled() {
+			logger.Info("Skipping disabled email service", zap.String("service", serviceConfig.Name))
+			continue
+		}
+		factory, ok := lookupFactory(serviceConfig.Type)
+		if !ok {
+			return nil, fmt.Errorf("service %s: unknown processor type %q (available: %s)",
+				serviceConfig.Name, serviceConfig.Type, strings.Join(Types(), ", "))
+		}
+		notifier, err := notifiers.get(serviceConfig.Config.Notifier)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", serviceConfig.Name, err)
+		}
+		processor, err := factory(serviceConfig, emailConfig.DefaultPatterns, notifier, logger)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", serviceConfig.Name, err)
+		}
 		manager.processors = append(manager.processors, processor)
+		manager.services = append(manager.services, serviceConfig)
+		metrics.InitProcessor(account, serviceConfig.Name)
 		logger.Info("Loaded email processor",
 			zap.String("service", serviceConfig.Name),
-			zap.String("email_from", serviceConfig.Config.EmailFrom),
+			zap.String("type", cmp.Or(serviceConfig.Type, DefaultType)),
+			zap.Int("priority", serviceConfig.Priority),
+			zap.Strings("email_from", serviceConfig.Config.EmailFrom),
 			zap.Strings("email_subjects", serviceConfig.Config.EmailSubject))
 	}
 
-	return manager
+	if emailConfig.Fallback.Enabled() {
+		fallback, err := newFallback(emailConfig.Fallback, notifiers.Telegram, logger)
+		if err != nil {
+			return nil, err
+		}
+		manager.fallback = fallback
+	}
+
+	return manager, nil
+}
+
+// Account returns the name of the account whose services the manager runs
+func (pm *Manager) Account() string {
+	return pm.account
+}
+
+// SetRecent records the outcome of every dispatched email in recent
+func (pm *Manager) SetRecent(recent *Recent) {
+	pm.recent = recent
+}
+
+// SetAudit writes one line per email a processor handled to audit, see
+// logging.NewAudit
+func (pm *Manager) SetAudit(audit *zap.Logger) {
+	pm.audit = audit
 }
 
 func (pm *Manager) GetProcessors() []models.EmailProcessor {
 	return pm.processors
 }
 
-func (pm *Manager) ProcessEmailsConcurrently(ctx context.Context, emails []models.Email) {
+// Info describes a loaded processor for GET /admin/processors
+type Info struct {
+	Account           string   `json:"account"`
+	Name              string   `json:"name"`
+	Type              string   `json:"type"`
+	Priority          int      `json:"priority"`
+	EmailFrom         []string `json:"email_from"`
+	FromMatch         string   `json:"from_match,omitempty"`
+	EmailSubject      []string `json:"email_subject,omitempty"`
+	SubjectMatch      string   `json:"subject_match,omitempty"`
+	CaseInsensitive   bool     `json:"case_insensitive,omitempty"`
+	BodyContains      []string `json:"body_contains,omitempty"`
+	BodyRegex         string   `json:"body_regex,omitempty"`
+	CodePattern       string   `json:"code_pattern,omitempty"`
+	CodePatternSource string   `json:"code_pattern_source,omitempty"` // custom or default
+	CodeMarkers       []string `json:"code_markers,omitempty"`
+	Notifier          string   `json:"notifier,omitempty"`
+	MarkAsRead        bool     `json:"mark_as_read"`
+}
+
+// describer is implemented by processors that can report their effective matching config
+type describer interface {
+	Describe() Info
+}
+
+// Describe lists the loaded processors in priority order, the order emails are
+// matched in, with their effective configuration
+func (pm *Manager) Describe() []Info {
+	infos := make([]Info, 0, len(pm.processors))
+	for i, processor := range pm.processors {
+		info := Info{Name: processorName(processor), EmailFrom: Senders(processor)}
+		if d, ok := processor.(describer); ok {
+			info = d.Describe()
+		}
+		if i < len(pm.services) {
+			info.Type = cmp.Or(pm.services[i].Type, DefaultType)
+			info.Priority = pm.services[i].Priority
+		}
+		info.Account = pm.account
+		info.MarkAsRead = MarksAsRead(processor)
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// MarksAsRead reports whether emails handled by the processor are marked as
+// read. Only the Perplexity and Cloudflare processors are whitelisted.
+func MarksAsRead(processor models.EmailProcessor) bool {
+	named, ok := processor.(interface{ GetName() string })
+	if !ok {
+		return false
+	}
+	name := strings.ToLower(named.GetName())
+	return name == "perplexity" || name == "cloudflare"
+}
+
+// Senders returns all senders of processors that accept several, such as the
+// generic processor with a list of email_from, or the single one
+func Senders(processor models.EmailProcessor) []string {
+	if multi, ok := processor.(interface{ GetSenders() []string }); ok {
+		return multi.GetSenders()
+	}
+	return []string{processor.GetSender()}
+}
+
+// Find returns the processor of the service with the given name
+func (pm *Manager) Find(name string) (models.EmailProcessor, bool) {
+	for _, processor := range pm.processors {
+		if processorName(processor) == name {
+			return processor, true
+		}
+	}
+	return nil, false
+}
+
+// ProcessEmailsConcurrently processes each email in its own goroutine and waits for
+// all of them. At most email.max_concurrency emails are processed at a time, across
+// all calls. onProcessed, if not nil, is called for every email processed successfully
+// and may be called concurrently. Several folders may call it at the same time; each
+// call only waits for its own emails.
+func (pm *Manager) ProcessEmailsConcurrently(ctx context.Context, emails []models.Email, onProcessed func(models.EmailProcessor, models.Email)) {
 	if len(emails) == 0 {
 		return
 	}
@@ -54,45 +202,198 @@ func (pm *Manager) ProcessEmailsConcurrently(ctx context.Context, emails []model
 	pm.logger.Info("Processing emails concurrently", zap.Int("email_count", len(emails)))
 
 	// Process each email in its own goroutine
+	var batch sync.WaitGroup
 	for _, email := range emails {
 		pm.wg.Add(1)
-		go pm.processEmailAsync(ctx, email)
+		batch.Add(1)
+		go func() {
+			defer batch.Done()
+			pm.processEmailAsync(ctx, email, onProcessed)
+		}()
 	}
 
-	// Wait for all goroutines to finish
+	// Wait for this batch to finish
+	batch.Wait()
+}
+
+// ForwardUnmatched sends the sender and subject of an email no service matched
+// to email.fallback. It does nothing without a fallback; telling forwarded
+// emails apart is left to the caller, since they are never marked as read.
+func (pm *Manager) ForwardUnmatched(ctx context.Context, email models.Email) error {
+	if pm.fallback == nil {
+		return nil
+	}
+	return pm.fallback.Forward(ctx, email)
+}
+
+// Wait blocks until every email handed to ProcessEmailsConcurrently has been processed
+func (pm *Manager) Wait() {
 	pm.wg.Wait()
 }
 
-func (pm *Manager) processEmailAsync(ctx context.Context, email models.Email) {
+func (pm *Manager) processEmailAsync(ctx context.Context, email models.Email, onProcessed func(models.EmailProcessor, models.Email)) {
 	defer pm.wg.Done()
 
-	// Check if the context was canceled
+	// Wait for a free slot, unless the context was canceled
+	if !pm.acquire(ctx) {
+		return
+	}
+	defer pm.release()
+
+	processor, result, err := Dispatch(ctx, email, pm.processors)
+	if processor != nil {
+		metrics.EmailsMatched.WithLabelValues(pm.account, processorName(processor)).Inc()
+		if err != nil {
+			metrics.ProcessingErrors.WithLabelValues(pm.account, processorName(processor)).Inc()
+		}
+	}
+	event := newEvent(email, result, err)
+	event.Account = pm.account
+	pm.recent.Add(event)
+	pm.auditEvent(event)
+	switch {
+	case processor == nil:
+		pm.logger.Info("Email ignored (no matching processor)",
+			zap.String("subject", email.Subject),
+			zap.String("from", email.From))
+	case err != nil:
+		pm.logger.Error("Failed to process email",
+			zap.String("processor", processorName(processor)),
+			zap.String("subject", email.Subject),
+			zap.String("from", email.From),
+			zap.Error(err))
+	case !result.Sent:
+		pm.logger.Info("Email handled without sending anything",
+			zap.String("processor", processorName(processor)),
+			zap.String("subject", email.Subject),
+			zap.String("from", email.From),
+			zap.String("reason", result.Skipped))
+		if onProcessed != nil {
+			onProcessed(processor, email)
+		}
+	default:
+		pm.logger.Info("Email processed successfully",
+			zap.String("processor", processorName(processor)),
+			zap.String("subject", email.Subject),
+			zap.String("from", email.From))
+		if onProcessed != nil {
+			onProcessed(processor, email)
+		}
+	}
+}
+
+// acquire takes a processing slot, blocking until one is free. It reports false
+// when ctx is canceled first.
+func (pm *Manager) acquire(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if pm.slots == nil {
+		return true
+	}
 	select {
+	case pm.slots <- struct{}{}:
+		return true
 	case <-ctx.Done():
+		return false
+	}
+}
+
+func (pm *Manager) release() {
+	if pm.slots != nil {
+		<-pm.slots
+	}
+}
+
+// auditEvent records a forwarded code, or a failed attempt to forward one, in the
+// audit log with the masked code and the chat ID or alias it was sent to. Emails
+// that were ignored or skipped without sending anything are not audited.
+func (pm *Manager) auditEvent(event Event) {
+	if pm.audit == nil || (event.Outcome != OutcomeProcessed && event.Outcome != OutcomeFailed) {
 		return
-	default:
 	}
 
-	// Find a processor that can handle this email
-	for _, processor := range pm.processors {
+	fields := []zap.Field{
+		zap.String("account", event.Account),
+		zap.String("service", event.Service),
+		zap.String("from", event.From),
+		zap.String("code", event.Code),
+		zap.Bool("success", event.Outcome == OutcomeProcessed),
+	}
+	for _, service := range pm.services {
+		if service.Name != event.Service {
+			continue
+		}
+		// Discord webhooks may be given as URLs, which carry their token
+		target := notifyTarget(service.Config)
+		if strings.Contains(target, "://") {
+			target = "[redacted URL]"
+		}
+		fields = append(fields,
+			zap.String("notifier", cmp.Or(service.Config.Notifier, config.NotifierTelegram)),
+			zap.String("target", target))
+		break
+	}
+	if event.Error != "" {
+		fields = append(fields, zap.String("error", event.Error))
+	}
+	pm.audit.Info("code forwarded", fields...)
+}
+
+// Match returns the first processor, in priority order, that handles the email,
+// or nil when none does
+func Match(email models.Email, processors []models.EmailProcessor) models.EmailProcessor {
+	for _, processor := range processors {
 		if processor.ShouldProcess(email) {
-			pm.logger.Info("Processing email",
-				zap.String("subject", email.Subject),
-				zap.String("from", email.From))
-
-			if err := processor.Process(email); err != nil {
-				pm.logger.Error("Failed to process email",
-					zap.String("subject", email.Subject),
-					zap.Error(err))
-			} else {
-				pm.logger.Info("Email processed successfully",
-					zap.String("subject", email.Subject))
-			}
-			return // Only the first matching processor should process the email
+			return processor
+		}
+	}
+	return nil
+}
+
+// MayMatch reports whether any processor could handle the email judging by its
+// sender and subject alone, i.e. whether its body is worth fetching. Processors
+// without a MatchesHeaders method need the body to decide and always may match.
+func MayMatch(email models.Email, processors []models.EmailProcessor) bool {
+	for _, processor := range processors {
+		headers, ok := processor.(interface{ MatchesHeaders(models.Email) bool })
+		if !ok || headers.MatchesHeaders(email) {
+			return true
 		}
 	}
+	return false
+}
+
+// Dispatch processes the email with the first matching processor only and
+// returns that processor with the processing result and error. matched is nil,
+// and result.Matched false, when no processor handles the email. Callers layer
+// their own follow-up, such as marking the email as read, on a nil error.
+func Dispatch(ctx context.Context, email models.Email, processors []models.EmailProcessor) (matched models.EmailProcessor, result models.ProcessingResult, err error) {
+	matched = Match(email, processors)
+	if matched == nil {
+		return nil, result, nil
+	}
+
+	result, err = process(ctx, matched, email)
+	return matched, result, err
+}
+
+// process runs the processor, taking its result from ProcessWithResult when it
+// has one. Other processors report only their service, without a code, and
+// count as sent when Process succeeds.
+func process(ctx context.Context, processor models.EmailProcessor, email models.Email) (models.ProcessingResult, error) {
+	if withResult, ok := processor.(interface {
+		ProcessWithResult(context.Context, models.Email) (models.ProcessingResult, error)
+	}); ok {
+		return withResult.ProcessWithResult(ctx, email)
+	}
+	err := processor.Process(ctx, email)
+	return models.ProcessingResult{Service: processorName(processor), Matched: true, Sent: err == nil}, err
+}
 
-	pm.logger.Info("Email ignored (no matching processor)",
-		zap.String("subject", email.Subject),
-		zap.String("from", email.From))
+func processorName(processor models.EmailProcessor) string {
+	if named, ok := processor.(interface{ GetName() string }); ok {
+		return named.GetName()
+	}
+	return processor.GetSender()
 }
@@ -2,10 +2,15 @@ package processor
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"automation-hub/internal/config"
 	"automation-hub/internal/models"
@@ -18,7 +23,7 @@ func TestProcessorManager(t *testing.T) {
 			{
 				Name: "cloudflare",
 				Config: config.ServiceProcessorConfig{
-					EmailFrom:       "no-reply@cloudflare.com",
+					EmailFrom:       []string{"no-reply@cloudflare.com"},
 					EmailSubject:    []string{"Verification Code"},
 					TelegramChatID:  "123",
 					TelegramMessage: "Code: %s",
@@ -27,7 +32,7 @@ func TestProcessorManager(t *testing.T) {
 			{
 				Name: "perplexity",
 				Config: config.ServiceProcessorConfig{
-					EmailFrom:       "no-reply@perplexity.ai",
+					EmailFrom:       []string{"no-reply@perplexity.ai"},
 					EmailSubject:    []string{"Sign In"},
 					TelegramChatID:  "123",
 					TelegramMessage: "Login: %s",
@@ -36,16 +41,25 @@ func TestProcessorManager(t *testing.T) {
 		},
 	}
 
-	mgr := NewProcessorManager(emailCfg, nil, logger)
+	mgr, err := NewProcessorManager(emailCfg, Notifiers{}, logger)
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
 
 	processors := mgr.GetProcessors()
 	if len(processors) != 2 {
 		t.Fatalf("Expected 2 processors, got %d", len(processors))
 	}
+	if p, ok := mgr.Find("perplexity"); !ok || p != processors[1] {
+		t.Errorf("Find(perplexity) = %v, %v, expected the perplexity processor", p, ok)
+	}
+	if _, ok := mgr.Find("github"); ok {
+		t.Error("Find(github) found a processor for an unknown service")
+	}
 
 	// Test processing empty email slice
 	ctx := context.Background()
-	mgr.ProcessEmailsConcurrently(ctx, nil)
+	mgr.ProcessEmailsConcurrently(ctx, nil, nil)
 
 	// Test processing matching and non-matching emails
 	emails := []models.Email{
@@ -61,13 +75,23 @@ func TestProcessorManager(t *testing.T) {
 		},
 	}
 
-	mgr.ProcessEmailsConcurrently(ctx, emails)
+	var mu sync.Mutex
+	var processed []string
+	mgr.ProcessEmailsConcurrently(ctx, emails, func(p models.EmailProcessor, email models.Email) {
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, email.From)
+	})
+	// Only the Cloudflare email is claimed by a processor
+	if len(processed) != 1 || processed[0] != "no-reply@cloudflare.com" {
+		t.Errorf("onProcessed called for %v, expected [no-reply@cloudflare.com]", processed)
+	}
 
 	// Test context cancellation
 	canceledCtx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	mgr.ProcessEmailsConcurrently(canceledCtx, emails)
+	mgr.ProcessEmailsConcurrently(canceledCtx, emails, nil)
 }
 
 func TestProcessorManager_CanceledContextAsync(t *testing.T) {
@@ -77,13 +101,16 @@ func TestProcessorManager_CanceledContextAsync(t *testing.T) {
 			{
 				Name: "cloudflare",
 				Config: config.ServiceProcessorConfig{
-					EmailFrom: "no-reply@cloudflare.com",
+					EmailFrom: []string{"no-reply@cloudflare.com"},
 				},
 			},
 		},
 	}
 
-	mgr := NewProcessorManager(emailCfg, nil, logger)
+	mgr, err := NewProcessorManager(emailCfg, Notifiers{}, logger)
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
 	time.Sleep(2 * time.Millisecond)
@@ -96,5 +123,416 @@ func TestProcessorManager_CanceledContextAsync(t *testing.T) {
 
 	// processEmailAsync should return early if context is canceled
 	mgr.wg.Add(1)
-	mgr.processEmailAsync(ctx, email)
+	mgr.processEmailAsync(ctx, email, nil)
+}
+
+func TestProcessorManagerPriority(t *testing.T) {
+	emailCfg := config.EmailConfig{
+		Services: []config.ServiceConfig{
+			{Name: "catch-all", Config: config.ServiceProcessorConfig{EmailFrom: []string{"@"}}},
+			{Name: "github", Priority: 10, Config: config.ServiceProcessorConfig{EmailFrom: []string{"noreply@github.com"}}},
+			{Name: "other", Config: config.ServiceProcessorConfig{EmailFrom: []string{"other@example.com"}}},
+			{Name: "cloudflare", Priority: 10, Config: config.ServiceProcessorConfig{EmailFrom: []string{"noreply@cloudflare.com"}}},
+		},
+	}
+
+	mgr, err := NewProcessorManager(emailCfg, Notifiers{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	expected := []string{"github", "cloudflare", "catch-all", "other"}
+	processors := mgr.GetProcessors()
+	if len(processors) != len(expected) {
+		t.Fatalf("Expected %d processors, got %d", len(expected), len(processors))
+	}
+	for i, name := range expected {
+		if got := processorName(processors[i]); got != name {
+			t.Errorf("processor[%d] = %s, expected %s", i, got, name)
+		}
+	}
+
+	// The input config is left untouched
+	if emailCfg.Services[0].Name != "catch-all" {
+		t.Errorf("Expected config order to be preserved, got %s first", emailCfg.Services[0].Name)
+	}
+}
+
+func TestProcessorManagerSkipsDisabled(t *testing.T) {
+	disabled, enabled := false, true
+	emailCfg := config.EmailConfig{
+		Services: []config.ServiceConfig{
+			{Name: "github", Config: config.ServiceProcessorConfig{EmailFrom: []string{"noreply@github.com"}}},
+			{Name: "noisy", Enabled: &disabled, Type: "unregistered"},
+			{Name: "cloudflare", Enabled: &enabled, Config: config.ServiceProcessorConfig{EmailFrom: []string{"noreply@cloudflare.com"}}},
+		},
+	}
+
+	mgr, err := NewProcessorManager(emailCfg, Notifiers{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	expected := []string{"github", "cloudflare"}
+	processors := mgr.GetProcessors()
+	if len(processors) != len(expected) {
+		t.Fatalf("Expected %d processors, got %d", len(expected), len(processors))
+	}
+	for i, name := range expected {
+		if got := processorName(processors[i]); got != name {
+			t.Errorf("processor[%d] = %s, expected %s", i, got, name)
+		}
+	}
+}
+
+func TestProcessorManagerWait(t *testing.T) {
+	mgr, err := NewProcessorManager(config.EmailConfig{}, Notifiers{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	// Nothing pending, Wait returns immediately
+	done := make(chan struct{})
+	go func() {
+		mgr.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() blocked with no pending emails")
+	}
+}
+
+// stubProcessor handles emails from its sender and fails with err
+type stubProcessor struct {
+	name      string
+	sender    string
+	err       error
+	processed atomic.Int32
+}
+
+func (p *stubProcessor) ShouldProcess(email models.Email) bool { return email.From == p.sender }
+
+func (p *stubProcessor) Process(ctx context.Context, email models.Email) error {
+	p.processed.Add(1)
+	return p.err
+}
+
+func (p *stubProcessor) GetSender() string { return p.sender }
+
+func (p *stubProcessor) GetName() string { return p.name }
+
+// multiSenderProcessor accepts emails from several senders
+type multiSenderProcessor struct {
+	stubProcessor
+	senders []string
+}
+
+func (p *multiSenderProcessor) GetSenders() []string { return p.senders }
+
+func TestSenders(t *testing.T) {
+	single := &stubProcessor{sender: "a@x.com"}
+	if got := Senders(single); len(got) != 1 || got[0] != "a@x.com" {
+		t.Errorf("Senders() = %v, expected [a@x.com]", got)
+	}
+
+	multi := &multiSenderProcessor{senders: []string{"a@x.com", "b@x.com"}}
+	if got := Senders(multi); len(got) != 2 {
+		t.Errorf("Senders() = %v, expected [a@x.com b@x.com]", got)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	failure := errors.New("telegram down")
+
+	tests := []struct {
+		name          string
+		from          string
+		expected      string // name of the matched processor, "" for none
+		expectedErr   error
+		wantProcessed []int32 // per processor
+	}{
+		{"No match", "nobody@example.com", "", nil, []int32{0, 0, 0}},
+		{"First match wins", "codes@example.com", "first", nil, []int32{1, 0, 0}},
+		{"Processing error returned with the processor", "alerts@example.com", "failing", failure, []int32{0, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processors := []*stubProcessor{
+				{name: "first", sender: "codes@example.com"},
+				{name: "second", sender: "codes@example.com"},
+				{name: "failing", sender: "alerts@example.com", err: failure},
+			}
+			list := make([]models.EmailProcessor, len(processors))
+			for i, p := range processors {
+				list[i] = p
+			}
+
+			matched, result, err := Dispatch(context.Background(), models.Email{From: tt.from}, list)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Dispatch() error = %v, expected %v", err, tt.expectedErr)
+			}
+			name := ""
+			if matched != nil {
+				name = processorName(matched)
+			}
+			if name != tt.expected {
+				t.Errorf("Dispatch() matched %q, expected %q", name, tt.expected)
+			}
+			if result.Service != tt.expected || result.Matched != (tt.expected != "") {
+				t.Errorf("Dispatch() result = %+v, expected service %q", result, tt.expected)
+			}
+			for i, p := range processors {
+				if got := p.processed.Load(); got != tt.wantProcessed[i] {
+					t.Errorf("Processor %s processed %d emails, expected %d", p.name, got, tt.wantProcessed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMayMatch(t *testing.T) {
+	generic := NewGenericEmailProcessor("perplexity", config.ServiceProcessorConfig{
+		EmailFrom:    []string{"team@perplexity.ai"},
+		EmailSubject: []string{"Sign in"},
+		BodyContains: []string{"code"},
+	}, nil, zap.NewNop())
+
+	tests := []struct {
+		name       string
+		email      models.Email
+		processors []models.EmailProcessor
+		expected   bool
+	}{
+		{"Sender and subject match, body not checked", models.Email{From: "team@perplexity.ai", Subject: "Sign in"}, []models.EmailProcessor{generic}, true},
+		{"Subject does not match", models.Email{From: "team@perplexity.ai", Subject: "Newsletter"}, []models.EmailProcessor{generic}, false},
+		{"Sender does not match", models.Email{From: "other@example.com", Subject: "Sign in"}, []models.EmailProcessor{generic}, false},
+		{"Processor without header matching needs the body", models.Email{From: "other@example.com"}, []models.EmailProcessor{generic, &stubProcessor{sender: "x@example.com"}}, true},
+		{"No processors", models.Email{From: "team@perplexity.ai", Subject: "Sign in"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MayMatch(tt.email, tt.processors); got != tt.expected {
+				t.Errorf("MayMatch() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessEmailsConcurrentlyOnProcessed(t *testing.T) {
+	ok := &stubProcessor{name: "ok", sender: "codes@example.com"}
+	failing := &stubProcessor{name: "failing", sender: "alerts@example.com", err: errors.New("telegram down")}
+	mgr := &Manager{processors: []models.EmailProcessor{ok, failing}, logger: zap.NewNop()}
+
+	var mu sync.Mutex
+	var done []string
+	mgr.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "codes@example.com"},
+		{From: "alerts@example.com"},
+		{From: "nobody@example.com"},
+	}, func(processor models.EmailProcessor, email models.Email) {
+		mu.Lock()
+		defer mu.Unlock()
+		done = append(done, processorName(processor))
+	})
+
+	// Only successfully processed emails get follow-up such as mark as read
+	if len(done) != 1 || done[0] != "ok" {
+		t.Errorf("onProcessed called for %v, expected only ok", done)
+	}
+	if ok.processed.Load() != 1 || failing.processed.Load() != 1 {
+		t.Errorf("Processed %d and %d emails, expected 1 each", ok.processed.Load(), failing.processed.Load())
+	}
+}
+
+// slowProcessor records how many emails it processes at the same time
+type slowProcessor struct {
+	stubProcessor
+	active atomic.Int32
+	peak   atomic.Int32
+}
+
+func (p *slowProcessor) Process(ctx context.Context, email models.Email) error {
+	active := p.active.Add(1)
+	defer p.active.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if active <= peak || p.peak.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return p.stubProcessor.Process(ctx, email)
+}
+
+func TestProcessEmailsConcurrentlyLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		expected    int32
+	}{
+		{"Configured", 2, 2},
+		{"Default", 0, defaultConcurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, err := NewProcessorManager(config.EmailConfig{MaxConcurrency: tt.concurrency}, Notifiers{}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+			}
+			proc := &slowProcessor{stubProcessor: stubProcessor{name: "slow", sender: "codes@example.com"}}
+			mgr.processors = []models.EmailProcessor{proc}
+
+			emails := make([]models.Email, 20)
+			for i := range emails {
+				emails[i] = models.Email{From: "codes@example.com"}
+			}
+			mgr.ProcessEmailsConcurrently(context.Background(), emails, nil)
+
+			if got := proc.processed.Load(); got != int32(len(emails)) {
+				t.Errorf("Processed %d emails, expected %d", got, len(emails))
+			}
+			if got := proc.peak.Load(); got > tt.expected {
+				t.Errorf("Peak concurrency = %d, expected at most %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessEmailsConcurrentlyCanceledWhileWaiting(t *testing.T) {
+	mgr, err := NewProcessorManager(config.EmailConfig{MaxConcurrency: 1}, Notifiers{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+	proc := &stubProcessor{name: "ok", sender: "codes@example.com"}
+	mgr.processors = []models.EmailProcessor{proc}
+
+	// Hold the only slot, so the emails wait until the context is canceled
+	mgr.slots <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	mgr.ProcessEmailsConcurrently(ctx, []models.Email{{From: "codes@example.com"}, {From: "codes@example.com"}}, nil)
+
+	if got := proc.processed.Load(); got != 0 {
+		t.Errorf("Processed %d emails after cancellation, expected 0", got)
+	}
+}
+
+func TestManagerDescribe(t *testing.T) {
+	emailCfg := config.EmailConfig{
+		DefaultPatterns: map[string]string{"github": `\b\d{8}\b`},
+		Services: []config.ServiceConfig{
+			{
+				Name: "github",
+				Config: config.ServiceProcessorConfig{
+					EmailFrom:      []string{"noreply@github.com"},
+					EmailSubject:   []string{"Your GitHub launch code"},
+					TelegramChatID: "123",
+				},
+			},
+			{
+				Name:     "cloudflare",
+				Priority: 10,
+				Config: config.ServiceProcessorConfig{
+					EmailFrom:      []string{"noreply@notify.cloudflare.com"},
+					FromMatch:      config.FromMatchExact,
+					EmailSubject:   []string{`^Login code`},
+					SubjectMatch:   config.SubjectMatchRegex,
+					TelegramChatID: "123",
+					CodePattern:    `\b\d{6}\b`,
+				},
+			},
+			{
+				Name: "broken",
+				Config: config.ServiceProcessorConfig{
+					EmailFrom:      []string{"noreply@example.com"},
+					EmailSubject:   []string{"Code"},
+					TelegramChatID: "123",
+					CodePattern:    "([",
+				},
+			},
+		},
+	}
+	mgr, err := NewProcessorManager(emailCfg, Notifiers{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+
+	infos := mgr.Describe()
+	if len(infos) != 3 {
+		t.Fatalf("Describe() returned %d processors, expected 3", len(infos))
+	}
+
+	// Priority order, the order emails are matched in
+	cloudflare, github, broken := infos[0], infos[1], infos[2]
+	if cloudflare.Name != "cloudflare" || github.Name != "github" || broken.Name != "broken" {
+		t.Fatalf("Describe() order = %s, %s, %s, expected cloudflare, github, broken", cloudflare.Name, github.Name, broken.Name)
+	}
+	if cloudflare.Type != DefaultType || cloudflare.Priority != 10 || cloudflare.FromMatch != config.FromMatchExact || cloudflare.SubjectMatch != config.SubjectMatchRegex {
+		t.Errorf("cloudflare = %+v, expected generic, priority 10, exact from, regex subject", cloudflare)
+	}
+	if cloudflare.CodePattern != `\b\d{6}\b` || cloudflare.CodePatternSource != "custom" || !cloudflare.MarkAsRead {
+		t.Errorf("cloudflare pattern = %q (%s), mark_as_read = %v, expected the custom pattern and true",
+			cloudflare.CodePattern, cloudflare.CodePatternSource, cloudflare.MarkAsRead)
+	}
+	if github.CodePattern != `\b\d{8}\b` || github.CodePatternSource != "default" || github.MarkAsRead {
+		t.Errorf("github pattern = %q (%s), mark_as_read = %v, expected the configured default and false",
+			github.CodePattern, github.CodePatternSource, github.MarkAsRead)
+	}
+	if github.FromMatch != config.FromMatchContains || github.Notifier != config.NotifierTelegram {
+		t.Errorf("github from_match = %q, notifier = %q, expected the defaults", github.FromMatch, github.Notifier)
+	}
+	// An invalid code_pattern falls back to the generic default
+	if broken.CodePatternSource != "default" || broken.CodePattern == "([" {
+		t.Errorf("broken pattern = %q (%s), expected the generic default", broken.CodePattern, broken.CodePatternSource)
+	}
+}
+
+func TestManagerAudit(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	mgr, err := NewProcessorManager(config.EmailConfig{
+		Services: []config.ServiceConfig{{Name: "github", Config: config.ServiceProcessorConfig{
+			EmailFrom:       []string{"noreply@github.com"},
+			EmailSubject:    []string{"code"},
+			TelegramChatID:  "123",
+			TelegramMessage: "%s",
+			CodePattern:     `\b\d{6}\b`,
+		}}},
+	}, Notifiers{Telegram: client}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+	mgr.SetAudit(zap.New(core))
+
+	mgr.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "noreply@github.com", Subject: "Your code", TextPlain: "123456"},
+		{From: "other@example.com", Subject: "Newsletter"},
+		// Matched, but no code is found and notify_on_failure is off, so nothing is sent
+		{From: "noreply@github.com", Subject: "Your code", TextPlain: "Welcome aboard"},
+	}, nil)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 audit line for the forwarded code, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	expected := map[string]any{
+		"service":  "github",
+		"from":     "noreply@github.com",
+		"code":     "1***6",
+		"success":  true,
+		"notifier": "telegram",
+		"target":   "123",
+	}
+	for key, want := range expected {
+		if fields[key] != want {
+			t.Errorf("Audit field %s = %v, expected %v", key, fields[key], want)
+		}
+	}
 }
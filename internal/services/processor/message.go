@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// codeMessage is the data a service's telegram_message template is rendered
+// with. The text fields are escaped for the notifier's parse mode.
+type codeMessage struct {
+	Service string
+	Code    string
+	From    string
+	Subject string
+	Now     time.Time
+}
+
+// messageFuncs are the helpers available to telegram_message templates
+var messageFuncs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": truncateRunes,
+}
+
+// parseCodeMessage parses a service's telegram_message. Messages without
+// template actions that use %s are the original Sprintf format and return nil.
+func parseCodeMessage(name, message string) (*template.Template, error) {
+	if isLegacyFormat(message) {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Funcs(messageFuncs).Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telegram_message template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// truncateRunes keeps the first n characters of s, for {{.Subject | truncate 30}}
+func truncateRunes(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
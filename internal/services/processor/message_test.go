@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+func TestGenericProcessorMessageTemplate(t *testing.T) {
+	email := models.Email{
+		From:      "noreply@github.com",
+		Subject:   "[GitHub] Please verify your device",
+		TextPlain: "Verification code: abc123",
+	}
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{"Legacy Sprintf format", "Code: %s", "Code: abc123"},
+		{"Template fields", "{{.Service}} code {{.Code}} from {{.From}}", `git\_hub code abc123 from noreply@github.com`},
+		{"Helpers", "{{.Code | upper}} {{.Subject | truncate 8}}", "ABC123 [GitHub]"},
+		{"Timestamp", "{{.Now.Year}}", strconv.Itoa(time.Now().Year())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &fakeNotifier{}
+			p := NewGenericEmailProcessor("git_hub", config.ServiceProcessorConfig{
+				EmailFrom:       []string{"noreply@github.com"},
+				TelegramMessage: tt.message,
+				CodePattern:     `\b[a-z]{3}\d{3}\b`,
+			}, notifier, zap.NewNop())
+
+			if err := p.Process(context.Background(), email); err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+			if len(notifier.messages) != 1 || notifier.messages[0] != tt.expected {
+				t.Errorf("Process() sent %q, expected %q", notifier.messages, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenericProcessorInvalidMessageTemplate(t *testing.T) {
+	service := config.ServiceConfig{Name: "github", Config: config.ServiceProcessorConfig{
+		EmailFrom:       []string{"noreply@github.com"},
+		TelegramMessage: "Code: {{.Code | shout}}",
+	}}
+
+	if _, err := newGenericProcessor(service, nil, &fakeNotifier{}, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "telegram_message") {
+		t.Errorf("newGenericProcessor() error = %v, expected an invalid telegram_message error", err)
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		n        int
+		s        string
+		expected string
+	}{
+		{3, "código", "cód"},
+		{10, "short", "short"},
+		{-1, "negative", "negative"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateRunes(tt.n, tt.s); got != tt.expected {
+			t.Errorf("truncateRunes(%d, %q) = %q, expected %q", tt.n, tt.s, got, tt.expected)
+		}
+	}
+}
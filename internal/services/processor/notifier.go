@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+	"automation-hub/internal/services/discord"
+	"automation-hub/internal/services/gotify"
+	"automation-hub/internal/services/telegram"
+	"automation-hub/internal/services/webhook"
+)
+
+// Notifier delivers a message to a target of its backend: a Telegram chat ID or
+// alias, a Discord webhook alias or URL, a notify_webhooks alias or a Gotify
+// message title. Escape makes
+// interpolated values literal in the backend's markup.
+type Notifier interface {
+	SendMessageContext(ctx context.Context, target, message string) error
+	Escape(text string) string
+}
+
+// documentSender is implemented by notifiers that can forward attachments
+type documentSender interface {
+	SendDocumentContext(ctx context.Context, target string, attachment models.Attachment, caption string) error
+}
+
+// codeSender is implemented by notifiers that take the code as structured data
+// instead of the formatted telegram_message
+type codeSender interface {
+	SendCodeContext(ctx context.Context, target string, notification models.CodeNotification) error
+}
+
+// requestSender is implemented by notifiers that honor the per-service Telegram
+// send options, disable_notification and reply_to_message_id
+type requestSender interface {
+	Send(ctx context.Context, req telegram.SendRequest) ([]telegram.SendResult, error)
+}
+
+// pushSender is implemented by notifiers that take a title and a priority with
+// each message, see gotify_priority
+type pushSender interface {
+	SendPushContext(ctx context.Context, msg gotify.Message) error
+}
+
+// Notifiers are the backends services choose from with `notifier`
+type Notifiers struct {
+	Telegram *telegram.Client
+	Discord  *discord.Client
+	Webhook  *webhook.Client
+	Gotify   *gotify.Client
+}
+
+// get returns the backend named by a service's notifier, Telegram by default
+func (n Notifiers) get(name string) (Notifier, error) {
+	switch name {
+	case "", config.NotifierTelegram:
+		return n.Telegram, nil
+	case config.NotifierDiscord:
+		return n.Discord, nil
+	case config.NotifierWebhook:
+		return n.Webhook, nil
+	case config.NotifierGotify:
+		return n.Gotify, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", name)
+}
+
+// notifyTarget is where a service's messages go on its notifier
+func notifyTarget(cfg config.ServiceProcessorConfig) string {
+	switch cfg.Notifier {
+	case config.NotifierDiscord:
+		return cfg.DiscordWebhook
+	case config.NotifierWebhook:
+		return cfg.NotifyWebhook
+	case config.NotifierGotify:
+		// A single server and app token, messages are titled with the service name
+		return ""
+	}
+	return cfg.TelegramChatID
+}
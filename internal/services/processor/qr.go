@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // image decoders for QR attachments
+	_ "image/jpeg"
+	_ "image/png"
+	"regexp"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+
+	"automation-hub/internal/models"
+)
+
+var errNoQRCode = errors.New("no image attachment with a QR code")
+
+// decodeQRAttachments returns the content of the first QR code found in the
+// image attachments, joining the reason every image failed otherwise
+func decodeQRAttachments(attachments []models.Attachment) (string, error) {
+	var errs []error
+	for _, attachment := range attachments {
+		if !strings.HasPrefix(strings.ToLower(attachment.MIMEType), "image/") {
+			continue
+		}
+		text, err := decodeQR(attachment.Data)
+		if err == nil {
+			return text, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", attachment.Filename, err))
+	}
+	if len(errs) == 0 {
+		return "", errNoQRCode
+	}
+	return "", errors.Join(errs...)
+}
+
+func decodeQR(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode QR code: %w", err)
+	}
+	return result.GetText(), nil
+}
+
+// codeFromQR returns otpauth:// URIs as-is, otherwise the code the pattern finds
+// in the QR content
+func codeFromQR(pattern *regexp.Regexp, text string) (string, bool) {
+	if strings.HasPrefix(strings.ToLower(text), "otpauth://") {
+		return text, true
+	}
+	return matchCode(pattern, text)
+}
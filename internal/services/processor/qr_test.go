@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// qrPNG renders contents as a QR code PNG
+func qrPNG(t *testing.T, contents string) []byte {
+	t.Helper()
+
+	matrix, err := qrcode.NewQRCodeWriter().EncodeWithoutHint(contents, gozxing.BarcodeFormat_QR_CODE, 200, 200)
+	if err != nil {
+		t.Fatalf("Failed to encode QR code: %v", err)
+	}
+	img := image.NewGray(image.Rect(0, 0, matrix.GetWidth(), matrix.GetHeight()))
+	for y := 0; y < matrix.GetHeight(); y++ {
+		for x := 0; x < matrix.GetWidth(); x++ {
+			if !matrix.Get(x, y) {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeQRAttachments(t *testing.T) {
+	uri := "otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example"
+
+	tests := []struct {
+		name        string
+		attachments []models.Attachment
+		expected    string
+		wantErr     bool
+	}{
+		{"QR image", []models.Attachment{
+			{Filename: "invoice.pdf", MIMEType: "application/pdf", Data: []byte("%PDF")},
+			{Filename: "qr.png", MIMEType: "image/png", Data: qrPNG(t, uri)},
+		}, uri, false},
+		{"Broken image", []models.Attachment{{Filename: "qr.png", MIMEType: "image/png", Data: []byte("nope")}}, "", true},
+		{"No images", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeQRAttachments(tt.attachments)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeQRAttachments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("decodeQRAttachments() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCodeFromQR(t *testing.T) {
+	pattern := regexp.MustCompile(`\b\d{6}\b`)
+
+	tests := []struct {
+		text     string
+		expected string
+		ok       bool
+	}{
+		{"otpauth://totp/Example?secret=ABC", "otpauth://totp/Example?secret=ABC", true},
+		{"Your code is 123456", "123456", true},
+		{"https://example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := codeFromQR(pattern, tt.text)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("codeFromQR(%q) = %s, %v, expected %s, %v", tt.text, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestQRCodeFallsBackToText(t *testing.T) {
+	cfg := config.ServiceProcessorConfig{
+		EmailFrom:   []string{"test@example.com"},
+		CodePattern: `\b\d{6}\b`,
+		DecodeQR:    true,
+	}
+	p := NewGenericEmailProcessor("default", cfg, nil, zap.NewNop())
+
+	withQR := models.Email{Attachments: []models.Attachment{
+		{Filename: "qr.png", MIMEType: "image/png", Data: qrPNG(t, "code 654321")},
+	}}
+	if got := p.qrCode(withQR); got != "654321" {
+		t.Errorf("qrCode() = %s, expected 654321", got)
+	}
+	if got := p.qrCode(models.Email{TextPlain: "Your code is 123456"}); got != "" {
+		t.Errorf("qrCode() = %s, expected fallback to text extraction", got)
+	}
+
+	p.config.DecodeQR = false
+	if got := p.qrCode(withQR); got != "" {
+		t.Errorf("qrCode() = %s, expected nothing without decode_qr", got)
+	}
+}
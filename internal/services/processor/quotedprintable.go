@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+
+	"automation-hub/internal/models"
+)
+
+// qpPartHeader finds a MIME part declaring quoted-printable inside a multipart body
+var qpPartHeader = regexp.MustCompile(`(?im)^content-transfer-encoding:[ \t]*quoted-printable[ \t]*\r?$`)
+
+// isQuotedPrintable reports whether the email text is quoted-printable, going by
+// the Content-Transfer-Encoding of the text part or, for multipart bodies, of
+// the part headers. Plain text that merely contains "=" is not.
+func isQuotedPrintable(email models.Email) bool {
+	if strings.EqualFold(email.TransferEncoding, "quoted-printable") {
+		return true
+	}
+	return qpPartHeader.MatchString(email.TextPlain)
+}
+
+// decodeBody returns the email text with quoted-printable decoded when declared
+func decodeBody(email models.Email) string {
+	if !isQuotedPrintable(email) {
+		return email.TextPlain
+	}
+	return decodeQuotedPrintable(email.TextPlain)
+}
+
+// decodeQuotedPrintable decodes =XX escapes and soft line breaks (=\r\n, =\n,
+// with optional trailing whitespace). Unlike mime/quotedprintable it never gives
+// up: invalid sequences such as "=ZZ" or a lone "=" are kept as they are, so
+// one bad escape doesn't leave the whole body encoded.
+func decodeQuotedPrintable(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	for i := 0; i < len(text); i++ {
+		if text[i] != '=' {
+			b.WriteByte(text[i])
+			continue
+		}
+
+		// Soft line break, possibly padded with spaces or tabs
+		j := i + 1
+		for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+			j++
+		}
+		if j < len(text) && text[j] == '\n' {
+			i = j
+			continue
+		}
+		if j+1 < len(text) && text[j] == '\r' && text[j+1] == '\n' {
+			i = j + 1
+			continue
+		}
+
+		if i+2 < len(text) {
+			hi, okHi := unhex(text[i+1])
+			lo, okLo := unhex(text[i+2])
+			if okHi && okLo {
+				b.WriteByte(hi<<4 | lo)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte('=')
+	}
+	return b.String()
+}
+
+// unhex decodes one hex digit, accepting lowercase as some senders emit it
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"testing"
+
+	"automation-hub/internal/models"
+)
+
+func TestDecodeQuotedPrintable(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Encoded characters", "Hello=20World=21", "Hello World!"},
+		{"Plain text unchanged", "Hello World", "Hello World"},
+		{"Soft line break", "Your code is 12=\n3456", "Your code is 123456"},
+		{"Soft line break with CRLF", "Your code is 12=\r\n3456", "Your code is 123456"},
+		{"Soft line break with trailing whitespace", "Your code is 12= \t\r\n3456", "Your code is 123456"},
+		{"UTF-8 bytes", "Inicie sesi=C3=B3n", "Inicie sesión"},
+		{"Lowercase hex", "sesi=c3=b3n", "sesión"},
+		{"Invalid escape kept", "a=ZZ b", "a=ZZ b"},
+		{"Invalid escape does not stop decoding", "a=ZZ c=C3=B3digo 123=\r\n456", "a=ZZ código 123456"},
+		{"Half escape kept", "a=4 b", "a=4 b"},
+		{"Trailing equals kept", "a=", "a="},
+		{"Equals before text kept", "x == y", "x == y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeQuotedPrintable(tt.input); got != tt.expected {
+				t.Errorf("decodeQuotedPrintable() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    models.Email
+		expected string
+	}{
+		{
+			name:     "Declared by the text part",
+			email:    models.Email{TextPlain: "code=3D123456", TransferEncoding: "Quoted-Printable"},
+			expected: "code=123456",
+		},
+		{
+			name:     "Declared by a multipart part header",
+			email:    models.Email{TextPlain: "--b1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\ncode=3D123456"},
+			expected: "--b1\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\ncode=123456",
+		},
+		{
+			name:     "Not declared",
+			email:    models.Email{TextPlain: "code=3D123456 is not =C3=B3 decoded"},
+			expected: "code=3D123456 is not =C3=B3 decoded",
+		},
+		{
+			name:     "Other encoding",
+			email:    models.Email{TextPlain: "code=3D123456", TransferEncoding: "8bit"},
+			expected: "code=3D123456",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeBody(tt.email); got != tt.expected {
+				t.Errorf("decodeBody() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
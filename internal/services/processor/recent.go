@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"sync"
+	"time"
+
+	"automation-hub/internal/logging"
+	"automation-hub/internal/models"
+)
+
+// DefaultRecentEvents is how many events GET /admin/recent keeps when
+// server.recent_events is unset
+const DefaultRecentEvents = 50
+
+// Outcomes of a processing Event
+const (
+	OutcomeProcessed = "processed" // a notifier accepted the code or attachments
+	OutcomeSkipped   = "skipped"   // matched but nothing sent, see Event.Reason
+	OutcomeFailed    = "failed"
+	OutcomeIgnored   = "ignored" // no processor matched
+)
+
+// Event is an email that went through the dispatch path, for GET /admin/recent
+type Event struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account,omitempty"` // see config.EmailConfig.AccountName
+	Service string    `json:"service,omitempty"`
+	Subject string    `json:"subject"`
+	From    string    `json:"from"`
+	Code    string    `json:"code,omitempty"` // masked, see logging.MaskCode
+	Outcome string    `json:"outcome"`
+	Reason  string    `json:"reason,omitempty"` // why a skipped email was not sent: stale, cooldown or no_code
+	Error   string    `json:"error,omitempty"`
+}
+
+// Recent keeps the last events in a fixed-size ring buffer. It outlives config
+// reloads, each new Manager is given the same one.
+type Recent struct {
+	mu     sync.Mutex
+	events []Event
+	next   int // slot the next event is written to
+	full   bool
+}
+
+// NewRecent keeps the last size events, DefaultRecentEvents when size is 0
+func NewRecent(size int) *Recent {
+	if size <= 0 {
+		size = DefaultRecentEvents
+	}
+	return &Recent{events: make([]Event, size)}
+}
+
+// Add records an event, overwriting the oldest once the buffer is full. A nil
+// Recent records nothing.
+func (r *Recent) Add(event Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Events returns the recorded events, newest first
+func (r *Recent) Events() []Event {
+	if r == nil {
+		return []Event{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.events)
+	}
+	events := make([]Event, 0, n)
+	for i := 1; i <= n; i++ {
+		events = append(events, r.events[(r.next-i+len(r.events))%len(r.events)])
+	}
+	return events
+}
+
+// newEvent describes the result of Dispatch, with the code masked
+func newEvent(email models.Email, result models.ProcessingResult, err error) Event {
+	event := Event{
+		Time:    time.Now(),
+		Subject: email.Subject,
+		From:    email.From,
+		Outcome: OutcomeProcessed,
+	}
+	if !result.Matched {
+		event.Outcome = OutcomeIgnored
+		return event
+	}
+
+	event.Service = result.Service
+	switch {
+	case err != nil:
+		event.Outcome = OutcomeFailed
+		event.Error = err.Error()
+	case !result.Sent:
+		event.Outcome = OutcomeSkipped
+		event.Reason = result.Skipped
+	}
+	if result.Code != "" {
+		event.Code = logging.MaskCode(result.Code)
+	}
+	return event
+}
@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+func TestRecent(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		added    int
+		expected []string // subjects, newest first
+	}{
+		{"Empty", 3, 0, []string{}},
+		{"Partly filled", 3, 2, []string{"2", "1"}},
+		{"Oldest overwritten", 3, 5, []string{"5", "4", "3"}},
+		{"Default size", 0, 1, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recent := NewRecent(tt.size)
+			for i := 1; i <= tt.added; i++ {
+				recent.Add(Event{Subject: string(rune('0' + i))})
+			}
+
+			events := recent.Events()
+			if len(events) != len(tt.expected) {
+				t.Fatalf("Events() returned %d events, expected %d", len(events), len(tt.expected))
+			}
+			for i, event := range events {
+				if event.Subject != tt.expected[i] {
+					t.Errorf("Events()[%d] = %q, expected %q", i, event.Subject, tt.expected[i])
+				}
+			}
+		})
+	}
+
+	var disabled *Recent
+	disabled.Add(Event{})
+	if events := disabled.Events(); events == nil || len(events) != 0 {
+		t.Errorf("Events() on nil = %v, expected an empty list", events)
+	}
+}
+
+// switchNotifier fails while err is set
+type switchNotifier struct {
+	fakeNotifier
+	err error
+}
+
+func (n *switchNotifier) SendMessageContext(ctx context.Context, target, message string) error {
+	if n.err != nil {
+		return n.err
+	}
+	return n.fakeNotifier.SendMessageContext(ctx, target, message)
+}
+
+func TestManagerRecordsRecentEvents(t *testing.T) {
+	notifier := &switchNotifier{}
+	cloudflare := NewGenericEmailProcessor("cloudflare", config.ServiceProcessorConfig{
+		EmailFrom:       []string{"noreply@notify.cloudflare.com"},
+		EmailSubject:    []string{"Verification"},
+		TelegramMessage: "Code: %s",
+	}, notifier, zap.NewNop())
+	manager := &Manager{processors: []models.EmailProcessor{cloudflare}, logger: zap.NewNop()}
+	recent := NewRecent(10)
+	manager.SetRecent(recent)
+
+	manager.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "noreply@notify.cloudflare.com", Subject: "Verification", TextPlain: "Your code is 123456"},
+	}, nil)
+	manager.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "news@example.com", Subject: "Weekly"},
+	}, nil)
+	manager.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "noreply@notify.cloudflare.com", Subject: "Verification", TextPlain: "Welcome aboard"},
+	}, nil)
+	notifier.err = errors.New("telegram down")
+	manager.ProcessEmailsConcurrently(context.Background(), []models.Email{
+		{From: "noreply@notify.cloudflare.com", Subject: "Verification", TextPlain: "Your code is 654321"},
+	}, nil)
+
+	events := recent.Events()
+	expected := []Event{
+		{Service: "cloudflare", Subject: "Verification", From: "noreply@notify.cloudflare.com", Code: "6***1", Outcome: OutcomeFailed, Error: "telegram down"},
+		{Service: "cloudflare", Subject: "Verification", From: "noreply@notify.cloudflare.com", Outcome: OutcomeSkipped, Reason: SkippedNoCode},
+		{Subject: "Weekly", From: "news@example.com", Outcome: OutcomeIgnored},
+		{Service: "cloudflare", Subject: "Verification", From: "noreply@notify.cloudflare.com", Code: "1***6", Outcome: OutcomeProcessed},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Recorded %d events, expected %d: %+v", len(events), len(expected), events)
+	}
+	for i, event := range events {
+		if event.Time.IsZero() {
+			t.Errorf("Event %d has no time", i)
+		}
+		event.Time = expected[i].Time
+		if event != expected[i] {
+			t.Errorf("Event %d = %+v, expected %+v", i, event, expected[i])
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// DefaultType is the processor type of services without a type
+const DefaultType = "generic"
+
+// Factory builds the email processor of a service. defaultPatterns is
+// email.default_patterns, for processors that pick a pattern by service name,
+// and notifier is the backend chosen by the service's notifier setting.
+type Factory func(service config.ServiceConfig, defaultPatterns map[string]string, notifier Notifier, logger *zap.Logger) (models.EmailProcessor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		DefaultType: newGenericProcessor,
+	}
+)
+
+// Register makes a processor type available to services with `type: name`. It is
+// meant to be called from init functions; a later call replaces the factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = factory
+}
+
+// Types returns the registered processor types, sorted
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// lookupFactory returns the factory of a processor type, "" meaning DefaultType
+func lookupFactory(kind string) (Factory, bool) {
+	if kind == "" {
+		kind = DefaultType
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[strings.ToLower(kind)]
+	return factory, ok
+}
+
+func newGenericProcessor(service config.ServiceConfig, defaultPatterns map[string]string, notifier Notifier, logger *zap.Logger) (models.EmailProcessor, error) {
+	processor := NewGenericEmailProcessorWithDefaults(service.Name, service.Config, defaultPatterns, notifier, logger)
+	if processor.messageErr != nil {
+		return nil, processor.messageErr
+	}
+	return processor, nil
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// trackingProcessor is a minimal non-generic processor used to exercise the registry
+type trackingProcessor struct {
+	service config.ServiceConfig
+}
+
+func (p *trackingProcessor) ShouldProcess(email models.Email) bool { return true }
+
+func (p *trackingProcessor) Process(ctx context.Context, email models.Email) error { return nil }
+
+func (p *trackingProcessor) GetSender() string { return "" }
+
+func (p *trackingProcessor) GetName() string { return p.service.Name }
+
+func TestRegistry(t *testing.T) {
+	Register("Tracking", func(service config.ServiceConfig, defaultPatterns map[string]string, notifier Notifier, logger *zap.Logger) (models.EmailProcessor, error) {
+		return &trackingProcessor{service: service}, nil
+	})
+	Register("broken", func(service config.ServiceConfig, defaultPatterns map[string]string, notifier Notifier, logger *zap.Logger) (models.EmailProcessor, error) {
+		return nil, errors.New("missing carrier")
+	})
+
+	if types := Types(); !slices.Contains(types, DefaultType) || !slices.Contains(types, "tracking") {
+		t.Errorf("Types() = %v, expected generic and tracking", types)
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		wantErr string
+		generic bool
+	}{
+		{"Empty type is generic", "", "", true},
+		{"Explicit generic", "generic", "", true},
+		{"Registered type, case-insensitive", "TRACKING", "", false},
+		{"Unknown type", "parcel", `unknown processor type "parcel"`, false},
+		{"Factory error", "broken", "missing carrier", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emailCfg := config.EmailConfig{
+				Services: []config.ServiceConfig{{Name: "svc", Type: tt.kind}},
+			}
+
+			mgr, err := NewProcessorManager(emailCfg, Notifiers{}, zap.NewNop())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewProcessorManager() error = %v, expected %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewProcessorManager() returned unexpected error: %v", err)
+			}
+
+			_, isGeneric := mgr.GetProcessors()[0].(*GenericEmailProcessor)
+			if isGeneric != tt.generic {
+				t.Errorf("Processor is %T, expected generic = %v", mgr.GetProcessors()[0], tt.generic)
+			}
+		})
+	}
+}
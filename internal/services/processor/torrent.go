@@ -1,7 +1,11 @@
 package processor
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
 
 	"go.uber.org/zap"
 
@@ -14,37 +18,108 @@ type TorrentProcessor struct {
 	telegram *telegram.Client
 	logger   *zap.Logger
 	config   *config.WebhookProcessorConfig
+	message  *template.Template
+	legacy   bool // message uses positional %s placeholders (name, path)
 }
 
-func NewTorrentProcessor(telegram *telegram.Client, webhookConfig *config.WebhookProcessorConfig, logger *zap.Logger) *TorrentProcessor {
-	return &TorrentProcessor{
+// torrentMessage is the data the message template is rendered with: the fields
+// of models.TorrentNotification, escaped, with a zero Size rendered as empty
+type torrentMessage struct {
+	TorrentName string
+	SavePath    string
+	Category    string
+	Size        string
+	Tracker     string
+	ContentPath string
+}
+
+// NewTorrentProcessor parses the configured message as a text/template with the
+// fields of models.TorrentNotification, e.g. {{.TorrentName}} and {{.SavePath}}.
+// Messages without template actions that still use %s are rendered with Sprintf.
+func NewTorrentProcessor(telegram *telegram.Client, webhookConfig *config.WebhookProcessorConfig, logger *zap.Logger) (*TorrentProcessor, error) {
+	processor := &TorrentProcessor{
 		telegram: telegram,
 		logger:   logger,
 		config:   webhookConfig,
 	}
+
+	if isLegacyFormat(webhookConfig.TelegramMessage) {
+		logger.Warn("Webhook message uses deprecated %s placeholders, use {{.TorrentName}} and {{.SavePath}} instead")
+		processor.legacy = true
+		return processor, nil
+	}
+
+	message, err := template.New("torrent").Parse(webhookConfig.TelegramMessage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent telegram_message template: %w", err)
+	}
+	processor.message = message
+
+	return processor, nil
 }
 
 // NewTorrentProcessorLegacy maintains compatibility with the existing code
 func NewTorrentProcessorLegacy(telegram *telegram.Client, chatID string, logger *zap.Logger) *TorrentProcessor {
-	return &TorrentProcessor{
-		telegram: telegram,
-		logger:   logger,
-		config: &config.WebhookProcessorConfig{
-			TelegramChatID: chatID,
-			TelegramMessage: `📥 **Download completed successfully!** 🎬
+	processor, _ := NewTorrentProcessor(telegram, &config.WebhookProcessorConfig{
+		TelegramChatID: chatID,
+		TelegramMessage: `📥 **Download completed successfully!** 🎬
 
 🔍 **Name:**  
-%s
+{{.TorrentName}}
 
 📍 **Path:**  
-%s`,
-		},
-	}
+{{.SavePath}}`,
+	}, logger)
+	return processor
 }
 
 func (p *TorrentProcessor) Process(notification models.TorrentNotification) error {
-	message := fmt.Sprintf(p.config.TelegramMessage, notification.TorrentName, notification.SavePath)
-	return p.telegram.SendMessage(p.config.TelegramChatID, message)
+	_, err := p.ProcessContext(context.Background(), notification)
+	return err
+}
+
+// ProcessContext renders and sends the message, giving up once ctx is done.
+// It returns the Telegram message sent to each chat.
+func (p *TorrentProcessor) ProcessContext(ctx context.Context, notification models.TorrentNotification) ([]telegram.SendResult, error) {
+	message, err := p.Render(notification)
+	if err != nil {
+		return nil, err
+	}
+	return p.telegram.Send(ctx, telegram.SendRequest{
+		ChatID:              p.config.TelegramChatID,
+		Text:                message,
+		DisableNotification: p.config.DisableNotification,
+		ReplyToMessageID:    p.config.ReplyToMessageID,
+	})
+}
+
+// Render formats the notification message. Name and path are escaped for the
+// configured parse mode since they often contain underscores.
+func (p *TorrentProcessor) Render(notification models.TorrentNotification) (string, error) {
+	data := torrentMessage{
+		TorrentName: p.telegram.Escape(notification.TorrentName),
+		SavePath:    p.telegram.Escape(notification.SavePath),
+		Category:    p.telegram.Escape(notification.Category),
+		Tracker:     p.telegram.Escape(notification.Tracker),
+		ContentPath: p.telegram.Escape(notification.ContentPath),
+	}
+	if notification.Size > 0 {
+		data.Size = strconv.FormatInt(notification.Size, 10)
+	}
+
+	if p.legacy {
+		return fmt.Sprintf(p.config.TelegramMessage, data.TorrentName, data.SavePath), nil
+	}
+
+	var sb strings.Builder
+	if err := p.message.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render torrent message: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func isLegacyFormat(message string) bool {
+	return !strings.Contains(message, "{{") && strings.Contains(message, "%s")
 }
 
 // GetWebhookConfig searches for the configuration of a specific webhook by name
@@ -1,13 +1,40 @@
 package processor
 
 import (
+	"context"
 	"testing"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
 
 	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+	"automation-hub/internal/services/telegram"
 )
 
+// recordingSender stands in for the Bot API and keeps every message sent
+type recordingSender struct {
+	sent []tgbotapi.MessageConfig
+}
+
+func (s *recordingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if msg, ok := c.(tgbotapi.MessageConfig); ok {
+		s.sent = append(s.sent, msg)
+	}
+	return tgbotapi.Message{MessageID: len(s.sent)}, nil
+}
+
+// newRecordingClient returns a plain-text Telegram client backed by a recordingSender
+func newRecordingClient(t *testing.T) (*telegram.Client, *recordingSender) {
+	t.Helper()
+	sender := &recordingSender{}
+	client, err := telegram.NewClientWithSender(config.TelegramConfig{}, sender, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewClientWithSender() returned unexpected error: %v", err)
+	}
+	return client, sender
+}
+
 func TestNewTorrentProcessor(t *testing.T) {
 	logger := zap.NewNop()
 	webhookCfg := &config.WebhookProcessorConfig{
@@ -15,7 +42,10 @@ func TestNewTorrentProcessor(t *testing.T) {
 		TelegramMessage: "Done %s",
 	}
 
-	proc := NewTorrentProcessor(nil, webhookCfg, logger)
+	proc, err := NewTorrentProcessor(nil, webhookCfg, logger)
+	if err != nil {
+		t.Fatalf("NewTorrentProcessor() returned unexpected error: %v", err)
+	}
 	if proc == nil {
 		t.Fatal("Expected NewTorrentProcessor to return non-nil instance")
 	}
@@ -36,6 +66,106 @@ func TestNewTorrentProcessorLegacy(t *testing.T) {
 	}
 }
 
+func TestTorrentProcessorRender(t *testing.T) {
+	logger := zap.NewNop()
+	notification := models.TorrentNotification{
+		TorrentName: "Debian ISO",
+		SavePath:    "/downloads/iso",
+	}
+
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{
+			name:     "Named fields",
+			message:  "{{.TorrentName}} at {{.SavePath}}",
+			expected: "Debian ISO at /downloads/iso",
+		},
+		{
+			name:     "Reordered named fields",
+			message:  "{{.SavePath}} <- {{.TorrentName}}",
+			expected: "/downloads/iso <- Debian ISO",
+		},
+		{
+			name:     "Legacy positional format",
+			message:  "Downloaded: %s at %s",
+			expected: "Downloaded: Debian ISO at /downloads/iso",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proc, err := NewTorrentProcessor(nil, &config.WebhookProcessorConfig{TelegramMessage: tt.message}, logger)
+			if err != nil {
+				t.Fatalf("NewTorrentProcessor() returned unexpected error: %v", err)
+			}
+			got, err := proc.Render(notification)
+			if err != nil {
+				t.Fatalf("Render() returned unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Render() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTorrentProcessorRenderOptionalFields(t *testing.T) {
+	logger := zap.NewNop()
+	message := "{{.TorrentName}} [{{.Category}}] {{.Size}} from {{.Tracker}} in {{.ContentPath}}"
+	proc, err := NewTorrentProcessor(nil, &config.WebhookProcessorConfig{TelegramMessage: message}, logger)
+	if err != nil {
+		t.Fatalf("NewTorrentProcessor() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		notification models.TorrentNotification
+		expected     string
+	}{
+		{
+			name: "All fields",
+			notification: models.TorrentNotification{
+				TorrentName: "Debian ISO",
+				SavePath:    "/downloads",
+				Category:    "linux",
+				Size:        658505728,
+				Tracker:     "https://tracker.debian.org/announce",
+				ContentPath: "/downloads/debian.iso",
+			},
+			expected: "Debian ISO [linux] 658505728 from https://tracker.debian.org/announce in /downloads/debian.iso",
+		},
+		{
+			name:         "Missing optional fields render empty",
+			notification: models.TorrentNotification{TorrentName: "Debian ISO", SavePath: "/downloads"},
+			expected:     "Debian ISO []  from  in ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := proc.Render(tt.notification)
+			if err != nil {
+				t.Fatalf("Render() returned unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Render() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewTorrentProcessor_InvalidTemplate(t *testing.T) {
+	logger := zap.NewNop()
+	webhookCfg := &config.WebhookProcessorConfig{TelegramMessage: "{{.TorrentName"}
+
+	if _, err := NewTorrentProcessor(nil, webhookCfg, logger); err == nil {
+		t.Error("Expected error for invalid template, got nil")
+	}
+}
+
 func TestGetWebhookConfig(t *testing.T) {
 	cfg := &config.Config{
 		Hook: []config.WebhookConfig{
@@ -71,3 +201,54 @@ func TestGetWebhookConfig(t *testing.T) {
 		t.Errorf("Expected nil for non_existent webhook, got %v", nonExistentHook)
 	}
 }
+
+func TestTorrentProcessorProcess(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	proc, err := NewTorrentProcessor(client, &config.WebhookProcessorConfig{
+		TelegramChatID:  "123",
+		TelegramMessage: "{{.TorrentName}} saved to {{.SavePath}}",
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewTorrentProcessor() returned unexpected error: %v", err)
+	}
+
+	results, err := proc.ProcessContext(context.Background(), models.TorrentNotification{
+		TorrentName: "Debian ISO",
+		SavePath:    "/downloads/iso",
+	})
+	if err != nil {
+		t.Fatalf("ProcessContext() returned unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("Expected 1 message sent, got %d", len(sender.sent))
+	}
+	if got := sender.sent[0]; got.ChatID != 123 || got.Text != "Debian ISO saved to /downloads/iso" {
+		t.Errorf("Sent message = chat %d %q, expected chat 123 %q", got.ChatID, got.Text, "Debian ISO saved to /downloads/iso")
+	}
+	if len(results) != 1 || results[0].MessageID != 1 {
+		t.Errorf("ProcessContext() = %+v, expected message ID 1", results)
+	}
+}
+
+func TestTorrentProcessorSilent(t *testing.T) {
+	client, sender := newRecordingClient(t)
+	proc, err := NewTorrentProcessor(client, &config.WebhookProcessorConfig{
+		TelegramChatID:      "123",
+		TelegramMessage:     "{{.TorrentName}}",
+		DisableNotification: true,
+		ReplyToMessageID:    42,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewTorrentProcessor() returned unexpected error: %v", err)
+	}
+
+	if err := proc.Process(models.TorrentNotification{TorrentName: "Debian ISO"}); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("Expected 1 message sent, got %d", len(sender.sent))
+	}
+	if got := sender.sent[0]; !got.DisableNotification || got.ReplyToMessageID != 42 {
+		t.Errorf("Sent message = silent %v, reply to %d, expected silent reply to 42", got.DisableNotification, got.ReplyToMessageID)
+	}
+}
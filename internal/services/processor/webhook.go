@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/services/telegram"
+)
+
+// GenericWebhookProcessor renders the configured message as a text/template using
+// the decoded JSON payload of the webhook, e.g. {{.series.title}} for Sonarr.
+// Payload values can be escaped for the configured parse mode with {{escape .series.title}}.
+type GenericWebhookProcessor struct {
+	name     string
+	telegram *telegram.Client
+	logger   *zap.Logger
+	config   *config.WebhookProcessorConfig
+	message  *template.Template
+}
+
+func NewGenericWebhookProcessor(name string, telegram *telegram.Client, webhookConfig *config.WebhookProcessorConfig, logger *zap.Logger) (*GenericWebhookProcessor, error) {
+	message, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{"escape": func(v interface{}) string {
+			if v == nil {
+				return ""
+			}
+			return telegram.Escape(fmt.Sprint(v))
+		}}).
+		Parse(webhookConfig.TelegramMessage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telegram_message template for webhook %s: %w", name, err)
+	}
+
+	return &GenericWebhookProcessor{
+		name:     name,
+		telegram: telegram,
+		logger:   logger,
+		config:   webhookConfig,
+		message:  message,
+	}, nil
+}
+
+func (p *GenericWebhookProcessor) Process(payload map[string]interface{}) error {
+	_, err := p.ProcessContext(context.Background(), payload)
+	return err
+}
+
+// ProcessContext renders and sends the message, giving up once ctx is done.
+// It returns the Telegram message sent to each chat.
+func (p *GenericWebhookProcessor) ProcessContext(ctx context.Context, payload map[string]interface{}) ([]telegram.SendResult, error) {
+	message, err := p.Render(payload)
+	if err != nil {
+		return nil, err
+	}
+	return p.telegram.Send(ctx, telegram.SendRequest{
+		ChatID:              p.config.TelegramChatID,
+		Text:                message,
+		DisableNotification: p.config.DisableNotification,
+		ReplyToMessageID:    p.config.ReplyToMessageID,
+	})
+}
+
+// Render executes the message template against the payload
+func (p *GenericWebhookProcessor) Render(payload map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	if err := p.message.Execute(&sb, payload); err != nil {
+		return "", fmt.Errorf("failed to render message for webhook %s: %w", p.name, err)
+	}
+	return sb.String(), nil
+}
+
+func (p *GenericWebhookProcessor) GetName() string {
+	return p.name
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+)
+
+func TestGenericWebhookProcessorRender(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.WebhookProcessorConfig{
+		TelegramChatID:  "123",
+		TelegramMessage: "{{.eventType}}: {{.series.title}} S{{.episode.season}}",
+	}
+
+	p, err := NewGenericWebhookProcessor("sonarr", nil, cfg, logger)
+	if err != nil {
+		t.Fatalf("NewGenericWebhookProcessor() returned unexpected error: %v", err)
+	}
+	if p.GetName() != "sonarr" {
+		t.Errorf("Expected name sonarr, got %s", p.GetName())
+	}
+
+	payload := map[string]interface{}{
+		"eventType": "Download",
+		"series":    map[string]interface{}{"title": "Severance"},
+		"episode":   map[string]interface{}{"season": 2},
+	}
+	got, err := p.Render(payload)
+	if err != nil {
+		t.Fatalf("Render() returned unexpected error: %v", err)
+	}
+	if got != "Download: Severance S2" {
+		t.Errorf("Render() = %q, expected %q", got, "Download: Severance S2")
+	}
+
+	if err := p.Process(payload); err != nil {
+		t.Errorf("Process() with nil telegram client returned error: %v", err)
+	}
+}
+
+func TestNewGenericWebhookProcessor_InvalidTemplate(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := &config.WebhookProcessorConfig{TelegramMessage: "{{.series.title"}
+
+	if _, err := NewGenericWebhookProcessor("sonarr", nil, cfg, logger); err == nil {
+		t.Error("Expected error for invalid template, got nil")
+	}
+}
+
+func TestGenericWebhookProcessorEscapeFunc(t *testing.T) {
+	cfg := &config.WebhookProcessorConfig{
+		TelegramChatID:  "123",
+		TelegramMessage: "{{escape .series.title}} ({{escape .episode.season}}){{escape .missing}}",
+	}
+
+	p, err := NewGenericWebhookProcessor("sonarr", nil, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewGenericWebhookProcessor() returned unexpected error: %v", err)
+	}
+
+	got, err := p.Render(map[string]interface{}{
+		"series":  map[string]interface{}{"title": "Mr_Robot"},
+		"episode": map[string]interface{}{"season": 4},
+	})
+	if err != nil {
+		t.Fatalf("Render() returned unexpected error: %v", err)
+	}
+	// Without a client the text is sent as plain, so nothing is escaped
+	if got != "Mr_Robot (4)" {
+		t.Errorf("Render() = %q, expected %q", got, "Mr_Robot (4)")
+	}
+}
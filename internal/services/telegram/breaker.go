@@ -0,0 +1,166 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/metrics"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 60 * time.Second
+)
+
+// ErrCircuitOpen is returned by sends while Telegram is considered down
+var ErrCircuitOpen = errors.New("telegram circuit open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops sending while Telegram is unreachable. After threshold
+// consecutive network errors or 5xx responses it opens and sends fail at once
+// for cooldown. Then one send goes through as a probe: if Telegram answers the
+// circuit closes, otherwise it opens for another cooldown. A nil breaker never
+// opens.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     clock.Clock
+	logger    *zap.Logger
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	probing   bool // the half-open probe is in flight
+}
+
+// newCircuitBreaker returns nil, a disabled breaker, for a negative threshold
+func newCircuitBreaker(threshold int, cooldown time.Duration, clk clock.Clock, logger *zap.Logger) *circuitBreaker {
+	if threshold < 0 {
+		return nil
+	}
+	if threshold == 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	metrics.TelegramCircuitState.Set(float64(breakerClosed))
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, clock: clk, logger: logger}
+}
+
+// Allow returns ErrCircuitOpen while the circuit is open or another send is
+// probing it. Every allowed send must report its outcome with Success, Failure
+// or Release.
+func (b *circuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now := b.clock.Now(); now.Before(b.openUntil) {
+			return fmt.Errorf("%w after %d consecutive failures, retrying in %s", ErrCircuitOpen, b.failures, b.openUntil.Sub(now).Round(time.Second))
+		}
+		b.setState(breakerHalfOpen)
+		b.logger.Info("Telegram circuit half-open, probing with the next message")
+	case breakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w, probe in flight", ErrCircuitOpen)
+		}
+	}
+	b.probing = b.state == breakerHalfOpen
+	return nil
+}
+
+// Success records that Telegram answered, closing the circuit
+func (b *circuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+		b.logger.Info("Telegram circuit closed, sending again")
+	}
+}
+
+// Failure records that Telegram could not be reached and reports whether the
+// circuit is open now, in which case the send should not be retried
+func (b *circuitBreaker) Failure() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openUntil = b.clock.Now().Add(b.cooldown)
+		b.setState(breakerOpen)
+		b.logger.Error("Telegram circuit opened, failing sends fast",
+			zap.Int("consecutive_failures", b.failures),
+			zap.Duration("cooldown", b.cooldown))
+	}
+	return b.state == breakerOpen
+}
+
+// Release gives up an allowed send without an outcome, e.g. when its context
+// was canceled, so another send can probe
+func (b *circuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Err describes the circuit when it is not closed, for readiness checks
+func (b *circuitBreaker) Err() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerClosed {
+		return nil
+	}
+	return fmt.Errorf("%w (%s) after %d consecutive failures", ErrCircuitOpen, b.state, b.failures)
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	metrics.TelegramCircuitState.Set(float64(state))
+}
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Nil breaker never opens", func(t *testing.T) {
+		var b *circuitBreaker
+		if b.Failure() || b.Allow() != nil || b.Err() != nil {
+			t.Error("Expected a nil breaker to stay closed")
+		}
+	})
+
+	t.Run("Negative threshold disables the breaker", func(t *testing.T) {
+		if b := newCircuitBreaker(-1, 0, clock.Real, zap.NewNop()); b != nil {
+			t.Errorf("newCircuitBreaker(-1) = %+v, expected nil", b)
+		}
+	})
+
+	t.Run("Opens after consecutive failures and probes after the cooldown", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		b := newCircuitBreaker(3, time.Minute, clk, zap.NewNop())
+
+		b.Failure()
+		b.Failure()
+		b.Success()
+		if b.Failure() || b.Failure() {
+			t.Fatal("Expected a success to reset the failure count")
+		}
+		if !b.Failure() {
+			t.Fatal("Expected the third consecutive failure to open the circuit")
+		}
+		if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Allow() = %v, expected ErrCircuitOpen", err)
+		}
+		if err := b.Err(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Err() = %v, expected ErrCircuitOpen", err)
+		}
+
+		clk.Advance(time.Minute)
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() after the cooldown = %v, expected a probe", err)
+		}
+		if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Allow() during the probe = %v, expected ErrCircuitOpen", err)
+		}
+		if !b.Failure() {
+			t.Fatal("Expected a failed probe to open the circuit again")
+		}
+
+		clk.Advance(time.Minute)
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() after the second cooldown = %v, expected a probe", err)
+		}
+		b.Success()
+		if err := b.Allow(); err != nil {
+			t.Errorf("Allow() after a successful probe = %v, expected nil", err)
+		}
+		if err := b.Err(); err != nil {
+			t.Errorf("Err() = %v, expected nil once closed", err)
+		}
+	})
+
+	t.Run("Released probe lets another send probe", func(t *testing.T) {
+		clk := clock.NewFake(time.Now())
+		b := newCircuitBreaker(1, time.Minute, clk, zap.NewNop())
+		b.Failure()
+		clk.Advance(time.Minute)
+
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() = %v, expected a probe", err)
+		}
+		b.Release()
+		if err := b.Allow(); err != nil {
+			t.Errorf("Allow() after Release = %v, expected a probe", err)
+		}
+	})
+}
+
+func TestSendMessageCircuitBreaker(t *testing.T) {
+	t.Run("Outage opens the circuit and sends fail fast", func(t *testing.T) {
+		client, requests, clk := newTestClient(t, 3, http.StatusBadGateway,
+			`{"ok":false,"error_code":502,"description":"Bad Gateway"}`)
+		client.breaker = newCircuitBreaker(2, time.Minute, clk, zap.NewNop())
+
+		if err := client.SendMessage("123", "Hello"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("SendMessage() = %v, expected ErrCircuitOpen", err)
+		}
+		// The second failure opens the circuit, so the third attempt is not made
+		if *requests != 2 {
+			t.Errorf("Expected 2 requests, got %d", *requests)
+		}
+
+		if err := client.SendMessage("123", "Hello"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("SendMessage() = %v, expected ErrCircuitOpen", err)
+		}
+		if *requests != 2 {
+			t.Errorf("Expected no request while the circuit is open, got %d", *requests-2)
+		}
+		if err := client.Ping(); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Ping() = %v, expected ErrCircuitOpen", err)
+		}
+
+		// After the cooldown a single probe goes out and opens the circuit again
+		clk.Advance(time.Minute)
+		if err := client.SendMessage("123", "Hello"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("SendMessage() = %v, expected ErrCircuitOpen", err)
+		}
+		if *requests != 3 {
+			t.Errorf("Expected 1 probe request, got %d", *requests-2)
+		}
+	})
+
+	t.Run("Rejected messages do not open the circuit", func(t *testing.T) {
+		client, requests, clk := newTestClient(t, 3, http.StatusBadRequest,
+			`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+		client.breaker = newCircuitBreaker(1, time.Minute, clk, zap.NewNop())
+
+		for range 3 {
+			if err := client.SendMessage("123", "Hello"); err == nil || errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("SendMessage() = %v, expected the Telegram error", err)
+			}
+		}
+		if *requests != 3 {
+			t.Errorf("Expected 3 requests, got %d", *requests)
+		}
+	})
+}
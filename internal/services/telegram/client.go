@@ -1,22 +1,62 @@
 package telegram
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/config"
+	"automation-hub/internal/metrics"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 1 * time.Second
 )
 
+// ErrDisabled is returned by sends on a client created with NewDisabledClient
+var ErrDisabled = errors.New("telegram disabled")
+
+// Sender delivers a message through the Bot API. *tgbotapi.BotAPI implements
+// it; tests inject a fake with NewClientWithSender.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
 type Client struct {
-	bot    *tgbotapi.BotAPI
-	logger *zap.Logger
+	bot         Sender
+	logger      *zap.Logger
+	maxAttempts int
+	baseDelay   time.Duration
+	clock       clock.Clock
+	limiter     *rateLimiter
+	breaker     *circuitBreaker
+	parseMode   string
+	prefix      string // telegram.message_prefix
+	suffix      string // telegram.message_suffix
+	chatAliases map[string]string
+	token       string
+	dryRun      atomic.Bool
 }
 
-func NewClient(token string, logger *zap.Logger) *Client {
+// NewClient connects to the Bot API, failing on an invalid parse mode or a bot
+// token Telegram rejects
+func NewClient(cfg config.TelegramConfig, logger *zap.Logger) (*Client, error) {
+	client, err := NewDisabledClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a custom HTTP client with proper timeout settings
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
@@ -32,44 +72,225 @@ func NewClient(token string, logger *zap.Logger) *Client {
 		},
 	}
 
-	bot, err := tgbotapi.NewBotAPI(token)
+	bot, err := tgbotapi.NewBotAPI(string(cfg.BotToken))
 	if err != nil {
-		logger.Fatal("Failed to create Telegram bot", zap.Error(err))
+		return nil, fmt.Errorf("failed to create Telegram bot: %w", redactToken(err, string(cfg.BotToken)))
 	}
 
 	// Set the custom HTTP client
 	bot.Client = httpClient
+	client.bot = bot
+	return client, nil
+}
 
-	return &Client{
-		bot:    bot,
-		logger: logger,
+// NewClientWithSender returns a client that sends through sender instead of
+// connecting to the Bot API
+func NewClientWithSender(cfg config.TelegramConfig, sender Sender, logger *zap.Logger) (*Client, error) {
+	client, err := NewDisabledClient(cfg, logger)
+	if err != nil {
+		return nil, err
 	}
+	client.bot = sender
+	return client, nil
+}
+
+// NewDisabledClient returns a client without a bot for running degraded: chat
+// IDs still resolve, but every send is logged as an error and fails with ErrDisabled
+func NewDisabledClient(cfg config.TelegramConfig, logger *zap.Logger) (*Client, error) {
+	parseMode, err := normalizeParseMode(cfg.ParseMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Telegram parse mode: %w", err)
+	}
+
+	return &Client{
+		logger:      logger,
+		maxAttempts: cfg.MaxAttempts,
+		baseDelay:   time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond,
+		limiter:     newRateLimiter(cfg.RateLimitPerSecond, cfg.ChatRateLimitPerMinute),
+		breaker:     newCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldownSeconds)*time.Second, clock.Real, logger),
+		parseMode:   parseMode,
+		prefix:      cfg.MessagePrefix,
+		suffix:      cfg.MessageSuffix,
+		chatAliases: cfg.ChatIDs,
+		token:       string(cfg.BotToken),
+		clock:       clock.Real,
+	}, nil
+}
+
+// SendRequest is a text message for Send
+type SendRequest struct {
+	ChatID              string // chat ID, alias or comma-separated list of both
+	Text                string
+	DisableNotification bool   // deliver silently
+	ReplyToMessageID    int    // 0 to send a standalone message
+	CopyText            string // adds a button under the message that copies this text, "" for none
+}
+
+// SendResult describes a message delivered to one chat
+type SendResult struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`        // 0 in dry run
+	Attempts  int   `json:"attempts"`          // 1 unless transient errors were retried
+	DryRun    bool  `json:"dry_run,omitempty"` // logged instead of sent
 }
 
 func (c *Client) SendMessage(chatID, message string) error {
-	if c == nil || c.bot == nil {
-		return nil
+	return c.SendMessageContext(context.Background(), chatID, message)
+}
+
+// SendMessageContext is Send without the per-chat results
+func (c *Client) SendMessageContext(ctx context.Context, chatID, message string) error {
+	_, err := c.Send(ctx, SendRequest{ChatID: chatID, Text: message})
+	return err
+}
+
+// Send sends a message, waiting for the rate limiter until ctx is done. The
+// chat ID may be a comma-separated list; the message is sent to every chat and
+// a failure in one chat does not stop the others. Results are returned for the
+// chats that received the message and per-chat errors are joined.
+func (c *Client) Send(ctx context.Context, req SendRequest) ([]SendResult, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	return c.sendToChats(req.ChatID, func(id string) (SendResult, error) {
+		return c.sendToChat(ctx, id, req)
+	})
+}
+
+// sendToChats calls send for every chat in a comma-separated chatID list
+func (c *Client) sendToChats(chatID string, send func(id string) (SendResult, error)) ([]SendResult, error) {
+	chatIDs := splitChatIDs(chatID)
+	if len(chatIDs) == 0 {
+		return nil, fmt.Errorf("invalid chat ID: %q", chatID)
+	}
+	if len(chatIDs) == 1 {
+		result, err := send(chatIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		return []SendResult{result}, nil
 	}
 
-	chatIDInt, err := parseInt64(chatID)
+	var results []SendResult
+	var errs []error
+	for _, id := range chatIDs {
+		result, err := send(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", id, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (c *Client) sendToChat(ctx context.Context, chatID string, req SendRequest) (SendResult, error) {
+	chatIDInt, err := c.numericChatID(chatID)
 	if err != nil {
-		return fmt.Errorf("invalid chat ID: %w", err)
+		return SendResult{}, err
 	}
 
-	msg := tgbotapi.NewMessage(chatIDInt, message)
-	msg.ParseMode = "Markdown"
+	// The prefix and suffix tag every message with its instance, as is in the parse mode
+	text := c.prefix + req.Text + c.suffix
+	if c.dryRun.Load() {
+		c.logger.Info("Dry run: Telegram message not sent",
+			zap.String("chat_id", chatID),
+			zap.String("message", text))
+		return SendResult{ChatID: chatIDInt, DryRun: true}, nil
+	}
+
+	return c.send(ctx, chatID, chatIDInt, func(parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(chatIDInt, text)
+		msg.ParseMode = parseMode
+		msg.DisableNotification = req.DisableNotification
+		msg.ReplyToMessageID = req.ReplyToMessageID
+		if keyboard := newCopyKeyboard(req.CopyText); keyboard != nil {
+			msg.ReplyMarkup = keyboard
+		}
+		return msg
+	})
+}
+
+// numericChatID resolves an alias and parses the resulting chat ID
+func (c *Client) numericChatID(chatID string) (int64, error) {
+	resolved, err := c.ResolveChatID(chatID)
+	if err != nil {
+		return 0, err
+	}
+
+	chatIDInt, err := parseInt64(resolved)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chat ID: %w", err)
+	}
+	return chatIDInt, nil
+}
+
+// errUnparsable marks a send Telegram rejected because it could not parse the
+// formatting, which send retries as plain text
+var errUnparsable = errors.New("unparsable formatting")
+
+// send delivers the message built with the configured parse mode. When Telegram
+// can't parse its formatting, e.g. an unescaped "_" in a path under Markdown, it
+// is sent once more as plain text so the code still gets through.
+func (c *Client) send(ctx context.Context, chatID string, chatIDInt int64, build func(parseMode string) tgbotapi.Chattable) (SendResult, error) {
+	result, err := c.sendWithRetries(ctx, chatID, chatIDInt, build(c.parseMode), c.parseMode != "")
+	if !errors.Is(err, errUnparsable) {
+		return result, err
+	}
+
+	c.logger.Warn("Telegram could not parse the message formatting, resending as plain text",
+		zap.String("chatID", chatID),
+		zap.String("parse_mode", c.parseMode),
+		zap.Error(err))
+	return c.sendWithRetries(ctx, chatID, chatIDInt, build(""), false)
+}
+
+// sendWithRetries delivers msg with the rate limiter, circuit breaker and retry
+// policy applied. With formatted set, a formatting error is returned wrapped in
+// errUnparsable instead of being counted as a failure.
+func (c *Client) sendWithRetries(ctx context.Context, chatID string, chatIDInt int64, msg tgbotapi.Chattable, formatted bool) (SendResult, error) {
+	if c.bot == nil {
+		metrics.TelegramSendFailures.Inc()
+		c.logger.Error("Telegram disabled, message not sent", zap.String("chatID", chatID))
+		return SendResult{}, ErrDisabled
+	}
 
 	// Retry logic for transient network errors
-	maxRetries := 3
+	maxRetries, baseDelay := c.retryPolicy()
 	var lastErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		_, err = c.bot.Send(msg)
+		if err := ctx.Err(); err != nil {
+			return SendResult{}, fmt.Errorf("send aborted: %w", err)
+		}
+		if err := c.limiter.Wait(ctx, chatIDInt); err != nil {
+			return SendResult{}, fmt.Errorf("rate limiter wait aborted: %w", err)
+		}
+		if err := c.breaker.Allow(); err != nil {
+			metrics.TelegramSendFailures.Inc()
+			c.logger.Warn("Telegram circuit open, message not sent",
+				zap.String("chatID", chatID),
+				zap.Error(err))
+			if lastErr != nil {
+				return SendResult{}, fmt.Errorf("failed to send message: %w (last error: %v)", err, lastErr)
+			}
+			return SendResult{}, fmt.Errorf("failed to send message: %w", err)
+		}
+
+		sent, err := c.botWithContext(ctx).Send(msg)
+		err = redactToken(err, c.token)
+		if err != nil && ctx.Err() != nil {
+			c.breaker.Release()
+			return SendResult{}, fmt.Errorf("send aborted: %w", ctx.Err())
+		}
 		if err == nil {
+			c.breaker.Success()
 			c.logger.Info("Telegram message sent successfully",
 				zap.String("chatID", chatID),
+				zap.Int("message_id", sent.MessageID),
 				zap.Int("attempt", attempt))
-			return nil
+			return SendResult{ChatID: chatIDInt, MessageID: sent.MessageID, Attempts: attempt}, nil
 		}
 
 		lastErr = err
@@ -79,21 +300,247 @@ func (c *Client) SendMessage(chatID, message string) error {
 			zap.Int("attempt", attempt),
 			zap.Int("maxRetries", maxRetries))
 
+		backoff, retryable := retryDelay(err, attempt, baseDelay)
+		// Any answer from Telegram, even a rejection, shows it is reachable
+		if isUnreachable(err) {
+			if c.breaker.Failure() {
+				continue
+			}
+		} else {
+			c.breaker.Success()
+		}
+		if formatted && isParseError(err) {
+			return SendResult{}, fmt.Errorf("%w: %w", errUnparsable, err)
+		}
+		if !retryable {
+			c.logger.Error("Telegram rejected message, not retrying",
+				zap.String("chatID", chatID),
+				zap.Error(err))
+			metrics.TelegramSendFailures.Inc()
+			return SendResult{}, fmt.Errorf("failed to send message: %w", err)
+		}
+
 		// Don't retry on last attempt
 		if attempt < maxRetries {
-			// Exponential backoff: 1s, 2s, 4s
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
 			c.logger.Info("Retrying Telegram message send",
 				zap.Duration("backoff", backoff))
-			time.Sleep(backoff)
+			if err := c.wait(ctx, backoff); err != nil {
+				return SendResult{}, fmt.Errorf("send aborted during backoff: %w (last error: %v)", err, lastErr)
+			}
 		}
 	}
 
+	metrics.TelegramSendFailures.Inc()
 	c.logger.Error("Failed to send Telegram message after retries",
 		zap.String("chatID", chatID),
 		zap.Error(lastErr),
 		zap.Int("attempts", maxRetries))
-	return fmt.Errorf("failed to send message after %d attempts: %w", maxRetries, lastErr)
+	return SendResult{}, fmt.Errorf("failed to send message after %d attempts: %w", maxRetries, lastErr)
+}
+
+// contextClient binds every Bot API request to ctx, which the library does not
+// accept itself, so cancelling ctx aborts a send in flight
+type contextClient struct {
+	ctx    context.Context
+	client tgbotapi.HTTPClient
+}
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+// botWithContext returns a shallow copy of the bot whose requests are bound to
+// ctx. Injected senders are returned as is.
+func (c *Client) botWithContext(ctx context.Context) Sender {
+	api, ok := c.bot.(*tgbotapi.BotAPI)
+	if !ok {
+		return c.bot
+	}
+	bot := *api
+	bot.Client = contextClient{ctx: ctx, client: api.Client}
+	return &bot
+}
+
+func (c *Client) retryPolicy() (int, time.Duration) {
+	maxAttempts, baseDelay := c.maxAttempts, c.baseDelay
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if baseDelay <= 0 {
+		baseDelay = defaultBaseDelay
+	}
+	return maxAttempts, baseDelay
+}
+
+// wait sleeps for d, returning early with the context error when ctx is done
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.clock.After(d):
+		return nil
+	}
+}
+
+// retryDelay decides whether a failed send should be retried and how long to wait.
+// Telegram API errors in the 4xx range (bad chat ID, blocked bot...) are permanent,
+// except 429 where the server tells us how long to back off with retry_after.
+// Network errors and 5xx responses use exponential backoff: base, 2*base, 4*base...
+func retryDelay(err error, attempt int, baseDelay time.Duration) (time.Duration, bool) {
+	backoff := baseDelay * time.Duration(1<<uint(attempt-1))
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			if apiErr.RetryAfter > 0 {
+				return time.Duration(apiErr.RetryAfter) * time.Second, true
+			}
+			return backoff, true
+		case apiErr.Code >= 400 && apiErr.Code < 500:
+			return 0, false
+		}
+	}
+
+	return backoff, true
+}
+
+// isUnreachable reports whether a failed send means Telegram could not be
+// reached: a network error or a 5xx response
+func isUnreachable(err error) bool {
+	var apiErr *tgbotapi.Error
+	return !errors.As(err, &apiErr) || apiErr.Code >= http.StatusInternalServerError
+}
+
+// isParseError reports whether Telegram rejected a message because its entities
+// could not be parsed under the parse mode
+func isParseError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) &&
+		apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(apiErr.Message), "can't parse")
+}
+
+// SetDryRun makes SendMessage log messages instead of sending them
+func (c *Client) SetDryRun(enabled bool) {
+	c.dryRun.Store(enabled)
+}
+
+// Ping checks that the Telegram Bot API is reachable with the configured token
+// and the circuit breaker is closed.
+// Injected senders without GetMe are assumed reachable.
+func (c *Client) Ping() error {
+	if c == nil || c.bot == nil {
+		return errors.New("telegram bot not initialized")
+	}
+	if err := c.breaker.Err(); err != nil {
+		return err
+	}
+	pinger, ok := c.bot.(interface{ GetMe() (tgbotapi.User, error) })
+	if !ok {
+		return nil
+	}
+	_, err := pinger.GetMe()
+	return redactToken(err, c.token)
+}
+
+// tokenRedactedError hides the bot token that net/http embeds in request URLs
+// while keeping the original error reachable through errors.As
+type tokenRedactedError struct {
+	err   error
+	token string
+}
+
+func (e *tokenRedactedError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.token, "[REDACTED]")
+}
+
+func (e *tokenRedactedError) Unwrap() error {
+	return e.err
+}
+
+func redactToken(err error, token string) error {
+	if err == nil || token == "" || !strings.Contains(err.Error(), token) {
+		return err
+	}
+	return &tokenRedactedError{err: err, token: token}
+}
+
+// Escape escapes text so it is shown literally under the configured parse mode.
+// Use it for values interpolated into a message, such as extracted codes.
+func (c *Client) Escape(text string) string {
+	if c == nil || c.parseMode == "" {
+		return text
+	}
+	return tgbotapi.EscapeText(c.parseMode, text)
+}
+
+// normalizeParseMode maps the configured parse mode to the Bot API value.
+// An empty value or "plain" sends the message without formatting.
+func normalizeParseMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "plain":
+		return "", nil
+	case "markdown":
+		return tgbotapi.ModeMarkdown, nil
+	case "markdownv2":
+		return tgbotapi.ModeMarkdownV2, nil
+	case "html":
+		return tgbotapi.ModeHTML, nil
+	}
+	return "", fmt.Errorf("unsupported parse mode %q (use Markdown, MarkdownV2, HTML or plain)", mode)
+}
+
+// ResolveChatID maps a chat alias from telegram.chat_ids to its numeric ID.
+// Numeric IDs are returned unchanged.
+func (c *Client) ResolveChatID(chatID string) (string, error) {
+	chatID = strings.TrimSpace(chatID)
+	if _, err := parseInt64(chatID); err == nil {
+		return chatID, nil
+	}
+
+	// viper lowercases map keys, so aliases are matched case-insensitively
+	if c != nil {
+		if id, ok := c.chatAliases[strings.ToLower(chatID)]; ok {
+			return strings.TrimSpace(id), nil
+		}
+	}
+	return "", fmt.Errorf("unknown chat alias %q", chatID)
+}
+
+// CheckChatIDs verifies that every chat in the given comma-separated lists is a
+// numeric ID or a known alias, so configuration mistakes surface at startup
+func (c *Client) CheckChatIDs(chatIDs ...string) error {
+	var errs []error
+	for _, list := range chatIDs {
+		ids := splitChatIDs(list)
+		if len(ids) == 0 {
+			errs = append(errs, fmt.Errorf("invalid chat ID: %q", list))
+			continue
+		}
+		for _, id := range ids {
+			resolved, err := c.ResolveChatID(id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if _, err := parseInt64(resolved); err != nil {
+				errs = append(errs, fmt.Errorf("chat alias %q maps to invalid chat ID %q", id, resolved))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// splitChatIDs splits a comma-separated list of chat IDs, dropping empty entries
+func splitChatIDs(chatID string) []string {
+	var ids []string
+	for _, id := range strings.Split(chatID, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 func parseInt64(s string) (int64, error) {
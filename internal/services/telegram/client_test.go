@@ -1,10 +1,19 @@
 package telegram
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
+
+	"automation-hub/internal/clock"
+	"automation-hub/internal/config"
 )
 
 func TestParseInt64(t *testing.T) {
@@ -78,7 +87,567 @@ func TestSendMessageNilClientOrBot(t *testing.T) {
 		bot:    nil,
 		logger: logger,
 	}
-	if err := clientWithNilBot.SendMessage("123456", "Hello"); err != nil {
-		t.Errorf("Expected nil error for client with nil bot, got %v", err)
+	if err := clientWithNilBot.SendMessage("123456", "Hello"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled for client with nil bot, got %v", err)
+	}
+}
+
+func TestNewDisabledClient(t *testing.T) {
+	cfg := config.TelegramConfig{
+		ParseMode: "Markdown",
+		ChatIDs:   map[string]string{"family": "123"},
+	}
+
+	client, err := NewDisabledClient(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewDisabledClient() returned unexpected error: %v", err)
+	}
+	if err := client.CheckChatIDs("family"); err != nil {
+		t.Errorf("CheckChatIDs() = %v, expected nil", err)
+	}
+	if err := client.SendMessage("family", "Hello"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("SendMessage() = %v, expected ErrDisabled", err)
+	}
+	if err := client.Ping(); err == nil {
+		t.Error("Ping() = nil, expected error for disabled client")
+	}
+
+	client.SetDryRun(true)
+	if err := client.SendMessage("family", "Hello"); err != nil {
+		t.Errorf("SendMessage() in dry run = %v, expected nil", err)
+	}
+
+	cfg.ParseMode = "Markdown3"
+	if _, err := NewDisabledClient(cfg, zap.NewNop()); err == nil {
+		t.Error("NewDisabledClient() = nil error, expected error for invalid parse mode")
+	}
+}
+
+func TestPingNilClientOrBot(t *testing.T) {
+	var nilClient *Client
+	if err := nilClient.Ping(); err == nil {
+		t.Error("Expected error when pinging with nil client, got nil")
+	}
+
+	clientWithNilBot := &Client{logger: zap.NewNop()}
+	if err := clientWithNilBot.Ping(); err == nil {
+		t.Error("Expected error when pinging with nil bot, got nil")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	base := time.Second
+
+	tests := []struct {
+		name          string
+		err           error
+		attempt       int
+		wantDelay     time.Duration
+		wantRetryable bool
+	}{
+		{
+			name:          "Network error first attempt",
+			err:           errors.New("connection reset"),
+			attempt:       1,
+			wantDelay:     time.Second,
+			wantRetryable: true,
+		},
+		{
+			name:          "Network error third attempt",
+			err:           errors.New("connection reset"),
+			attempt:       3,
+			wantDelay:     4 * time.Second,
+			wantRetryable: true,
+		},
+		{
+			name:          "Bad request is permanent",
+			err:           &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"},
+			attempt:       1,
+			wantRetryable: false,
+		},
+		{
+			name:          "Forbidden is permanent",
+			err:           &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"},
+			attempt:       1,
+			wantRetryable: false,
+		},
+		{
+			name: "Too many requests honors retry_after",
+			err: &tgbotapi.Error{
+				Code:               429,
+				Message:            "Too Many Requests: retry after 7",
+				ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7},
+			},
+			attempt:       1,
+			wantDelay:     7 * time.Second,
+			wantRetryable: true,
+		},
+		{
+			name:          "Server error is retried",
+			err:           &tgbotapi.Error{Code: 502, Message: "Bad Gateway"},
+			attempt:       2,
+			wantDelay:     2 * time.Second,
+			wantRetryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retryable := retryDelay(tt.err, tt.attempt, base)
+			if retryable != tt.wantRetryable {
+				t.Fatalf("retryDelay() retryable = %v, want %v", retryable, tt.wantRetryable)
+			}
+			if retryable && delay != tt.wantDelay {
+				t.Errorf("retryDelay() delay = %v, want %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+// newTestClient returns a Client whose bot talks to a fake Telegram API
+// answering every request with the given status and body
+func newTestClient(t *testing.T, maxAttempts int, status int, body string) (*Client, *int, *clock.Fake) {
+	t.Helper()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	bot := &tgbotapi.BotAPI{Token: "test", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+
+	clk := clock.NewFake(time.Now())
+	client := &Client{
+		bot:         bot,
+		logger:      zap.NewNop(),
+		maxAttempts: maxAttempts,
+		clock:       clk,
+	}
+	return client, &requests, clk
+}
+
+func TestSendMessageRetries(t *testing.T) {
+	t.Run("Permanent error is not retried", func(t *testing.T) {
+		client, requests, clk := newTestClient(t, 3, http.StatusBadRequest,
+			`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+
+		if err := client.SendMessage("123", "Hello"); err == nil {
+			t.Fatal("Expected error for rejected message, got nil")
+		}
+		if *requests != 1 {
+			t.Errorf("Expected 1 request, got %d", *requests)
+		}
+		if len(clk.Waits()) != 0 {
+			t.Errorf("Expected no backoff, got %v", clk.Waits())
+		}
+	})
+
+	t.Run("Transient error is retried up to max attempts", func(t *testing.T) {
+		client, requests, clk := newTestClient(t, 4, http.StatusInternalServerError,
+			`{"ok":false,"error_code":500,"description":"Internal Server Error"}`)
+
+		if err := client.SendMessage("123", "Hello"); err == nil {
+			t.Fatal("Expected error after exhausting retries, got nil")
+		}
+		if *requests != 4 {
+			t.Errorf("Expected 4 requests, got %d", *requests)
+		}
+		expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+		if len(clk.Waits()) != len(expected) {
+			t.Fatalf("Expected backoffs %v, got %v", expected, clk.Waits())
+		}
+		for i := range expected {
+			if clk.Waits()[i] != expected[i] {
+				t.Errorf("Expected backoffs %v, got %v", expected, clk.Waits())
+				break
+			}
+		}
+	})
+
+	t.Run("Rate limited send waits retry_after", func(t *testing.T) {
+		client, requests, clk := newTestClient(t, 2, http.StatusTooManyRequests,
+			`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":5}}`)
+
+		if err := client.SendMessage("123", "Hello"); err == nil {
+			t.Fatal("Expected error after exhausting retries, got nil")
+		}
+		if *requests != 2 {
+			t.Errorf("Expected 2 requests, got %d", *requests)
+		}
+		if len(clk.Waits()) != 1 || clk.Waits()[0] != 5*time.Second {
+			t.Errorf("Expected a single 5s backoff, got %v", clk.Waits())
+		}
+	})
+}
+
+func TestNormalizeParseMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"plain", "", false},
+		{"Markdown", tgbotapi.ModeMarkdown, false},
+		{"markdownv2", tgbotapi.ModeMarkdownV2, false},
+		{" HTML ", tgbotapi.ModeHTML, false},
+		{"rich", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := normalizeParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeParseMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("normalizeParseMode(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		input     string
+		expected  string
+	}{
+		{"Plain leaves text untouched", "", "a_b*c[d]", "a_b*c[d]"},
+		{"Markdown", tgbotapi.ModeMarkdown, "AB_12*3", `AB\_12\*3`},
+		{"MarkdownV2", tgbotapi.ModeMarkdownV2, "code-1.2_x", `code\-1\.2\_x`},
+		{"HTML", tgbotapi.ModeHTML, "<b>&", "&lt;b&gt;&amp;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{parseMode: tt.parseMode}
+			if got := c.Escape(tt.input); got != tt.expected {
+				t.Errorf("Escape(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	var nilClient *Client
+	if got := nilClient.Escape("a_b"); got != "a_b" {
+		t.Errorf("Escape() on nil client = %q, expected %q", got, "a_b")
+	}
+}
+
+func TestSplitChatIDs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"123", []string{"123"}},
+		{"123,-456", []string{"123", "-456"}},
+		{" 123 , ,456,", []string{"123", "456"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := splitChatIDs(tt.input)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("splitChatIDs(%q) = %v, expected %v", tt.input, got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("splitChatIDs(%q) = %v, expected %v", tt.input, got, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSendMessageMultipleChats(t *testing.T) {
+	client, requests, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+
+	// The invalid chat fails without stopping delivery to the other two
+	err := client.SendMessage("123, invalid, 456", "Hello")
+	if err == nil {
+		t.Fatal("Expected aggregated error for invalid chat, got nil")
+	}
+	if !strings.Contains(err.Error(), "chat invalid") {
+		t.Errorf("Expected error to name the failing chat, got %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+
+	if err := client.SendMessage(" , ", "Hello"); err == nil {
+		t.Error("Expected error for empty chat list, got nil")
+	}
+}
+
+func TestResolveChatID(t *testing.T) {
+	client := &Client{chatAliases: map[string]string{"family": "-100123", "broken": "abc"}}
+
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"123", "123", false},
+		{"-456", "-456", false},
+		{"family", "-100123", false},
+		{"Family", "-100123", false},
+		{"unknown", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := client.ResolveChatID(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveChatID(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ResolveChatID(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	if err := client.CheckChatIDs("123", "family, 456"); err != nil {
+		t.Errorf("CheckChatIDs() = %v, expected nil", err)
+	}
+	for _, chatIDs := range [][]string{{"family,unknown"}, {"broken"}, {""}} {
+		if err := client.CheckChatIDs(chatIDs...); err == nil {
+			t.Errorf("CheckChatIDs(%q) = nil, expected error", chatIDs)
+		}
+	}
+}
+
+func TestSendMessageResolvesAlias(t *testing.T) {
+	client, requests, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+	client.chatAliases = map[string]string{"family": "123"}
+
+	if err := client.SendMessage("family", "Hello"); err != nil {
+		t.Errorf("SendMessage() = %v, expected nil", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 request, got %d", *requests)
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	token := "123456:ABC-secret"
+	apiErr := &tgbotapi.Error{Code: 429, Message: "Too Many Requests"}
+	urlErr := errors.Join(errors.New(`Post "https://api.telegram.org/bot`+token+`/sendMessage": timeout`), apiErr)
+
+	err := redactToken(urlErr, token)
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("redactToken() = %q, expected token to be hidden", err.Error())
+	}
+	var target *tgbotapi.Error
+	if !errors.As(err, &target) {
+		t.Errorf("redactToken() lost the wrapped error")
+	}
+
+	if err := redactToken(nil, token); err != nil {
+		t.Errorf("redactToken(nil) = %v, expected nil", err)
+	}
+	if err := redactToken(apiErr, token); err != apiErr {
+		t.Errorf("redactToken() = %v, expected the original error", err)
+	}
+}
+
+func TestSendMessageDryRun(t *testing.T) {
+	client, requests, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+	client.chatAliases = map[string]string{"family": "123"}
+	client.SetDryRun(true)
+
+	if err := client.SendMessage("family, 456", "Hello"); err != nil {
+		t.Errorf("SendMessage() = %v, expected nil", err)
+	}
+	if *requests != 0 {
+		t.Errorf("Expected no requests in dry run, got %d", *requests)
+	}
+	if err := client.SendMessage("unknown", "Hello"); err == nil {
+		t.Errorf("SendMessage() = nil, expected error for unknown alias")
+	}
+}
+
+func TestSendMessageContextCanceled(t *testing.T) {
+	client, requests, _ := newTestClient(t, 3, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.SendMessageContext(ctx, "123", "Hello")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SendMessageContext() = %v, expected context.Canceled", err)
+	}
+	if *requests != 0 {
+		t.Errorf("Expected no requests after cancellation, got %d", *requests)
+	}
+}
+
+func TestSend(t *testing.T) {
+	client, _, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":7,"chat":{"id":123}}}`)
+
+	results, err := client.Send(context.Background(), SendRequest{ChatID: "123, 456", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Send() returned unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Send() returned %d results, expected 2", len(results))
+	}
+	for i, want := range []int64{123, 456} {
+		got := results[i]
+		if got.ChatID != want || got.MessageID != 7 || got.Attempts != 1 || got.DryRun {
+			t.Errorf("Send() result %d = %+v, expected chat %d, message 7, 1 attempt", i, got, want)
+		}
+	}
+
+	client.SetDryRun(true)
+	results, err = client.Send(context.Background(), SendRequest{ChatID: "123", Text: "Hello"})
+	if err != nil {
+		t.Fatalf("Send() returned unexpected error: %v", err)
+	}
+	if len(results) != 1 || !results[0].DryRun || results[0].MessageID != 0 {
+		t.Errorf("Send() in dry run = %+v, expected one dry-run result without message ID", results)
+	}
+}
+
+func TestSendMessageContextCanceledInFlight(t *testing.T) {
+	// The handler hangs until the test ends, like a stalled Telegram API
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	bot := &tgbotapi.BotAPI{Token: "test", Client: srv.Client()}
+	bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+	client := &Client{bot: bot, logger: zap.NewNop(), maxAttempts: 3, clock: clock.NewFake(time.Now())}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	err := client.SendMessageContext(ctx, "123", "Hello")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SendMessageContext() = %v, expected context.Canceled", err)
+	}
+}
+
+func TestSendPlainTextFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		reply     string // answer to formatted messages
+		expected  []string
+		wantErr   bool
+	}{
+		{
+			name:      "Unparsable formatting is resent as plain text",
+			parseMode: tgbotapi.ModeMarkdown,
+			reply:     `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 10"}`,
+			expected:  []string{"Markdown", ""},
+		},
+		{
+			name:      "Other rejections are not resent",
+			parseMode: tgbotapi.ModeMarkdown,
+			reply:     `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`,
+			expected:  []string{"Markdown"},
+			wantErr:   true,
+		},
+		{
+			name:      "Plain text is sent once",
+			parseMode: "",
+			reply:     `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities"}`,
+			expected:  []string{""},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parseModes []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				parseMode := r.FormValue("parse_mode")
+				parseModes = append(parseModes, parseMode)
+				w.Header().Set("Content-Type", "application/json")
+				if parseMode == "" && tt.parseMode != "" {
+					_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":7,"chat":{"id":123}}}`))
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(tt.reply))
+			}))
+			t.Cleanup(srv.Close)
+
+			bot := &tgbotapi.BotAPI{Token: "test", Client: srv.Client()}
+			bot.SetAPIEndpoint(srv.URL + "/bot%s/%s")
+			client := &Client{bot: bot, logger: zap.NewNop(), parseMode: tt.parseMode, clock: clock.NewFake(time.Now())}
+
+			results, err := client.Send(context.Background(), SendRequest{ChatID: "123", Text: "Path: /tmp/my_file"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(results) != 1 || results[0].MessageID != 7) {
+				t.Errorf("Send() = %+v, expected message 7", results)
+			}
+			if strings.Join(parseModes, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Sent with parse modes %q, expected %q", parseModes, tt.expected)
+			}
+		})
+	}
+}
+
+// textSender records the text of every message sent through it
+type textSender struct {
+	texts []string
+}
+
+func (s *textSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if msg, ok := c.(tgbotapi.MessageConfig); ok {
+		s.texts = append(s.texts, msg.Text)
+	}
+	return tgbotapi.Message{MessageID: 1}, nil
+}
+
+func TestSendMessagePrefixSuffix(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		suffix   string
+		expected string
+	}{
+		{"Unset", "", "", "Code: 123456"},
+		{"Prefix", "[home] ", "", "[home] Code: 123456"},
+		{"Prefix and suffix", "[home]\n", "\n— nas", "[home]\nCode: 123456\n— nas"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &textSender{}
+			client, err := NewClientWithSender(config.TelegramConfig{MessagePrefix: tt.prefix, MessageSuffix: tt.suffix}, sender, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewClientWithSender() returned unexpected error: %v", err)
+			}
+			if err := client.SendMessage("123", "Code: 123456"); err != nil {
+				t.Fatalf("SendMessage() returned unexpected error: %v", err)
+			}
+			if len(sender.texts) != 1 || sender.texts[0] != tt.expected {
+				t.Errorf("Sent %q, expected %q", sender.texts, tt.expected)
+			}
+		})
 	}
 }
@@ -0,0 +1,83 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+
+	"automation-hub/internal/models"
+)
+
+// Bot API upload limits
+const (
+	MaxDocumentSize = 50 << 20
+	MaxPhotoSize    = 10 << 20
+)
+
+// ErrAttachmentTooLarge is returned for files above the Bot API upload limit
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the Telegram upload limit")
+
+func (c *Client) SendDocument(chatID string, attachment models.Attachment, caption string) error {
+	return c.SendDocumentContext(context.Background(), chatID, attachment, caption)
+}
+
+// SendDocumentContext uploads an attachment to every chat in chatID. Images small
+// enough are sent as photos, everything else as documents. caption is sent with
+// the configured parse mode, so escape interpolated values.
+func (c *Client) SendDocumentContext(ctx context.Context, chatID string, attachment models.Attachment, caption string) error {
+	if c == nil {
+		return nil
+	}
+	if len(attachment.Data) > MaxDocumentSize {
+		return fmt.Errorf("%s (%d bytes): %w", attachment.Filename, len(attachment.Data), ErrAttachmentTooLarge)
+	}
+
+	_, err := c.sendToChats(chatID, func(id string) (SendResult, error) {
+		chatIDInt, err := c.numericChatID(id)
+		if err != nil {
+			return SendResult{}, err
+		}
+
+		if c.dryRun.Load() {
+			c.logger.Info("Dry run: Telegram document not sent",
+				zap.String("chat_id", id),
+				zap.String("filename", attachment.Filename),
+				zap.Int("size", len(attachment.Data)),
+				zap.String("caption", caption))
+			return SendResult{ChatID: chatIDInt, DryRun: true}, nil
+		}
+
+		return c.send(ctx, id, chatIDInt, func(parseMode string) tgbotapi.Chattable {
+			return newFileMessage(chatIDInt, attachment, caption, parseMode)
+		})
+	})
+	return err
+}
+
+func newFileMessage(chatID int64, attachment models.Attachment, caption, parseMode string) tgbotapi.Chattable {
+	file := tgbotapi.FileBytes{Name: attachment.Filename, Bytes: attachment.Data}
+	if isPhoto(attachment.MIMEType) && len(attachment.Data) <= MaxPhotoSize {
+		photo := tgbotapi.NewPhoto(chatID, file)
+		photo.Caption = caption
+		photo.ParseMode = parseMode
+		return photo
+	}
+
+	document := tgbotapi.NewDocument(chatID, file)
+	document.Caption = caption
+	document.ParseMode = parseMode
+	return document
+}
+
+// isPhoto reports whether Telegram accepts the MIME type as a photo
+func isPhoto(mimeType string) bool {
+	switch strings.ToLower(mimeType) {
+	case "image/jpeg", "image/png":
+		return true
+	}
+	return false
+}
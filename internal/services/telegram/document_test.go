@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"automation-hub/internal/models"
+)
+
+func TestNewFileMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		mimeType  string
+		size      int
+		wantPhoto bool
+	}{
+		{"PNG as photo", "image/png", 10, true},
+		{"PDF as document", "application/pdf", 10, false},
+		{"GIF as document", "image/gif", 10, false},
+		{"Large image as document", "image/jpeg", MaxPhotoSize + 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachment := models.Attachment{Filename: "file", MIMEType: tt.mimeType, Data: make([]byte, tt.size)}
+			msg := newFileMessage(123, attachment, "caption", "HTML")
+			_, isPhoto := msg.(tgbotapi.PhotoConfig)
+			if isPhoto != tt.wantPhoto {
+				t.Errorf("newFileMessage() photo = %v, expected %v", isPhoto, tt.wantPhoto)
+			}
+		})
+	}
+}
+
+func TestSendDocument(t *testing.T) {
+	client, requests, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+	pdf := models.Attachment{Filename: "code.pdf", MIMEType: "application/pdf", Data: []byte("%PDF-1.4")}
+
+	if err := client.SendDocument("123, 456", pdf, "Your code"); err != nil {
+		t.Errorf("SendDocument() = %v, expected nil", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+
+	oversized := models.Attachment{Filename: "big.pdf", Data: make([]byte, MaxDocumentSize+1)}
+	if err := client.SendDocument("123", oversized, ""); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("SendDocument() = %v, expected ErrAttachmentTooLarge", err)
+	}
+
+	client.SetDryRun(true)
+	if err := client.SendDocument("123", pdf, ""); err != nil {
+		t.Errorf("SendDocument() = %v, expected nil in dry run", err)
+	}
+	if *requests != 2 {
+		t.Errorf("Expected no requests in dry run, got %d", *requests-2)
+	}
+}
@@ -0,0 +1,33 @@
+package telegram
+
+// maxCopyText is the longest text a copy_text button accepts
+const maxCopyText = 256
+
+// copyKeyboard is an inline keyboard with a single copy_text button. The Bot
+// API added copy_text in 7.11, after the tgbotapi release in use, so the markup
+// is built here instead of with tgbotapi.NewInlineKeyboardMarkup; ReplyMarkup
+// is sent as JSON whatever its type. A callback_data button would need the
+// service to answer callback queries, which it doesn't.
+type copyKeyboard struct {
+	InlineKeyboard [][]copyButton `json:"inline_keyboard"`
+}
+
+type copyButton struct {
+	Text     string   `json:"text"`
+	CopyText copyText `json:"copy_text"`
+}
+
+type copyText struct {
+	Text string `json:"text"`
+}
+
+// newCopyKeyboard returns a "Copy code" button that copies text to the
+// clipboard, or nil when text is empty or too long for Telegram to accept
+func newCopyKeyboard(text string) *copyKeyboard {
+	if text == "" || len(text) > maxCopyText {
+		return nil
+	}
+	return &copyKeyboard{
+		InlineKeyboard: [][]copyButton{{{Text: "📋 Copy code", CopyText: copyText{Text: text}}}},
+	}
+}
@@ -0,0 +1,26 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewCopyKeyboard(t *testing.T) {
+	keyboard := newCopyKeyboard("123456")
+	data, err := json.Marshal(keyboard)
+	if err != nil {
+		t.Fatalf("Failed to marshal keyboard: %v", err)
+	}
+	expected := `{"inline_keyboard":[[{"text":"📋 Copy code","copy_text":{"text":"123456"}}]]}`
+	if string(data) != expected {
+		t.Errorf("Keyboard = %s, expected %s", data, expected)
+	}
+
+	if keyboard := newCopyKeyboard(""); keyboard != nil {
+		t.Errorf("newCopyKeyboard(\"\") = %+v, expected nil", keyboard)
+	}
+	if keyboard := newCopyKeyboard(strings.Repeat("x", maxCopyText+1)); keyboard != nil {
+		t.Error("Expected no keyboard for a text longer than Telegram accepts")
+	}
+}
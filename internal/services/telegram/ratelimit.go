@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Telegram allows ~30 messages per second overall and 20 per minute in a group
+	defaultGlobalPerSecond = 30
+	defaultChatPerMinute   = 20
+)
+
+// rateLimiter keeps a global token bucket plus one bucket per chat. Wait blocks
+// until both allow a send instead of dropping the message.
+type rateLimiter struct {
+	global  *rate.Limiter
+	perChat rate.Limit
+
+	mu    sync.Mutex
+	chats map[int64]*rate.Limiter
+}
+
+func newRateLimiter(globalPerSecond, chatPerMinute int) *rateLimiter {
+	if globalPerSecond <= 0 {
+		globalPerSecond = defaultGlobalPerSecond
+	}
+	if chatPerMinute <= 0 {
+		chatPerMinute = defaultChatPerMinute
+	}
+
+	return &rateLimiter{
+		global:  rate.NewLimiter(rate.Limit(globalPerSecond), globalPerSecond),
+		perChat: rate.Every(time.Minute / time.Duration(chatPerMinute)),
+		chats:   make(map[int64]*rate.Limiter),
+	}
+}
+
+// Wait blocks until a message can be sent to chatID, or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context, chatID int64) error {
+	if l == nil {
+		return nil
+	}
+	if err := l.chat(chatID).Wait(ctx); err != nil {
+		return err
+	}
+	return l.global.Wait(ctx)
+}
+
+func (l *rateLimiter) chat(chatID int64) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.chats[chatID]
+	if !ok {
+		limiter = rate.NewLimiter(l.perChat, 1)
+		l.chats[chatID] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,82 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestNewRateLimiterDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		globalPerSecond int
+		chatPerMinute   int
+		expectedGlobal  rate.Limit
+		expectedPerChat rate.Limit
+	}{
+		{"Defaults", 0, 0, 30, rate.Every(3 * time.Second)},
+		{"Negative values use defaults", -1, -5, 30, rate.Every(3 * time.Second)},
+		{"Custom limits", 10, 60, 10, rate.Every(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.globalPerSecond, tt.chatPerMinute)
+			if l.global.Limit() != tt.expectedGlobal {
+				t.Errorf("global limit = %v, expected %v", l.global.Limit(), tt.expectedGlobal)
+			}
+			if l.perChat != tt.expectedPerChat {
+				t.Errorf("per-chat limit = %v, expected %v", l.perChat, tt.expectedPerChat)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	t.Run("Nil limiter never blocks", func(t *testing.T) {
+		var l *rateLimiter
+		if err := l.Wait(context.Background(), 1); err != nil {
+			t.Errorf("Wait() = %v, expected nil", err)
+		}
+	})
+
+	t.Run("Per-chat bucket blocks only that chat", func(t *testing.T) {
+		l := newRateLimiter(30, 1)
+		if err := l.Wait(context.Background(), 1); err != nil {
+			t.Fatalf("first Wait() = %v, expected nil", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := l.Wait(ctx, 1); err == nil {
+			t.Error("second Wait() on same chat = nil, expected error")
+		}
+		if err := l.Wait(context.Background(), 2); err != nil {
+			t.Errorf("Wait() on other chat = %v, expected nil", err)
+		}
+	})
+}
+
+func TestSendMessageContextRateLimited(t *testing.T) {
+	client, requests, _ := newTestClient(t, 1, http.StatusOK,
+		`{"ok":true,"result":{"message_id":1,"chat":{"id":123}}}`)
+	client.limiter = newRateLimiter(30, 1)
+
+	if err := client.SendMessage("123", "Hello"); err != nil {
+		t.Fatalf("SendMessage() = %v, expected nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.SendMessageContext(ctx, "123", "Hello again")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SendMessageContext() = %v, expected context.Canceled", err)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 request, got %d", *requests)
+	}
+}
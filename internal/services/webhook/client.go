@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/httpretry"
+	"automation-hub/internal/models"
+)
+
+// endpoint is a resolved notify_webhooks entry
+type endpoint struct {
+	url     string
+	method  string
+	headers map[string]string
+}
+
+// Client posts notifications as JSON to the HTTP endpoints in notify_webhooks
+type Client struct {
+	retry     *httpretry.Client
+	logger    *zap.Logger
+	endpoints map[string]endpoint
+	dryRun    atomic.Bool
+}
+
+func NewClient(cfg map[string]config.NotifyWebhookConfig, logger *zap.Logger) *Client {
+	endpoints := make(map[string]endpoint, len(cfg))
+	for alias, webhook := range cfg {
+		method := strings.ToUpper(webhook.Method)
+		if method == "" {
+			method = http.MethodPost
+		}
+		headers := make(map[string]string, len(webhook.Headers))
+		for name, value := range webhook.Headers {
+			headers[name] = string(value)
+		}
+		endpoints[alias] = endpoint{url: string(webhook.URL), method: method, headers: headers}
+	}
+
+	return &Client{
+		retry:     httpretry.New(logger, nil),
+		logger:    logger,
+		endpoints: endpoints,
+	}
+}
+
+// SetDryRun makes the client log notifications instead of posting them
+func (c *Client) SetDryRun(enabled bool) {
+	c.dryRun.Store(enabled)
+}
+
+// SendCodeContext posts an extracted code as {service, code, subject, from} to
+// the endpoint with the given alias
+func (c *Client) SendCodeContext(ctx context.Context, alias string, notification models.CodeNotification) error {
+	if c == nil {
+		return nil
+	}
+	return c.post(ctx, alias, notification)
+}
+
+// SendMessageContext posts a preformatted message as {"message": ...}, for
+// callers that have no code to report
+func (c *Client) SendMessageContext(ctx context.Context, alias, message string) error {
+	if c == nil {
+		return nil
+	}
+	return c.post(ctx, alias, map[string]string{"message": message})
+}
+
+// Escape returns text unchanged: JSON encoding already keeps it literal
+func (c *Client) Escape(text string) string {
+	return text
+}
+
+// post encodes the body and sends it, retrying network errors, 429 and 5xx
+// responses with exponential backoff. Other 4xx responses are not retried.
+func (c *Client) post(ctx context.Context, alias string, body any) error {
+	target, ok := c.endpoints[alias]
+	if !ok {
+		return fmt.Errorf("unknown notify webhook alias %q", alias)
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook notification: %w", err)
+	}
+
+	if c.dryRun.Load() {
+		c.logger.Info("Dry run: webhook notification not sent",
+			zap.String("webhook", alias),
+			zap.ByteString("payload", payload))
+		return nil
+	}
+
+	attempt, status, err := c.retry.Send(ctx, "webhook notification",
+		httpretry.Request{Method: target.method, URL: target.url, Headers: target.headers, Payload: payload},
+		zap.String("webhook", alias))
+	if err != nil {
+		return err
+	}
+	c.logger.Info("Webhook notification sent successfully",
+		zap.String("webhook", alias),
+		zap.Int("status", status),
+		zap.Int("attempt", attempt))
+	return nil
+}
@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"automation-hub/internal/config"
+	"automation-hub/internal/models"
+)
+
+// received is one request seen by the fake endpoint
+type received struct {
+	method        string
+	path          string
+	authorization string
+	body          map[string]string
+}
+
+// newTestClient returns a Client whose "dashboard" endpoint answers with
+// status, and the requests it received. Retries are left to httpretry.
+func newTestClient(t *testing.T, method string, status int) (*Client, *[]received) {
+	t.Helper()
+
+	var requests []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := received{method: r.Method, path: r.URL.Path, authorization: r.Header.Get("Authorization")}
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			t.Errorf("Invalid JSON payload: %v", err)
+		}
+		requests = append(requests, req)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(map[string]config.NotifyWebhookConfig{
+		"dashboard": {
+			URL:     config.Secret(srv.URL + "/codes"),
+			Method:  method,
+			Headers: map[string]config.Secret{"authorization": "Bearer token"},
+		},
+	}, zap.NewNop())
+	return client, &requests
+}
+
+func TestSendCodeContext(t *testing.T) {
+	client, requests := newTestClient(t, "", http.StatusOK)
+
+	notification := models.CodeNotification{
+		Service: "cloudflare",
+		Code:    "123456",
+		Subject: "Your login code",
+		From:    "noreply@notify.cloudflare.com",
+	}
+	if err := client.SendCodeContext(context.Background(), "dashboard", notification); err != nil {
+		t.Fatalf("SendCodeContext() returned unexpected error: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(*requests))
+	}
+	got := (*requests)[0]
+	if got.method != http.MethodPost || got.path != "/codes" {
+		t.Errorf("Received %s %s, expected POST /codes", got.method, got.path)
+	}
+	if got.authorization != "Bearer token" {
+		t.Errorf("Authorization header = %q, expected %q", got.authorization, "Bearer token")
+	}
+	want := map[string]string{"service": "cloudflare", "code": "123456", "subject": "Your login code", "from": "noreply@notify.cloudflare.com"}
+	for key, value := range want {
+		if got.body[key] != value {
+			t.Errorf("Payload %s = %q, expected %q", key, got.body[key], value)
+		}
+	}
+}
+
+func TestSendCodeContextRejected(t *testing.T) {
+	// A rejected token is permanent, so it is sent once
+	client, requests := newTestClient(t, "", http.StatusUnauthorized)
+
+	err := client.SendCodeContext(context.Background(), "dashboard", models.CodeNotification{Code: "123456"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("SendCodeContext() = %v, expected the HTTP 401 error", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("Expected 1 request, got %d", len(*requests))
+	}
+}
+
+func TestSendMessageContext(t *testing.T) {
+	client, requests := newTestClient(t, "put", http.StatusOK)
+
+	client.SetDryRun(true)
+	if err := client.SendMessageContext(context.Background(), "dashboard", "Not found"); err != nil {
+		t.Errorf("SendMessageContext() in dry run = %v, expected nil", err)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("Expected no posts in dry run, got %d", len(*requests))
+	}
+
+	client.SetDryRun(false)
+	if err := client.SendMessageContext(context.Background(), "dashboard", "Not found"); err != nil {
+		t.Fatalf("SendMessageContext() returned unexpected error: %v", err)
+	}
+	if got := (*requests)[0]; got.method != http.MethodPut || got.body["message"] != "Not found" {
+		t.Errorf("Received %s %v, expected PUT with message", got.method, got.body)
+	}
+
+	if err := client.SendMessageContext(context.Background(), "alerts", "Hi"); err == nil {
+		t.Error("SendMessageContext() = nil, expected error for unknown alias")
+	}
+}